@@ -20,28 +20,50 @@ import (
 	"context"
 	"crypto"
 	"crypto/rand"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"os"
+	"path/filepath"
+	"time"
 
+	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
 	"github.com/cert-manager/csi-lib/driver"
 	"github.com/cert-manager/csi-lib/manager"
-	"github.com/cert-manager/csi-lib/manager/util"
 	"github.com/cert-manager/csi-lib/metadata"
 	"github.com/cert-manager/csi-lib/storage"
+	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
 	"golang.org/x/sync/errgroup"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/mount-utils"
 	"k8s.io/utils/clock"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
 	"github.com/cert-manager/csi-driver/cmd/app/options"
 	"github.com/cert-manager/csi-driver/internal/version"
 	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+	"github.com/cert-manager/csi-driver/pkg/client"
+	"github.com/cert-manager/csi-driver/pkg/fifo"
 	"github.com/cert-manager/csi-driver/pkg/filestore"
+	"github.com/cert-manager/csi-driver/pkg/health"
+	"github.com/cert-manager/csi-driver/pkg/issuerref"
+	"github.com/cert-manager/csi-driver/pkg/issuerstore"
 	"github.com/cert-manager/csi-driver/pkg/keygen"
+	"github.com/cert-manager/csi-driver/pkg/metrics"
+	"github.com/cert-manager/csi-driver/pkg/mounter"
+	"github.com/cert-manager/csi-driver/pkg/precheck"
+	"github.com/cert-manager/csi-driver/pkg/reconcile"
 	"github.com/cert-manager/csi-driver/pkg/requestgen"
+	"github.com/cert-manager/csi-driver/pkg/tracing"
+	"github.com/cert-manager/csi-driver/pkg/volumelog"
 )
 
 const (
@@ -66,53 +88,339 @@ func NewCommand(ctx context.Context) *cobra.Command {
 			ctrl.SetLogger(log)
 
 			log.Info("Starting driver", "version", version.VersionInfo())
-			store, err := storage.NewFilesystem(opts.Logr.WithName("storage"), opts.DataRoot)
+			store, err := newStore(opts.Logr.WithName("storage"), opts.DataRoot, opts.IssuerDataRootSubpaths)
 			if err != nil {
 				return fmt.Errorf("failed to setup filesystem: %w", err)
 			}
-			store.FSGroupVolumeAttributeKey = csiapi.FSGroupKey
 
-			keyGenerator := keygen.Generator{Store: store}
-			writer := filestore.Writer{Store: store}
+			driverMetrics := metrics.New(ctrlmetrics.Registry)
 
-			var clientForMeta manager.ClientForMetadataFunc
+			// The CertificateRequests of this node are watched so that the
+			// end of each issuance attempt is recorded as it happens, and so
+			// that prechecks read requests from the cache.
+			requestInformers := client.NewNodeInformerFactory(opts.CMClient, opts.NodeID)
+			requests := requestInformers.Certmanager().V1().CertificateRequests()
+			if err := driverMetrics.WatchRequests(requests.Informer()); err != nil {
+				return fmt.Errorf("failed to watch CertificateRequests: %w", err)
+			}
+
+			var tracer *tracing.Tracer
+			if len(opts.OTelEndpoint) > 0 {
+				provider, err := tracing.NewProvider(ctx, opts.OTelEndpoint)
+				if err != nil {
+					return fmt.Errorf("failed to setup tracing: %w", err)
+				}
+				defer func() {
+					shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+					defer cancel()
+					if err := provider.Shutdown(shutdownCtx); err != nil {
+						log.Error(err, "Failed to flush spans")
+					}
+				}()
+				tracer = tracing.New(provider)
+			}
+
+			keyGenerator := keygen.Generator{Store: store, Log: opts.Logr.WithName("keygen")}
+			feeder := fifo.NewFeeder(opts.Logr.WithName("fifo"))
+			writer := filestore.Writer{
+				Store:              store,
+				FIFOs:              feeder,
+				MinReissueInterval: opts.MinReissueInterval,
+				ReissueClamped:     driverMetrics.ReissueClamped,
+				RenewalJitter:      opts.RenewalJitter,
+				KeystoreWritten:    driverMetrics.KeystoreWritten,
+				Client:             opts.KubeClient,
+				Log:                opts.Logr.WithName("writer"),
+				Clock:              clock.RealClock{},
+			}
+			if opts.WatchManagedFiles {
+				watcher, err := filestore.NewWatcher(opts.Logr.WithName("watcher"), &writer)
+				if err != nil {
+					return err
+				}
+				writer.Watcher = watcher
+			}
+
+			clientForMeta := func(meta metadata.Metadata) (cmclient.Interface, error) {
+				if _, ok := meta.VolumeContext[csiapi.TokenAudiencesKey]; ok {
+					return nil, fmt.Errorf("%q requires the driver to be run with --use-token-request", csiapi.TokenAudiencesKey)
+				}
+				return opts.CMClient, nil
+			}
 			if opts.UseTokenRequest {
-				clientForMeta = util.ClientForMetadataTokenRequestEmptyAud(opts.RestConfig)
+				clientForMeta = client.ClientForMetadataTokenRequest(opts.RestConfig)
+			}
+			if opts.UseServerSideApply {
+				clientForMeta = client.WithServerSideApply(clientForMeta)
+			}
+			clientForMeta = client.WithNormalizedRequest(clientForMeta)
+			clientForMeta = client.WithLabels(clientForMeta)
+			if opts.OrphanCleanupInterval > 0 {
+				clientForMeta = client.WithNodeID(clientForMeta, opts.NodeID)
+			}
+			retryBackoff := client.DefaultRetryBackoff
+			retryBackoff.Duration, retryBackoff.Steps = opts.APIRetryBackoff, opts.APIRetryAttempts
+			clientForMeta = client.WithRetry(opts.Logr.WithName("client"), clientForMeta, retryBackoff)
+			// The request is named before it is retried, so that a retry which
+			// finds a request already persisted fetches it by the same name.
+			if opts.ParsedRequestNameTemplate != nil {
+				clientForMeta = client.WithRequestName(clientForMeta, opts.ParsedRequestNameTemplate)
+			}
+			var protector *client.InflightProtector
+			if opts.ProtectInflightRequests {
+				protector = &client.InflightProtector{Log: opts.Logr.WithName("inflight"), Client: opts.CMClient, NodeID: opts.NodeID}
+				if err := protector.ReleaseNode(ctx); err != nil {
+					log.Error(err, "Failed to remove in-flight finalizers from CertificateRequests created before restart")
+				}
+				clientForMeta = protector.WithFinalizer(clientForMeta)
+			}
+			limiter := client.NewRequestLimiter(opts.MaxConcurrentRequests, opts.MaxConcurrentRenewals, driverMetrics.SetInflightRequests, driverMetrics.SetWaitingRequests)
+			clientForMeta = limiter.WithLimit(clientForMeta)
+			clientForMeta = client.WithCreateObserver(clientForMeta, driverMetrics.RequestCreated)
+			if tracer != nil {
+				clientForMeta = client.WithTracing(clientForMeta, tracer)
+			}
+
+			var readyToRequest []manager.ReadyToRequestFunc
+			deniedCheck := &precheck.Denied{Lister: requests.Lister()}
+			if opts.VerifyPodContext {
+				podCheck := &precheck.Pod{Client: opts.KubeClient, NodeID: opts.NodeID}
+				readyToRequest = append(readyToRequest, podCheck.ReadyToRequest)
+			}
+			if opts.MinReliableDuration > 0 {
+				durationCheck := &precheck.Duration{Log: opts.Logr.WithName("precheck"), Min: opts.MinReliableDuration, Reject: opts.RejectBelowMinReliableDuration}
+				readyToRequest = append(readyToRequest, durationCheck.ReadyToRequest)
+			}
+			if len(opts.KnownIssuerKeyTypes) > 0 {
+				keyTypeCheck := &precheck.KeyType{Allowed: opts.KnownIssuerKeyTypes}
+				readyToRequest = append(readyToRequest, keyTypeCheck.ReadyToRequest)
+			}
+			if opts.PrecheckRBAC {
+				rbacCheck := &precheck.RBAC{Log: opts.Logr.WithName("precheck"), Client: opts.KubeClient, Clock: clock.RealClock{}}
+				rbacCheck.LogClusterAccess(ctx)
+				readyToRequest = append(readyToRequest, rbacCheck.ReadyToRequest)
+			}
+			requestTimeout := &client.RequestTimeout{
+				Log:        opts.Logr.WithName("request-timeout"),
+				Client:     opts.CMClient,
+				Store:      store,
+				Clock:      clock.RealClock{},
+				NodeID:     opts.NodeID,
+				Protector:  protector,
+				Timeout:    opts.RequestTimeout,
+				MaxTimeout: opts.MaxRequestTimeout,
+			}
+			if opts.RequestTimeout > 0 || opts.MaxRequestTimeout > 0 {
+				readyToRequest = append(readyToRequest, requestTimeout.ReadyToRequest)
+			}
+			if opts.CheckNamespaceTerminating {
+				nsCheck := &precheck.Namespace{Log: opts.Logr.WithName("precheck"), Client: opts.KubeClient}
+				readyToRequest = append(readyToRequest, nsCheck.ReadyToRequest)
 			}
 
+			var (
+				generatePrivateKey manager.GeneratePrivateKeyFunc = keyGenerator.KeyForMetadata
+				writeKeypair       manager.WriteKeypairFunc       = writer.WriteKeypair
+				driverStore        storage.Interface              = &fifo.Store{Interface: &reconcile.Republish{Backend: store, Log: opts.Logr.WithName("republish"), Clock: clock.RealClock{}}, Feeder: feeder}
+			)
+			var podInfoKeys []string
+			if opts.VerifyPodContext {
+				podInfoKeys = append(podInfoKeys, csiapi.K8sVolumeContextKeyPodName, csiapi.K8sVolumeContextKeyPodUID)
+			}
+			driverStore = &precheck.PodInfo{Interface: driverStore, RequiredKeys: podInfoKeys}
+			driverStore = &precheck.PKCS12PasswordSecret{Interface: driverStore, Client: opts.KubeClient}
+			driverStore = &precheck.Attributes{Interface: driverStore, AllowUnknown: opts.AllowUnknownAttributes}
+			dryRun := &client.DryRun{Log: opts.Logr.WithName("dry-run"), Client: opts.CMClient, Completed: driverMetrics.DryRunCompleted}
+			writeKeypair = dryRun.InstrumentWriteKeypair(writeKeypair)
+			driverStore = &client.DryRunStore{Interface: driverStore, DryRun: dryRun}
+			if opts.ReissueOnCAChange {
+				caChange := &reconcile.CAChange{Backend: store, Log: opts.Logr.WithName("ca-change"), Clock: clock.RealClock{}}
+				writeKeypair = caChange.InstrumentWriteKeypair(writeKeypair)
+			}
+			if tracer != nil {
+				writeKeypair = tracer.InstrumentWriteKeypair(writeKeypair)
+				driverStore = &tracing.Store{Interface: driverStore, Tracer: tracer}
+			}
+			if opts.LogVolumeLifecycle {
+				lifecycleLog := opts.Logr.WithName("lifecycle")
+				generatePrivateKey = volumelog.InstrumentGeneratePrivateKey(lifecycleLog, generatePrivateKey)
+				writeKeypair = volumelog.InstrumentWriteKeypair(lifecycleLog, writeKeypair)
+				driverStore = &volumelog.Store{Interface: driverStore, Log: lifecycleLog}
+			}
+			if opts.ProvisioningSummaryLog {
+				summary := &volumelog.Summary{Log: opts.Logr.WithName("provisioning"), Clock: clock.RealClock{}}
+				writeKeypair = summary.InstrumentWriteKeypair(writeKeypair)
+				driverStore = &volumelog.SummaryStore{Interface: driverStore, Summary: summary}
+			}
+			if protector != nil {
+				writeKeypair = protector.InstrumentWriteKeypair(writeKeypair)
+				driverStore = &client.InflightStore{Interface: driverStore, Protector: protector}
+			}
+			if writer.Watcher != nil {
+				driverStore = &filestore.WatchedStore{Interface: driverStore, Watcher: writer.Watcher}
+			}
+			writeKeypair = limiter.InstrumentWriteKeypair(writeKeypair)
+			driverStore = &client.LimitedStore{Interface: driverStore, Limiter: limiter}
+
+			// The issuer is resolved from the pod before the volume is seen by
+			// any other wrapper, since they read the issuer of the volume.
+			var outerStore storage.Interface = &metrics.Store{Interface: driverStore, Metrics: driverMetrics}
+			if opts.AllowPodAnnotationIssuer {
+				outerStore = &issuerref.PodAnnotationStore{Interface: outerStore, Client: opts.KubeClient}
+			}
+			// The correlation ID is set before any other wrapper sees the
+			// volume, so that every log entry for the volume carries it.
+			outerStore = &volumelog.CorrelationStore{Interface: outerStore}
+
 			mngrlog := opts.Logr.WithName("manager")
-			d, err := driver.New(opts.Endpoint, opts.Logr.WithName("driver"), driver.Options{
+			mngr := manager.NewManagerOrDie(manager.Options{
+				Client:             opts.CMClient,
+				ClientForMetadata:  clientForMeta,
+				MetadataReader:     reconcile.MetadataReaderForManager(store),
+				Clock:              clock.RealClock{},
+				Log:                &mngrlog,
+				NodeID:             opts.NodeID,
+				GeneratePrivateKey: driverMetrics.InstrumentGeneratePrivateKey(generatePrivateKey),
+				GenerateRequest:    requestgen.RequestForMetadata,
+				SignRequest:        signRequest,
+				WriteKeypair:       driverMetrics.InstrumentWriteKeypair(writeKeypair),
+				// Attempts rejected by the denied check are recorded as
+				// denied, and those rejected by any other check as failed.
+				ReadyToRequest: precheck.All(
+					driverMetrics.InstrumentReadyToRequest(metrics.ResultDenied, deniedCheck.ReadyToRequest),
+					driverMetrics.InstrumentReadyToRequest(metrics.ResultFailure, precheck.All(readyToRequest...)),
+				),
+				RenewalBackoffConfig: &wait.Backoff{
+					Duration: opts.IssuanceBackoffInitial,
+					Factor:   opts.IssuanceBackoffFactor,
+					Jitter:   0.5,
+					Steps:    math.MaxInt32,
+					Cap:      opts.IssuanceBackoffMax,
+				},
+			})
+
+			var driverMounter mount.Interface = &mounter.Mounter{Interface: mount.New("")}
+			if tracer != nil {
+				driverMounter = &tracing.Mounter{Interface: driverMounter, Tracer: tracer}
+			}
+
+			d, err := newDriverWithRetry(ctx, log, opts.RegistrationRetryTimeout, opts.Endpoint, opts.Logr.WithName("driver"), driver.Options{
 				DriverName:    opts.DriverName,
-				DriverVersion: version.AppVersion,
+				DriverVersion: version.DriverVersion(),
 				NodeID:        opts.NodeID,
-				Store:         store,
-				Manager: manager.NewManagerOrDie(manager.Options{
-					Client:             opts.CMClient,
-					ClientForMetadata:  clientForMeta,
-					MetadataReader:     store,
-					Clock:              clock.RealClock{},
-					Log:                &mngrlog,
-					NodeID:             opts.NodeID,
-					GeneratePrivateKey: keyGenerator.KeyForMetadata,
-					GenerateRequest:    requestgen.RequestForMetadata,
-					SignRequest:        signRequest,
-					WriteKeypair:       writer.WriteKeypair,
-				}),
+				Store:         outerStore,
+				Manager:       mngr,
+				Mounter:       driverMounter,
 			})
 			if err != nil {
 				return fmt.Errorf("failed to setup driver: %w", err)
 			}
+			checks := &health.Checks{Client: opts.CMClient.Discovery()}
+			checks.DriverRegistered()
+
+			startup := reconcile.Startup{
+				Log:             opts.Logr.WithName("startup"),
+				Store:           store,
+				Manager:         mngr,
+				Metrics:         driverMetrics,
+				Clock:           clock.RealClock{},
+				BatchSize:       opts.StartupReconcileBatchSize,
+				BatchDelay:      opts.StartupReconcileBatchDelay,
+				MaxReuseAge:     opts.MaxReuseAge,
+				ReadConcurrency: opts.ReconcileReadConcurrency,
+			}
+
+			certificateAge := reconcile.CertificateAge{
+				Log:      opts.Logr.WithName("certificate-age"),
+				Store:    store,
+				Metrics:  driverMetrics,
+				Clock:    clock.RealClock{},
+				Interval: opts.CertificateAgeInterval,
+			}
+
+			expiryWatchdog := reconcile.ExpiryWatchdog{
+				Log:       opts.Logr.WithName("expiry-watchdog"),
+				Store:     store,
+				Metrics:   driverMetrics,
+				Clock:     clock.RealClock{},
+				Threshold: opts.ExpiryWarningThreshold,
+				Interval:  opts.ExpiryWarningInterval,
+			}
+
+			orphanReaper := client.OrphanReaper{
+				Log:      opts.Logr.WithName("orphan-reaper"),
+				Client:   opts.CMClient,
+				Store:    store,
+				Clock:    clock.RealClock{},
+				NodeID:   opts.NodeID,
+				Interval: opts.OrphanCleanupInterval,
+			}
 
 			g, gCTX := errgroup.WithContext(ctx)
 			g.Go(func() error {
 				<-ctx.Done()
-				log.Info("shutting down driver", "context", ctx.Err())
-				d.Stop()
+				log.Info("shutting down driver", "context", ctx.Err(), "timeout", opts.ShutdownTimeout)
+				shutdown(log, opts.ShutdownTimeout, d, limiter)
+				return nil
+			})
+
+			g.Go(func() error {
+				if err := startup.Run(gCTX); err != nil {
+					return fmt.Errorf("failed registering existing volumes: %w", err)
+				}
+				return nil
+			})
+
+			// Shutdown waits for the informers to stop once the context is
+			// cancelled.
+			requestInformers.Start(gCTX.Done())
+			g.Go(func() error {
+				requestInformers.Shutdown()
 				return nil
 			})
+			for _, synced := range requestInformers.WaitForCacheSync(gCTX.Done()) {
+				if !synced {
+					return errors.New("failed to sync the CertificateRequest cache")
+				}
+			}
+
+			g.Go(func() error {
+				return certificateAge.Run(gCTX)
+			})
+
+			if opts.ExpiryWarningThreshold > 0 {
+				g.Go(func() error {
+					return expiryWatchdog.Run(gCTX)
+				})
+			}
+
+			if opts.OrphanCleanupInterval > 0 {
+				g.Go(func() error {
+					return orphanReaper.Run(gCTX)
+				})
+			}
+
+			if opts.RequestTimeout > 0 || opts.MaxRequestTimeout > 0 {
+				g.Go(func() error {
+					return requestTimeout.Run(gCTX)
+				})
+			}
+
+			if writer.Watcher != nil {
+				g.Go(func() error {
+					return writer.Watcher.Run(gCTX)
+				})
+			}
+
+			if opts.HealthProbeListenAddress != "0" {
+				g.Go(func() error {
+					return checks.Serve(gCTX, opts.Logr.WithName("health"), opts.HealthProbeListenAddress)
+				})
+			}
 
 			g.Go(func() error {
 				log.Info("running driver")
+				defer checks.DriverStopped()
 				if err := d.Run(); err != nil {
 					return fmt.Errorf("failed running driver: %w", err)
 				}
@@ -136,8 +444,9 @@ func NewCommand(ctx context.Context) *cobra.Command {
 			// The advantages of using the controller-runtime metricsserver are:
 			// * It already exists and is actively maintained.
 			// * Provides optional features for securing the metrics endpoint by
-			//   TLS and by authentication with a K8S service account token,
-			//   should that be requested by users in the future.
+			//   TLS, used by --metrics-tls-cert-file, and by authentication
+			//   with a K8S service account token, should that be requested by
+			//   users in the future.
 			// * Consistency with cert-manager/approver-policy, which also uses
 			//   this library and therefore publishes the same set of
 			//   controller-runtime base metrics.
@@ -148,11 +457,28 @@ func NewCommand(ctx context.Context) *cobra.Command {
 			//   associated with globals and makes it difficult for us to control
 			//   which metrics are published for csi-driver.
 			//   https://github.com/kubernetes-sigs/controller-runtime/issues/210
+			metricsOptions := metricsserver.Options{
+				BindAddress: opts.MetricsBindAddress,
+			}
+			if len(opts.MetricsTLSCertFile) > 0 && opts.MetricsBindAddress != "0" {
+				// Load the certificate here rather than giving its directory
+				// to the metrics server, which falls back to a self-signed
+				// certificate if the files do not exist.
+				certWatcher, err := certwatcher.New(opts.MetricsTLSCertFile, opts.MetricsTLSKeyFile)
+				if err != nil {
+					return fmt.Errorf("failed to load metrics TLS certificate: %w", err)
+				}
+				g.Go(func() error {
+					return certWatcher.Start(gCTX)
+				})
+				metricsOptions.SecureServing = true
+				metricsOptions.TLSOpts = []func(*tls.Config){func(c *tls.Config) {
+					c.GetCertificate = certWatcher.GetCertificate
+				}}
+			}
 			var unusedHttpClient *http.Client
 			metricsServer, err := metricsserver.NewServer(
-				metricsserver.Options{
-					BindAddress: opts.MetricsBindAddress,
-				},
+				metricsOptions,
 				opts.RestConfig,
 				unusedHttpClient,
 			)
@@ -169,10 +495,116 @@ func NewCommand(ctx context.Context) *cobra.Command {
 	}
 
 	opts = opts.Prepare(cmd)
+	cmd.AddCommand(newValidateCommand())
 
 	return cmd
 }
 
+// shutdown stops the driver, waiting up to the timeout for in-flight mounts
+// and requests to complete. No new requests are created, and the gRPC server
+// refuses new calls while those in flight finish. If the timeout elapses, the
+// volumes still waiting for a request are logged, and the driver exits
+// without waiting further.
+func shutdown(log logr.Logger, timeout time.Duration, d *driver.Driver, limiter *client.RequestLimiter) {
+	limiter.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		d.Stop()
+		close(stopped)
+	}()
+
+	if err := limiter.Drain(ctx); err != nil {
+		log.Info("Shutdown timeout elapsed with CertificateRequests in progress", "volume_ids", limiter.Outstanding())
+		return
+	}
+	select {
+	case <-stopped:
+		log.Info("In-flight mounts and CertificateRequests completed")
+	case <-ctx.Done():
+		log.Info("Shutdown timeout elapsed with mounts in progress")
+	}
+}
+
+// registrationRetryBackoff is the backoff used when retrying binding the CSI
+// socket.
+var registrationRetryBackoff = wait.Backoff{
+	Duration: time.Millisecond * 500,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    math.MaxInt32,
+	Cap:      time.Second * 10,
+}
+
+// newStore builds the storage backend for the data root. Issuers with a
+// subpath are given their own filesystem under the data root, each with its
+// own tmpfs, so that their volumes are never listed or cleaned up alongside
+// those of other issuers.
+func newStore(log logr.Logger, dataRoot string, subpaths map[string]string) (*issuerstore.Store, error) {
+	newFilesystem := func(dir string) (*storage.Filesystem, error) {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		fs, err := storage.NewFilesystem(log.WithValues("data_root", dir), dir)
+		if err != nil {
+			return nil, err
+		}
+		fs.FSGroupVolumeAttributeKey = csiapi.FSGroupKey
+		return fs, nil
+	}
+
+	def, err := newFilesystem(dataRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	issuers := make(map[string]issuerstore.Backend, len(subpaths))
+	for ref, subpath := range subpaths {
+		fs, err := newFilesystem(filepath.Join(dataRoot, subpath))
+		if err != nil {
+			return nil, fmt.Errorf("issuer %q: %w", ref, err)
+		}
+		issuers[ref] = fs
+	}
+
+	return issuerstore.New(def, issuers), nil
+}
+
+// newDriverWithRetry builds the driver, which binds the CSI socket. If binding
+// fails, such as when the kubelet plugin directory is not yet ready at node
+// startup, it is retried with backoff until the timeout has elapsed. A
+// timeout of 0 disables retrying.
+func newDriverWithRetry(ctx context.Context, log logr.Logger, timeout time.Duration, endpoint string, driverLog logr.Logger, opts driver.Options) (*driver.Driver, error) {
+	if timeout == 0 {
+		return driver.New(endpoint, driverLog, opts)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var (
+		d       *driver.Driver
+		lastErr error
+		attempt int
+	)
+	err := wait.ExponentialBackoffWithContext(ctx, registrationRetryBackoff, func(context.Context) (bool, error) {
+		attempt++
+		d, lastErr = driver.New(endpoint, driverLog, opts)
+		if lastErr != nil {
+			log.Error(lastErr, "Failed to bind CSI socket, retrying", "endpoint", endpoint, "attempt", attempt)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil && lastErr != nil {
+		return nil, fmt.Errorf("timed out after %d attempts: %w", attempt, lastErr)
+	}
+	return d, err
+}
+
 // signRequest will sign an X.509 certificate signing request with the provided
 // private key.
 func signRequest(_ metadata.Metadata, key crypto.PrivateKey, request *x509.CertificateRequest) ([]byte, error) {
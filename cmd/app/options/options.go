@@ -19,19 +19,34 @@ package options
 import (
 	"flag"
 	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"text/template"
+	"time"
 
 	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
 	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	cliflag "k8s.io/component-base/cli/flag"
 	"k8s.io/klog/v2"
 
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
+
+	"github.com/cert-manager/csi-driver/pkg/client"
+	"github.com/cert-manager/csi-driver/pkg/issuerstore"
+	"github.com/cert-manager/csi-driver/pkg/precheck"
 )
 
+// nodeIDEnvVars are the environment variables, in order of precedence, which
+// the node ID is read from when --node-id is not set. They are typically
+// populated from spec.nodeName through the downward API.
+var nodeIDEnvVars = []string{"NODE_ID", "KUBE_NODE_NAME"}
+
 // Options are the main options for the driver. Populated via processing
 // command line flags.
 type Options struct {
@@ -55,11 +70,55 @@ type Options struct {
 	// from.
 	DataRoot string
 
+	// TempDir is the directory used for any temporary files written by the
+	// driver or its dependencies. Defaults to a directory under DataRoot, so
+	// that the driver can run with a read-only root filesystem.
+	TempDir string
+
+	// IssuerDataRootSubpaths maps issuer references, of the form
+	// "<kind>.<group>/[<namespace>/]<name>", to a subpath of DataRoot which
+	// the volumes using that issuer are written to. Volumes using any other
+	// issuer are written to DataRoot.
+	IssuerDataRootSubpaths map[string]string
+
+	// RegistrationRetryTimeout is the maximum time spent retrying binding the
+	// CSI socket at startup. The value 0 disables retrying.
+	RegistrationRetryTimeout time.Duration
+
+	// ShutdownTimeout is the maximum time spent waiting for in-flight mounts
+	// and issuance to complete when the driver is asked to stop.
+	ShutdownTimeout time.Duration
+
 	// UseTokenRequest declares that the CSI driver will use the empty audience
-	// token request for creating CertificateRequests. Requires the token request
-	// to be defined on the CSIDriver manifest.
+	// token request for creating CertificateRequests, or the audiences
+	// requested by the volume. Requires the token requests to be defined on
+	// the CSIDriver manifest.
 	UseTokenRequest bool
 
+	// APIRetryAttempts is the maximum number of attempts made to create a
+	// CertificateRequest when the API server returns a transient error.
+	APIRetryAttempts int
+
+	// APIRetryBackoff is the time waited before the first retry of a
+	// transient error. The wait doubles for each further retry.
+	APIRetryBackoff time.Duration
+
+	// IssuanceBackoffInitial is the time waited before retrying a failed
+	// issuance for a volume.
+	IssuanceBackoffInitial time.Duration
+
+	// IssuanceBackoffMax is the longest time waited between retries of a
+	// failed issuance for a volume.
+	IssuanceBackoffMax time.Duration
+
+	// IssuanceBackoffFactor is the factor the wait is multiplied by for each
+	// further failure of the same volume.
+	IssuanceBackoffFactor float64
+
+	// UseServerSideApply declares that CertificateRequests will be created
+	// using server-side apply, with a fixed field manager name.
+	UseServerSideApply bool
+
 	// Logr is the shared base logger.
 	Logr logr.Logger
 
@@ -70,10 +129,166 @@ type Options struct {
 	// CMClient is a rest client for interacting with cert-manager resources.
 	CMClient cmclient.Interface
 
+	// KubeClient is a rest client for interacting with Kubernetes resources.
+	KubeClient kubernetes.Interface
+
 	// MetricsBindAddress is the TCP address for exposing HTTP Prometheus metrics
 	// which will be served on the HTTP path '/metrics'. The value "0" will
 	// disable exposing metrics.
 	MetricsBindAddress string
+
+	// MetricsTLSCertFile and MetricsTLSKeyFile are the paths of the
+	// certificate and private key the metrics endpoint is served with over
+	// HTTPS. If both are empty, metrics are served over plain HTTP.
+	MetricsTLSCertFile string
+	MetricsTLSKeyFile  string
+
+	// HealthProbeListenAddress is the TCP address for serving the liveness and
+	// readiness probes on the HTTP paths '/healthz' and '/readyz'. The value
+	// "0" will disable the probes.
+	HealthProbeListenAddress string
+
+	// StartupReconcileBatchSize is the number of existing volumes that are
+	// registered for management at once when the driver starts. The value 0
+	// registers all existing volumes at once.
+	StartupReconcileBatchSize int
+
+	// StartupReconcileBatchDelay is the time waited between registering each
+	// batch of existing volumes when the driver starts.
+	StartupReconcileBatchDelay time.Duration
+
+	// ReconcileReadConcurrency is the number of existing volumes which are
+	// read at once when the driver starts.
+	ReconcileReadConcurrency int
+
+	// MaxConcurrentRequests is the maximum number of CertificateRequests
+	// which the driver has outstanding at once. Further issuance blocks until
+	// a request completes. The value 0 disables the limit.
+	MaxConcurrentRequests int
+
+	// MaxConcurrentRenewals is the maximum number of outstanding
+	// CertificateRequests which renew an existing certificate. These also
+	// count towards MaxConcurrentRequests. The value 0 disables the limit.
+	MaxConcurrentRenewals int
+
+	// MaxReuseAge is the maximum age of an existing certificate which will be
+	// reused when the driver restarts. Older certificates are re-issued
+	// immediately. The value 0 disables the check.
+	MaxReuseAge time.Duration
+
+	// CertificateAgeInterval is the interval at which the age of the oldest
+	// certificate served by a managed volume is computed for metrics.
+	CertificateAgeInterval time.Duration
+
+	// RequestTimeout is how long a CertificateRequest of a volume on this
+	// node may be pending before it is deleted, failing the next attempt for
+	// the volume. The value 0 disables the timeout.
+	RequestTimeout time.Duration
+
+	// MaxRequestTimeout is the longest request timeout a volume may request
+	// with the csi.cert-manager.io/request-timeout attribute. The value 0
+	// ignores requested timeouts.
+	MaxRequestTimeout time.Duration
+
+	// OrphanCleanupInterval is the interval at which CertificateRequests
+	// created on this node whose volume no longer exists are deleted. The
+	// value 0 disables cleanup.
+	OrphanCleanupInterval time.Duration
+
+	// ExpiryWarningThreshold is the time before expiry from which a
+	// certificate which has not been renewed is warned about. The value 0
+	// disables the warnings.
+	ExpiryWarningThreshold time.Duration
+
+	// ExpiryWarningInterval is the interval at which certificates are checked
+	// against ExpiryWarningThreshold.
+	ExpiryWarningInterval time.Duration
+
+	// MinReliableDuration is the shortest certificate duration which renewal
+	// can keep up with reliably. Requests for shorter durations are logged, or
+	// refused if RejectBelowMinReliableDuration is set. The value 0 disables
+	// the check.
+	MinReliableDuration time.Duration
+
+	// MinReissueInterval is the shortest time after issuance that a volume
+	// will be renewed, regardless of its computed renewal time. The value 0
+	// disables the limit.
+	MinReissueInterval time.Duration
+
+	// RenewalJitter is the upper bound of a per-volume offset added to the
+	// computed renewal time of each volume. The value 0 disables jitter.
+	RenewalJitter time.Duration
+
+	// RejectBelowMinReliableDuration declares that certificates shorter than
+	// MinReliableDuration will not be requested.
+	RejectBelowMinReliableDuration bool
+
+	// KnownIssuerConstraints maps issuer references to the key types they are
+	// known to accept, separated by ";". Requests for volumes using these
+	// issuers are refused if the generated key type is not accepted.
+	KnownIssuerConstraints map[string]string
+
+	// KnownIssuerKeyTypes is KnownIssuerConstraints, parsed.
+	KnownIssuerKeyTypes map[string][]string
+
+	// LogVolumeLifecycle declares that the driver will log each volume being
+	// published, issued, and unpublished, keyed by volume ID.
+	LogVolumeLifecycle bool
+
+	// WatchManagedFiles declares that the driver will restore files written to
+	// volumes which are modified or removed by anything else.
+	WatchManagedFiles bool
+
+	// ProvisioningSummaryLog declares that the driver will log a single line
+	// summarising each successful mount.
+	ProvisioningSummaryLog bool
+
+	// RequestNameTemplate is a Go template from which the names of created
+	// CertificateRequests are derived. If empty, requests are given the
+	// random names generated by csi-lib.
+	RequestNameTemplate string
+
+	// ParsedRequestNameTemplate is RequestNameTemplate, parsed.
+	ParsedRequestNameTemplate *template.Template
+
+	// ReissueOnCAChange declares that the driver will reissue the volumes of
+	// an issuer which still hold its previous CA, once it is seen to rotate.
+	ReissueOnCAChange bool
+
+	// OTelEndpoint is the URL of the OTLP gRPC endpoint that spans of the
+	// issuance lifecycle are exported to. If empty, tracing is disabled.
+	OTelEndpoint string
+
+	// PrecheckRBAC declares that the driver will check that it is permitted
+	// to create CertificateRequests in the namespace of the pod before
+	// requesting a certificate.
+	PrecheckRBAC bool
+
+	// ProtectInflightRequests declares that the driver will add a finalizer
+	// to the CertificateRequests it creates, so that they are not garbage
+	// collected before the driver has read the certificate from them.
+	ProtectInflightRequests bool
+
+	// CheckNamespaceTerminating declares that the driver will check that the
+	// namespace of the pod is not terminating before requesting a
+	// certificate. Requires permission to get namespaces.
+	CheckNamespaceTerminating bool
+
+	// VerifyPodContext declares that the driver will verify that the pod
+	// described in the volume context exists with the same UID and service
+	// account, and is scheduled to this node, before requesting a certificate.
+	// Requires permission to get pods.
+	VerifyPodContext bool
+
+	// AllowUnknownAttributes declares that volume attributes with the
+	// driver's prefix which are not recognised are permitted, rather than
+	// failing the mount.
+	AllowUnknownAttributes bool
+
+	// AllowPodAnnotationIssuer declares that the issuer name, kind, and group
+	// of a volume may be set by annotations on the pod, where absent from the
+	// volume attributes. Requires permission to get pods.
+	AllowPodAnnotationIssuer bool
 }
 
 func New() *Options {
@@ -93,6 +308,14 @@ func (o *Options) Complete() error {
 	}
 	o.Logr = log
 
+	if err := o.completeNodeID(); err != nil {
+		return err
+	}
+
+	if err := o.setupTempDir(); err != nil {
+		return err
+	}
+
 	var err error
 	o.RestConfig, err = o.kubeConfigFlags.ToRESTConfig()
 	if err != nil {
@@ -104,6 +327,120 @@ func (o *Options) Complete() error {
 		return fmt.Errorf("failed to build cert-manager rest client: %s", err)
 	}
 
+	o.KubeClient, err = kubernetes.NewForConfig(o.RestConfig)
+	if err != nil {
+		return fmt.Errorf("failed to build kubernetes rest client: %s", err)
+	}
+
+	if o.StartupReconcileBatchSize < 0 {
+		return fmt.Errorf("--startup-reconcile-batch-size must not be negative: %d", o.StartupReconcileBatchSize)
+	}
+	if o.ReconcileReadConcurrency < 1 {
+		return fmt.Errorf("--reconcile-read-concurrency must be at least 1: %d", o.ReconcileReadConcurrency)
+	}
+	if o.StartupReconcileBatchDelay < 0 {
+		return fmt.Errorf("--startup-reconcile-batch-delay must not be negative: %s", o.StartupReconcileBatchDelay)
+	}
+	if o.MaxConcurrentRequests < 0 {
+		return fmt.Errorf("--max-concurrent-requests must not be negative: %d", o.MaxConcurrentRequests)
+	}
+	if o.MaxConcurrentRenewals < 0 {
+		return fmt.Errorf("--max-concurrent-renewals must not be negative: %d", o.MaxConcurrentRenewals)
+	}
+	if o.MaxReuseAge < 0 {
+		return fmt.Errorf("--max-reuse-age must not be negative: %s", o.MaxReuseAge)
+	}
+	if o.APIRetryAttempts < 1 {
+		return fmt.Errorf("--api-retry-attempts must be at least 1: %d", o.APIRetryAttempts)
+	}
+	if o.APIRetryBackoff <= 0 {
+		return fmt.Errorf("--api-retry-backoff must be positive: %s", o.APIRetryBackoff)
+	}
+	if o.IssuanceBackoffInitial <= 0 {
+		return fmt.Errorf("--issuance-backoff-initial must be positive: %s", o.IssuanceBackoffInitial)
+	}
+	if o.IssuanceBackoffMax < o.IssuanceBackoffInitial {
+		return fmt.Errorf("--issuance-backoff-max must not be less than --issuance-backoff-initial: %s", o.IssuanceBackoffMax)
+	}
+	if o.IssuanceBackoffFactor < 1 {
+		return fmt.Errorf("--issuance-backoff-factor must be at least 1: %v", o.IssuanceBackoffFactor)
+	}
+	if o.RegistrationRetryTimeout < 0 {
+		return fmt.Errorf("--registration-retry-timeout must not be negative: %s", o.RegistrationRetryTimeout)
+	}
+	if o.ShutdownTimeout < 0 {
+		return fmt.Errorf("--shutdown-timeout must not be negative: %s", o.ShutdownTimeout)
+	}
+	if o.MinReliableDuration < 0 {
+		return fmt.Errorf("--min-reliable-duration must not be negative: %s", o.MinReliableDuration)
+	}
+	if o.MinReissueInterval < 0 {
+		return fmt.Errorf("--min-reissue-interval must not be negative: %s", o.MinReissueInterval)
+	}
+	if o.RenewalJitter < 0 {
+		return fmt.Errorf("--renewal-jitter must not be negative: %s", o.RenewalJitter)
+	}
+	if o.RequestTimeout < 0 {
+		return fmt.Errorf("--request-timeout must not be negative: %s", o.RequestTimeout)
+	}
+	if o.MaxRequestTimeout < 0 {
+		return fmt.Errorf("--max-request-timeout must not be negative: %s", o.MaxRequestTimeout)
+	}
+	if o.OrphanCleanupInterval < 0 {
+		return fmt.Errorf("--orphan-cleanup-interval must not be negative: %s", o.OrphanCleanupInterval)
+	}
+	if o.CertificateAgeInterval <= 0 {
+		return fmt.Errorf("--certificate-age-interval must be positive: %s", o.CertificateAgeInterval)
+	}
+	if o.ExpiryWarningThreshold < 0 {
+		return fmt.Errorf("--expiry-warning-threshold must not be negative: %s", o.ExpiryWarningThreshold)
+	}
+	if o.ExpiryWarningInterval <= 0 {
+		return fmt.Errorf("--expiry-warning-interval must be positive: %s", o.ExpiryWarningInterval)
+	}
+	if (len(o.MetricsTLSCertFile) > 0) != (len(o.MetricsTLSKeyFile) > 0) {
+		return fmt.Errorf("--metrics-tls-cert-file and --metrics-tls-key-file must be set together")
+	}
+	if len(o.RequestNameTemplate) > 0 {
+		if o.ParsedRequestNameTemplate, err = client.ParseRequestNameTemplate(o.RequestNameTemplate); err != nil {
+			return fmt.Errorf("--request-name-template is invalid: %w", err)
+		}
+	}
+	if len(o.OTelEndpoint) > 0 {
+		u, err := url.Parse(o.OTelEndpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			return fmt.Errorf("--otel-endpoint must be a http:// or https:// URL: %q", o.OTelEndpoint)
+		}
+	}
+	if o.PrecheckRBAC && o.UseTokenRequest {
+		return fmt.Errorf("--precheck-rbac cannot be used with --use-token-request, since CertificateRequests are created with the pod's identity")
+	}
+	if err := issuerstore.ValidateSubpaths(o.IssuerDataRootSubpaths); err != nil {
+		return fmt.Errorf("--issuer-data-root-subpaths is invalid: %w", err)
+	}
+	if o.KnownIssuerKeyTypes, err = precheck.ParseKeyTypeConstraints(o.KnownIssuerConstraints); err != nil {
+		return fmt.Errorf("--known-issuer-constraints is invalid: %w", err)
+	}
+
+	return nil
+}
+
+// setupTempDir creates the temporary directory, and points TMPDIR at it so
+// that os.TempDir, and so any library creating temporary files, never writes
+// to the system temporary directory.
+func (o *Options) setupTempDir() error {
+	if len(o.TempDir) == 0 {
+		o.TempDir = filepath.Join(o.DataRoot, "tmp")
+	}
+
+	if err := os.MkdirAll(o.TempDir, 0700); err != nil {
+		return fmt.Errorf("failed to create --temp-dir: %w", err)
+	}
+
+	if err := os.Setenv("TMPDIR", o.TempDir); err != nil {
+		return fmt.Errorf("failed to set TMPDIR: %w", err)
+	}
+
 	return nil
 }
 
@@ -132,16 +469,31 @@ func (o *Options) addFlags(cmd *cobra.Command) {
 	}
 }
 
+// completeNodeID falls back to reading the node ID from the environment when
+// --node-id is not set.
+func (o *Options) completeNodeID() error {
+	if len(o.NodeID) > 0 {
+		return nil
+	}
+	for _, env := range nodeIDEnvVars {
+		if v := os.Getenv(env); len(v) > 0 {
+			o.NodeID = v
+			o.Logr.Info("Using node ID from environment", "env", env, "node-id", v)
+			return nil
+		}
+	}
+	return fmt.Errorf("--node-id is required, or the node name must be set in one of the environment variables %v", nodeIDEnvVars)
+}
+
 func (o *Options) addAppFlags(fs *pflag.FlagSet) {
 	fs.StringVarP(&o.logLevel,
 		"log-level", "v", "1",
 		"Log level (1-5).")
 
 	fs.StringVar(&o.NodeID, "node-id", "",
-		"The name of the node which is hosting this driver instance.")
-	if err := cobra.MarkFlagRequired(fs, "node-id"); err != nil {
-		panic(err)
-	}
+		"The name of the node which is hosting this driver instance. "+
+			"If not set, it is read from the NODE_ID environment variable, then from KUBE_NODE_NAME. "+
+			"The flag takes precedence over both environment variables.")
 
 	fs.StringVar(&o.Endpoint, "endpoint", "",
 		"The endpoint that the driver will connect to the Kubelet.")
@@ -154,10 +506,162 @@ func (o *Options) addAppFlags(fs *pflag.FlagSet) {
 
 	fs.StringVar(&o.DataRoot, "data-root", "/csi-data-dir",
 		"The directory that the driver will write and mount volumes from.")
+	fs.StringVar(&o.TempDir, "temp-dir", "",
+		"The directory used for temporary files, instead of the system temporary directory. "+
+			`Defaults to "tmp" under --data-root, so that the driver can run with a read-only root filesystem.`)
+	fs.StringToStringVar(&o.IssuerDataRootSubpaths, "issuer-data-root-subpaths", nil,
+		"Write the volumes using an issuer to a separate subpath of --data-root, isolating their keys from those of other issuers. "+
+			`Issuers are given as "<kind>.<group>/[<namespace>/]<name>", for example "ClusterIssuer.cert-manager.io/ca-issuer=ca". `+
+			"Volumes using any other issuer are written to --data-root.")
+
+	fs.DurationVar(&o.RegistrationRetryTimeout, "registration-retry-timeout", 0,
+		"The maximum time to spend retrying binding the CSI socket at startup, such as when the kubelet plugin directory is not yet ready. "+
+			`The value "0" will fail immediately.`)
+	fs.DurationVar(&o.ShutdownTimeout, "shutdown-timeout", time.Second*20,
+		"The maximum time to wait on SIGTERM or SIGINT for in-flight mounts and CertificateRequests to complete before exiting. "+
+			"No new mounts or CertificateRequests are started once shutdown begins. Should be shorter than the termination grace period of the driver's pods.")
 
 	fs.BoolVar(&o.UseTokenRequest, "use-token-request", false,
-		"Use the empty audience token request for creating CertificateRequests. Requires the token request to be defined on the CSIDriver manifest.")
+		"Use the empty audience token request for creating CertificateRequests. Requires the token request to be defined on the CSIDriver manifest. "+
+			`Volumes may request other audiences with the "csi.cert-manager.io/token-audiences" attribute, each of which must also be defined as a token request.`)
+	fs.IntVar(&o.APIRetryAttempts, "api-retry-attempts", 5,
+		"The maximum number of attempts to create a CertificateRequest when the API server returns a transient error, "+
+			"such as a timeout, refused connection, rate limit, or unavailable webhook. Other errors are never retried.")
+	fs.DurationVar(&o.APIRetryBackoff, "api-retry-backoff", time.Second,
+		"The time to wait before the first retry of a transient API server error. The wait doubles for each further retry.")
+	fs.DurationVar(&o.IssuanceBackoffInitial, "issuance-backoff-initial", time.Second*30,
+		"The time to wait before retrying the issuance of a volume whose CertificateRequest failed, or could not be created. "+
+			"Volumes whose CertificateRequest was denied are not retried until the denied request is deleted, or the pod is recreated.")
+	fs.DurationVar(&o.IssuanceBackoffMax, "issuance-backoff-max", time.Minute*5,
+		"The longest time to wait between retries of a failed issuance for a volume, before up to 50% jitter is added. "+
+			"The wait is reset once a certificate is issued for the volume.")
+	fs.Float64Var(&o.IssuanceBackoffFactor, "issuance-backoff-factor", 2,
+		"The factor the wait is multiplied by for each further failed issuance of the same volume, up to --issuance-backoff-max.")
+	fs.BoolVar(&o.UseServerSideApply, "use-server-side-apply", false,
+		"Create CertificateRequests using server-side apply with the field manager \"cert-manager-csi-driver\", rather than a plain create. Requires permission to patch CertificateRequests.")
 	fs.StringVar(&o.MetricsBindAddress, "metrics-bind-address", "0",
 		"TCP address for exposing HTTP Prometheus metrics which will be served on the HTTP path '/metrics'. "+
 			`The value "0" will disable exposing metrics.`)
+	fs.StringVar(&o.MetricsTLSCertFile, "metrics-tls-cert-file", "",
+		"Path to a PEM encoded certificate to serve metrics with over HTTPS. Must be set with --metrics-tls-key-file. "+
+			"The files are reloaded when they change. If neither is set, metrics are served over plain HTTP.")
+	fs.StringVar(&o.MetricsTLSKeyFile, "metrics-tls-key-file", "",
+		"Path to the PEM encoded private key of --metrics-tls-cert-file.")
+	fs.StringVar(&o.HealthProbeListenAddress, "health-probe-listen-address", ":8081",
+		"TCP address for serving the liveness probe on the HTTP path '/healthz' and the readiness probe on '/readyz'. "+
+			"The driver is ready once its CSI socket is registered and it has reached the cert-manager API, and is live until its gRPC server stops serving. "+
+			`The value "0" will disable the probes.`)
+
+	fs.IntVar(&o.StartupReconcileBatchSize, "startup-reconcile-batch-size", 0,
+		"The number of existing volumes that are registered for management at once when the driver starts. "+
+			"Volumes whose certificate has already expired are registered first. "+
+			`The value "0" will register all existing volumes at once.`)
+	fs.DurationVar(&o.StartupReconcileBatchDelay, "startup-reconcile-batch-delay", time.Second,
+		"The time to wait between registering each batch of existing volumes when the driver starts.")
+	fs.IntVar(&o.ReconcileReadConcurrency, "reconcile-read-concurrency", 8,
+		"The number of existing volumes whose metadata and certificate are read at once when the driver starts. "+
+			"Higher values make the driver ready sooner after a restart on nodes hosting many volumes.")
+	fs.IntVar(&o.MaxConcurrentRequests, "max-concurrent-requests", 0,
+		"The maximum number of CertificateRequests that the driver has outstanding at once, from creation until the certificate is written to the volume. "+
+			"Mounts and renewals needing further requests wait until one completes, and mounts which wait too long fail and are retried by the kubelet. "+
+			"Mounts waiting for a request are given priority over waiting renewals. "+
+			`The number outstanding is recorded in the certmanager_csi_inflight_certificate_requests metric. The value "0" disables the limit.`)
+	fs.IntVar(&o.MaxConcurrentRenewals, "max-concurrent-renewals", 0,
+		"The maximum number of outstanding CertificateRequests that renew the certificate of an already mounted volume. "+
+			"Renewals also count towards --max-concurrent-requests, so limiting them keeps requests available to mount new volumes during a wave of renewals. "+
+			"The number of mounts and renewals waiting for a request is recorded in the certmanager_csi_waiting_certificate_requests metric. "+
+			`The value "0" disables the limit.`)
+	fs.DurationVar(&o.MaxReuseAge, "max-reuse-age", 0,
+		"The maximum age of an existing certificate that will be reused when the driver starts. "+
+			"Existing certificates issued longer ago than this are re-issued immediately, even if still valid. "+
+			`The value "0" will reuse existing certificates until they are due for renewal.`)
+	fs.DurationVar(&o.MinReliableDuration, "min-reliable-duration", 0,
+		"The shortest certificate duration that renewal can reliably keep up with, given issuance latency. "+
+			`Requests for shorter durations are logged as a warning. The value "0" disables the check.`)
+	fs.BoolVar(&o.RejectBelowMinReliableDuration, "reject-below-min-reliable-duration", false,
+		"Refuse to request certificates with a duration shorter than --min-reliable-duration, rather than logging a warning.")
+	fs.DurationVar(&o.MinReissueInterval, "min-reissue-interval", 0,
+		"The shortest time after issuance that a volume will be renewed, regardless of its renew-before and duration. "+
+			"Renewals delayed by this limit are logged and counted in the certmanager_csi_reissue_interval_clamped_total metric. "+
+			`The value "0" disables the limit.`)
+	fs.DurationVar(&o.RenewalJitter, "renewal-jitter", 0,
+		"The upper bound of a random offset added to the computed renewal time of each volume, so that volumes issued together renew at different times. "+
+			"The offset is fixed per volume for the lifetime of the driver process, and never delays renewal past half of the time remaining until expiry. "+
+			`The value "0" disables jitter.`)
+	fs.DurationVar(&o.CertificateAgeInterval, "certificate-age-interval", time.Minute,
+		"The interval at which the age of the oldest certificate served by a managed volume is computed, "+
+			"for the certmanager_csi_oldest_certificate_age_seconds metric.")
+	fs.DurationVar(&o.RequestTimeout, "request-timeout", time.Minute*5,
+		"How long a CertificateRequest may go without being signed or denied, such as when its issuer is stuck or it is never approved, before it is deleted. "+
+			"The next attempt for the volume then fails with a timeout error naming the request, which the kubelet reports for the mount, and the attempt after creates a new request. "+
+			"csi-lib separately bounds each attempt to 60 seconds, and resumes the pending request on the next attempt. "+
+			"Volumes may override it with the csi.cert-manager.io/request-timeout attribute, up to --max-request-timeout. "+
+			`The value "0" disables the timeout, so a request which is never signed is waited on indefinitely.`)
+	fs.DurationVar(&o.MaxRequestTimeout, "max-request-timeout", time.Minute*30,
+		"The longest request timeout a volume may request with the csi.cert-manager.io/request-timeout attribute. "+
+			"Longer requested timeouts are clamped to it. "+
+			`The value "0" ignores requested timeouts, so that every volume uses --request-timeout.`)
+	fs.DurationVar(&o.OrphanCleanupInterval, "orphan-cleanup-interval", 0,
+		"The interval at which CertificateRequests created by the driver on this node, whose volume no longer exists in the data root, are deleted. "+
+			"Such requests are left behind when a node stops without unpublishing its volumes. "+
+			"Only requests created while cleanup is enabled are annotated with the node, so older requests are never deleted. "+
+			`The value "0" disables cleanup.`)
+	fs.DurationVar(&o.ExpiryWarningThreshold, "expiry-warning-threshold", 0,
+		"The time before expiry from which a certificate that has not been renewed is logged as a warning, escalating to an error as it nears expiry, "+
+			"and recorded in the certmanager_csi_certificate_near_expiry metric. "+
+			"Certificates are checked independently of renewal, so that warnings continue if renewal has stopped. "+
+			`Should be shorter than the renew-before of every volume. The value "0" disables the warnings.`)
+	fs.DurationVar(&o.ExpiryWarningInterval, "expiry-warning-interval", time.Minute,
+		"The interval at which certificates are checked against --expiry-warning-threshold.")
+	fs.StringToStringVar(&o.KnownIssuerConstraints, "known-issuer-constraints", nil,
+		"The key types that issuers are known to accept, so that incompatible requests fail at mount time rather than being denied. "+
+			`Issuers are given as "<kind>.<group>/[<namespace>/]<name>", with key types RSA-<size>, ECDSA-<256|384|521> or Ed25519 separated by ";", `+
+			`for example "ClusterIssuer.cert-manager.io/ca=RSA-2048;RSA-4096".`)
+
+	fs.BoolVar(&o.LogVolumeLifecycle, "log-volume-lifecycle", false,
+		"Log each volume being published, issued a certificate, and unpublished. "+
+			`Entries carry the volume ID under the "volume_id" key, as do the driver's other logs and per-volume metrics.`)
+	fs.BoolVar(&o.WatchManagedFiles, "watch-managed-files", false,
+		"Watch the files written to each volume under the data root, and write them again if they are modified or removed by anything other than the driver, "+
+			"such as a process in the pod truncating the mounted certificate. Files are restored from a copy, including the private key, kept in memory from the last write by this driver process, "+
+			"so files are only watched once they have been written since the driver started.")
+	fs.BoolVar(&o.ProvisioningSummaryLog, "provisioning-summary-log", false,
+		"Log a single line at info level for each successful mount, once the first certificate of the volume has been written. "+
+			"The line carries the volume ID, pod, issuer, number of SANs, granted duration, expiry, and the latency from publish to the certificate being written. "+
+			"Renewals are not logged.")
+	fs.StringVar(&o.RequestNameTemplate, "request-name-template", "",
+		"A Go template from which the names of created CertificateRequests are derived, with the fields "+
+			"{{.PodNamespace}}, {{.PodName}}, {{.PodUID}}, {{.VolumeID}}, {{.IssuerName}} and {{.IssuerKind}}, "+
+			`for example "{{.PodNamespace}}-{{.PodName}}". The result is lower cased, with other characters than letters and digits replaced by "-", `+
+			"then truncated and suffixed with a hash so that every request has a unique, legal name. If empty, requests are given random names.")
+	fs.BoolVar(&o.ReissueOnCAChange, "reissue-on-ca-change", false,
+		"Reissue the volumes of an issuer once its CA is seen to rotate, rather than waiting for their certificates to renew. "+
+			"A rotation is seen when the CA returned for a volume's CertificateRequest differs from the CA file written to that volume. "+
+			"Every other volume of the issuer with a different CA file is then renewed immediately, rewriting all of its files. "+
+			"Volumes of a ClusterIssuer are matched across namespaces, and those of other issuers within their namespace.")
+	fs.StringVar(&o.OTelEndpoint, "otel-endpoint", "",
+		"The URL of an OTLP gRPC endpoint, such as an OpenTelemetry collector, to export spans of the issuance lifecycle of each volume to. "+
+			"Spans are recorded for publishing the volume, creating the CertificateRequest, waiting for it to be issued, and writing files. "+
+			"A http:// URL is not secured with TLS. If empty, tracing is disabled.")
+	fs.BoolVar(&o.PrecheckRBAC, "precheck-rbac", false,
+		"Check that the driver is permitted to create CertificateRequests in the namespace of the pod before requesting a certificate, "+
+			"failing the mount with an RBAC error if not. Results are cached per namespace.")
+	fs.BoolVar(&o.ProtectInflightRequests, "protect-inflight-requests", false,
+		"Add a finalizer to each CertificateRequest the driver creates, so that it is not garbage collected with its pod before the driver has read the certificate. "+
+			"The finalizer is removed once the certificate is written, the next request for the volume is created, or the volume is removed. "+
+			"Requires the driver to be permitted to update CertificateRequests.")
+	fs.BoolVar(&o.CheckNamespaceTerminating, "check-namespace-terminating", false,
+		"Check that the namespace of the pod is not terminating before requesting a certificate. "+
+			"Requires the driver to be permitted to get namespaces, otherwise the check is disabled.")
+	fs.BoolVar(&o.VerifyPodContext, "verify-pod-context", false,
+		"Verify that the pod name, namespace, UID, and service account passed by the kubelet match a pod scheduled to this node before requesting a certificate. "+
+			"Requires the driver to be permitted to get pods, and adds an API call for every issuance and renewal. "+
+			"Certificates are not requested for pods which cannot be verified.")
+	fs.BoolVar(&o.AllowUnknownAttributes, "allow-unknown-attributes", false,
+		"Allow volume attributes with the csi.cert-manager.io/ prefix which are not recognised by the driver. "+
+			"By default, a volume with an unknown attribute fails to mount with an error naming the attribute, so that mistyped attributes are not silently ignored.")
+	fs.BoolVar(&o.AllowPodAnnotationIssuer, "allow-pod-annotation-issuer", false,
+		"Allow the issuer-name, issuer-kind, and issuer-group of a volume to be set by the annotations with the same keys on the pod, such as csi.cert-manager.io/issuer-name, "+
+			"when the attribute is absent from the volume. Volume attributes always take precedence. "+
+			"Requires the driver to be permitted to get pods, which are read once each time a volume is published.")
 }
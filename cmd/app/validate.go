@@ -0,0 +1,223 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+
+	"github.com/cert-manager/csi-driver/pkg/apis/defaults"
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+	"github.com/cert-manager/csi-driver/pkg/apis/validation"
+	"github.com/cert-manager/csi-driver/pkg/keygen"
+	"github.com/cert-manager/csi-driver/pkg/requestgen"
+)
+
+const (
+	validateHelpOutput = "Validate a set of volume attributes without publishing a volume"
+	validateLongOutput = validateHelpOutput + `.
+
+The attributes are defaulted, validated and parsed exactly as they are when a
+volume is published, and the resulting request is printed. Nothing is created
+and the cluster is never contacted, so this may be run in CI to lint the
+volumeAttributes of a PodSpec before it is rolled out.
+
+Attributes are read from --file, a YAML or JSON map of attribute keys to values
+such as the volumeAttributes of a volume, and from each --attr, which takes
+precedence. The pod information normally added by the kubelet is set from the
+--pod-* flags, unless given as an attribute.`
+)
+
+// newValidateCommand returns the validate subcommand, which reports how a set
+// of volume attributes would be resolved, or every reason they would be
+// rejected.
+func newValidateCommand() *cobra.Command {
+	var (
+		file         string
+		attrFlags    []string
+		allowUnknown bool
+		podInfo      = map[string]*string{}
+	)
+
+	cmd := &cobra.Command{
+		Use:           "validate",
+		Short:         validateHelpOutput,
+		Long:          validateLongOutput,
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			attrs, err := readAttributes(file, attrFlags)
+			if err != nil {
+				return err
+			}
+			for key, v := range podInfo {
+				if _, ok := attrs[key]; !ok {
+					attrs[key] = *v
+				}
+			}
+			return validateAttributes(cmd.OutOrStdout(), cmd.ErrOrStderr(), attrs, allowUnknown)
+		},
+	}
+
+	fs := cmd.Flags()
+	fs.StringVarP(&file, "file", "f", "",
+		"Path to a YAML or JSON file containing a map of volume attribute keys to values.")
+	fs.StringArrayVar(&attrFlags, "attr", nil,
+		"A volume attribute in the form key=value. May be given multiple times, and takes precedence over --file.")
+	fs.BoolVar(&allowUnknown, "allow-unknown-attributes", false,
+		"Allow attributes prefixed with csi.cert-manager.io/ which are not recognised, as with the driver flag of the same name.")
+	for _, f := range []struct{ name, key, value string }{
+		{"pod-name", csiapi.K8sVolumeContextKeyPodName, "example"},
+		{"pod-namespace", csiapi.K8sVolumeContextKeyPodNamespace, "default"},
+		{"pod-uid", csiapi.K8sVolumeContextKeyPodUID, "00000000-0000-0000-0000-000000000000"},
+		{"service-account-name", csiapi.K8sVolumeContextKeyServiceAccountName, "default"},
+	} {
+		podInfo[f.key] = fs.String(f.name, f.value, fmt.Sprintf("Value of the %q pod information attribute, used by templated attributes.", f.key))
+	}
+
+	return cmd
+}
+
+// readAttributes returns the attributes read from the given file, if any,
+// overridden by the given key=value pairs.
+func readAttributes(file string, pairs []string) (map[string]string, error) {
+	attrs := make(map[string]string)
+	if len(file) > 0 {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading attributes file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, &attrs); err != nil {
+			return nil, fmt.Errorf("parsing attributes file %q: %w", file, err)
+		}
+		if attrs == nil {
+			attrs = make(map[string]string)
+		}
+	}
+
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || len(key) == 0 {
+			return nil, fmt.Errorf("--attr %q must be in the form key=value", pair)
+		}
+		attrs[key] = value
+	}
+
+	return attrs, nil
+}
+
+// validateAttributes runs the given attributes through the same defaulting,
+// validation and request generation as a published volume. The resolved
+// request is written to out, or each validation error to errOut.
+func validateAttributes(out, errOut io.Writer, attrs map[string]string, allowUnknown bool) error {
+	defaulted, err := defaults.SetDefaultAttributes(attrs)
+	if err != nil {
+		return err
+	}
+
+	el := validation.ValidateAttributes(defaulted)
+	if !allowUnknown {
+		el = append(el, validation.ValidateAttributeKeys(attrs)...)
+	}
+	el = append(el, validation.ValidatePodInfo(attrs)...)
+	if len(el) > 0 {
+		for _, err := range el {
+			fmt.Fprintln(errOut, err.Error())
+		}
+		return fmt.Errorf("volume attributes are invalid: %d error(s) found", len(el))
+	}
+
+	bundle, err := requestgen.RequestForMetadata(metadata.Metadata{VolumeID: "validate", VolumeContext: attrs})
+	if err != nil {
+		return fmt.Errorf("volume attributes are invalid: %w", err)
+	}
+
+	subject := bundle.Request.Subject
+	if len(bundle.Request.RawSubject) > 0 {
+		var rdns pkix.RDNSequence
+		if _, err := asn1.Unmarshal(bundle.Request.RawSubject, &rdns); err != nil {
+			return fmt.Errorf("decoding literal subject: %w", err)
+		}
+		subject.FillFromRDNSequence(&rdns)
+	}
+
+	var ips, uris, usages []string
+	for _, ip := range bundle.Request.IPAddresses {
+		ips = append(ips, ip.String())
+	}
+	for _, uri := range bundle.Request.URIs {
+		uris = append(uris, uri.String())
+	}
+	for _, usage := range bundle.Usages {
+		usages = append(usages, string(usage))
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Issuer:\t%s (kind %s, group %s)\n", bundle.IssuerRef.Name, bundle.IssuerRef.Kind, bundle.IssuerRef.Group)
+	fmt.Fprintf(w, "Namespace:\t%s\n", bundle.Namespace)
+	fmt.Fprintf(w, "Private key:\t%s, %s\n", keygen.KeyType(defaulted), defaulted[csiapi.KeyEncodingKey])
+	fmt.Fprintf(w, "Subject:\t%s\n", subject.String())
+	fmt.Fprintf(w, "DNS names:\t%s\n", strings.Join(bundle.Request.DNSNames, ", "))
+	fmt.Fprintf(w, "IP addresses:\t%s\n", strings.Join(ips, ", "))
+	fmt.Fprintf(w, "URIs:\t%s\n", strings.Join(uris, ", "))
+	fmt.Fprintf(w, "Key usages:\t%s\n", strings.Join(usages, ", "))
+	fmt.Fprintf(w, "Is CA:\t%t\n", bundle.IsCA)
+	fmt.Fprintf(w, "Duration:\t%s\n", bundle.Duration)
+	fmt.Fprintf(w, "Renew before:\t%s\n", renewBeforeDescription(defaulted))
+	if v, ok := defaulted[csiapi.PostIssueCooldownKey]; ok {
+		fmt.Fprintf(w, "Post-issue cooldown:\t%s\n", v)
+	}
+
+	paths := validation.OutputFilePaths(defaulted)
+	keys := make([]string, 0, len(paths))
+	for key, file := range paths {
+		if len(file) > 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	fmt.Fprintln(w, "Files:")
+	for _, key := range keys {
+		fmt.Fprintf(w, "  %s\t%s\n", paths[key], key)
+	}
+
+	return w.Flush()
+}
+
+// renewBeforeDescription describes when a certificate issued for the given
+// defaulted attributes is renewed. The renewal time depends on the lifetime
+// of the issued certificate, so is described rather than calculated.
+func renewBeforeDescription(attrs map[string]string) string {
+	if v, ok := attrs[csiapi.RenewBeforeKey]; ok {
+		return fmt.Sprintf("%s before expiry, or 1/3 of the issued lifetime if that is not longer than %s", v, v)
+	}
+	if v, ok := attrs[csiapi.RenewBeforePercentageKey]; ok {
+		return v + "% of the issued lifetime before expiry"
+	}
+	return "1/3 of the issued lifetime before expiry"
+}
@@ -0,0 +1,168 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// validOutput is the request printed for the attributes of the valid test
+// cases.
+const validOutput = "Issuer:        ca-issuer (kind ClusterIssuer, group cert-manager.io)\n" +
+	"Namespace:     default\n" +
+	"Private key:   ECDSA-256, PKCS1\n" +
+	"Subject:       \n" +
+	"DNS names:     example.default.svc\n" +
+	"IP addresses:  \n" +
+	"URIs:          \n" +
+	"Key usages:    digital signature, key encipherment\n" +
+	"Is CA:         false\n" +
+	"Duration:      24h0m0s\n" +
+	"Renew before:  1/3 of the issued lifetime before expiry\n" +
+	"Files:\n" +
+	"  ca.crt   csi.cert-manager.io/ca-file\n" +
+	"  tls.crt  csi.cert-manager.io/certificate-file\n" +
+	"  tls.key  csi.cert-manager.io/privatekey-file\n"
+
+func Test_validateCommand(t *testing.T) {
+	validAttrs := []string{
+		"--attr", "csi.cert-manager.io/issuer-name=ca-issuer",
+		"--attr", "csi.cert-manager.io/issuer-kind=ClusterIssuer",
+		"--attr", "csi.cert-manager.io/dns-names=${POD_NAME}.${POD_NAMESPACE}.svc",
+		"--attr", "csi.cert-manager.io/key-algorithm=ECDSA",
+		"--attr", "csi.cert-manager.io/duration=24h",
+	}
+
+	tests := map[string]struct {
+		// files are written to a temporary directory, whose path replaces
+		// "$DIR" in args.
+		files map[string]string
+		args  []string
+
+		expOut     string
+		expOutLine string
+		expErrOut  string
+		expErr     string
+	}{
+		"valid attributes should print the resolved request": {
+			args:   validAttrs,
+			expOut: validOutput,
+		},
+		"valid attributes from a YAML file should print the resolved request": {
+			files: map[string]string{"attrs.yaml": `csi.cert-manager.io/issuer-name: ca-issuer
+csi.cert-manager.io/issuer-kind: ClusterIssuer
+csi.cert-manager.io/dns-names: ${POD_NAME}.${POD_NAMESPACE}.svc
+csi.cert-manager.io/key-algorithm: ECDSA
+csi.cert-manager.io/duration: 24h
+`},
+			args:   []string{"--file", "$DIR/attrs.yaml"},
+			expOut: validOutput,
+		},
+		"valid attributes from a JSON file should print the resolved request": {
+			files: map[string]string{"attrs.json": `{
+  "csi.cert-manager.io/issuer-name": "ca-issuer",
+  "csi.cert-manager.io/issuer-kind": "ClusterIssuer",
+  "csi.cert-manager.io/dns-names": "${POD_NAME}.${POD_NAMESPACE}.svc",
+  "csi.cert-manager.io/key-algorithm": "ECDSA",
+  "csi.cert-manager.io/duration": "24h"
+}`},
+			args:   []string{"-f", "$DIR/attrs.json"},
+			expOut: validOutput,
+		},
+		"attributes given with --attr should take precedence over the file": {
+			files: map[string]string{"attrs.yaml": `csi.cert-manager.io/issuer-name: ca-issuer
+csi.cert-manager.io/duration: 24h
+`},
+			args:       []string{"--file", "$DIR/attrs.yaml", "--attr", "csi.cert-manager.io/duration=48h"},
+			expOutLine: "Duration:      48h0m0s\n",
+		},
+		"pod information flags should be used by templated attributes": {
+			args:       []string{"--attr", "csi.cert-manager.io/issuer-name=ca-issuer", "--attr", "csi.cert-manager.io/dns-names=${POD_NAME}.svc", "--pod-name", "my-pod"},
+			expOutLine: "DNS names:     my-pod.svc\n",
+		},
+		"pod information given as an attribute should take precedence over the flags": {
+			args:       []string{"--attr", "csi.cert-manager.io/issuer-name=ca-issuer", "--attr", "csi.storage.k8s.io/pod.namespace=sandbox", "--pod-namespace", "other"},
+			expOutLine: "Namespace:     sandbox\n",
+		},
+		"invalid attributes should print every error and fail": {
+			args: []string{"--attr", "csi.cert-manager.io/duration=bad", "--attr", "csi.cert-manager.io/bogus=x"},
+			expErrOut: "volumeAttributes.csi.cert-manager.io/issuer-name: Required value: issuer-name is a required field\n" +
+				"volumeAttributes.csi.cert-manager.io/duration: Invalid value: \"bad\": must be a valid duration string: time: invalid duration \"bad\"\n" +
+				"volumeAttributes.csi.cert-manager.io/bogus: Invalid value: \"x\": unknown attribute\n",
+			expErr: "volume attributes are invalid: 3 error(s) found",
+		},
+		"unknown attributes should be allowed with --allow-unknown-attributes": {
+			args:       append([]string{"--attr", "csi.cert-manager.io/bogus=x", "--allow-unknown-attributes"}, validAttrs...),
+			expOutLine: "Issuer:        ca-issuer (kind ClusterIssuer, group cert-manager.io)\n",
+		},
+		"an --attr which is not a key=value pair should fail": {
+			args:   []string{"--attr", "csi.cert-manager.io/issuer-name"},
+			expErr: `--attr "csi.cert-manager.io/issuer-name" must be in the form key=value`,
+		},
+		"a file which is not a map of attributes should fail": {
+			files:  map[string]string{"attrs.yaml": "- not a map\n"},
+			args:   []string{"--file", "$DIR/attrs.yaml"},
+			expErr: `parsing attributes file`,
+		},
+		"a missing file should fail": {
+			args:   []string{"--file", "$DIR/missing.yaml"},
+			expErr: "reading attributes file",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, data := range test.files {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600))
+			}
+			args := make([]string, len(test.args))
+			for i, arg := range test.args {
+				args[i] = strings.ReplaceAll(arg, "$DIR", dir)
+			}
+
+			var out, errOut bytes.Buffer
+			cmd := newValidateCommand()
+			cmd.SetOut(&out)
+			cmd.SetErr(&errOut)
+			cmd.SetArgs(args)
+
+			err := cmd.Execute()
+			if len(test.expErr) > 0 {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			if len(test.expOut) > 0 {
+				assert.Equal(t, test.expOut, out.String())
+			}
+			if len(test.expOutLine) > 0 {
+				assert.Contains(t, out.String(), test.expOutLine)
+			}
+			assert.Equal(t, test.expErrOut, errOut.String())
+		})
+	}
+}
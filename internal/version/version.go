@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"runtime/debug"
 )
 
 func init() {
@@ -42,6 +43,20 @@ var (
 	GitCommit  = ""
 )
 
+// DriverVersion returns the version reported to the kubelet by the CSI
+// Identity service. GetPluginInfo fails if the version is empty, so binaries
+// built without -ldflags fall back to the module version recorded in the
+// build info, or "devel" if there is none.
+func DriverVersion() string {
+	if AppVersion != "" {
+		return AppVersion
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "devel"
+}
+
 func VersionInfo() Version {
 	return Version{
 		AppVersion: AppVersion,
@@ -0,0 +1,57 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package version
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cert-manager/csi-lib/driver"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DriverVersion(t *testing.T) {
+	tests := map[string]struct {
+		appVersion string
+		expVersion string
+	}{
+		"if AppVersion is set, it should be returned": {
+			appVersion: "v0.10.0",
+			expVersion: "v0.10.0",
+		},
+		"if AppVersion is not set, should fall back to a non-empty version": {
+			appVersion: "",
+			expVersion: "devel",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			old := AppVersion
+			AppVersion = test.appVersion
+			t.Cleanup(func() { AppVersion = old })
+
+			assert.Equal(t, test.expVersion, DriverVersion())
+
+			resp, err := driver.NewIdentityServer("csi.cert-manager.io", DriverVersion()).GetPluginInfo(context.TODO(), &csi.GetPluginInfoRequest{})
+			require.NoError(t, err)
+			assert.Equal(t, test.expVersion, resp.GetVendorVersion())
+		})
+	}
+}
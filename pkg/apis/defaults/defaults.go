@@ -17,10 +17,12 @@ limitations under the License.
 package defaults
 
 import (
+	"strconv"
 	"strings"
 
 	"github.com/cert-manager/cert-manager/pkg/apis/certmanager"
 	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmpki "github.com/cert-manager/cert-manager/pkg/util/pki"
 
 	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
 )
@@ -44,10 +46,12 @@ func SetDefaultAttributes(attrOriginal map[string]string) (map[string]string, er
 	setDefaultIfEmpty(attr, csiapi.KeyFileKey, "tls.key")
 
 	setDefaultIfEmpty(attr, csiapi.KeyEncodingKey, "PKCS1")
+	setDefaultPrivateKey(attr)
 
 	setDefaultIfEmpty(attr, csiapi.KeyUsagesKey, strings.Join([]string{string(cmapi.UsageDigitalSignature), string(cmapi.UsageKeyEncipherment)}, ","))
 
 	setDefaultKeyStorePKCS12(attr)
+	setDefaultCombined(attr)
 
 	return attr, nil
 }
@@ -58,6 +62,18 @@ func setDefaultIfEmpty(attr map[string]string, k, v string) {
 	}
 }
 
+// setDefaultPrivateKey sets the default private key algorithm, and the default
+// size for that algorithm. Ed25519 keys have no size.
+func setDefaultPrivateKey(attr map[string]string) {
+	setDefaultIfEmpty(attr, csiapi.KeyAlgorithmKey, string(cmapi.RSAKeyAlgorithm))
+	switch cmapi.PrivateKeyAlgorithm(attr[csiapi.KeyAlgorithmKey]) {
+	case cmapi.RSAKeyAlgorithm:
+		setDefaultIfEmpty(attr, csiapi.KeySizeKey, strconv.Itoa(cmpki.MinRSAKeySize))
+	case cmapi.ECDSAKeyAlgorithm:
+		setDefaultIfEmpty(attr, csiapi.KeySizeKey, strconv.Itoa(cmpki.ECCurve256))
+	}
+}
+
 // setDefaultKeystorePKCS12 sets the default values for the PKCS12 relevant
 // attributes. If the csiapi.KeyStorePKCS12EnableKey key is not defined, omit
 // setting defaults on the other PKCS12 keys, since they should not be present
@@ -66,5 +82,14 @@ func setDefaultIfEmpty(attr map[string]string, k, v string) {
 func setDefaultKeyStorePKCS12(attr map[string]string) {
 	if _, ok := attr[csiapi.KeyStorePKCS12EnableKey]; ok {
 		setDefaultIfEmpty(attr, csiapi.KeyStorePKCS12FileKey, "keystore.p12")
+		setDefaultIfEmpty(attr, csiapi.KeyStorePKCS12IncludeChainKey, "true")
+	}
+}
+
+// setDefaultCombined sets the default combined file name if a combined format
+// has been requested.
+func setDefaultCombined(attr map[string]string) {
+	if _, ok := attr[csiapi.CombinedFormatKey]; ok {
+		setDefaultIfEmpty(attr, csiapi.CombinedFileKey, "tls-combined.pem")
 	}
 }
@@ -36,8 +36,9 @@ func Test_pkcs12Values(t *testing.T) {
 				"csi.cert-manager.io/pkcs12-enable": "foo",
 			},
 			expOutput: map[string]string{
-				"csi.cert-manager.io/pkcs12-enable":   "foo",
-				"csi.cert-manager.io/pkcs12-filename": "keystore.p12",
+				"csi.cert-manager.io/pkcs12-enable":        "foo",
+				"csi.cert-manager.io/pkcs12-filename":      "keystore.p12",
+				"csi.cert-manager.io/pkcs12-include-chain": "true",
 			},
 		},
 	}
@@ -50,3 +51,91 @@ func Test_pkcs12Values(t *testing.T) {
 		})
 	}
 }
+
+func Test_combinedValues(t *testing.T) {
+	tests := map[string]struct {
+		input     map[string]string
+		expOutput map[string]string
+	}{
+		"if attributes are empty, expect no combined attributes": {
+			input:     map[string]string{},
+			expOutput: map[string]string{},
+		},
+		"if combined format attribute present, expect combined file present": {
+			input: map[string]string{
+				"csi.cert-manager.io/combined-format": "haproxy",
+			},
+			expOutput: map[string]string{
+				"csi.cert-manager.io/combined-format": "haproxy",
+				"csi.cert-manager.io/combined-file":   "tls-combined.pem",
+			},
+		},
+		"if combined file attribute present, expect it is not overridden": {
+			input: map[string]string{
+				"csi.cert-manager.io/combined-format": "nginx",
+				"csi.cert-manager.io/combined-file":   "fullchain.pem",
+			},
+			expOutput: map[string]string{
+				"csi.cert-manager.io/combined-format": "nginx",
+				"csi.cert-manager.io/combined-file":   "fullchain.pem",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			out := test.input
+			setDefaultCombined(out)
+			assert.Equal(t, test.expOutput, out)
+		})
+	}
+}
+
+func Test_privateKeyValues(t *testing.T) {
+	tests := map[string]struct {
+		input     map[string]string
+		expOutput map[string]string
+	}{
+		"if attributes are empty, expect a 2048-bit RSA key": {
+			input: map[string]string{},
+			expOutput: map[string]string{
+				"csi.cert-manager.io/key-algorithm": "RSA",
+				"csi.cert-manager.io/key-size":      "2048",
+			},
+		},
+		"if ECDSA requested, expect the P-256 curve": {
+			input: map[string]string{
+				"csi.cert-manager.io/key-algorithm": "ECDSA",
+			},
+			expOutput: map[string]string{
+				"csi.cert-manager.io/key-algorithm": "ECDSA",
+				"csi.cert-manager.io/key-size":      "256",
+			},
+		},
+		"if Ed25519 requested, expect no key size": {
+			input: map[string]string{
+				"csi.cert-manager.io/key-algorithm": "Ed25519",
+			},
+			expOutput: map[string]string{
+				"csi.cert-manager.io/key-algorithm": "Ed25519",
+			},
+		},
+		"if key size present, expect it is not overridden": {
+			input: map[string]string{
+				"csi.cert-manager.io/key-size": "4096",
+			},
+			expOutput: map[string]string{
+				"csi.cert-manager.io/key-algorithm": "RSA",
+				"csi.cert-manager.io/key-size":      "4096",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			out := test.input
+			setDefaultPrivateKey(out)
+			assert.Equal(t, test.expOutput, out)
+		})
+	}
+}
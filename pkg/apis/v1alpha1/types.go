@@ -39,20 +39,195 @@ const (
 	IsCAKey        = "csi.cert-manager.io/is-ca"
 	KeyUsagesKey   = "csi.cert-manager.io/key-usages"
 	KeyEncodingKey = "csi.cert-manager.io/key-encoding"
+	SANCriticalKey = "csi.cert-manager.io/san-critical"
+
+	// KeyAlgorithmKey is the algorithm of the private key generated for the
+	// volume, one of RSA (the default), ECDSA or Ed25519. KeySizeKey is the
+	// RSA modulus size in bits (default 2048), or the ECDSA curve size of
+	// 256 (the default), 384 or 521. The key size is ignored for Ed25519.
+	KeyAlgorithmKey = "csi.cert-manager.io/key-algorithm"
+	KeySizeKey      = "csi.cert-manager.io/key-size"
+
+	RequireExactSANsKey = "csi.cert-manager.io/require-exact-sans"
+
+	// ReissueOnSANDriftKey, if "true", reissues the certificate of a volume
+	// which is published again if the SANs requested from its current volume
+	// context are no longer those of the certificate in the volume.
+	ReissueOnSANDriftKey = "csi.cert-manager.io/reissue-on-san-drift"
+
+	SkipCertVerificationKey = "csi.cert-manager.io/skip-cert-verification"
 
 	CAFileKey   = "csi.cert-manager.io/ca-file"
 	CertFileKey = "csi.cert-manager.io/certificate-file"
 	KeyFileKey  = "csi.cert-manager.io/privatekey-file"
 	FSGroupKey  = "csi.cert-manager.io/fs-group"
 
-	RenewBeforeKey  = "csi.cert-manager.io/renew-before"
-	ReusePrivateKey = "csi.cert-manager.io/reuse-private-key"
+	FileModeKey               = "csi.cert-manager.io/file-mode"
+	CertificatePermissionsKey = "csi.cert-manager.io/certificate-permissions"
+	PrivateKeyPermissionsKey  = "csi.cert-manager.io/privatekey-permissions"
+
+	RenewBeforeKey           = "csi.cert-manager.io/renew-before"
+	RenewBeforePercentageKey = "csi.cert-manager.io/renew-before-percentage"
+	ReusePrivateKey          = "csi.cert-manager.io/reuse-private-key"
+	PostIssueCooldownKey     = "csi.cert-manager.io/post-issue-cooldown"
+	OnKeyReadErrorKey        = "csi.cert-manager.io/on-key-read-error"
+
+	// RequestTimeoutKey is how long a CertificateRequest of the volume may be
+	// pending before it is deleted, in place of the driver's
+	// --request-timeout. It is clamped to the driver's --max-request-timeout.
+	RequestTimeoutKey = "csi.cert-manager.io/request-timeout"
+
+	KeyStorePKCS12EnableKey       = "csi.cert-manager.io/pkcs12-enable"
+	KeyStorePKCS12FileKey         = "csi.cert-manager.io/pkcs12-filename"
+	KeyStorePKCS12PasswordKey     = "csi.cert-manager.io/pkcs12-password" // #nosec G101: False positive, gosec thinks this is a credential.
+	KeyStorePKCS12IncludeChainKey = "csi.cert-manager.io/pkcs12-include-chain"
+
+	// KeyStorePKCS12PasswordSecretKey names a Secret in the pod's namespace
+	// holding the PKCS12 keystore password under its "password" key, as an
+	// alternative to KeyStorePKCS12PasswordKey. The Secret is read each time
+	// the keystore is written, and the password is never written to disk.
+	KeyStorePKCS12PasswordSecretKey = "csi.cert-manager.io/pkcs12-password-secret" // #nosec G101: False positive, this is the name of a Secret.
+
+	CombinedFormatKey  = "csi.cert-manager.io/combined-format"
+	CombinedFileKey    = "csi.cert-manager.io/combined-file"
+	CombinedPEMFileKey = "csi.cert-manager.io/combined-pem-file"
+
+	OutputFIFOKey = "csi.cert-manager.io/output-fifo"
+
+	IssuerDNFileKey = "csi.cert-manager.io/issuer-dn-file"
+	CertInfoFileKey = "csi.cert-manager.io/cert-info-file"
+
+	// LastRenewalFileKey names a file holding the RFC 3339 time at which a
+	// certificate was last written to the volume, for monitoring renewal
+	// without metrics.
+	LastRenewalFileKey = "csi.cert-manager.io/last-renewal-file"
+
+	// TrustBundleFileKey names a file holding the PEM encoded CA returned by
+	// the issuer, as a trust bundle for SPIFFE and other consumers which load
+	// trust anchors separately from the CA file. It is rewritten on every
+	// issuance, together with the other files, and is always PEM encoded.
+	// With --reissue-on-ca-change, the bundle of every volume of an issuer
+	// is refreshed once its CA rotates.
+	TrustBundleFileKey = "csi.cert-manager.io/trust-bundle-file"
+
+	PreferredChainKey = "csi.cert-manager.io/preferred-chain"
+
+	FileLayoutKey = "csi.cert-manager.io/file-layout"
+
+	// EncodingKey is the encoding of the private key, certificate, and CA
+	// files, one of PEM (the default) or DER.
+	EncodingKey = "csi.cert-manager.io/encoding"
+
+	PriorityKey = "csi.cert-manager.io/priority"
+
+	// AnnotationsKey and LabelsKey hold comma separated key=value pairs which
+	// are added as annotations and labels to every CertificateRequest created
+	// for the volume, such as for approval policies. Keys in the
+	// cert-manager.io domain are reserved for the driver and cert-manager.
+	AnnotationsKey = "csi.cert-manager.io/annotations"
+	LabelsKey      = "csi.cert-manager.io/labels"
+
+	// TokenAudiencesKey holds comma separated audiences of the service account
+	// tokens requested for the volume when the driver uses token requests.
+	// CertificateRequests are created with the token of the first audience.
+	// Each audience must be declared as a token request on the CSIDriver.
+	TokenAudiencesKey = "csi.cert-manager.io/token-audiences"
+
+	// DryRunKey, if "true", requests a certificate for the volume without
+	// writing it. The CertificateRequest is deleted once it completes, and the
+	// mount always fails with an error reporting the outcome, so the pod
+	// never starts. Use it to check an issuer and its approval policy accept
+	// the volume's attributes before rolling them out.
+	DryRunKey = "csi.cert-manager.io/dry-run"
+
+	ACMEKeyPrefix                     = "csi.cert-manager.io/acme-"
+	ACMEHTTP01IngressNameOverrideKey  = "csi.cert-manager.io/acme-http01-override-ingress-name"
+	ACMEHTTP01IngressClassOverrideKey = "csi.cert-manager.io/acme-http01-override-ingress-class"
+)
+
+const (
+	// Supported values of the csi.cert-manager.io/combined-format attribute.
+	CombinedFormatHAProxy  = "haproxy"
+	CombinedFormatNginx    = "nginx"
+	CombinedFormatPostgres = "postgres"
+)
+
+const (
+	// Supported values of the csi.cert-manager.io/require-exact-sans attribute.
+	RequireSANsSuperset = "superset"
+	RequireSANsExact    = "exact"
+)
+
+const (
+	// Supported values of the csi.cert-manager.io/on-key-read-error
+	// attribute, which sets what happens when reuse-private-key is enabled
+	// and the existing private key file cannot be read or decoded. A private
+	// key file which does not exist is always regenerated.
+	//
+	// OnKeyReadErrorRegenerate, the default, logs a warning and generates a
+	// new private key. OnKeyReadErrorFail fails the issuance, and so the
+	// mount of a new volume.
+	OnKeyReadErrorRegenerate = "regenerate"
+	OnKeyReadErrorFail       = "fail"
+)
+
+const (
+	// Supported values of the csi.cert-manager.io/file-layout attribute.
+	//
+	// FileLayoutSecretTLS writes exactly the tls.crt, tls.key, and ca.crt
+	// files of a kubernetes.io/tls Secret written by cert-manager, byte for
+	// byte: tls.crt holds the chain as returned by the issuer, tls.key the
+	// PEM encoded private key in the requested key encoding, and ca.crt the
+	// CA, which is empty if the issuer returned none. Unlike a Secret volume,
+	// the files are only readable by their owner and the fs-group.
+	FileLayoutSecretTLS = "secret-tls"
 
-	KeyStorePKCS12EnableKey   = "csi.cert-manager.io/pkcs12-enable"
-	KeyStorePKCS12FileKey     = "csi.cert-manager.io/pkcs12-filename"
-	KeyStorePKCS12PasswordKey = "csi.cert-manager.io/pkcs12-password" // #nosec G101: False positive, gosec thinks this is a credential.
+	// FileLayoutGoTLS guarantees the certificate and private key files can be
+	// loaded by Go's tls.LoadX509KeyPair: the certificate file holds the leaf
+	// followed by its intermediates in signing order, without the root, and
+	// the private key file the PEM encoded private key matching the leaf. An
+	// issued chain which is not a single unbroken chain fails issuance,
+	// so the layout cannot be combined with preferred-chain.
+	FileLayoutGoTLS = "go-tls"
 )
 
+const (
+	// Supported values of the csi.cert-manager.io/encoding attribute.
+	//
+	// EncodingDER writes each file as a single DER encoded value: the private
+	// key in the requested key encoding, the leaf certificate without its
+	// intermediates, and the CA certificate. DER cannot hold more than one
+	// certificate, so issuance fails if the issuer returns more than one CA
+	// certificate. Keystores and combined files are always written in their
+	// own formats.
+	EncodingPEM = "PEM"
+	EncodingDER = "DER"
+)
+
+const (
+	// Supported values of the csi.cert-manager.io/priority attribute.
+	//
+	// Every CertificateRequest created by the driver is annotated with its
+	// priority under PriorityAnnotationKey, for issuers which queue requests
+	// by priority. If the attribute is not set, the initial issuance of a
+	// volume is PriorityHigh, since a pod is waiting on it, and renewals are
+	// PriorityNormal.
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+
+	// PriorityAnnotationKey is the annotation holding the priority of a
+	// CertificateRequest.
+	PriorityAnnotationKey = "csi.cert-manager.io/priority"
+)
+
+// CorrelationIDKey holds the correlation ID of a volume, which is generated
+// by the driver when the volume is first published and is carried by every
+// log entry for the volume. It is stored with the volume context, so is kept
+// when the volume is republished or the driver restarts. Any value given in
+// the volume attributes is replaced.
+const CorrelationIDKey = "csi.cert-manager.io/correlation-id"
+
 const (
 	// Well-known attribute keys that are present in the volume context, passed
 	// from the Kubelet during PublishVolume calls.
@@ -60,4 +235,106 @@ const (
 	K8sVolumeContextKeyPodNamespace       = "csi.storage.k8s.io/pod.namespace"
 	K8sVolumeContextKeyPodUID             = "csi.storage.k8s.io/pod.uid"
 	K8sVolumeContextKeyServiceAccountName = "csi.storage.k8s.io/serviceAccount.name"
+
+	// K8sVolumeContextKeyServiceAccountTokens holds the service account
+	// tokens requested by the token requests of the CSIDriver, as a JSON
+	// object keyed by audience.
+	K8sVolumeContextKeyServiceAccountTokens = "csi.storage.k8s.io/serviceAccount.tokens"
 )
+
+// AttributeKeyPrefix is the prefix of every volume attribute key of the
+// driver.
+const AttributeKeyPrefix = "csi.cert-manager.io/"
+
+// AttributeKeys are every volume attribute key recognised by the driver.
+var AttributeKeys = []string{
+	IssuerNameKey,
+	IssuerKindKey,
+	IssuerGroupKey,
+	LiteralSubjectKey,
+	CommonNameKey,
+	OrganizationsKey,
+	OrganizationalUnitsKey,
+	CountriesKey,
+	ProvincesKey,
+	LocalitiesKey,
+	StreetAddressesKey,
+	PostalCodesKey,
+	SerialNumberKey,
+	DNSNamesKey,
+	IPSANsKey,
+	URISANsKey,
+	DurationKey,
+	IsCAKey,
+	KeyUsagesKey,
+	KeyEncodingKey,
+	SANCriticalKey,
+	KeyAlgorithmKey,
+	KeySizeKey,
+	RequireExactSANsKey,
+	ReissueOnSANDriftKey,
+	SkipCertVerificationKey,
+	CAFileKey,
+	CertFileKey,
+	KeyFileKey,
+	FSGroupKey,
+	FileModeKey,
+	CertificatePermissionsKey,
+	PrivateKeyPermissionsKey,
+	RenewBeforeKey,
+	RenewBeforePercentageKey,
+	ReusePrivateKey,
+	PostIssueCooldownKey,
+	OnKeyReadErrorKey,
+	RequestTimeoutKey,
+	KeyStorePKCS12EnableKey,
+	KeyStorePKCS12FileKey,
+	KeyStorePKCS12PasswordKey,
+	KeyStorePKCS12IncludeChainKey,
+	KeyStorePKCS12PasswordSecretKey,
+	CombinedFormatKey,
+	CombinedFileKey,
+	CombinedPEMFileKey,
+	OutputFIFOKey,
+	IssuerDNFileKey,
+	CertInfoFileKey,
+	LastRenewalFileKey,
+	TrustBundleFileKey,
+	PreferredChainKey,
+	FileLayoutKey,
+	EncodingKey,
+	CorrelationIDKey,
+	PriorityKey,
+	AnnotationsKey,
+	LabelsKey,
+	TokenAudiencesKey,
+	DryRunKey,
+	ACMEHTTP01IngressNameOverrideKey,
+	ACMEHTTP01IngressClassOverrideKey,
+}
+
+// TemplateVariables maps the variables which may be used in templated
+// attributes, such as ${POD_NAME}, to the volume context key they are
+// expanded from.
+var TemplateVariables = map[string]string{
+	"POD_NAME":             K8sVolumeContextKeyPodName,
+	"POD_NAMESPACE":        K8sVolumeContextKeyPodNamespace,
+	"POD_UID":              K8sVolumeContextKeyPodUID,
+	"SERVICE_ACCOUNT_NAME": K8sVolumeContextKeyServiceAccountName,
+}
+
+// TemplatedKeys are the attribute keys whose values are expanded with
+// TemplateVariables.
+var TemplatedKeys = []string{
+	LiteralSubjectKey,
+	CommonNameKey,
+	OrganizationsKey,
+	OrganizationalUnitsKey,
+	CountriesKey,
+	ProvincesKey,
+	LocalitiesKey,
+	StreetAddressesKey,
+	PostalCodesKey,
+	DNSNamesKey,
+	URISANsKey,
+}
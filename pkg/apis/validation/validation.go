@@ -17,19 +17,34 @@ limitations under the License.
 package validation
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"os"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	cmapiutil "github.com/cert-manager/cert-manager/pkg/api/util"
+	"github.com/cert-manager/cert-manager/pkg/apis/certmanager"
 	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	cmpki "github.com/cert-manager/cert-manager/pkg/util/pki"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 
 	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
 )
 
+// maxPostIssueCooldown is the longest post-issue cooldown which may be
+// requested. The cooldown is intended to cover issuer backend replication
+// delays, not to defer renewal for long periods.
+const maxPostIssueCooldown = time.Minute * 10
+
 // ValidateAttributes validates that the attributes provided
 func ValidateAttributes(attr map[string]string) field.ErrorList {
 	var el field.ErrorList
@@ -40,30 +55,69 @@ func ValidateAttributes(attr map[string]string) field.ErrorList {
 		el = append(el, field.Required(path.Child(csiapi.IssuerNameKey), "issuer-name is a required field"))
 	}
 
+	el = append(el, issuerRef(path, attr)...)
+
 	el = append(el, boolValue(path.Child(csiapi.IsCAKey), attr[csiapi.IsCAKey])...)
 
 	el = append(el, durationParse(path.Child(csiapi.DurationKey), attr[csiapi.DurationKey])...)
 
 	el = append(el, keyUsages(path.Child(csiapi.KeyUsagesKey), attr[csiapi.KeyUsagesKey])...)
 
-	el = append(el, filename(path.Child(csiapi.CAFileKey), attr[csiapi.CAFileKey])...)
-	el = append(el, filename(path.Child(csiapi.CertFileKey), attr[csiapi.CertFileKey])...)
-	el = append(el, filename(path.Child(csiapi.KeyFileKey), attr[csiapi.KeyFileKey])...)
-	el = append(el, filename(path.Child(csiapi.KeyStorePKCS12FileKey), attr[csiapi.KeyStorePKCS12FileKey])...)
+	el = append(el, ipSANsValue(path.Child(csiapi.IPSANsKey), attr[csiapi.IPSANsKey])...)
+
+	// Every attribute naming an output file is validated here, so that no
+	// file can be written outside of the volume.
+	filePaths := OutputFilePaths(attr)
+	for _, k := range outputFileKeys {
+		if file, ok := filePaths[k]; ok {
+			el = append(el, filename(path.Child(k), file)...)
+		}
+	}
+
+	el = append(el, permissionsValue(path.Child(csiapi.FileModeKey), attr, csiapi.FileModeKey)...)
+	el = append(el, permissionsValue(path.Child(csiapi.CertificatePermissionsKey), attr, csiapi.CertificatePermissionsKey)...)
+	el = append(el, permissionsValue(path.Child(csiapi.PrivateKeyPermissionsKey), attr, csiapi.PrivateKeyPermissionsKey)...)
 
 	el = append(el, durationParse(path.Child(csiapi.RenewBeforeKey), attr[csiapi.RenewBeforeKey])...)
+	el = append(el, renewBeforePercentageValue(path.Child(csiapi.RenewBeforePercentageKey), attr)...)
 	el = append(el, boolValue(path.Child(csiapi.ReusePrivateKey), attr[csiapi.ReusePrivateKey])...)
+	el = append(el, postIssueCooldownValue(path.Child(csiapi.PostIssueCooldownKey), attr[csiapi.PostIssueCooldownKey])...)
+	el = append(el, onKeyReadErrorValue(path.Child(csiapi.OnKeyReadErrorKey), attr)...)
+	el = append(el, requestTimeoutValue(path.Child(csiapi.RequestTimeoutKey), attr[csiapi.RequestTimeoutKey])...)
 
 	el = append(el, keyEncodingValue(path.Child(csiapi.KeyEncodingKey), attr[csiapi.KeyEncodingKey])...)
+	el = append(el, privateKeyValues(path, attr)...)
 
 	el = append(el, pkcs12Values(path, attr)...)
 
-	el = append(el, uniqueFilePaths(path, map[string]string{
-		csiapi.CAFileKey:             attr[csiapi.CAFileKey],
-		csiapi.CertFileKey:           attr[csiapi.CertFileKey],
-		csiapi.KeyFileKey:            attr[csiapi.KeyFileKey],
-		csiapi.KeyStorePKCS12FileKey: attr[csiapi.KeyStorePKCS12FileKey],
-	})...)
+	el = append(el, sanCriticalValue(path.Child(csiapi.SANCriticalKey), attr)...)
+	el = append(el, requireExactSANsValue(path.Child(csiapi.RequireExactSANsKey), attr[csiapi.RequireExactSANsKey])...)
+	el = append(el, boolValue(path.Child(csiapi.ReissueOnSANDriftKey), attr[csiapi.ReissueOnSANDriftKey])...)
+	el = append(el, skipCertVerificationValue(path.Child(csiapi.SkipCertVerificationKey), attr)...)
+
+	el = append(el, combinedValues(path, attr)...)
+	el = append(el, optionalFileValue(path.Child(csiapi.CombinedPEMFileKey), attr, csiapi.CombinedPEMFileKey)...)
+
+	el = append(el, outputFIFOValue(path, attr)...)
+
+	el = append(el, acmeValues(path, attr)...)
+
+	for _, k := range []string{csiapi.IssuerDNFileKey, csiapi.CertInfoFileKey, csiapi.LastRenewalFileKey, csiapi.TrustBundleFileKey} {
+		el = append(el, optionalFileValue(path.Child(k), attr, k)...)
+	}
+
+	el = append(el, preferredChainValue(path.Child(csiapi.PreferredChainKey), attr)...)
+
+	el = append(el, fileLayoutValues(path, attr)...)
+	el = append(el, encodingValue(path.Child(csiapi.EncodingKey), attr)...)
+
+	el = append(el, priorityValue(path.Child(csiapi.PriorityKey), attr[csiapi.PriorityKey])...)
+	el = append(el, requestMetadataValue(path.Child(csiapi.AnnotationsKey), attr[csiapi.AnnotationsKey], false)...)
+	el = append(el, requestMetadataValue(path.Child(csiapi.LabelsKey), attr[csiapi.LabelsKey], true)...)
+	el = append(el, tokenAudiencesValue(path.Child(csiapi.TokenAudiencesKey), attr)...)
+	el = append(el, boolValue(path.Child(csiapi.DryRunKey), attr[csiapi.DryRunKey])...)
+
+	el = append(el, uniqueFilePaths(path, filePaths)...)
 
 	// If there are errors, then return not approved and the aggregated errors.
 	if len(el) > 0 {
@@ -73,6 +127,135 @@ func ValidateAttributes(attr map[string]string) field.ErrorList {
 	return nil
 }
 
+// maxSuggestionDistance is the largest edit distance between an unknown
+// attribute key and a known key for the known key to be suggested.
+const maxSuggestionDistance = 3
+
+// ValidateAttributeKeys validates that every attribute with the driver's
+// prefix is recognised, so that a mistyped key fails the mount rather than
+// being silently ignored. The closest known key is suggested for each unknown
+// key, if one is close. ACME attributes are validated by ValidateAttributes.
+func ValidateAttributeKeys(attr map[string]string) field.ErrorList {
+	var el field.ErrorList
+
+	path := field.NewPath("volumeAttributes")
+	for k := range attr {
+		if !strings.HasPrefix(k, csiapi.AttributeKeyPrefix) || strings.HasPrefix(k, csiapi.ACMEKeyPrefix) || slices.Contains(csiapi.AttributeKeys, k) {
+			continue
+		}
+		msg := "unknown attribute"
+		if suggestion, ok := closestAttributeKey(k); ok {
+			msg = fmt.Sprintf("unknown attribute, did you mean %q?", suggestion)
+		}
+		el = append(el, field.Invalid(path.Child(k), attr[k], msg))
+	}
+	sort.Slice(el, func(i, j int) bool { return el[i].Field < el[j].Field })
+
+	return el
+}
+
+// closestAttributeKey returns the known attribute key with the smallest edit
+// distance from the given key, if it is no more than maxSuggestionDistance.
+func closestAttributeKey(key string) (string, bool) {
+	best, bestDistance := "", maxSuggestionDistance+1
+	for _, known := range csiapi.AttributeKeys {
+		if d := editDistance(key, known); d < bestDistance {
+			best, bestDistance = known, d
+		}
+	}
+	return best, len(best) > 0
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// podInfoOnMountHint is the remedy given when pod information is missing from
+// the volume context.
+const podInfoOnMountHint = "pod information is missing from the volume context, set podInfoOnMount: true on the CSIDriver object"
+
+// ValidatePodInfo validates that the volume context holds the pod information
+// needed by the given attributes, which the kubelet only passes when the
+// CSIDriver object has podInfoOnMount set. The pod namespace is always
+// required, since the CertificateRequest is created in it. Pod fields
+// referenced by templated attributes, and the given required keys, are also
+// required.
+func ValidatePodInfo(attr map[string]string, requiredKeys ...string) field.ErrorList {
+	var el field.ErrorList
+
+	path := field.NewPath("volumeContext")
+
+	required := map[string]string{
+		csiapi.K8sVolumeContextKeyPodNamespace: "the CertificateRequest is created in the pod namespace",
+	}
+	for _, key := range requiredKeys {
+		if _, ok := required[key]; !ok {
+			required[key] = "required by the driver configuration"
+		}
+	}
+	for _, templated := range csiapi.TemplatedKeys {
+		os.Expand(attr[templated], func(name string) string {
+			if key, ok := csiapi.TemplateVariables[name]; ok {
+				if _, ok := required[key]; !ok {
+					required[key] = fmt.Sprintf("${%s} is used by %s", name, templated)
+				}
+			}
+			return ""
+		})
+	}
+
+	var keys []string
+	for key := range required {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if len(attr[key]) == 0 {
+			el = append(el, field.Required(path.Child(key), fmt.Sprintf("%s: %s", required[key], podInfoOnMountHint)))
+		}
+	}
+
+	return el
+}
+
+// issuerRef validates that the issuer kind is compatible with the issuer
+// group. The built-in cert-manager group only serves the Issuer and
+// ClusterIssuer kinds, so any other kind must be an external issuer with its
+// own group. An empty group or kind is treated as its default.
+func issuerRef(path *field.Path, attr map[string]string) field.ErrorList {
+	group, kind := attr[csiapi.IssuerGroupKey], attr[csiapi.IssuerKindKey]
+	if len(kind) == 0 || (len(group) > 0 && group != certmanager.GroupName) {
+		return nil
+	}
+
+	switch kind {
+	case cmapi.IssuerKind, cmapi.ClusterIssuerKind:
+		return nil
+	}
+
+	return field.ErrorList{field.Invalid(path.Child(csiapi.IssuerKindKey), kind,
+		fmt.Sprintf("issuer group %q only supports the kinds %q and %q; if %q is an external issuer, set %q to its API group",
+			certmanager.GroupName, cmapi.IssuerKind, cmapi.ClusterIssuerKind, kind, csiapi.IssuerGroupKey))}
+}
+
 func keyUsages(path *field.Path, ss string) field.ErrorList {
 	if len(ss) == 0 {
 		return nil
@@ -103,6 +286,96 @@ func durationParse(path *field.Path, s string) field.ErrorList {
 	return nil
 }
 
+// ipSANsValue validates that every entry of the comma separated IP SANs is an
+// IP address.
+func ipSANsValue(path *field.Path, s string) field.ErrorList {
+	if len(s) == 0 {
+		return nil
+	}
+	var invalid []string
+	for _, ip := range strings.Split(s, ",") {
+		if ip = strings.TrimSpace(ip); net.ParseIP(ip) == nil {
+			invalid = append(invalid, ip)
+		}
+	}
+	if len(invalid) > 0 {
+		return field.ErrorList{field.Invalid(path, s, fmt.Sprintf("must be a comma separated list of IP addresses, invalid entries: %q", invalid))}
+	}
+	return nil
+}
+
+// postIssueCooldownValue validates the post-issue cooldown is a positive
+// duration no longer than maxPostIssueCooldown.
+func postIssueCooldownValue(path *field.Path, s string) field.ErrorList {
+	if len(s) == 0 {
+		return nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return field.ErrorList{field.Invalid(path, s, "must be a valid duration string: "+err.Error())}
+	}
+	if d <= 0 || d > maxPostIssueCooldown {
+		return field.ErrorList{field.Invalid(path, s, fmt.Sprintf("must be a positive duration no longer than %s", maxPostIssueCooldown))}
+	}
+	return nil
+}
+
+// requestTimeoutValue validates the request timeout is a positive duration.
+func requestTimeoutValue(path *field.Path, s string) field.ErrorList {
+	if len(s) == 0 {
+		return nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return field.ErrorList{field.Invalid(path, s, "must be a valid duration string: "+err.Error())}
+	}
+	if d <= 0 {
+		return field.ErrorList{field.Invalid(path, s, "must be a positive duration")}
+	}
+	return nil
+}
+
+// renewBeforePercentageValue validates the renew before percentage attribute
+// is a whole number between 1 and 99, and is not combined with renew-before.
+func renewBeforePercentageValue(path *field.Path, attr map[string]string) field.ErrorList {
+	s, ok := attr[csiapi.RenewBeforePercentageKey]
+	if !ok {
+		return nil
+	}
+	if p, err := strconv.Atoi(s); err != nil || p < 1 || p > 99 {
+		return field.ErrorList{field.Invalid(path, s, "must be a whole number between 1 and 99")}
+	}
+	if _, ok := attr[csiapi.RenewBeforeKey]; ok {
+		return field.ErrorList{field.Invalid(path, s, fmt.Sprintf("cannot be set together with %s", csiapi.RenewBeforeKey))}
+	}
+	return nil
+}
+
+// permissionsValue validates the file permissions attribute, if set, is an
+// octal string of permission bits. An empty value is rejected rather than
+// treated as unset, since the writer applies every permissions attribute
+// which is present.
+func permissionsValue(path *field.Path, attr map[string]string, key string) field.ErrorList {
+	s, ok := attr[key]
+	if !ok {
+		return nil
+	}
+	if _, err := ParsePermissions(s); err != nil {
+		return field.ErrorList{field.Invalid(path, s, err.Error())}
+	}
+	return nil
+}
+
+// ParsePermissions parses the given octal string, such as "0640", as file
+// permission bits.
+func ParsePermissions(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > uint64(os.ModePerm) {
+		return 0, errors.New("must be an octal file mode between 0000 and 0777")
+	}
+	return os.FileMode(mode), nil
+}
+
 func boolValue(path *field.Path, s string) field.ErrorList {
 	if len(s) == 0 {
 		return nil
@@ -120,16 +393,86 @@ func keyEncodingValue(path *field.Path, s string) field.ErrorList {
 	return nil
 }
 
+// privateKeyValues validates the private key algorithm is supported, and the
+// key size is valid for it.
+func privateKeyValues(path *field.Path, attr map[string]string) field.ErrorList {
+	algorithm := cmapi.PrivateKeyAlgorithm(attr[csiapi.KeyAlgorithmKey])
+	size, hasSize := attr[csiapi.KeySizeKey]
+
+	switch algorithm {
+	case "", cmapi.RSAKeyAlgorithm:
+		if n, err := strconv.Atoi(size); hasSize && (err != nil || n < cmpki.MinRSAKeySize || n > cmpki.MaxRSAKeySize) {
+			return field.ErrorList{field.Invalid(path.Child(csiapi.KeySizeKey), size,
+				fmt.Sprintf("must be a whole number of bits between %d and %d for RSA keys", cmpki.MinRSAKeySize, cmpki.MaxRSAKeySize))}
+		}
+	case cmapi.ECDSAKeyAlgorithm:
+		supported := []string{strconv.Itoa(cmpki.ECCurve256), strconv.Itoa(cmpki.ECCurve384), strconv.Itoa(cmpki.ECCurve521)}
+		if hasSize && !slices.Contains(supported, size) {
+			return field.ErrorList{field.NotSupported(path.Child(csiapi.KeySizeKey), size, supported)}
+		}
+	case cmapi.Ed25519KeyAlgorithm:
+	default:
+		return field.ErrorList{field.NotSupported(path.Child(csiapi.KeyAlgorithmKey), string(algorithm),
+			[]string{string(cmapi.RSAKeyAlgorithm), string(cmapi.ECDSAKeyAlgorithm), string(cmapi.Ed25519KeyAlgorithm)})}
+	}
+
+	return nil
+}
+
+// outputFileKeys are the attributes which name a file written to the volume.
+// Any attribute added which names an output file must be added here.
+var outputFileKeys = []string{
+	csiapi.CAFileKey,
+	csiapi.CertFileKey,
+	csiapi.KeyFileKey,
+	csiapi.KeyStorePKCS12FileKey,
+	csiapi.CombinedFileKey,
+	csiapi.CombinedPEMFileKey,
+	csiapi.IssuerDNFileKey,
+	csiapi.CertInfoFileKey,
+	csiapi.LastRenewalFileKey,
+	csiapi.TrustBundleFileKey,
+}
+
+// OutputFilePaths returns the file named by each output file attribute which
+// is set. The CA, certificate, key, and PKCS12 files are always set once
+// defaulted. The remaining files are optional, and an empty optional file is
+// rejected separately, so is not included.
+func OutputFilePaths(attr map[string]string) map[string]string {
+	paths := make(map[string]string)
+	for _, k := range outputFileKeys {
+		file, ok := attr[k]
+		switch k {
+		case csiapi.CAFileKey, csiapi.CertFileKey, csiapi.KeyFileKey, csiapi.KeyStorePKCS12FileKey:
+			ok = true
+		case csiapi.CombinedPEMFileKey, csiapi.IssuerDNFileKey, csiapi.CertInfoFileKey, csiapi.LastRenewalFileKey, csiapi.TrustBundleFileKey:
+			ok = len(file) > 0
+		}
+		if ok {
+			paths[k] = file
+		}
+	}
+	return paths
+}
+
 // filename ensures that a given filename, is indeed a valid filename. It does
 // this by validating that the given filename is not:
 // 1. absolute
 // 2. starting with '..'
 // 3. contain '/'
 // 4. longer than 255 characters
-// 4. include leading or trailing spaces
+// 5. include leading or trailing spaces
+// 6. the volume directory itself
+//
+// A filename which passes these checks always resolves to a file directly
+// within the volume directory.
 func filename(path *field.Path, filename string) field.ErrorList {
 	var el field.ErrorList
 
+	if filename == "." {
+		el = append(el, field.Invalid(path, filename, "filename must not be '.'"))
+	}
+
 	if filepath.IsAbs(filename) {
 		el = append(el, field.Invalid(path, filename, "filename must not be an absolute path"))
 	}
@@ -182,6 +525,367 @@ func uniqueFilePaths(path *field.Path, paths map[string]string) field.ErrorList
 	return el
 }
 
+// sanCriticalValue validates that the SAN critical attribute is a boolean,
+// that it is only set when SANs are requested, and that it is not disabled
+// when the subject is empty. RFC 5280 requires that the subjectAltName
+// extension is critical when the subject is empty.
+func sanCriticalValue(path *field.Path, attr map[string]string) field.ErrorList {
+	v, ok := attr[csiapi.SANCriticalKey]
+	if !ok {
+		return nil
+	}
+
+	if el := boolValue(path, v); len(el) > 0 {
+		return el
+	}
+
+	hasSANs := false
+	for _, k := range []string{csiapi.DNSNamesKey, csiapi.IPSANsKey, csiapi.URISANsKey} {
+		if len(attr[k]) > 0 {
+			hasSANs = true
+		}
+	}
+
+	hasSubject := false
+	for _, k := range []string{
+		csiapi.LiteralSubjectKey, csiapi.CommonNameKey, csiapi.OrganizationsKey,
+		csiapi.OrganizationalUnitsKey, csiapi.CountriesKey, csiapi.ProvincesKey,
+		csiapi.LocalitiesKey, csiapi.StreetAddressesKey, csiapi.PostalCodesKey,
+		csiapi.SerialNumberKey,
+	} {
+		if len(attr[k]) > 0 {
+			hasSubject = true
+		}
+	}
+
+	switch {
+	case v == "true" && !hasSANs:
+		return field.ErrorList{field.Invalid(path, v, "cannot mark subjectAltName extension as critical when no SANs are requested")}
+	case v == "false" && hasSANs && !hasSubject:
+		return field.ErrorList{field.Invalid(path, v, "subjectAltName extension must be critical when the subject is empty")}
+	}
+
+	return nil
+}
+
+// priorityValue validates the priority attribute, if set, is a supported
+// priority.
+func priorityValue(path *field.Path, s string) field.ErrorList {
+	switch s {
+	case "", csiapi.PriorityHigh, csiapi.PriorityNormal, csiapi.PriorityLow:
+		return nil
+	default:
+		return field.ErrorList{field.NotSupported(path, s, []string{csiapi.PriorityHigh, csiapi.PriorityNormal, csiapi.PriorityLow})}
+	}
+}
+
+// requestMetadataValue validates the annotations or labels attribute is a list
+// of key=value pairs with valid keys, and label values if labels, which are
+// not reserved for the driver or cert-manager.
+func requestMetadataValue(path *field.Path, s string, labels bool) field.ErrorList {
+	if len(s) == 0 {
+		return nil
+	}
+
+	pairs, err := ParseKeyValues(s)
+	if err != nil {
+		return field.ErrorList{field.Invalid(path, s, err.Error())}
+	}
+
+	keys := make([]string, 0, len(pairs))
+	for k := range pairs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var el field.ErrorList
+	for _, k := range keys {
+		for _, msg := range validation.IsQualifiedName(k) {
+			el = append(el, field.Invalid(path, s, fmt.Sprintf("key %q: %s", k, msg)))
+		}
+		if labels {
+			for _, msg := range validation.IsValidLabelValue(pairs[k]) {
+				el = append(el, field.Invalid(path, s, fmt.Sprintf("value of key %q: %s", k, msg)))
+			}
+		}
+		if reservedRequestMetadataKey(k, labels) {
+			el = append(el, field.Invalid(path, s, fmt.Sprintf("key %q is reserved for use by the driver and cert-manager", k)))
+		}
+	}
+
+	return el
+}
+
+// reservedRequestMetadataKey returns whether the given annotation or label key
+// is set by the driver or cert-manager, so may not be set by volumes.
+func reservedRequestMetadataKey(k string, label bool) bool {
+	// The driver labels every request as managed by it.
+	if label && k == "app.kubernetes.io/managed-by" {
+		return true
+	}
+	domain, _, ok := strings.Cut(k, "/")
+	return ok && (domain == certmanager.GroupName || strings.HasSuffix(domain, "."+certmanager.GroupName))
+}
+
+// ParseKeyValues parses the given comma separated list of key=value pairs.
+// Whitespace around each pair is ignored.
+func ParseKeyValues(s string) (map[string]string, error) {
+	pairs := make(map[string]string)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		k, v, ok := strings.Cut(entry, "=")
+		if !ok || len(k) == 0 {
+			return nil, fmt.Errorf("must be a comma separated list of key=value pairs, got %q", entry)
+		}
+		if _, ok := pairs[k]; ok {
+			return nil, fmt.Errorf("key %q is given more than once", k)
+		}
+		pairs[k] = v
+	}
+	return pairs, nil
+}
+
+// tokenAudiencesValue validates the token audiences attribute, if set, is a
+// list of distinct audiences.
+func tokenAudiencesValue(path *field.Path, attr map[string]string) field.ErrorList {
+	s, ok := attr[csiapi.TokenAudiencesKey]
+	if !ok {
+		return nil
+	}
+	if _, err := ParseTokenAudiences(s); err != nil {
+		return field.ErrorList{field.Invalid(path, s, err.Error())}
+	}
+	return nil
+}
+
+// ParseTokenAudiences parses a comma separated list of token audiences.
+// Surrounding whitespace is ignored.
+func ParseTokenAudiences(s string) ([]string, error) {
+	var audiences []string
+	for _, audience := range strings.Split(s, ",") {
+		audience = strings.TrimSpace(audience)
+		if len(audience) == 0 {
+			return nil, errors.New("must be a comma separated list of non-empty audiences")
+		}
+		if slices.Contains(audiences, audience) {
+			return nil, fmt.Errorf("audience %q is given more than once", audience)
+		}
+		audiences = append(audiences, audience)
+	}
+	return audiences, nil
+}
+
+// onKeyReadErrorValue validates the on key read error attribute is a supported
+// value, and is only set when the private key is reused.
+func onKeyReadErrorValue(path *field.Path, attr map[string]string) field.ErrorList {
+	s, ok := attr[csiapi.OnKeyReadErrorKey]
+	if !ok {
+		return nil
+	}
+	switch s {
+	case csiapi.OnKeyReadErrorRegenerate, csiapi.OnKeyReadErrorFail:
+	default:
+		return field.ErrorList{field.NotSupported(path, s, []string{csiapi.OnKeyReadErrorRegenerate, csiapi.OnKeyReadErrorFail})}
+	}
+	if attr[csiapi.ReusePrivateKey] != "true" {
+		return field.ErrorList{field.Invalid(path, s, fmt.Sprintf("may only be set when %s is true", csiapi.ReusePrivateKey))}
+	}
+	return nil
+}
+
+// requireExactSANsValue validates the SAN check mode is supported.
+func requireExactSANsValue(path *field.Path, s string) field.ErrorList {
+	switch s {
+	case "", csiapi.RequireSANsSuperset, csiapi.RequireSANsExact:
+		return nil
+	default:
+		return field.ErrorList{field.NotSupported(path, s, []string{csiapi.RequireSANsSuperset, csiapi.RequireSANsExact})}
+	}
+}
+
+// skipCertVerificationValue validates the skip certificate verification
+// attribute is a boolean, and is not combined with an attribute which
+// requests verification.
+func skipCertVerificationValue(path *field.Path, attr map[string]string) field.ErrorList {
+	s := attr[csiapi.SkipCertVerificationKey]
+	if el := boolValue(path, s); len(el) > 0 {
+		return el
+	}
+	if s == "true" && len(attr[csiapi.RequireExactSANsKey]) > 0 {
+		return field.ErrorList{field.Invalid(path, s, fmt.Sprintf("cannot skip certificate verification when %s is set", csiapi.RequireExactSANsKey))}
+	}
+	return nil
+}
+
+// optionalFileValue validates the given optional output file attribute, if
+// set, is not empty. The filename itself is validated with every other output
+// file.
+func optionalFileValue(path *field.Path, attr map[string]string, key string) field.ErrorList {
+	if file, ok := attr[key]; ok && len(file) == 0 {
+		return field.ErrorList{field.Invalid(path, file, "filename must not be empty")}
+	}
+	return nil
+}
+
+// preferredChainValue validates the preferred chain attribute, if set, names
+// a CA.
+func preferredChainValue(path *field.Path, attr map[string]string) field.ErrorList {
+	if name, ok := attr[csiapi.PreferredChainKey]; ok && len(strings.TrimSpace(name)) == 0 {
+		return field.ErrorList{field.Invalid(path, name, "must be the common name of a CA")}
+	}
+	return nil
+}
+
+// combinedValues validates the combined file attributes are valid.
+func combinedValues(path *field.Path, attr map[string]string) field.ErrorList {
+	var el field.ErrorList
+
+	format, ok := attr[csiapi.CombinedFormatKey]
+	if !ok {
+		if file, ok := attr[csiapi.CombinedFileKey]; ok {
+			el = append(el, field.Invalid(path.Child(csiapi.CombinedFileKey), file,
+				fmt.Sprintf("cannot use attribute without %q set", csiapi.CombinedFormatKey)))
+		}
+		return el
+	}
+
+	switch format {
+	case csiapi.CombinedFormatHAProxy, csiapi.CombinedFormatNginx, csiapi.CombinedFormatPostgres:
+	default:
+		el = append(el, field.NotSupported(path.Child(csiapi.CombinedFormatKey), format,
+			[]string{csiapi.CombinedFormatHAProxy, csiapi.CombinedFormatNginx, csiapi.CombinedFormatPostgres}))
+	}
+
+	return el
+}
+
+// outputFIFOValue validates the named pipe output attribute is a boolean, and
+// is not combined with outputs which need the certificate or private key
+// written to disk.
+func outputFIFOValue(path *field.Path, attr map[string]string) field.ErrorList {
+	v := attr[csiapi.OutputFIFOKey]
+	if el := boolValue(path.Child(csiapi.OutputFIFOKey), v); len(el) > 0 {
+		return el
+	}
+	if v != "true" {
+		return nil
+	}
+
+	var el field.ErrorList
+	for _, k := range []string{csiapi.KeyStorePKCS12EnableKey, csiapi.ReusePrivateKey} {
+		if attr[k] == "true" {
+			el = append(el, field.Invalid(path.Child(csiapi.OutputFIFOKey), v,
+				fmt.Sprintf("cannot be used with %q set to %q", k, "true")))
+		}
+	}
+	for _, k := range []string{csiapi.CombinedFormatKey, csiapi.CombinedPEMFileKey, csiapi.FileModeKey, csiapi.CertificatePermissionsKey, csiapi.PrivateKeyPermissionsKey} {
+		if _, ok := attr[k]; ok {
+			el = append(el, field.Invalid(path.Child(csiapi.OutputFIFOKey), v,
+				fmt.Sprintf("cannot be used with %q", k)))
+		}
+	}
+
+	return el
+}
+
+// fileLayoutValues validates that the file layout is supported, and that no
+// other attribute changes the files it guarantees.
+func fileLayoutValues(path *field.Path, attr map[string]string) field.ErrorList {
+	layout, ok := attr[csiapi.FileLayoutKey]
+	if !ok {
+		return nil
+	}
+	switch layout {
+	case csiapi.FileLayoutSecretTLS:
+	case csiapi.FileLayoutGoTLS:
+		// The private key is only guaranteed to match the leaf if the
+		// issued certificate is verified, and the chain is only guaranteed
+		// to be in order if it is a single chain.
+		var el field.ErrorList
+		if attr[csiapi.SkipCertVerificationKey] == "true" {
+			el = append(el, field.Invalid(path.Child(csiapi.FileLayoutKey), layout,
+				fmt.Sprintf("cannot be used with %q set to %q", csiapi.SkipCertVerificationKey, "true")))
+		}
+		if _, ok := attr[csiapi.PreferredChainKey]; ok {
+			el = append(el, field.Invalid(path.Child(csiapi.FileLayoutKey), layout,
+				fmt.Sprintf("cannot be used with %q", csiapi.PreferredChainKey)))
+		}
+		return el
+	default:
+		return field.ErrorList{field.NotSupported(path.Child(csiapi.FileLayoutKey), layout, []string{csiapi.FileLayoutSecretTLS, csiapi.FileLayoutGoTLS})}
+	}
+
+	var el field.ErrorList
+	for _, f := range []struct{ key, file string }{
+		{csiapi.CAFileKey, cmmeta.TLSCAKey},
+		{csiapi.CertFileKey, corev1.TLSCertKey},
+		{csiapi.KeyFileKey, corev1.TLSPrivateKeyKey},
+	} {
+		if attr[f.key] != f.file {
+			el = append(el, field.Invalid(path.Child(f.key), attr[f.key],
+				fmt.Sprintf("must be %q when %q is %q", f.file, csiapi.FileLayoutKey, layout)))
+		}
+	}
+	for _, k := range []string{csiapi.CombinedFormatKey, csiapi.CombinedPEMFileKey, csiapi.IssuerDNFileKey, csiapi.CertInfoFileKey, csiapi.LastRenewalFileKey, csiapi.TrustBundleFileKey, csiapi.PreferredChainKey} {
+		if _, ok := attr[k]; ok {
+			el = append(el, field.Invalid(path.Child(csiapi.FileLayoutKey), layout,
+				fmt.Sprintf("cannot be used with %q", k)))
+		}
+	}
+	if attr[csiapi.OutputFIFOKey] == "true" {
+		el = append(el, field.Invalid(path.Child(csiapi.FileLayoutKey), layout,
+			fmt.Sprintf("cannot be used with %q set to %q", csiapi.OutputFIFOKey, "true")))
+	}
+
+	return el
+}
+
+// encodingValue validates that the file encoding is supported, and that DER
+// is not used with a file layout, which guarantees PEM encoded files.
+func encodingValue(path *field.Path, attr map[string]string) field.ErrorList {
+	encoding, ok := attr[csiapi.EncodingKey]
+	if !ok {
+		return nil
+	}
+	switch encoding {
+	case csiapi.EncodingPEM:
+	case csiapi.EncodingDER:
+		if _, ok := attr[csiapi.FileLayoutKey]; ok {
+			return field.ErrorList{field.Invalid(path, encoding, fmt.Sprintf("cannot be used with %q", csiapi.FileLayoutKey))}
+		}
+	default:
+		return field.ErrorList{field.NotSupported(path, encoding, []string{csiapi.EncodingPEM, csiapi.EncodingDER})}
+	}
+	return nil
+}
+
+// acmeValues validates that ACME annotation attributes only use the keys
+// recognised by the cert-manager ACME issuer. The ingress name and class
+// overrides are mutually exclusive.
+func acmeValues(path *field.Path, attr map[string]string) field.ErrorList {
+	supported := []string{
+		csiapi.ACMEHTTP01IngressClassOverrideKey,
+		csiapi.ACMEHTTP01IngressNameOverrideKey,
+	}
+
+	var el field.ErrorList
+	for k := range attr {
+		if strings.HasPrefix(k, csiapi.ACMEKeyPrefix) && !slices.Contains(supported, k) {
+			el = append(el, field.Invalid(path.Child(k), attr[k],
+				fmt.Sprintf("unsupported ACME attribute, supported attributes are %q", supported)))
+		}
+	}
+	sort.Slice(el, func(i, j int) bool { return el[i].Field < el[j].Field })
+
+	_, hasName := attr[csiapi.ACMEHTTP01IngressNameOverrideKey]
+	if class, hasClass := attr[csiapi.ACMEHTTP01IngressClassOverrideKey]; hasName && hasClass {
+		el = append(el, field.Invalid(path.Child(csiapi.ACMEHTTP01IngressClassOverrideKey), class,
+			fmt.Sprintf("cannot be used with %q", csiapi.ACMEHTTP01IngressNameOverrideKey)))
+	}
+
+	return el
+}
+
 // pkcs12Values validates the PKCS12 attributes are valid.
 func pkcs12Values(path *field.Path, attr map[string]string) field.ErrorList {
 	var el field.ErrorList
@@ -190,7 +894,17 @@ func pkcs12Values(path *field.Path, attr map[string]string) field.ErrorList {
 		if file := attr[csiapi.KeyStorePKCS12FileKey]; len(file) == 0 {
 			el = append(el, field.Required(path.Child(csiapi.KeyStorePKCS12FileKey), "required attribute when PKCS12 KeyStore is enabled"))
 		}
-		if password := attr[csiapi.KeyStorePKCS12PasswordKey]; len(password) == 0 {
+		password := attr[csiapi.KeyStorePKCS12PasswordKey]
+		secret, hasSecret := attr[csiapi.KeyStorePKCS12PasswordSecretKey]
+		switch {
+		case hasSecret && len(password) > 0:
+			el = append(el, field.Invalid(path.Child(csiapi.KeyStorePKCS12PasswordSecretKey), secret,
+				fmt.Sprintf("cannot be set together with %q", csiapi.KeyStorePKCS12PasswordKey)))
+		case hasSecret:
+			for _, msg := range validation.IsDNS1123Subdomain(secret) {
+				el = append(el, field.Invalid(path.Child(csiapi.KeyStorePKCS12PasswordSecretKey), secret, msg))
+			}
+		case len(password) == 0:
 			el = append(el, field.Required(path.Child(csiapi.KeyStorePKCS12PasswordKey), "required attribute when PKCS12 KeyStore is enabled"))
 		}
 
@@ -200,6 +914,8 @@ func pkcs12Values(path *field.Path, attr map[string]string) field.ErrorList {
 			el = append(el, field.NotSupported(path.Child(csiapi.KeyStorePKCS12EnableKey), enable, []string{"true", "false"}))
 		}
 
+		el = append(el, boolValue(path.Child(csiapi.KeyStorePKCS12IncludeChainKey), attr[csiapi.KeyStorePKCS12IncludeChainKey])...)
+
 	} else {
 		// No PKCS12 attributes should be defined when PKCS12 is not defined.
 
@@ -212,6 +928,16 @@ func pkcs12Values(path *field.Path, attr map[string]string) field.ErrorList {
 			el = append(el, field.Invalid(path.Child(csiapi.KeyStorePKCS12PasswordKey), password,
 				fmt.Sprintf("cannot use attribute without %q set to %q or %q", csiapi.KeyStorePKCS12EnableKey, "true", "false")))
 		}
+
+		if secret, ok := attr[csiapi.KeyStorePKCS12PasswordSecretKey]; ok {
+			el = append(el, field.Invalid(path.Child(csiapi.KeyStorePKCS12PasswordSecretKey), secret,
+				fmt.Sprintf("cannot use attribute without %q set to %q or %q", csiapi.KeyStorePKCS12EnableKey, "true", "false")))
+		}
+
+		if includeChain, ok := attr[csiapi.KeyStorePKCS12IncludeChainKey]; ok {
+			el = append(el, field.Invalid(path.Child(csiapi.KeyStorePKCS12IncludeChainKey), includeChain,
+				fmt.Sprintf("cannot use attribute without %q set to %q or %q", csiapi.KeyStorePKCS12EnableKey, "true", "false")))
+		}
 	}
 
 	if len(el) > 0 {
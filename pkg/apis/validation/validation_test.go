@@ -17,10 +17,13 @@ limitations under the License.
 package validation
 
 import (
+	"maps"
+	"slices"
 	"testing"
 
 	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 
 	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
@@ -57,6 +60,63 @@ func Test_ValidateAttributes(t *testing.T) {
 				field.Required(field.NewPath("volumeAttributes", "csi.cert-manager.io/issuer-name"), "issuer-name is a required field"),
 			},
 		},
+		"built-in issuer group with an external kind should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:  "test-issuer",
+				csiapi.IssuerKindKey:  "AWSPCAIssuer",
+				csiapi.IssuerGroupKey: "cert-manager.io",
+				csiapi.CAFileKey:      "ca.crt",
+				csiapi.CertFileKey:    "crt.tls",
+				csiapi.KeyFileKey:     "key.tls",
+				csiapi.CommonNameKey:  "foo.bar",
+				csiapi.KeyEncodingKey: "PKCS1",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/issuer-kind"), "AWSPCAIssuer",
+					`issuer group "cert-manager.io" only supports the kinds "Issuer" and "ClusterIssuer"; if "AWSPCAIssuer" is an external issuer, set "csi.cert-manager.io/issuer-group" to its API group`),
+			},
+		},
+		"external kind without an issuer group should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:  "test-issuer",
+				csiapi.IssuerKindKey:  "AWSPCAIssuer",
+				csiapi.CAFileKey:      "ca.crt",
+				csiapi.CertFileKey:    "crt.tls",
+				csiapi.KeyFileKey:     "key.tls",
+				csiapi.CommonNameKey:  "foo.bar",
+				csiapi.KeyEncodingKey: "PKCS1",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/issuer-kind"), "AWSPCAIssuer",
+					`issuer group "cert-manager.io" only supports the kinds "Issuer" and "ClusterIssuer"; if "AWSPCAIssuer" is an external issuer, set "csi.cert-manager.io/issuer-group" to its API group`),
+			},
+		},
+		"external kind with an external issuer group should not error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:  "test-issuer",
+				csiapi.IssuerKindKey:  "AWSPCAIssuer",
+				csiapi.IssuerGroupKey: "awspca.cert-manager.io",
+				csiapi.CAFileKey:      "ca.crt",
+				csiapi.CertFileKey:    "crt.tls",
+				csiapi.KeyFileKey:     "key.tls",
+				csiapi.CommonNameKey:  "foo.bar",
+				csiapi.KeyEncodingKey: "PKCS1",
+			},
+			expErr: nil,
+		},
+		"built-in issuer group with ClusterIssuer kind should not error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:  "test-issuer",
+				csiapi.IssuerKindKey:  "ClusterIssuer",
+				csiapi.IssuerGroupKey: "cert-manager.io",
+				csiapi.CAFileKey:      "ca.crt",
+				csiapi.CertFileKey:    "crt.tls",
+				csiapi.KeyFileKey:     "key.tls",
+				csiapi.CommonNameKey:  "foo.bar",
+				csiapi.KeyEncodingKey: "PKCS1",
+			},
+			expErr: nil,
+		},
 		"valid attributes with common name should return no error": {
 			attr: map[string]string{
 				csiapi.IssuerNameKey:  "test-issuer",
@@ -101,58 +161,850 @@ func Test_ValidateAttributes(t *testing.T) {
 				csiapi.KeyUsagesKey:   "code signing  ,      email protection,    s/mime,ipsec end system",
 				csiapi.KeyEncodingKey: "PKCS1",
 			},
-			expErr: nil,
+			expErr: nil,
+		},
+		"attributes with wrong key usages should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:  "test-issuer",
+				csiapi.CAFileKey:      "ca.crt",
+				csiapi.CertFileKey:    "crt.tls",
+				csiapi.KeyFileKey:     "key.tls",
+				csiapi.DNSNamesKey:    "foo.bar.com,car.bar.com",
+				csiapi.KeyUsagesKey:   "foo,bar,hello world",
+				csiapi.KeyEncodingKey: "PKCS1",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/key-usages"), "foo", "not a valid key usage"),
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/key-usages"), "bar", "not a valid key usage"),
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/key-usages"), "hello world", "not a valid key usage"),
+			},
+		},
+		"bad duration and a bad bool value should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:   "test-issuer",
+				csiapi.CAFileKey:       "ca.crt",
+				csiapi.CertFileKey:     "crt.tls",
+				csiapi.KeyFileKey:      "key.tls",
+				csiapi.DurationKey:     "bad-duration",
+				csiapi.ReusePrivateKey: "FOO",
+				csiapi.KeyEncodingKey:  "PKCS1",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/duration"), "bad-duration", `must be a valid duration string: time: invalid duration "bad-duration"`),
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/reuse-private-key"), "FOO", `may only accept values of "true" or "false"`),
+			},
+		},
+		"invalid file permissions should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:             "test-issuer",
+				csiapi.CAFileKey:                 "ca.crt",
+				csiapi.CertFileKey:               "crt.tls",
+				csiapi.KeyFileKey:                "key.tls",
+				csiapi.KeyEncodingKey:            "PKCS1",
+				csiapi.CertificatePermissionsKey: "0644",
+				csiapi.PrivateKeyPermissionsKey:  "0800",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/privatekey-permissions"), "0800", "must be an octal file mode between 0000 and 0777"),
+			},
+		},
+		"empty file permissions should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:             "test-issuer",
+				csiapi.CAFileKey:                 "ca.crt",
+				csiapi.CertFileKey:               "crt.tls",
+				csiapi.KeyFileKey:                "key.tls",
+				csiapi.KeyEncodingKey:            "PKCS1",
+				csiapi.FileModeKey:               "",
+				csiapi.CertificatePermissionsKey: "",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/file-mode"), "", "must be an octal file mode between 0000 and 0777"),
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/certificate-permissions"), "", "must be an octal file mode between 0000 and 0777"),
+			},
+		},
+		"file permissions with output fifo should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:            "test-issuer",
+				csiapi.CAFileKey:                "ca.crt",
+				csiapi.CertFileKey:              "crt.tls",
+				csiapi.KeyFileKey:               "key.tls",
+				csiapi.KeyEncodingKey:           "PKCS1",
+				csiapi.OutputFIFOKey:            "true",
+				csiapi.PrivateKeyPermissionsKey: "0400",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/output-fifo"), "true",
+					"cannot be used with \"csi.cert-manager.io/privatekey-permissions\""),
+			},
+		},
+		"invalid file mode should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:  "test-issuer",
+				csiapi.CAFileKey:      "ca.crt",
+				csiapi.CertFileKey:    "crt.tls",
+				csiapi.KeyFileKey:     "key.tls",
+				csiapi.KeyEncodingKey: "PKCS1",
+				csiapi.FileModeKey:    "0999",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/file-mode"), "0999", "must be an octal file mode between 0000 and 0777"),
+			},
+		},
+		"file mode with output fifo should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:  "test-issuer",
+				csiapi.CAFileKey:      "ca.crt",
+				csiapi.CertFileKey:    "crt.tls",
+				csiapi.KeyFileKey:     "key.tls",
+				csiapi.KeyEncodingKey: "PKCS1",
+				csiapi.FileModeKey:    "0640",
+				csiapi.OutputFIFOKey:  "true",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/output-fifo"), "true", `cannot be used with "csi.cert-manager.io/file-mode"`),
+			},
+		},
+		"0777 file permissions should not error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:             "test-issuer",
+				csiapi.CAFileKey:                 "ca.crt",
+				csiapi.CertFileKey:               "crt.tls",
+				csiapi.KeyFileKey:                "key.tls",
+				csiapi.KeyEncodingKey:            "PKCS1",
+				csiapi.CertificatePermissionsKey: "777",
+			},
+			expErr: nil,
+		},
+		"out of range renew before percentage should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:            "test-issuer",
+				csiapi.CAFileKey:                "ca.crt",
+				csiapi.CertFileKey:              "crt.tls",
+				csiapi.KeyFileKey:               "key.tls",
+				csiapi.KeyEncodingKey:           "PKCS1",
+				csiapi.RenewBeforePercentageKey: "100",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/renew-before-percentage"), "100", "must be a whole number between 1 and 99"),
+			},
+		},
+		"renew before percentage together with renew before should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:            "test-issuer",
+				csiapi.CAFileKey:                "ca.crt",
+				csiapi.CertFileKey:              "crt.tls",
+				csiapi.KeyFileKey:               "key.tls",
+				csiapi.KeyEncodingKey:           "PKCS1",
+				csiapi.RenewBeforeKey:           "1h",
+				csiapi.RenewBeforePercentageKey: "30",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/renew-before-percentage"), "30", "cannot be set together with csi.cert-manager.io/renew-before"),
+			},
+		},
+		"invalid PKCS12 options should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:             "test-issuer",
+				csiapi.KeyEncodingKey:            "PKCS1",
+				csiapi.CAFileKey:                 "ca.crt",
+				csiapi.CertFileKey:               "crt.tls",
+				csiapi.KeyFileKey:                "key.tls",
+				csiapi.KeyStorePKCS12FileKey:     "../crt.p12",
+				csiapi.KeyStorePKCS12PasswordKey: "password",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/pkcs12-filename"), "../crt.p12",
+					`filename must not start with '..'`),
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/pkcs12-filename"), "../crt.p12",
+					`filename must not include '/'`),
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/pkcs12-filename"), "../crt.p12",
+					"cannot use attribute without \"csi.cert-manager.io/pkcs12-enable\" set to \"true\" or \"false\""),
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/pkcs12-password"), "password",
+					"cannot use attribute without \"csi.cert-manager.io/pkcs12-enable\" set to \"true\" or \"false\""),
+			},
+		},
+		"invalid PKCS12 include chain options should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:                 "test-issuer",
+				csiapi.KeyEncodingKey:                "PKCS1",
+				csiapi.CAFileKey:                     "ca.crt",
+				csiapi.CertFileKey:                   "crt.tls",
+				csiapi.KeyFileKey:                    "key.tls",
+				csiapi.KeyStorePKCS12EnableKey:       "true",
+				csiapi.KeyStorePKCS12FileKey:         "crt.p12",
+				csiapi.KeyStorePKCS12PasswordKey:     "password",
+				csiapi.KeyStorePKCS12IncludeChainKey: "yes",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/pkcs12-include-chain"), "yes", `may only accept values of "true" or "false"`),
+			},
+		},
+		"PKCS12 include chain without PKCS12 enabled should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:                 "test-issuer",
+				csiapi.KeyEncodingKey:                "PKCS1",
+				csiapi.CAFileKey:                     "ca.crt",
+				csiapi.CertFileKey:                   "crt.tls",
+				csiapi.KeyFileKey:                    "key.tls",
+				csiapi.KeyStorePKCS12IncludeChainKey: "true",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/pkcs12-include-chain"), "true",
+					"cannot use attribute without \"csi.cert-manager.io/pkcs12-enable\" set to \"true\" or \"false\""),
+			},
+		},
+		"valid combined format should not error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:     "test-issuer",
+				csiapi.KeyEncodingKey:    "PKCS1",
+				csiapi.CAFileKey:         "ca.crt",
+				csiapi.CertFileKey:       "crt.tls",
+				csiapi.KeyFileKey:        "key.tls",
+				csiapi.CombinedFormatKey: "haproxy",
+				csiapi.CombinedFileKey:   "haproxy.pem",
+			},
+			expErr: nil,
+		},
+		"invalid combined options should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:     "test-issuer",
+				csiapi.KeyEncodingKey:    "PKCS1",
+				csiapi.CAFileKey:         "ca.crt",
+				csiapi.CertFileKey:       "crt.tls",
+				csiapi.KeyFileKey:        "key.tls",
+				csiapi.CombinedFormatKey: "apache",
+				csiapi.CombinedFileKey:   "crt.tls",
+			},
+			expErr: field.ErrorList{
+				field.NotSupported(field.NewPath("volumeAttributes", "csi.cert-manager.io/combined-format"), "apache", []string{"haproxy", "nginx", "postgres"}),
+				field.Duplicate(field.NewPath("volumeAttributes", "csi.cert-manager.io/certificate-file"), "crt.tls"),
+				field.Duplicate(field.NewPath("volumeAttributes", "csi.cert-manager.io/combined-file"), "crt.tls"),
+			},
+		},
+		"combined file without combined format should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:   "test-issuer",
+				csiapi.KeyEncodingKey:  "PKCS1",
+				csiapi.CAFileKey:       "ca.crt",
+				csiapi.CertFileKey:     "crt.tls",
+				csiapi.KeyFileKey:      "key.tls",
+				csiapi.CombinedFileKey: "combined.pem",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/combined-file"), "combined.pem",
+					"cannot use attribute without \"csi.cert-manager.io/combined-format\" set"),
+			},
+		},
+		"valid issuer dn file should not error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:   "test-issuer",
+				csiapi.KeyEncodingKey:  "PKCS1",
+				csiapi.CAFileKey:       "ca.crt",
+				csiapi.CertFileKey:     "crt.tls",
+				csiapi.KeyFileKey:      "key.tls",
+				csiapi.IssuerDNFileKey: "issuer-dn",
+			},
+			expErr: nil,
+		},
+		"invalid issuer dn file should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:   "test-issuer",
+				csiapi.KeyEncodingKey:  "PKCS1",
+				csiapi.CAFileKey:       "ca.crt",
+				csiapi.CertFileKey:     "crt.tls",
+				csiapi.KeyFileKey:      "key.tls",
+				csiapi.IssuerDNFileKey: "../issuer-dn",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/issuer-dn-file"), "../issuer-dn", "filename must not start with '..'"),
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/issuer-dn-file"), "../issuer-dn", "filename must not include '/'"),
+			},
+		},
+		"empty issuer dn file should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:   "test-issuer",
+				csiapi.KeyEncodingKey:  "PKCS1",
+				csiapi.CAFileKey:       "ca.crt",
+				csiapi.CertFileKey:     "crt.tls",
+				csiapi.KeyFileKey:      "key.tls",
+				csiapi.IssuerDNFileKey: "",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/issuer-dn-file"), "", "filename must not be empty"),
+			},
+		},
+		"issuer dn file clashing with certificate file should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:   "test-issuer",
+				csiapi.KeyEncodingKey:  "PKCS1",
+				csiapi.CAFileKey:       "ca.crt",
+				csiapi.CertFileKey:     "crt.tls",
+				csiapi.KeyFileKey:      "key.tls",
+				csiapi.IssuerDNFileKey: "crt.tls",
+			},
+			expErr: field.ErrorList{
+				field.Duplicate(field.NewPath("volumeAttributes", "csi.cert-manager.io/certificate-file"), "crt.tls"),
+				field.Duplicate(field.NewPath("volumeAttributes", "csi.cert-manager.io/issuer-dn-file"), "crt.tls"),
+			},
+		},
+		"combined pem file should not error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:      "test-issuer",
+				csiapi.KeyEncodingKey:     "PKCS1",
+				csiapi.CAFileKey:          "ca.crt",
+				csiapi.CertFileKey:        "crt.tls",
+				csiapi.KeyFileKey:         "key.tls",
+				csiapi.CombinedPEMFileKey: "tls-combined.pem",
+			},
+			expErr: nil,
+		},
+		"empty combined pem file should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:      "test-issuer",
+				csiapi.KeyEncodingKey:     "PKCS1",
+				csiapi.CAFileKey:          "ca.crt",
+				csiapi.CertFileKey:        "crt.tls",
+				csiapi.KeyFileKey:         "key.tls",
+				csiapi.CombinedPEMFileKey: "",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/combined-pem-file"), "", "filename must not be empty"),
+			},
+		},
+		"combined pem file clashing with private key file should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:      "test-issuer",
+				csiapi.KeyEncodingKey:     "PKCS1",
+				csiapi.CAFileKey:          "ca.crt",
+				csiapi.CertFileKey:        "crt.tls",
+				csiapi.KeyFileKey:         "key.tls",
+				csiapi.CombinedPEMFileKey: "key.tls",
+			},
+			expErr: field.ErrorList{
+				field.Duplicate(field.NewPath("volumeAttributes", "csi.cert-manager.io/combined-pem-file"), "key.tls"),
+				field.Duplicate(field.NewPath("volumeAttributes", "csi.cert-manager.io/privatekey-file"), "key.tls"),
+			},
+		},
+		"combined pem file with output fifo should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:      "test-issuer",
+				csiapi.KeyEncodingKey:     "PKCS1",
+				csiapi.CAFileKey:          "ca.crt",
+				csiapi.CertFileKey:        "crt.tls",
+				csiapi.KeyFileKey:         "key.tls",
+				csiapi.CombinedPEMFileKey: "tls-combined.pem",
+				csiapi.OutputFIFOKey:      "true",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/output-fifo"), "true", `cannot be used with "csi.cert-manager.io/combined-pem-file"`),
+			},
+		},
+		"empty last renewal file should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:      "test-issuer",
+				csiapi.KeyEncodingKey:     "PKCS1",
+				csiapi.CAFileKey:          "ca.crt",
+				csiapi.CertFileKey:        "crt.tls",
+				csiapi.KeyFileKey:         "key.tls",
+				csiapi.LastRenewalFileKey: "",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/last-renewal-file"), "", "filename must not be empty"),
+			},
+		},
+		"trust bundle file which is the CA file should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:      "test-issuer",
+				csiapi.KeyEncodingKey:     "PKCS1",
+				csiapi.CAFileKey:          "ca.crt",
+				csiapi.CertFileKey:        "crt.tls",
+				csiapi.KeyFileKey:         "key.tls",
+				csiapi.TrustBundleFileKey: "ca.crt",
+			},
+			expErr: field.ErrorList{
+				field.Duplicate(field.NewPath("volumeAttributes", "csi.cert-manager.io/ca-file"), "ca.crt"),
+				field.Duplicate(field.NewPath("volumeAttributes", "csi.cert-manager.io/trust-bundle-file"), "ca.crt"),
+			},
+		},
+		"invalid cert info file should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:   "test-issuer",
+				csiapi.KeyEncodingKey:  "PKCS1",
+				csiapi.CAFileKey:       "ca.crt",
+				csiapi.CertFileKey:     "crt.tls",
+				csiapi.KeyFileKey:      "key.tls",
+				csiapi.CertInfoFileKey: "info/cert.txt",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/cert-info-file"), "info/cert.txt", "filename must not include '/'"),
+			},
+		},
+		"cert info file clashing with issuer dn file should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:   "test-issuer",
+				csiapi.KeyEncodingKey:  "PKCS1",
+				csiapi.CAFileKey:       "ca.crt",
+				csiapi.CertFileKey:     "crt.tls",
+				csiapi.KeyFileKey:      "key.tls",
+				csiapi.IssuerDNFileKey: "info",
+				csiapi.CertInfoFileKey: "info",
+			},
+			expErr: field.ErrorList{
+				field.Duplicate(field.NewPath("volumeAttributes", "csi.cert-manager.io/cert-info-file"), "info"),
+				field.Duplicate(field.NewPath("volumeAttributes", "csi.cert-manager.io/issuer-dn-file"), "info"),
+			},
+		},
+		"empty preferred chain should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:     "test-issuer",
+				csiapi.KeyEncodingKey:    "PKCS1",
+				csiapi.CAFileKey:         "ca.crt",
+				csiapi.CertFileKey:       "crt.tls",
+				csiapi.KeyFileKey:        "key.tls",
+				csiapi.PreferredChainKey: " ",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/preferred-chain"), " ", "must be the common name of a CA"),
+			},
+		},
+		"secret-tls file layout should not error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:  "test-issuer",
+				csiapi.KeyEncodingKey: "PKCS1",
+				csiapi.CAFileKey:      "ca.crt",
+				csiapi.CertFileKey:    "tls.crt",
+				csiapi.KeyFileKey:     "tls.key",
+				csiapi.FileLayoutKey:  "secret-tls",
+			},
+			expErr: nil,
+		},
+		"go-tls file layout with skip cert verification should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:           "test-issuer",
+				csiapi.KeyEncodingKey:          "PKCS1",
+				csiapi.CAFileKey:               "ca.crt",
+				csiapi.CertFileKey:             "cert.pem",
+				csiapi.KeyFileKey:              "key.pem",
+				csiapi.SkipCertVerificationKey: "true",
+				csiapi.FileLayoutKey:           "go-tls",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/file-layout"), "go-tls",
+					"cannot be used with \"csi.cert-manager.io/skip-cert-verification\" set to \"true\""),
+			},
+		},
+		"unknown file layout should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:  "test-issuer",
+				csiapi.KeyEncodingKey: "PKCS1",
+				csiapi.CAFileKey:      "ca.crt",
+				csiapi.CertFileKey:    "tls.crt",
+				csiapi.KeyFileKey:     "tls.key",
+				csiapi.FileLayoutKey:  "opaque",
+			},
+			expErr: field.ErrorList{
+				field.NotSupported(field.NewPath("volumeAttributes", "csi.cert-manager.io/file-layout"), "opaque", []string{"secret-tls", "go-tls"}),
+			},
+		},
+		"secret-tls file layout with custom files should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:     "test-issuer",
+				csiapi.KeyEncodingKey:    "PKCS1",
+				csiapi.CAFileKey:         "ca.crt",
+				csiapi.CertFileKey:       "crt.tls",
+				csiapi.KeyFileKey:        "tls.key",
+				csiapi.CombinedFormatKey: "haproxy",
+				csiapi.CombinedFileKey:   "combined.pem",
+				csiapi.OutputFIFOKey:     "true",
+				csiapi.FileLayoutKey:     "secret-tls",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/output-fifo"), "true",
+					"cannot be used with \"csi.cert-manager.io/combined-format\""),
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/certificate-file"), "crt.tls",
+					"must be \"tls.crt\" when \"csi.cert-manager.io/file-layout\" is \"secret-tls\""),
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/file-layout"), "secret-tls",
+					"cannot be used with \"csi.cert-manager.io/combined-format\""),
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/file-layout"), "secret-tls",
+					"cannot be used with \"csi.cert-manager.io/output-fifo\" set to \"true\""),
+			},
+		},
+		"output fifo with keystore outputs should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:             "test-issuer",
+				csiapi.KeyEncodingKey:            "PKCS1",
+				csiapi.CAFileKey:                 "ca.crt",
+				csiapi.CertFileKey:               "crt.tls",
+				csiapi.KeyFileKey:                "key.tls",
+				csiapi.ReusePrivateKey:           "true",
+				csiapi.KeyStorePKCS12EnableKey:   "true",
+				csiapi.KeyStorePKCS12FileKey:     "keystore.p12",
+				csiapi.KeyStorePKCS12PasswordKey: "password",
+				csiapi.CombinedFormatKey:         "haproxy",
+				csiapi.CombinedFileKey:           "combined.pem",
+				csiapi.OutputFIFOKey:             "true",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/output-fifo"), "true",
+					"cannot be used with \"csi.cert-manager.io/pkcs12-enable\" set to \"true\""),
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/output-fifo"), "true",
+					"cannot be used with \"csi.cert-manager.io/reuse-private-key\" set to \"true\""),
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/output-fifo"), "true",
+					"cannot be used with \"csi.cert-manager.io/combined-format\""),
+			},
+		},
+		"post-issue cooldown which is too long should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:        "test-issuer",
+				csiapi.KeyEncodingKey:       "PKCS1",
+				csiapi.CAFileKey:            "ca.crt",
+				csiapi.CertFileKey:          "crt.tls",
+				csiapi.KeyFileKey:           "key.tls",
+				csiapi.PostIssueCooldownKey: "1h",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/post-issue-cooldown"), "1h", "must be a positive duration no longer than 10m0s"),
+			},
+		},
+		"post-issue cooldown which is negative should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:        "test-issuer",
+				csiapi.KeyEncodingKey:       "PKCS1",
+				csiapi.CAFileKey:            "ca.crt",
+				csiapi.CertFileKey:          "crt.tls",
+				csiapi.KeyFileKey:           "key.tls",
+				csiapi.PostIssueCooldownKey: "-30s",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/post-issue-cooldown"), "-30s", "must be a positive duration no longer than 10m0s"),
+			},
+		},
+		"valid request timeout should not error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:     "test-issuer",
+				csiapi.KeyEncodingKey:    "PKCS1",
+				csiapi.CAFileKey:         "ca.crt",
+				csiapi.CertFileKey:       "crt.tls",
+				csiapi.KeyFileKey:        "key.tls",
+				csiapi.RequestTimeoutKey: "15m",
+			},
+			expErr: nil,
+		},
+		"request timeout which is not a duration should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:     "test-issuer",
+				csiapi.KeyEncodingKey:    "PKCS1",
+				csiapi.CAFileKey:         "ca.crt",
+				csiapi.CertFileKey:       "crt.tls",
+				csiapi.KeyFileKey:        "key.tls",
+				csiapi.RequestTimeoutKey: "soon",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/request-timeout"), "soon", `must be a valid duration string: time: invalid duration "soon"`),
+			},
+		},
+		"request timeout which is not positive should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:     "test-issuer",
+				csiapi.KeyEncodingKey:    "PKCS1",
+				csiapi.CAFileKey:         "ca.crt",
+				csiapi.CertFileKey:       "crt.tls",
+				csiapi.KeyFileKey:        "key.tls",
+				csiapi.RequestTimeoutKey: "0s",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/request-timeout"), "0s", "must be a positive duration"),
+			},
+		},
+		"ACME attributes with unsupported or conflicting keys should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:                     "test-issuer",
+				csiapi.KeyEncodingKey:                    "PKCS1",
+				csiapi.CAFileKey:                         "ca.crt",
+				csiapi.CertFileKey:                       "crt.tls",
+				csiapi.KeyFileKey:                        "key.tls",
+				csiapi.ACMEHTTP01IngressNameOverrideKey:  "my-ingress",
+				csiapi.ACMEHTTP01IngressClassOverrideKey: "nginx",
+				"csi.cert-manager.io/acme-http01-solver": "true",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/acme-http01-solver"), "true",
+					`unsupported ACME attribute, supported attributes are ["csi.cert-manager.io/acme-http01-override-ingress-class" "csi.cert-manager.io/acme-http01-override-ingress-name"]`),
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/acme-http01-override-ingress-class"), "nginx",
+					`cannot be used with "csi.cert-manager.io/acme-http01-override-ingress-name"`),
+			},
+		},
+		"unsupported require-exact-sans mode should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:       "test-issuer",
+				csiapi.KeyEncodingKey:      "PKCS1",
+				csiapi.CAFileKey:           "ca.crt",
+				csiapi.CertFileKey:         "crt.tls",
+				csiapi.KeyFileKey:          "key.tls",
+				csiapi.RequireExactSANsKey: "true",
+			},
+			expErr: field.ErrorList{
+				field.NotSupported(field.NewPath("volumeAttributes", "csi.cert-manager.io/require-exact-sans"), "true", []string{"superset", "exact"}),
+			},
+		},
+		"unsupported priority should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:  "test-issuer",
+				csiapi.KeyEncodingKey: "PKCS1",
+				csiapi.CAFileKey:      "ca.crt",
+				csiapi.CertFileKey:    "crt.tls",
+				csiapi.KeyFileKey:     "key.tls",
+				csiapi.PriorityKey:    "urgent",
+			},
+			expErr: field.ErrorList{
+				field.NotSupported(field.NewPath("volumeAttributes", "csi.cert-manager.io/priority"), "urgent", []string{"high", "normal", "low"}),
+			},
+		},
+		"valid annotations and labels should not error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:  "test-issuer",
+				csiapi.KeyEncodingKey: "PKCS1",
+				csiapi.CAFileKey:      "ca.crt",
+				csiapi.CertFileKey:    "crt.tls",
+				csiapi.KeyFileKey:     "key.tls",
+				csiapi.AnnotationsKey: "policy.example.com/team=payments, note=a b",
+				csiapi.LabelsKey:      "team=payments",
+			},
+			expErr: nil,
+		},
+		"malformed annotations should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:  "test-issuer",
+				csiapi.KeyEncodingKey: "PKCS1",
+				csiapi.CAFileKey:      "ca.crt",
+				csiapi.CertFileKey:    "crt.tls",
+				csiapi.KeyFileKey:     "key.tls",
+				csiapi.AnnotationsKey: "team=payments,team",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/annotations"), "team=payments,team",
+					`must be a comma separated list of key=value pairs, got "team"`),
+			},
+		},
+		"duplicate label keys should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:  "test-issuer",
+				csiapi.KeyEncodingKey: "PKCS1",
+				csiapi.CAFileKey:      "ca.crt",
+				csiapi.CertFileKey:    "crt.tls",
+				csiapi.KeyFileKey:     "key.tls",
+				csiapi.LabelsKey:      "team=a,team=b",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/labels"), "team=a,team=b",
+					`key "team" is given more than once`),
+			},
+		},
+		"reserved annotation and label keys should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:  "test-issuer",
+				csiapi.KeyEncodingKey: "PKCS1",
+				csiapi.CAFileKey:      "ca.crt",
+				csiapi.CertFileKey:    "crt.tls",
+				csiapi.KeyFileKey:     "key.tls",
+				csiapi.AnnotationsKey: "csi.cert-manager.io/priority=low",
+				csiapi.LabelsKey:      "app.kubernetes.io/managed-by=me,cert-manager.io/foo=bar",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/annotations"), "csi.cert-manager.io/priority=low",
+					`key "csi.cert-manager.io/priority" is reserved for use by the driver and cert-manager`),
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/labels"), "app.kubernetes.io/managed-by=me,cert-manager.io/foo=bar",
+					`key "app.kubernetes.io/managed-by" is reserved for use by the driver and cert-manager`),
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/labels"), "app.kubernetes.io/managed-by=me,cert-manager.io/foo=bar",
+					`key "cert-manager.io/foo" is reserved for use by the driver and cert-manager`),
+			},
+		},
+		"invalid label keys and values should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:  "test-issuer",
+				csiapi.KeyEncodingKey: "PKCS1",
+				csiapi.CAFileKey:      "ca.crt",
+				csiapi.CertFileKey:    "crt.tls",
+				csiapi.KeyFileKey:     "key.tls",
+				csiapi.LabelsKey:      "team=a b",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/labels"), "team=a b",
+					`value of key "team": a valid label must be an empty string or consist of alphanumeric characters, '-', '_' or '.', and must start and end with an alphanumeric character (e.g. 'MyValue',  or 'my_value',  or '12345', regex used for validation is '(([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9])?')`),
+			},
+		},
+		"token audiences should not error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:     "test-issuer",
+				csiapi.KeyEncodingKey:    "PKCS1",
+				csiapi.CAFileKey:         "ca.crt",
+				csiapi.CertFileKey:       "crt.tls",
+				csiapi.KeyFileKey:        "key.tls",
+				csiapi.TokenAudiencesKey: "sts.amazonaws.com, vault",
+			},
+			expErr: nil,
+		},
+		"empty token audiences should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:     "test-issuer",
+				csiapi.KeyEncodingKey:    "PKCS1",
+				csiapi.CAFileKey:         "ca.crt",
+				csiapi.CertFileKey:       "crt.tls",
+				csiapi.KeyFileKey:        "key.tls",
+				csiapi.TokenAudiencesKey: "vault,,sts.amazonaws.com",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/token-audiences"), "vault,,sts.amazonaws.com",
+					"must be a comma separated list of non-empty audiences"),
+			},
+		},
+		"duplicate token audiences should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:     "test-issuer",
+				csiapi.KeyEncodingKey:    "PKCS1",
+				csiapi.CAFileKey:         "ca.crt",
+				csiapi.CertFileKey:       "crt.tls",
+				csiapi.KeyFileKey:        "key.tls",
+				csiapi.TokenAudiencesKey: "vault,vault",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/token-audiences"), "vault,vault",
+					`audience "vault" is given more than once`),
+			},
 		},
-		"attributes with wrong key usages should error": {
+		"non-boolean dry-run should error": {
 			attr: map[string]string{
 				csiapi.IssuerNameKey:  "test-issuer",
+				csiapi.KeyEncodingKey: "PKCS1",
 				csiapi.CAFileKey:      "ca.crt",
 				csiapi.CertFileKey:    "crt.tls",
 				csiapi.KeyFileKey:     "key.tls",
-				csiapi.DNSNamesKey:    "foo.bar.com,car.bar.com",
-				csiapi.KeyUsagesKey:   "foo,bar,hello world",
-				csiapi.KeyEncodingKey: "PKCS1",
+				csiapi.DryRunKey:      "yes",
 			},
 			expErr: field.ErrorList{
-				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/key-usages"), "foo", "not a valid key usage"),
-				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/key-usages"), "bar", "not a valid key usage"),
-				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/key-usages"), "hello world", "not a valid key usage"),
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/dry-run"), "yes",
+					`may only accept values of "true" or "false"`),
 			},
 		},
-		"bad duration and a bad bool value should error": {
+		"supported key algorithms and sizes should not error": {
 			attr: map[string]string{
 				csiapi.IssuerNameKey:   "test-issuer",
+				csiapi.KeyEncodingKey:  "PKCS8",
 				csiapi.CAFileKey:       "ca.crt",
 				csiapi.CertFileKey:     "crt.tls",
 				csiapi.KeyFileKey:      "key.tls",
-				csiapi.DurationKey:     "bad-duration",
-				csiapi.ReusePrivateKey: "FOO",
+				csiapi.KeyAlgorithmKey: "ECDSA",
+				csiapi.KeySizeKey:      "384",
+			},
+			expErr: nil,
+		},
+		"unsupported key algorithm should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:   "test-issuer",
 				csiapi.KeyEncodingKey:  "PKCS1",
+				csiapi.CAFileKey:       "ca.crt",
+				csiapi.CertFileKey:     "crt.tls",
+				csiapi.KeyFileKey:      "key.tls",
+				csiapi.KeyAlgorithmKey: "DSA",
 			},
 			expErr: field.ErrorList{
-				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/duration"), "bad-duration", `must be a valid duration string: time: invalid duration "bad-duration"`),
-				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/reuse-private-key"), "FOO", `may only accept values of "true" or "false"`),
+				field.NotSupported(field.NewPath("volumeAttributes", "csi.cert-manager.io/key-algorithm"), "DSA", []string{"RSA", "ECDSA", "Ed25519"}),
 			},
 		},
-		"invalid PKCS12 options should error": {
+		"invalid RSA key size should error": {
 			attr: map[string]string{
-				csiapi.IssuerNameKey:             "test-issuer",
-				csiapi.KeyEncodingKey:            "PKCS1",
-				csiapi.CAFileKey:                 "ca.crt",
-				csiapi.CertFileKey:               "crt.tls",
-				csiapi.KeyFileKey:                "key.tls",
-				csiapi.KeyStorePKCS12FileKey:     "../crt.p12",
-				csiapi.KeyStorePKCS12PasswordKey: "password",
+				csiapi.IssuerNameKey:   "test-issuer",
+				csiapi.KeyEncodingKey:  "PKCS1",
+				csiapi.CAFileKey:       "ca.crt",
+				csiapi.CertFileKey:     "crt.tls",
+				csiapi.KeyFileKey:      "key.tls",
+				csiapi.KeyAlgorithmKey: "RSA",
+				csiapi.KeySizeKey:      "123",
 			},
 			expErr: field.ErrorList{
-				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/pkcs12-filename"), "../crt.p12",
-					`filename must not start with '..'`),
-				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/pkcs12-filename"), "../crt.p12",
-					`filename must not include '/'`),
-				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/pkcs12-filename"), "../crt.p12",
-					"cannot use attribute without \"csi.cert-manager.io/pkcs12-enable\" set to \"true\" or \"false\""),
-				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/pkcs12-password"), "password",
-					"cannot use attribute without \"csi.cert-manager.io/pkcs12-enable\" set to \"true\" or \"false\""),
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/key-size"), "123", "must be a whole number of bits between 2048 and 8192 for RSA keys"),
+			},
+		},
+		"unsupported ECDSA key size should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:   "test-issuer",
+				csiapi.KeyEncodingKey:  "PKCS1",
+				csiapi.CAFileKey:       "ca.crt",
+				csiapi.CertFileKey:     "crt.tls",
+				csiapi.KeyFileKey:      "key.tls",
+				csiapi.KeyAlgorithmKey: "ECDSA",
+				csiapi.KeySizeKey:      "2048",
+			},
+			expErr: field.ErrorList{
+				field.NotSupported(field.NewPath("volumeAttributes", "csi.cert-manager.io/key-size"), "2048", []string{"256", "384", "521"}),
+			},
+		},
+		"unsupported on-key-read-error mode should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:     "test-issuer",
+				csiapi.KeyEncodingKey:    "PKCS1",
+				csiapi.CAFileKey:         "ca.crt",
+				csiapi.CertFileKey:       "crt.tls",
+				csiapi.KeyFileKey:        "key.tls",
+				csiapi.ReusePrivateKey:   "true",
+				csiapi.OnKeyReadErrorKey: "ignore",
+			},
+			expErr: field.ErrorList{
+				field.NotSupported(field.NewPath("volumeAttributes", "csi.cert-manager.io/on-key-read-error"), "ignore", []string{"regenerate", "fail"}),
+			},
+		},
+		"on-key-read-error without reuse-private-key should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:     "test-issuer",
+				csiapi.KeyEncodingKey:    "PKCS1",
+				csiapi.CAFileKey:         "ca.crt",
+				csiapi.CertFileKey:       "crt.tls",
+				csiapi.KeyFileKey:        "key.tls",
+				csiapi.OnKeyReadErrorKey: "fail",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/on-key-read-error"), "fail", "may only be set when csi.cert-manager.io/reuse-private-key is true"),
+			},
+		},
+		"skip-cert-verification which is not a boolean should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:           "test-issuer",
+				csiapi.KeyEncodingKey:          "PKCS1",
+				csiapi.CAFileKey:               "ca.crt",
+				csiapi.CertFileKey:             "crt.tls",
+				csiapi.KeyFileKey:              "key.tls",
+				csiapi.SkipCertVerificationKey: "yes",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/skip-cert-verification"), "yes", `may only accept values of "true" or "false"`),
+			},
+		},
+		"skip-cert-verification with require-exact-sans should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:           "test-issuer",
+				csiapi.KeyEncodingKey:          "PKCS1",
+				csiapi.CAFileKey:               "ca.crt",
+				csiapi.CertFileKey:             "crt.tls",
+				csiapi.KeyFileKey:              "key.tls",
+				csiapi.RequireExactSANsKey:     "exact",
+				csiapi.SkipCertVerificationKey: "true",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/skip-cert-verification"), "true", "cannot skip certificate verification when csi.cert-manager.io/require-exact-sans is set"),
+			},
+		},
+		"output fifo which is not a boolean should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:  "test-issuer",
+				csiapi.KeyEncodingKey: "PKCS1",
+				csiapi.CAFileKey:      "ca.crt",
+				csiapi.CertFileKey:    "crt.tls",
+				csiapi.KeyFileKey:     "key.tls",
+				csiapi.OutputFIFOKey:  "yes",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/output-fifo"), "yes", `may only accept values of "true" or "false"`),
 			},
 		},
 		"setting output filenames which are duplicated should error": {
@@ -215,6 +1067,101 @@ func Test_ValidateAttributes(t *testing.T) {
 			},
 			expErr: nil,
 		},
+		"san-critical set to true with DNS names should not error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:  "test-issuer",
+				csiapi.CAFileKey:      "ca.crt",
+				csiapi.CertFileKey:    "crt.tls",
+				csiapi.KeyFileKey:     "key.tls",
+				csiapi.CommonNameKey:  "foo.bar",
+				csiapi.DNSNamesKey:    "foo.bar.com",
+				csiapi.SANCriticalKey: "true",
+				csiapi.KeyEncodingKey: "PKCS1",
+			},
+			expErr: nil,
+		},
+		"san-critical with a bad bool value should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:  "test-issuer",
+				csiapi.CAFileKey:      "ca.crt",
+				csiapi.CertFileKey:    "crt.tls",
+				csiapi.KeyFileKey:     "key.tls",
+				csiapi.DNSNamesKey:    "foo.bar.com",
+				csiapi.SANCriticalKey: "yes",
+				csiapi.KeyEncodingKey: "PKCS1",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/san-critical"), "yes", `may only accept values of "true" or "false"`),
+			},
+		},
+		"san-critical set to true without SANs should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:  "test-issuer",
+				csiapi.CAFileKey:      "ca.crt",
+				csiapi.CertFileKey:    "crt.tls",
+				csiapi.KeyFileKey:     "key.tls",
+				csiapi.CommonNameKey:  "foo.bar",
+				csiapi.SANCriticalKey: "true",
+				csiapi.KeyEncodingKey: "PKCS1",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/san-critical"), "true", "cannot mark subjectAltName extension as critical when no SANs are requested"),
+			},
+		},
+		"san-critical set to false with an empty subject should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:  "test-issuer",
+				csiapi.CAFileKey:      "ca.crt",
+				csiapi.CertFileKey:    "crt.tls",
+				csiapi.KeyFileKey:     "key.tls",
+				csiapi.DNSNamesKey:    "foo.bar.com",
+				csiapi.SANCriticalKey: "false",
+				csiapi.KeyEncodingKey: "PKCS1",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/san-critical"), "false", "subjectAltName extension must be critical when the subject is empty"),
+			},
+		},
+		"unsupported encoding should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:  "test-issuer",
+				csiapi.CAFileKey:      "ca.crt",
+				csiapi.CertFileKey:    "crt.tls",
+				csiapi.KeyFileKey:     "key.tls",
+				csiapi.KeyEncodingKey: "PKCS1",
+				csiapi.EncodingKey:    "BER",
+			},
+			expErr: field.ErrorList{
+				field.NotSupported(field.NewPath("volumeAttributes", "csi.cert-manager.io/encoding"), "BER", []string{"PEM", "DER"}),
+			},
+		},
+		"DER encoding with a file layout should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:  "test-issuer",
+				csiapi.CAFileKey:      "ca.crt",
+				csiapi.CertFileKey:    "tls.crt",
+				csiapi.KeyFileKey:     "tls.key",
+				csiapi.KeyEncodingKey: "PKCS1",
+				csiapi.FileLayoutKey:  "secret-tls",
+				csiapi.EncodingKey:    "DER",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/encoding"), "DER", `cannot be used with "csi.cert-manager.io/file-layout"`),
+			},
+		},
+		"invalid IP SANs should error naming the invalid entries": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:  "test-issuer",
+				csiapi.CAFileKey:      "ca.crt",
+				csiapi.CertFileKey:    "crt.tls",
+				csiapi.KeyFileKey:     "key.tls",
+				csiapi.IPSANsKey:      "10.0.0.1, 10.0.0.300,foo",
+				csiapi.KeyEncodingKey: "PKCS1",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(field.NewPath("volumeAttributes", "csi.cert-manager.io/ip-sans"), "10.0.0.1, 10.0.0.300,foo", `must be a comma separated list of IP addresses, invalid entries: ["10.0.0.300" "foo"]`),
+			},
+		},
 	}
 
 	for name, test := range tests {
@@ -224,6 +1171,124 @@ func Test_ValidateAttributes(t *testing.T) {
 	}
 }
 
+func Test_ValidateAttributeKeys(t *testing.T) {
+	path := field.NewPath("volumeAttributes")
+
+	tests := map[string]struct {
+		attr   map[string]string
+		expErr field.ErrorList
+	}{
+		"known attributes should not error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:                    "test-issuer",
+				csiapi.DNSNamesKey:                      "foo.bar.com",
+				csiapi.ACMEHTTP01IngressNameOverrideKey: "my-ingress",
+			},
+			expErr: nil,
+		},
+		"attributes without the driver prefix should not error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:                   "test-issuer",
+				csiapi.K8sVolumeContextKeyPodNamespace: "my-namespace",
+				"example.com/foo":                      "bar",
+			},
+			expErr: nil,
+		},
+		"mistyped attribute should error with a suggestion": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:           "test-issuer",
+				"csi.cert-manager.io/dns-name": "foo.bar.com",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(path.Child("csi.cert-manager.io/dns-name"), "foo.bar.com", `unknown attribute, did you mean "csi.cert-manager.io/dns-names"?`),
+			},
+		},
+		"unknown attributes should error in order": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:            "test-issuer",
+				"csi.cert-manager.io/zzz":       "a",
+				"csi.cert-manager.io/something": "b",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(path.Child("csi.cert-manager.io/something"), "b", "unknown attribute"),
+				field.Invalid(path.Child("csi.cert-manager.io/zzz"), "a", "unknown attribute"),
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.EqualValues(t, test.expErr, ValidateAttributeKeys(test.attr))
+		})
+	}
+}
+
+func Test_ValidatePodInfo(t *testing.T) {
+	hint := "pod information is missing from the volume context, set podInfoOnMount: true on the CSIDriver object"
+	path := field.NewPath("volumeContext")
+
+	tests := map[string]struct {
+		attr         map[string]string
+		requiredKeys []string
+		expErr       field.ErrorList
+	}{
+		"pod namespace without templating should not error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:                   "test-issuer",
+				csiapi.DNSNamesKey:                     "foo.bar.com",
+				csiapi.K8sVolumeContextKeyPodNamespace: "my-namespace",
+			},
+			expErr: nil,
+		},
+		"missing pod namespace should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey: "test-issuer",
+				csiapi.DNSNamesKey:   "foo.bar.com",
+			},
+			expErr: field.ErrorList{
+				field.Required(path.Child("csi.storage.k8s.io/pod.namespace"), "the CertificateRequest is created in the pod namespace: "+hint),
+			},
+		},
+		"templated pod fields which are present should not error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:                   "test-issuer",
+				csiapi.DNSNamesKey:                     "${POD_NAME}.${POD_NAMESPACE}.svc",
+				csiapi.K8sVolumeContextKeyPodName:      "my-pod",
+				csiapi.K8sVolumeContextKeyPodNamespace: "my-namespace",
+			},
+			expErr: nil,
+		},
+		"templated pod fields which are missing should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:                   "test-issuer",
+				csiapi.DNSNamesKey:                     "${POD_NAME}.svc",
+				csiapi.URISANsKey:                      "spiffe://cluster.local/ns/$POD_NAMESPACE/sa/${SERVICE_ACCOUNT_NAME}",
+				csiapi.K8sVolumeContextKeyPodNamespace: "my-namespace",
+			},
+			expErr: field.ErrorList{
+				field.Required(path.Child("csi.storage.k8s.io/pod.name"), "${POD_NAME} is used by csi.cert-manager.io/dns-names: "+hint),
+				field.Required(path.Child("csi.storage.k8s.io/serviceAccount.name"), "${SERVICE_ACCOUNT_NAME} is used by csi.cert-manager.io/uri-sans: "+hint),
+			},
+		},
+		"required keys which are missing should error": {
+			attr: map[string]string{
+				csiapi.IssuerNameKey:                   "test-issuer",
+				csiapi.K8sVolumeContextKeyPodNamespace: "my-namespace",
+			},
+			requiredKeys: []string{csiapi.K8sVolumeContextKeyPodName},
+			expErr: field.ErrorList{
+				field.Required(path.Child("csi.storage.k8s.io/pod.name"), "required by the driver configuration: "+hint),
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.EqualValues(t, test.expErr, ValidatePodInfo(test.attr, test.requiredKeys...))
+		})
+	}
+}
+
 func Test_durationParse(t *testing.T) {
 	for name, test := range map[string]struct {
 		s      string
@@ -386,6 +1451,46 @@ func Test_PKCS12Values(t *testing.T) {
 			},
 			expErr: nil,
 		},
+		"if password secret is defined, and enabled is defined as true, expect no error": {
+			attr: map[string]string{
+				"csi.cert-manager.io/pkcs12-enable":          "true",
+				"csi.cert-manager.io/pkcs12-filename":        "my-file",
+				"csi.cert-manager.io/pkcs12-password-secret": "keystore-password",
+			},
+			expErr: nil,
+		},
+		"if password secret and password are defined, expect error": {
+			attr: map[string]string{
+				"csi.cert-manager.io/pkcs12-enable":          "true",
+				"csi.cert-manager.io/pkcs12-filename":        "my-file",
+				"csi.cert-manager.io/pkcs12-password":        "password",
+				"csi.cert-manager.io/pkcs12-password-secret": "keystore-password",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(basePath.Child("csi.cert-manager.io/pkcs12-password-secret"), "keystore-password",
+					"cannot be set together with \"csi.cert-manager.io/pkcs12-password\""),
+			},
+		},
+		"if password secret is not a valid Secret name, expect error": {
+			attr: map[string]string{
+				"csi.cert-manager.io/pkcs12-enable":          "true",
+				"csi.cert-manager.io/pkcs12-filename":        "my-file",
+				"csi.cert-manager.io/pkcs12-password-secret": "Keystore_Password",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(basePath.Child("csi.cert-manager.io/pkcs12-password-secret"), "Keystore_Password",
+					"a lowercase RFC 1123 subdomain must consist of lower case alphanumeric characters, '-' or '.', and must start and end with an alphanumeric character (e.g. 'example.com', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?(\\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*')"),
+			},
+		},
+		"if password secret is defined, but enabled is not defined, expect error": {
+			attr: map[string]string{
+				"csi.cert-manager.io/pkcs12-password-secret": "keystore-password",
+			},
+			expErr: field.ErrorList{
+				field.Invalid(basePath.Child("csi.cert-manager.io/pkcs12-password-secret"), "keystore-password",
+					"cannot use attribute without \"csi.cert-manager.io/pkcs12-enable\" set to \"true\" or \"false\""),
+			},
+		},
 	}
 
 	for name, test := range tests {
@@ -445,6 +1550,12 @@ func Test_filename(t *testing.T) {
 				field.Invalid(basePath, "foofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoofoo", "filename must be no longer than 255 characters"),
 			},
 		},
+		"a filename which is the volume directory should error": {
+			filename: ".",
+			expErr: field.ErrorList{
+				field.Invalid(basePath, ".", "filename must not be '.'"),
+			},
+		},
 		"a valid filename should not error": {
 			filename: "foo.bar",
 			expErr:   nil,
@@ -466,6 +1577,51 @@ func Test_filename(t *testing.T) {
 	}
 }
 
+func Test_ValidateAttributes_outputFileTraversal(t *testing.T) {
+	// Each attribute naming an output file, with the attributes the file
+	// requires.
+	attrs := map[string]map[string]string{
+		csiapi.CAFileKey:   {},
+		csiapi.CertFileKey: {},
+		csiapi.KeyFileKey:  {},
+		csiapi.KeyStorePKCS12FileKey: {
+			csiapi.KeyStorePKCS12EnableKey:   "true",
+			csiapi.KeyStorePKCS12PasswordKey: "password",
+		},
+		csiapi.CombinedFileKey: {
+			csiapi.CombinedFormatKey: csiapi.CombinedFormatHAProxy,
+		},
+		csiapi.CombinedPEMFileKey: {},
+		csiapi.IssuerDNFileKey:    {},
+		csiapi.LastRenewalFileKey: {},
+		csiapi.CertInfoFileKey:    {},
+		csiapi.TrustBundleFileKey: {},
+	}
+	require.ElementsMatch(t, outputFileKeys, slices.Collect(maps.Keys(attrs)), "every output file attribute must be tested")
+
+	for _, file := range []string{"..", ".", "../escape", "../../etc/passwd", "/etc/passwd", "sub/../../escape", "sub/file"} {
+		for key, extra := range attrs {
+			t.Run(key+"="+file, func(t *testing.T) {
+				attr := map[string]string{
+					csiapi.IssuerNameKey:  "test-issuer",
+					csiapi.KeyEncodingKey: "PKCS8",
+					csiapi.CAFileKey:      "ca.crt",
+					csiapi.CertFileKey:    "tls.crt",
+					csiapi.KeyFileKey:     "tls.key",
+				}
+				maps.Copy(attr, extra)
+				attr[key] = file
+
+				el := ValidateAttributes(attr)
+				require.NotEmpty(t, el)
+				for _, err := range el {
+					assert.Equal(t, field.NewPath("volumeAttributes", key).String(), err.Field)
+				}
+			})
+		}
+	}
+}
+
 func Test_uniqueFilePaths(t *testing.T) {
 	basePath := field.NewPath("root")
 
@@ -0,0 +1,90 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmv1client "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/typed/certmanager/v1"
+	"github.com/cert-manager/csi-lib/manager"
+	"github.com/cert-manager/csi-lib/metadata"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+)
+
+// FieldManager is the field manager name used when applying
+// CertificateRequests with server-side apply.
+const FieldManager = "cert-manager-csi-driver"
+
+// WithServerSideApply wraps the given ClientForMetadataFunc so that
+// CertificateRequests created with the returned clients are applied using
+// server-side apply, with the driver as the field manager.
+//
+// Each issuance, including renewals, creates a request with a new unique name,
+// so applying always creates a fresh CertificateRequest rather than patching
+// an existing one. Requests without a name, which rely on generateName, are
+// created as normal since they cannot be applied.
+func WithServerSideApply(clientForMeta manager.ClientForMetadataFunc) manager.ClientForMetadataFunc {
+	return interceptCreate(clientForMeta, func(ctx context.Context, _ metadata.Metadata, client cmv1client.CertificateRequestInterface,
+		cr *cmapi.CertificateRequest, opts metav1.CreateOptions) (*cmapi.CertificateRequest, error) {
+		if len(cr.Name) == 0 {
+			return client.Create(ctx, cr, opts)
+		}
+
+		data, err := applyConfiguration(cr)
+		if err != nil {
+			return nil, err
+		}
+
+		return client.Patch(ctx, cr.Name, types.ApplyPatchType, data, metav1.PatchOptions{
+			DryRun:       opts.DryRun,
+			Force:        ptr.To(true),
+			FieldManager: FieldManager,
+		})
+	})
+}
+
+// applyConfiguration returns the apply patch for the given CertificateRequest,
+// containing only the fields the driver sets.
+func applyConfiguration(cr *cmapi.CertificateRequest) ([]byte, error) {
+	cr = &cmapi.CertificateRequest{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: cmapi.SchemeGroupVersion.String(),
+			Kind:       cmapi.CertificateRequestKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            cr.Name,
+			Namespace:       cr.Namespace,
+			Labels:          cr.Labels,
+			Annotations:     cr.Annotations,
+			OwnerReferences: cr.OwnerReferences,
+			Finalizers:      cr.Finalizers,
+		},
+		Spec: cr.Spec,
+	}
+
+	data, err := json.Marshal(cr)
+	if err != nil {
+		return nil, fmt.Errorf("encoding CertificateRequest apply patch: %w", err)
+	}
+
+	return data, nil
+}
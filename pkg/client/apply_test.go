@@ -0,0 +1,97 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
+	cmfake "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/fake"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func Test_WithServerSideApply(t *testing.T) {
+	fakeClient := cmfake.NewSimpleClientset()
+
+	var patches []k8stesting.PatchAction
+	fakeClient.PrependReactor("patch", "certificaterequests", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		patches = append(patches, patch)
+
+		var cr cmapi.CertificateRequest
+		if err := json.Unmarshal(patch.GetPatch(), &cr); err != nil {
+			return true, nil, err
+		}
+		return true, &cr, nil
+	})
+
+	clientForMeta := WithServerSideApply(func(metadata.Metadata) (cmclient.Interface, error) {
+		return fakeClient, nil
+	})
+	client, err := clientForMeta(metadata.Metadata{VolumeID: "vol-id"})
+	require.NoError(t, err)
+
+	crs := client.CertmanagerV1().CertificateRequests("my-namespace")
+	for _, name := range []string{"my-cr", "my-renewed-cr"} {
+		cr := &cmapi.CertificateRequest{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", Name: name, Labels: map[string]string{"foo": "bar"}},
+			Spec:       cmapi.CertificateRequestSpec{Request: []byte("csr")},
+			Status:     cmapi.CertificateRequestStatus{Certificate: []byte("ignored")},
+		}
+		applied, err := crs.Create(context.Background(), cr, metav1.CreateOptions{})
+		require.NoError(t, err)
+
+		assert.Equal(t, "cert-manager.io/v1", applied.APIVersion)
+		assert.Equal(t, "CertificateRequest", applied.Kind)
+		assert.Equal(t, name, applied.Name)
+		assert.Equal(t, map[string]string{"foo": "bar"}, applied.Labels)
+		assert.Equal(t, []byte("csr"), applied.Spec.Request)
+		assert.Empty(t, applied.Status.Certificate)
+	}
+
+	// Every issuance should apply a request under its own name.
+	require.Len(t, patches, 2)
+	for i, name := range []string{"my-cr", "my-renewed-cr"} {
+		assert.Equal(t, name, patches[i].GetName())
+		assert.Equal(t, types.ApplyPatchType, patches[i].GetPatchType())
+	}
+}
+
+func Test_WithServerSideApply_generateName(t *testing.T) {
+	fakeClient := cmfake.NewSimpleClientset()
+	clientForMeta := WithServerSideApply(func(metadata.Metadata) (cmclient.Interface, error) {
+		return fakeClient, nil
+	})
+	client, err := clientForMeta(metadata.Metadata{VolumeID: "vol-id"})
+	require.NoError(t, err)
+
+	cr := &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", GenerateName: "my-cr-"}}
+	_, err = client.CertmanagerV1().CertificateRequests("my-namespace").Create(context.Background(), cr, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	require.Len(t, fakeClient.Actions(), 1)
+	assert.Equal(t, "create", fakeClient.Actions()[0].GetVerb(), "expected requests without a name to be created")
+}
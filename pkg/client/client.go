@@ -0,0 +1,79 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package client contains wrappers for the cert-manager API client used by
+// the csi-lib manager, which change how the driver creates
+// CertificateRequests.
+package client
+
+import (
+	"context"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
+	cmv1client "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/typed/certmanager/v1"
+	"github.com/cert-manager/csi-lib/manager"
+	"github.com/cert-manager/csi-lib/metadata"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// createInterceptor is called in place of creating a CertificateRequest. It
+// is responsible for calling Create on the given client.
+type createInterceptor func(ctx context.Context, meta metadata.Metadata, client cmv1client.CertificateRequestInterface,
+	cr *cmapi.CertificateRequest, opts metav1.CreateOptions) (*cmapi.CertificateRequest, error)
+
+// interceptCreate wraps the given ClientForMetadataFunc so that
+// CertificateRequests created with the returned clients are passed through
+// the interceptor.
+func interceptCreate(clientForMeta manager.ClientForMetadataFunc, intercept createInterceptor) manager.ClientForMetadataFunc {
+	return func(meta metadata.Metadata) (cmclient.Interface, error) {
+		client, err := clientForMeta(meta)
+		if err != nil {
+			return nil, err
+		}
+		return &interceptedClient{Interface: client, meta: meta, intercept: intercept}, nil
+	}
+}
+
+type interceptedClient struct {
+	cmclient.Interface
+	meta      metadata.Metadata
+	intercept createInterceptor
+}
+
+func (c *interceptedClient) CertmanagerV1() cmv1client.CertmanagerV1Interface {
+	return &interceptedV1Client{CertmanagerV1Interface: c.Interface.CertmanagerV1(), meta: c.meta, intercept: c.intercept}
+}
+
+type interceptedV1Client struct {
+	cmv1client.CertmanagerV1Interface
+	meta      metadata.Metadata
+	intercept createInterceptor
+}
+
+func (c *interceptedV1Client) CertificateRequests(namespace string) cmv1client.CertificateRequestInterface {
+	return &interceptedCertificateRequests{CertificateRequestInterface: c.CertmanagerV1Interface.CertificateRequests(namespace), meta: c.meta, intercept: c.intercept}
+}
+
+type interceptedCertificateRequests struct {
+	cmv1client.CertificateRequestInterface
+	meta      metadata.Metadata
+	intercept createInterceptor
+}
+
+func (c *interceptedCertificateRequests) Create(ctx context.Context, cr *cmapi.CertificateRequest, opts metav1.CreateOptions) (*cmapi.CertificateRequest, error) {
+	return c.intercept(ctx, c.meta, c.CertificateRequestInterface, cr, opts)
+}
@@ -0,0 +1,88 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmv1client "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/typed/certmanager/v1"
+	"github.com/cert-manager/csi-lib/manager"
+	"github.com/cert-manager/csi-lib/metadata"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// csrPEMType is the PEM block type of a CSR, which cert-manager expects.
+	csrPEMType = "CERTIFICATE REQUEST"
+
+	// legacyCSRPEMType is the PEM block type of a CSR written by some older
+	// tools, which strict issuers reject.
+	legacyCSRPEMType = "NEW " + csrPEMType
+)
+
+// WithNormalizedRequest wraps the given ClientForMetadataFunc so that the CSR
+// of every CertificateRequest created with the returned clients is a single
+// PEM block of the type cert-manager expects. CSRs given as DER, or as a PEM
+// block of the legacy "NEW CERTIFICATE REQUEST" type, are re-encoded. CSRs
+// which cannot be parsed, or whose signature is invalid, are refused before
+// they reach the API server.
+func WithNormalizedRequest(clientForMeta manager.ClientForMetadataFunc) manager.ClientForMetadataFunc {
+	return interceptCreate(clientForMeta, func(ctx context.Context, _ metadata.Metadata, client cmv1client.CertificateRequestInterface,
+		cr *cmapi.CertificateRequest, opts metav1.CreateOptions) (*cmapi.CertificateRequest, error) {
+		request, err := normalizeRequest(cr.Spec.Request)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate signing request: %w", err)
+		}
+		if !bytes.Equal(request, cr.Spec.Request) {
+			cr = cr.DeepCopy()
+			cr.Spec.Request = request
+		}
+
+		return client.Create(ctx, cr, opts)
+	})
+}
+
+// normalizeRequest returns the given PEM or DER encoded CSR as a single PEM
+// block of type csrPEMType, without PEM headers.
+func normalizeRequest(request []byte) ([]byte, error) {
+	der := request
+	if block, rest := pem.Decode(request); block != nil {
+		if block.Type != csrPEMType && block.Type != legacyCSRPEMType {
+			return nil, fmt.Errorf("unexpected PEM block type %q", block.Type)
+		}
+		if len(bytes.TrimSpace(rest)) > 0 {
+			return nil, errors.New("unexpected data after the PEM block")
+		}
+		der = block.Bytes
+	}
+
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, err
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: csrPEMType, Bytes: csr.Raw}), nil
+}
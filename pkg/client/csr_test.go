@@ -0,0 +1,117 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"testing"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
+	cmfake "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/fake"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_WithNormalizedRequest(t *testing.T) {
+	pk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "my-csr"},
+		DNSNames: []string{"example.com"},
+	}, pk)
+	require.NoError(t, err)
+
+	expPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+
+	tampered := append([]byte(nil), der...)
+	tampered[len(tampered)-1] ^= 0xff
+
+	tests := map[string]struct {
+		request []byte
+		expErr  string
+	}{
+		"a PEM encoded CSR should be submitted unchanged": {
+			request: expPEM,
+		},
+		"a CSR with the legacy PEM block type should be re-encoded": {
+			request: pem.EncodeToMemory(&pem.Block{Type: "NEW CERTIFICATE REQUEST", Bytes: der}),
+		},
+		"a CSR with PEM headers should be re-encoded without them": {
+			request: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Headers: map[string]string{"Comment": "csr"}, Bytes: der}),
+		},
+		"a DER encoded CSR should be PEM encoded": {
+			request: der,
+		},
+		"a PEM block of another type should error": {
+			request: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			expErr:  `invalid certificate signing request: unexpected PEM block type "CERTIFICATE"`,
+		},
+		"data after the PEM block should error": {
+			request: append(append([]byte(nil), expPEM...), expPEM...),
+			expErr:  "invalid certificate signing request: unexpected data after the PEM block",
+		},
+		"a CSR with an invalid signature should error": {
+			request: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: tampered}),
+			expErr:  "invalid certificate signing request: x509: ECDSA verification failure",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeClient := cmfake.NewSimpleClientset()
+			clientForMeta := WithNormalizedRequest(func(metadata.Metadata) (cmclient.Interface, error) {
+				return fakeClient, nil
+			})
+
+			client, err := clientForMeta(metadata.Metadata{VolumeID: "vol-id"})
+			require.NoError(t, err)
+
+			cr := &cmapi.CertificateRequest{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", Name: "my-cr"},
+				Spec:       cmapi.CertificateRequestSpec{Request: test.request},
+			}
+			_, err = client.CertmanagerV1().CertificateRequests("my-namespace").Create(context.Background(), cr, metav1.CreateOptions{})
+			if len(test.expErr) > 0 {
+				assert.EqualError(t, err, test.expErr)
+				assert.Empty(t, fakeClient.Actions(), "expected the request not to be submitted")
+				return
+			}
+			require.NoError(t, err)
+
+			stored, err := fakeClient.CertmanagerV1().CertificateRequests("my-namespace").Get(context.Background(), "my-cr", metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, expPEM, stored.Spec.Request)
+
+			block, rest := pem.Decode(stored.Spec.Request)
+			require.NotNil(t, block)
+			assert.Empty(t, rest)
+			assert.Equal(t, "CERTIFICATE REQUEST", block.Type)
+			csr, err := x509.ParseCertificateRequest(block.Bytes)
+			require.NoError(t, err)
+			assert.Equal(t, "my-csr", csr.Subject.CommonName)
+		})
+	}
+}
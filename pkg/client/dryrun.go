@@ -0,0 +1,164 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"time"
+
+	apiutil "github.com/cert-manager/cert-manager/pkg/api/util"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
+	"github.com/cert-manager/csi-lib/manager"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+	"github.com/cert-manager/csi-driver/pkg/metrics"
+	"github.com/cert-manager/csi-driver/pkg/volumelog"
+)
+
+// dryRunTimeout is the timeout for finding and deleting the requests of a
+// dry-run volume.
+const dryRunTimeout = time.Second * 30
+
+// DryRun handles volumes with the dry-run attribute set. A certificate is
+// requested for them as usual, but is never written to the volume: writing
+// fails with an error, which fails the mount. When the failed volume is
+// removed, the outcome of its most recent CertificateRequest is logged and
+// recorded, and every CertificateRequest of the volume is deleted.
+//
+// The kubelet retries a failed mount, so a dry-run is repeated, with a new
+// CertificateRequest, until the pod is deleted.
+type DryRun struct {
+	Log    logr.Logger
+	Client cmclient.Interface
+
+	// Completed, if set, is called with the volume ID and the result of each
+	// completed dry-run, one of the results of the issuance attempts metric.
+	Completed func(volumeID, result string)
+}
+
+// IsDryRun returns true if the volume has the dry-run attribute set.
+func IsDryRun(meta metadata.Metadata) bool {
+	return meta.VolumeContext[csiapi.DryRunKey] == "true"
+}
+
+// InstrumentWriteKeypair wraps the given function so that the certificate of
+// a dry-run volume is never written, and the mount fails once it is issued.
+func (d *DryRun) InstrumentWriteKeypair(f manager.WriteKeypairFunc) manager.WriteKeypairFunc {
+	return func(meta metadata.Metadata, key crypto.PrivateKey, chain []byte, ca []byte) error {
+		if !IsDryRun(meta) {
+			return f(meta, key, chain, ca)
+		}
+		return fmt.Errorf("dry-run complete: a certificate was issued for the volume, nothing was written since %s is %q", csiapi.DryRunKey, "true")
+	}
+}
+
+// complete logs and records the outcome of the dry-run of the given volume,
+// and deletes its requests.
+func (d *DryRun) complete(meta metadata.Metadata) {
+	volumeID := VolumeIDLabelValue(meta.VolumeID)
+	if len(volumeID) == 0 {
+		return
+	}
+	namespace := meta.VolumeContext[csiapi.K8sVolumeContextKeyPodNamespace]
+	log := volumelog.ForMetadata(d.Log, meta)
+
+	ctx, cancel := context.WithTimeout(context.Background(), dryRunTimeout)
+	defer cancel()
+
+	client := d.Client.CertmanagerV1().CertificateRequests(namespace)
+	list, err := client.List(ctx, metav1.ListOptions{
+		LabelSelector: ManagedByLabelKey + "=" + ManagedByLabelValue + "," + VolumeIDLabelKey + "=" + volumeID,
+	})
+	if err != nil {
+		log.Error(err, "Failed to list the CertificateRequests of dry-run volume")
+		return
+	}
+
+	var latest *cmapi.CertificateRequest
+	for i := range list.Items {
+		cr := &list.Items[i]
+		if latest == nil || latest.CreationTimestamp.Before(&cr.CreationTimestamp) {
+			latest = cr
+		}
+	}
+
+	result, message := dryRunResult(latest)
+	if latest != nil {
+		log = log.WithValues("request", latest.Name)
+	}
+	log.Info("Dry-run complete", "result", result, "message", message)
+	if d.Completed != nil {
+		d.Completed(meta.VolumeID, result)
+	}
+
+	for _, cr := range list.Items {
+		if err := client.Delete(ctx, cr.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			log.Error(err, "Failed to delete CertificateRequest of dry-run volume", "name", cr.Name)
+		}
+	}
+}
+
+// dryRunResult returns the result of a dry-run from the state of its most
+// recent request, and the message of the condition it was decided by. A
+// dry-run which never created a request failed, and one whose request is
+// neither issued, denied nor failed timed out.
+func dryRunResult(cr *cmapi.CertificateRequest) (string, string) {
+	if cr == nil {
+		return metrics.ResultFailure, "no CertificateRequest was created"
+	}
+	if apiutil.CertificateRequestIsDenied(cr) {
+		return metrics.ResultDenied, apiutil.GetCertificateRequestCondition(cr, cmapi.CertificateRequestConditionDenied).Message
+	}
+
+	ready := apiutil.GetCertificateRequestCondition(cr, cmapi.CertificateRequestConditionReady)
+	if ready == nil {
+		return metrics.ResultTimeout, "request has no ready condition"
+	}
+	switch ready.Reason {
+	case cmapi.CertificateRequestReasonIssued:
+		return metrics.ResultSuccess, ready.Message
+	case cmapi.CertificateRequestReasonFailed:
+		return metrics.ResultFailure, ready.Message
+	default:
+		return metrics.ResultTimeout, ready.Message
+	}
+}
+
+// DryRunStore wraps a storage backend to complete the dry-run of volumes
+// which are removed.
+type DryRunStore struct {
+	storage.Interface
+
+	DryRun *DryRun
+}
+
+// RemoveVolume completes the dry-run of the volume, if it is a dry-run
+// volume, and removes it from the storage backend.
+func (s *DryRunStore) RemoveVolume(volumeID string) error {
+	if meta, err := s.Interface.ReadMetadata(volumeID); err == nil && IsDryRun(meta) {
+		s.DryRun.complete(meta)
+	}
+	return s.Interface.RemoveVolume(volumeID)
+}
@@ -0,0 +1,148 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"crypto"
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	cmfake "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/fake"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+	"github.com/cert-manager/csi-driver/pkg/metrics"
+)
+
+func Test_DryRun_InstrumentWriteKeypair(t *testing.T) {
+	var written []string
+	d := &DryRun{Log: logr.Discard()}
+	writeKeypair := d.InstrumentWriteKeypair(func(meta metadata.Metadata, _ crypto.PrivateKey, _, _ []byte) error {
+		written = append(written, meta.VolumeID)
+		return nil
+	})
+
+	assert.NoError(t, writeKeypair(metadata.Metadata{VolumeID: "vol-1"}, nil, nil, nil))
+	err := writeKeypair(metadata.Metadata{VolumeID: "vol-2", VolumeContext: map[string]string{csiapi.DryRunKey: "true"}}, nil, nil, nil)
+	assert.ErrorContains(t, err, "dry-run complete")
+	assert.Equal(t, []string{"vol-1"}, written)
+}
+
+func Test_DryRunStore_RemoveVolume(t *testing.T) {
+	request := func(name, volumeID string, age time.Duration, conditions ...cmapi.CertificateRequestCondition) *cmapi.CertificateRequest {
+		return &cmapi.CertificateRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:         "my-namespace",
+				Name:              name,
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+				Labels: map[string]string{
+					ManagedByLabelKey: ManagedByLabelValue,
+					VolumeIDLabelKey:  volumeID,
+				},
+			},
+			Status: cmapi.CertificateRequestStatus{Conditions: conditions},
+		}
+	}
+	issued := cmapi.CertificateRequestCondition{Type: cmapi.CertificateRequestConditionReady, Status: cmmeta.ConditionTrue, Reason: cmapi.CertificateRequestReasonIssued}
+	failed := cmapi.CertificateRequestCondition{Type: cmapi.CertificateRequestConditionReady, Status: cmmeta.ConditionFalse, Reason: cmapi.CertificateRequestReasonFailed}
+	pending := cmapi.CertificateRequestCondition{Type: cmapi.CertificateRequestConditionReady, Status: cmmeta.ConditionFalse, Reason: cmapi.CertificateRequestReasonPending}
+	denied := cmapi.CertificateRequestCondition{Type: cmapi.CertificateRequestConditionDenied, Status: cmmeta.ConditionTrue, Message: "not allowed"}
+
+	tests := map[string]struct {
+		dryRun      string
+		requests    []runtime.Object
+		expResults  []string
+		expRequests []string
+	}{
+		"a volume which is not a dry-run should keep its requests": {
+			dryRun:      "false",
+			requests:    []runtime.Object{request("cr-1", "vol-id", 0, issued)},
+			expResults:  nil,
+			expRequests: []string{"cr-1", "other-volume"},
+		},
+		"an issued request should be recorded as a success and deleted": {
+			dryRun:      "true",
+			requests:    []runtime.Object{request("cr-1", "vol-id", 0, issued)},
+			expResults:  []string{metrics.ResultSuccess},
+			expRequests: []string{"other-volume"},
+		},
+		"the most recent request should decide the result": {
+			dryRun:      "true",
+			requests:    []runtime.Object{request("cr-1", "vol-id", time.Minute, issued), request("cr-2", "vol-id", 0, failed)},
+			expResults:  []string{metrics.ResultFailure},
+			expRequests: []string{"other-volume"},
+		},
+		"a denied request should be recorded as denied": {
+			dryRun:      "true",
+			requests:    []runtime.Object{request("cr-1", "vol-id", 0, denied)},
+			expResults:  []string{metrics.ResultDenied},
+			expRequests: []string{"other-volume"},
+		},
+		"a pending request should be recorded as a timeout": {
+			dryRun:      "true",
+			requests:    []runtime.Object{request("cr-1", "vol-id", 0, pending)},
+			expResults:  []string{metrics.ResultTimeout},
+			expRequests: []string{"other-volume"},
+		},
+		"a dry-run which created no request should be recorded as a failure": {
+			dryRun:      "true",
+			requests:    nil,
+			expResults:  []string{metrics.ResultFailure},
+			expRequests: []string{"other-volume"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeClient := cmfake.NewSimpleClientset(append(test.requests, request("other-volume", "other-vol-id", 0, issued))...)
+			var results []string
+			store := &DryRunStore{
+				Interface: storage.NewMemoryFS(),
+				DryRun: &DryRun{Log: logr.Discard(), Client: fakeClient, Completed: func(volumeID, result string) {
+					assert.Equal(t, "vol-id", volumeID)
+					results = append(results, result)
+				}},
+			}
+
+			_, err := store.RegisterMetadata(metadata.Metadata{VolumeID: "vol-id", VolumeContext: map[string]string{
+				csiapi.K8sVolumeContextKeyPodNamespace: "my-namespace",
+				csiapi.DryRunKey:                       test.dryRun,
+			}})
+			require.NoError(t, err)
+			require.NoError(t, store.RemoveVolume("vol-id"))
+
+			assert.Equal(t, test.expResults, results)
+
+			list, err := fakeClient.CertmanagerV1().CertificateRequests("my-namespace").List(context.Background(), metav1.ListOptions{})
+			require.NoError(t, err)
+			var names []string
+			for _, cr := range list.Items {
+				names = append(names, cr.Name)
+			}
+			assert.ElementsMatch(t, test.expRequests, names)
+		})
+	}
+}
@@ -0,0 +1,211 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
+	cmv1client "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/typed/certmanager/v1"
+	"github.com/cert-manager/csi-lib/manager"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// InflightFinalizer is the finalizer added to CertificateRequests by the
+	// driver while it may still read the certificate from them.
+	InflightFinalizer = "csi.cert-manager.io/inflight"
+
+	// NodeIDAnnotationKey is the annotation holding the ID of the node whose
+	// driver added the InflightFinalizer to a CertificateRequest.
+	NodeIDAnnotationKey = "csi.cert-manager.io/node-id"
+)
+
+// releaseTimeout is the timeout for removing the finalizer from the requests
+// of a volume.
+const releaseTimeout = time.Second * 30
+
+// InflightProtector protects the CertificateRequests created by the driver
+// from being garbage collected, such as when the pod owning a request is
+// deleted, before the driver has read the certificate from them. Protected
+// requests hold the InflightFinalizer, which is removed once the certificate
+// has been written to the volume, when the next request for the volume is
+// created, or when the volume is removed, whether issuance succeeded or not.
+type InflightProtector struct {
+	Log    logr.Logger
+	Client cmclient.Interface
+
+	// NodeID is the name of the node which is hosting this driver instance.
+	NodeID string
+
+	// lock protects requests.
+	lock sync.Mutex
+	// requests holds the protected requests of each volume.
+	requests map[string][]types.NamespacedName
+}
+
+// WithFinalizer wraps the given ClientForMetadataFunc so that every
+// CertificateRequest created with the returned clients is protected until it
+// is released. The requests of any previous issuance attempt for the volume
+// are released first.
+func (p *InflightProtector) WithFinalizer(clientForMeta manager.ClientForMetadataFunc) manager.ClientForMetadataFunc {
+	return interceptCreate(clientForMeta, func(ctx context.Context, meta metadata.Metadata, client cmv1client.CertificateRequestInterface,
+		cr *cmapi.CertificateRequest, opts metav1.CreateOptions) (*cmapi.CertificateRequest, error) {
+		p.Release(meta.VolumeID)
+
+		cr = cr.DeepCopy()
+		if !slices.Contains(cr.Finalizers, InflightFinalizer) {
+			cr.Finalizers = append(cr.Finalizers, InflightFinalizer)
+		}
+		if cr.Annotations == nil {
+			cr.Annotations = make(map[string]string)
+		}
+		cr.Annotations[NodeIDAnnotationKey] = p.NodeID
+
+		created, err := client.Create(ctx, cr, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		if p.requests == nil {
+			p.requests = make(map[string][]types.NamespacedName)
+		}
+		p.requests[meta.VolumeID] = append(p.requests[meta.VolumeID], types.NamespacedName{Namespace: created.Namespace, Name: created.Name})
+
+		return created, nil
+	})
+}
+
+// Release removes the finalizer from the protected requests of the given
+// volume. Requests whose finalizer could not be removed remain protected, and
+// are retried on the next release.
+func (p *InflightProtector) Release(volumeID string) {
+	p.lock.Lock()
+	requests := p.requests[volumeID]
+	delete(p.requests, volumeID)
+	p.lock.Unlock()
+
+	if len(requests) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+
+	var failed []types.NamespacedName
+	for _, req := range requests {
+		if err := p.removeFinalizer(ctx, req); err != nil {
+			p.Log.Error(err, "Failed to remove in-flight finalizer from CertificateRequest", "volume_id", volumeID, "namespace", req.Namespace, "name", req.Name)
+			failed = append(failed, req)
+		}
+	}
+
+	if len(failed) > 0 {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		p.requests[volumeID] = append(failed, p.requests[volumeID]...)
+	}
+}
+
+// ReleaseNode removes the finalizer from every request protected by a driver
+// on this node. It is run when the driver starts, since requests which were in
+// flight when the driver stopped are never resumed.
+func (p *InflightProtector) ReleaseNode(ctx context.Context) error {
+	list, err := p.Client.CertmanagerV1().CertificateRequests(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		LabelSelector: NodeSelector(p.NodeID),
+	})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, cr := range list.Items {
+		if cr.Annotations[NodeIDAnnotationKey] != p.NodeID || !slices.Contains(cr.Finalizers, InflightFinalizer) {
+			continue
+		}
+		p.Log.Info("Removing in-flight finalizer from CertificateRequest created before restart", "namespace", cr.Namespace, "name", cr.Name)
+		if err := p.removeFinalizer(ctx, types.NamespacedName{Namespace: cr.Namespace, Name: cr.Name}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// removeFinalizer removes the InflightFinalizer from the given request, if it
+// still exists.
+func (p *InflightProtector) removeFinalizer(ctx context.Context, req types.NamespacedName) error {
+	client := p.Client.CertmanagerV1().CertificateRequests(req.Namespace)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cr, err := client.Get(ctx, req.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		i := slices.Index(cr.Finalizers, InflightFinalizer)
+		if i < 0 {
+			return nil
+		}
+		cr.Finalizers = slices.Delete(cr.Finalizers, i, i+1)
+
+		_, err = client.Update(ctx, cr, metav1.UpdateOptions{})
+		return err
+	})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// InstrumentWriteKeypair wraps the given function, which csi-lib calls once
+// the certificate has been read from a request, to release the requests of
+// the volume whether or not writing succeeds.
+func (p *InflightProtector) InstrumentWriteKeypair(f manager.WriteKeypairFunc) manager.WriteKeypairFunc {
+	return func(meta metadata.Metadata, key crypto.PrivateKey, chain []byte, ca []byte) error {
+		defer p.Release(meta.VolumeID)
+		return f(meta, key, chain, ca)
+	}
+}
+
+// InflightStore wraps a storage backend to release the protected requests of
+// volumes which are removed.
+type InflightStore struct {
+	storage.Interface
+
+	Protector *InflightProtector
+}
+
+// RemoveVolume removes the volume from the storage backend, and releases its
+// protected requests.
+func (s *InflightStore) RemoveVolume(volumeID string) error {
+	s.Protector.Release(volumeID)
+	return s.Interface.RemoveVolume(volumeID)
+}
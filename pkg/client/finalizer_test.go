@@ -0,0 +1,111 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"testing"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
+	cmfake "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/fake"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func finalizersOf(t *testing.T, client cmclient.Interface, name string) []string {
+	cr, err := client.CertmanagerV1().CertificateRequests("my-namespace").Get(context.Background(), name, metav1.GetOptions{})
+	require.NoError(t, err)
+	return cr.Finalizers
+}
+
+func Test_InflightProtector(t *testing.T) {
+	fakeClient := cmfake.NewSimpleClientset()
+	p := &InflightProtector{Log: logr.Discard(), Client: fakeClient, NodeID: "node-1"}
+	clientForMeta := p.WithFinalizer(func(metadata.Metadata) (cmclient.Interface, error) {
+		return fakeClient, nil
+	})
+
+	meta := metadata.Metadata{VolumeID: "vol-id"}
+	create := func(name string) {
+		client, err := clientForMeta(meta)
+		require.NoError(t, err)
+		cr := &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", Name: name, Finalizers: []string{"other"}}}
+		created, err := client.CertmanagerV1().CertificateRequests("my-namespace").Create(context.Background(), cr, metav1.CreateOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "node-1", created.Annotations[NodeIDAnnotationKey])
+	}
+
+	// A failed attempt should stay protected until the next request for the
+	// volume is created.
+	create("cr-1")
+	assert.Equal(t, []string{"other", InflightFinalizer}, finalizersOf(t, fakeClient, "cr-1"))
+	create("cr-2")
+	assert.Equal(t, []string{"other"}, finalizersOf(t, fakeClient, "cr-1"))
+	assert.Equal(t, []string{"other", InflightFinalizer}, finalizersOf(t, fakeClient, "cr-2"))
+
+	// Writing the certificate should release the request, even on error.
+	writeKeypair := p.InstrumentWriteKeypair(func(metadata.Metadata, crypto.PrivateKey, []byte, []byte) error {
+		return errors.New("writing data")
+	})
+	assert.Error(t, writeKeypair(meta, nil, nil, nil))
+	assert.Equal(t, []string{"other"}, finalizersOf(t, fakeClient, "cr-2"))
+
+	// Removing the volume should release the request.
+	create("cr-3")
+	store := &InflightStore{Interface: storage.NewMemoryFS(), Protector: p}
+	_, err := store.RegisterMetadata(meta)
+	require.NoError(t, err)
+	require.NoError(t, store.RemoveVolume("vol-id"))
+	assert.Equal(t, []string{"other"}, finalizersOf(t, fakeClient, "cr-3"))
+
+	// Releasing a request which has been deleted should not error.
+	create("cr-4")
+	require.NoError(t, fakeClient.CertmanagerV1().CertificateRequests("my-namespace").Delete(context.Background(), "cr-4", metav1.DeleteOptions{}))
+	p.Release("vol-id")
+	assert.Empty(t, p.requests["vol-id"])
+}
+
+func Test_InflightProtector_ReleaseNode(t *testing.T) {
+	request := func(name, nodeID string, finalizers ...string) *cmapi.CertificateRequest {
+		return &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "my-namespace",
+			Name:        name,
+			Labels:      map[string]string{ManagedByLabelKey: ManagedByLabelValue, NodeIDHashLabelKey: HashIdentifier(nodeID)},
+			Annotations: map[string]string{NodeIDAnnotationKey: nodeID},
+			Finalizers:  finalizers,
+		}}
+	}
+
+	fakeClient := cmfake.NewSimpleClientset(
+		request("this-node", "node-1", "other", InflightFinalizer),
+		request("other-node", "node-2", InflightFinalizer),
+		request("unprotected", "node-1"),
+	)
+	p := &InflightProtector{Log: logr.Discard(), Client: fakeClient, NodeID: "node-1"}
+
+	require.NoError(t, p.ReleaseNode(context.Background()))
+	assert.Equal(t, []string{"other"}, finalizersOf(t, fakeClient, "this-node"))
+	assert.Equal(t, []string{InflightFinalizer}, finalizersOf(t, fakeClient, "other-node"))
+	assert.Empty(t, finalizersOf(t, fakeClient, "unprotected"))
+}
@@ -0,0 +1,32 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
+	cminformers "github.com/cert-manager/cert-manager/pkg/client/informers/externalversions"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NewNodeInformerFactory returns an informer factory which only watches the
+// CertificateRequests which csi-lib created on the given node, so that the
+// cache holds this node's requests rather than every request in the cluster.
+func NewNodeInformerFactory(cmClient cmclient.Interface, nodeID string) cminformers.SharedInformerFactory {
+	return cminformers.NewSharedInformerFactoryWithOptions(cmClient, 0, cminformers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+		opts.LabelSelector = NodeSelector(nodeID)
+	}))
+}
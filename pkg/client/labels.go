@@ -0,0 +1,142 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmv1client "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/typed/certmanager/v1"
+	"github.com/cert-manager/csi-lib/manager"
+	"github.com/cert-manager/csi-lib/metadata"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+	csivalidation "github.com/cert-manager/csi-driver/pkg/apis/validation"
+)
+
+const (
+	// ManagedByLabelKey is the well-known label added to every
+	// CertificateRequest created by the driver.
+	ManagedByLabelKey = "app.kubernetes.io/managed-by"
+
+	// ManagedByLabelValue is the value of the ManagedByLabelKey label.
+	ManagedByLabelValue = "cert-manager-csi-driver"
+
+	// VolumeIDLabelKey is the label holding the ID of the volume a
+	// CertificateRequest was created for. Volume IDs longer than the maximum
+	// label value length are truncated, and suffixed with a hash of the whole
+	// volume ID.
+	VolumeIDLabelKey = "csi.cert-manager.io/volume-id"
+
+	// NodeIDHashLabelKey and VolumeIDHashLabelKey are the labels added by
+	// csi-lib to every CertificateRequest it creates, holding a hash of the
+	// ID of the node and volume the request was created for. csi-lib watches
+	// only the requests labelled with the hash of its own node.
+	NodeIDHashLabelKey   = "csi.cert-manager.io/node-id-hash"
+	VolumeIDHashLabelKey = "csi.cert-manager.io/volume-id-hash"
+
+	// hashSuffixLength is the number of hex characters of the hash suffixed to
+	// truncated values.
+	hashSuffixLength = 16
+)
+
+// WithLabels wraps the given ClientForMetadataFunc so that every
+// CertificateRequest created with the returned clients is labelled as managed
+// by the driver, and with the ID of the volume it was created for, followed by
+// any labels requested by the volume. Labels already set on the request are
+// never overwritten.
+func WithLabels(clientForMeta manager.ClientForMetadataFunc) manager.ClientForMetadataFunc {
+	return interceptCreate(clientForMeta, func(ctx context.Context, meta metadata.Metadata, client cmv1client.CertificateRequestInterface,
+		cr *cmapi.CertificateRequest, opts metav1.CreateOptions) (*cmapi.CertificateRequest, error) {
+		cr = cr.DeepCopy()
+		if cr.Labels == nil {
+			cr.Labels = make(map[string]string)
+		}
+
+		setLabelIfEmpty(cr.Labels, ManagedByLabelKey, ManagedByLabelValue)
+		if volumeID := VolumeIDLabelValue(meta.VolumeID); len(volumeID) > 0 {
+			setLabelIfEmpty(cr.Labels, VolumeIDLabelKey, volumeID)
+		}
+		if v := meta.VolumeContext[csiapi.LabelsKey]; len(v) > 0 {
+			requested, err := csivalidation.ParseKeyValues(v)
+			if err != nil {
+				return nil, fmt.Errorf("%q: %w", csiapi.LabelsKey, err)
+			}
+			for k, v := range requested {
+				setLabelIfEmpty(cr.Labels, k, v)
+			}
+		}
+
+		return client.Create(ctx, cr, opts)
+	})
+}
+
+func setLabelIfEmpty(labels map[string]string, k, v string) {
+	if _, ok := labels[k]; !ok {
+		labels[k] = v
+	}
+}
+
+// VolumeIDLabelValue returns the volume ID as a valid label value. Volume IDs
+// longer than the maximum label value length are truncated with a hash
+// suffix, so that the value remains unique and is stable for the same volume
+// across renewals and restarts. Returns an empty string if the volume ID
+// cannot be used as a label value.
+func VolumeIDLabelValue(volumeID string) string {
+	volumeID = truncateWithHash(volumeID, validation.LabelValueMaxLength)
+	if len(validation.IsValidLabelValue(volumeID)) > 0 {
+		return ""
+	}
+	return volumeID
+}
+
+// HashIdentifier returns the value of the NodeIDHashLabelKey or
+// VolumeIDHashLabelKey label csi-lib sets for the given node or volume ID. It
+// must match csi-lib, which does not export its implementation.
+func HashIdentifier(id string) string {
+	h := fnv.New32()
+	h.Write([]byte(id))
+	return rand.SafeEncodeString(fmt.Sprint(h.Sum32()))
+}
+
+// NodeSelector returns the label selector of the CertificateRequests managed
+// by the driver which csi-lib created on the given node.
+func NodeSelector(nodeID string) string {
+	return ManagedByLabelKey + "=" + ManagedByLabelValue + "," + NodeIDHashLabelKey + "=" + HashIdentifier(nodeID)
+}
+
+// truncateWithHash returns the value unchanged if it is no longer than max.
+// Longer values are truncated and suffixed with a hash of the whole value,
+// so that values sharing a long prefix remain distinct. The result never ends
+// with a separator character, and is always the same for the same value.
+func truncateWithHash(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+	sum := sha256.Sum256([]byte(value))
+	suffix := hex.EncodeToString(sum[:])[:hashSuffixLength]
+	prefix := strings.TrimRight(value[:max-len(suffix)-1], "-_.")
+	return prefix + "-" + suffix
+}
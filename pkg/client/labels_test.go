@@ -0,0 +1,171 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
+	cmfake "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/fake"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func Test_WithLabels(t *testing.T) {
+	tests := map[string]struct {
+		volumeID      string
+		volumeContext map[string]string
+		labels        map[string]string
+		expLabels     map[string]string
+	}{
+		"labels should be added to a request without labels": {
+			volumeID: "vol-id",
+			expLabels: map[string]string{
+				"app.kubernetes.io/managed-by":  "cert-manager-csi-driver",
+				"csi.cert-manager.io/volume-id": "vol-id",
+			},
+		},
+		"existing labels should be kept and not overwritten": {
+			volumeID: "vol-id",
+			labels: map[string]string{
+				"app.kubernetes.io/managed-by":       "someone-else",
+				"csi.cert-manager.io/volume-id-hash": "abc",
+			},
+			expLabels: map[string]string{
+				"app.kubernetes.io/managed-by":       "someone-else",
+				"csi.cert-manager.io/volume-id":      "vol-id",
+				"csi.cert-manager.io/volume-id-hash": "abc",
+			},
+		},
+		"labels requested by the volume should be added without overwriting existing labels": {
+			volumeID: "vol-id",
+			volumeContext: map[string]string{
+				"csi.cert-manager.io/labels": "team=payments,csi.cert-manager.io/volume-id-hash=other",
+			},
+			labels: map[string]string{
+				"csi.cert-manager.io/volume-id-hash": "abc",
+			},
+			expLabels: map[string]string{
+				"app.kubernetes.io/managed-by":       "cert-manager-csi-driver",
+				"csi.cert-manager.io/volume-id":      "vol-id",
+				"csi.cert-manager.io/volume-id-hash": "abc",
+				"team":                               "payments",
+			},
+		},
+		"long kubelet volume IDs should be truncated with a hash suffix": {
+			volumeID: "csi-0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			expLabels: map[string]string{
+				"app.kubernetes.io/managed-by":  "cert-manager-csi-driver",
+				"csi.cert-manager.io/volume-id": "csi-0123456789abcdef0123456789abcdef0123456789-0b769ca6a312a5a1",
+			},
+		},
+		"volume IDs which are not valid label values should be omitted": {
+			volumeID: "vol/id",
+			expLabels: map[string]string{
+				"app.kubernetes.io/managed-by": "cert-manager-csi-driver",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeClient := cmfake.NewSimpleClientset()
+			clientForMeta := WithLabels(func(metadata.Metadata) (cmclient.Interface, error) {
+				return fakeClient, nil
+			})
+
+			client, err := clientForMeta(metadata.Metadata{VolumeID: test.volumeID, VolumeContext: test.volumeContext})
+			require.NoError(t, err)
+
+			cr := &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", Name: "my-cr", Labels: test.labels}}
+			created, err := client.CertmanagerV1().CertificateRequests("my-namespace").Create(context.Background(), cr, metav1.CreateOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, test.expLabels, created.Labels)
+
+			stored, err := fakeClient.CertmanagerV1().CertificateRequests("my-namespace").Get(context.Background(), "my-cr", metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, test.expLabels, stored.Labels)
+		})
+	}
+}
+
+func Test_VolumeIDLabelValue(t *testing.T) {
+	tests := map[string]struct {
+		volumeID string
+		expValue string
+	}{
+		"short volume IDs should be unchanged": {
+			volumeID: "vol-id",
+			expValue: "vol-id",
+		},
+		"volume IDs of the maximum length should be unchanged": {
+			volumeID: strings.Repeat("a", 63),
+			expValue: strings.Repeat("a", 63),
+		},
+		"volume IDs one longer than the maximum length should be hashed": {
+			volumeID: strings.Repeat("a", 64),
+			expValue: strings.Repeat("a", 46) + "-ffe054fe7ae0cb6d",
+		},
+		"separators before the hash suffix should be trimmed": {
+			volumeID: strings.Repeat("a", 40) + strings.Repeat("-", 100),
+			expValue: strings.Repeat("a", 40) + "-0efa8d874f7a41d5",
+		},
+		"volume IDs which are not valid label values should be omitted": {
+			volumeID: "vol/id",
+			expValue: "",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.expValue, VolumeIDLabelValue(test.volumeID))
+		})
+	}
+}
+
+func Test_VolumeIDLabelValue_longInputs(t *testing.T) {
+	seen := make(map[string]string)
+	for _, length := range []int{64, 100, 253, 1000, 10000} {
+		for _, last := range []string{"a", "b"} {
+			volumeID := "csi-" + strings.Repeat("0", length) + last
+
+			value := VolumeIDLabelValue(volumeID)
+			assert.Empty(t, validation.IsValidLabelValue(value), "expected %q to be a valid label value", value)
+			assert.NotEmpty(t, value)
+			assert.Equal(t, value, VolumeIDLabelValue(volumeID), "expected the value to be stable")
+
+			if other, ok := seen[value]; ok {
+				t.Errorf("volume IDs %q and %q have the same label value %q", other, volumeID, value)
+			}
+			seen[value] = volumeID
+		}
+	}
+}
+
+func Test_HashIdentifier(t *testing.T) {
+	// The values must match the node and volume ID hash labels set by
+	// csi-lib, so are pinned.
+	assert.Equal(t, "9bd6bbf5f", HashIdentifier("node-1"))
+	assert.Equal(t, "78c56d69fd", HashIdentifier("vol-1"))
+	assert.Equal(t, ManagedByLabelKey+"="+ManagedByLabelValue+","+NodeIDHashLabelKey+"=9bd6bbf5f", NodeSelector("node-1"))
+}
@@ -0,0 +1,298 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmv1client "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/typed/certmanager/v1"
+	"github.com/cert-manager/csi-lib/manager"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RequestLimiter bounds the number of CertificateRequests the driver has
+// outstanding at once. A request is outstanding from when it is created until
+// its certificate has been written to the volume, the next request for the
+// volume is created, or the volume is removed. Creating a request while the
+// limit is reached blocks until another request completes, or the context is
+// cancelled.
+//
+// Requests which renew the certificate of a volume may be further bounded, so
+// that a wave of renewals cannot use all the requests available to volumes
+// being mounted. Mounts waiting for a request are also given priority over
+// waiting renewals, since pods cannot start until their volume is mounted.
+type RequestLimiter struct {
+	// max is the maximum number of outstanding requests, and maxRenewals the
+	// maximum number which are renewals. The value 0 does not limit requests.
+	max, maxRenewals int
+
+	// inflight, if set, is called with the number of outstanding requests
+	// whenever it changes.
+	inflight func(n int)
+	// waiting, if set, is called with the number of mounts and renewals
+	// waiting to create a request whenever either changes.
+	waiting func(initial, renewals int)
+
+	// lock protects all fields below.
+	lock sync.Mutex
+	// volumes holds the volumes which have a request outstanding, and
+	// whether that request is a renewal.
+	volumes map[string]bool
+	// reserved and reservedRenewals are the number of requests, and of those
+	// renewals, which are outstanding or being created.
+	reserved, reservedRenewals int
+	// waitingInitial and waitingRenewals are the number of mounts and
+	// renewals waiting to create a request.
+	waitingInitial, waitingRenewals int
+	// changed is closed, and replaced, whenever a waiting request may be able
+	// to proceed.
+	changed chan struct{}
+	// stopped is set once the driver is shutting down, after which no further
+	// requests may be created.
+	stopped bool
+}
+
+// errStopped is returned when creating a request after the limiter has been
+// stopped.
+var errStopped = errors.New("driver is shutting down")
+
+// NewRequestLimiter returns a RequestLimiter allowing at most max outstanding
+// requests, of which at most maxRenewals are renewals. The value 0 does not
+// limit requests, but still counts them. If set, inflight is called with the
+// number of outstanding requests, and waiting with the number of mounts and
+// renewals waiting to create a request, whenever they change.
+func NewRequestLimiter(max, maxRenewals int, inflight func(n int), waiting func(initial, renewals int)) *RequestLimiter {
+	return &RequestLimiter{
+		max:         max,
+		maxRenewals: maxRenewals,
+		inflight:    inflight,
+		waiting:     waiting,
+		volumes:     make(map[string]bool),
+		changed:     make(chan struct{}),
+	}
+}
+
+// WithLimit wraps the given ClientForMetadataFunc so that every
+// CertificateRequest created with the returned clients is outstanding until it
+// is released. The request of any previous issuance attempt for the volume is
+// released first. Requests for volumes which have previously been issued a
+// certificate are renewals.
+func (l *RequestLimiter) WithLimit(clientForMeta manager.ClientForMetadataFunc) manager.ClientForMetadataFunc {
+	return interceptCreate(clientForMeta, func(ctx context.Context, meta metadata.Metadata, client cmv1client.CertificateRequestInterface,
+		cr *cmapi.CertificateRequest, opts metav1.CreateOptions) (*cmapi.CertificateRequest, error) {
+		l.Release(meta.VolumeID)
+
+		renewal := meta.NextIssuanceTime != nil && !meta.NextIssuanceTime.IsZero()
+		if err := l.reserve(ctx, renewal); err != nil {
+			return nil, fmt.Errorf("waiting for an outstanding CertificateRequest to complete: %w", err)
+		}
+
+		created, err := client.Create(ctx, cr, opts)
+
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		if err != nil {
+			l.unreserve(renewal)
+			return nil, err
+		}
+		l.volumes[meta.VolumeID] = renewal
+		l.recordInflight()
+
+		return created, nil
+	})
+}
+
+// reserve blocks until a request may be created, or the context is cancelled.
+func (l *RequestLimiter) reserve(ctx context.Context, renewal bool) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.addWaiting(renewal, 1)
+	defer l.addWaiting(renewal, -1)
+
+	for !l.available(renewal) {
+		if l.stopped {
+			return errStopped
+		}
+		changed := l.changed
+		l.lock.Unlock()
+		select {
+		case <-changed:
+			l.lock.Lock()
+		case <-ctx.Done():
+			l.lock.Lock()
+			return ctx.Err()
+		}
+	}
+
+	l.reserved++
+	if renewal {
+		l.reservedRenewals++
+	}
+
+	return nil
+}
+
+// available returns whether a request may be created. Renewals wait while any
+// mount is waiting. Must be called with the lock held.
+func (l *RequestLimiter) available(renewal bool) bool {
+	if l.stopped {
+		return false
+	}
+	if l.max > 0 && l.reserved >= l.max {
+		return false
+	}
+	if renewal {
+		if l.waitingInitial > 0 {
+			return false
+		}
+		if l.maxRenewals > 0 && l.reservedRenewals >= l.maxRenewals {
+			return false
+		}
+	}
+	return true
+}
+
+// unreserve releases a reserved request, allowing a waiting request to
+// proceed. Must be called with the lock held.
+func (l *RequestLimiter) unreserve(renewal bool) {
+	l.reserved--
+	if renewal {
+		l.reservedRenewals--
+	}
+	l.notify()
+}
+
+// notify wakes every waiting request to check whether it may proceed. Must be
+// called with the lock held.
+func (l *RequestLimiter) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// addWaiting adds delta to the number of mounts or renewals waiting, and
+// reports the new numbers. Must be called with the lock held.
+func (l *RequestLimiter) addWaiting(renewal bool, delta int) {
+	if renewal {
+		l.waitingRenewals += delta
+	} else {
+		l.waitingInitial += delta
+		// Renewals waiting behind this mount may now be able to proceed.
+		if delta < 0 {
+			l.notify()
+		}
+	}
+	if l.waiting != nil {
+		l.waiting(l.waitingInitial, l.waitingRenewals)
+	}
+}
+
+// Release releases the outstanding request of the given volume, if any.
+func (l *RequestLimiter) Release(volumeID string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	renewal, ok := l.volumes[volumeID]
+	if !ok {
+		return
+	}
+	delete(l.volumes, volumeID)
+	l.unreserve(renewal)
+	l.recordInflight()
+}
+
+// Stop stops the limiter for shutdown. Requests waiting to be created, and
+// any created after, fail. Outstanding requests are unaffected.
+func (l *RequestLimiter) Stop() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.stopped = true
+	l.notify()
+}
+
+// Drain blocks until no request is outstanding or being created, or the
+// context is cancelled.
+func (l *RequestLimiter) Drain(ctx context.Context) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for l.reserved > 0 {
+		changed := l.changed
+		l.lock.Unlock()
+		select {
+		case <-changed:
+			l.lock.Lock()
+		case <-ctx.Done():
+			l.lock.Lock()
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// Outstanding returns the IDs of the volumes with a request outstanding,
+// sorted.
+func (l *RequestLimiter) Outstanding() []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return slices.Sorted(maps.Keys(l.volumes))
+}
+
+// recordInflight reports the number of outstanding requests. Must be called
+// with the lock held.
+func (l *RequestLimiter) recordInflight() {
+	if l.inflight != nil {
+		l.inflight(len(l.volumes))
+	}
+}
+
+// InstrumentWriteKeypair wraps the given function, which csi-lib calls once
+// the certificate has been read from a request, to release the request of the
+// volume whether or not writing succeeds.
+func (l *RequestLimiter) InstrumentWriteKeypair(f manager.WriteKeypairFunc) manager.WriteKeypairFunc {
+	return func(meta metadata.Metadata, key crypto.PrivateKey, chain []byte, ca []byte) error {
+		defer l.Release(meta.VolumeID)
+		return f(meta, key, chain, ca)
+	}
+}
+
+// LimitedStore wraps a storage backend to release the outstanding request of
+// volumes which are removed.
+type LimitedStore struct {
+	storage.Interface
+
+	Limiter *RequestLimiter
+}
+
+// RemoveVolume removes the volume from the storage backend, and releases its
+// outstanding request.
+func (s *LimitedStore) RemoveVolume(volumeID string) error {
+	s.Limiter.Release(volumeID)
+	return s.Interface.RemoveVolume(volumeID)
+}
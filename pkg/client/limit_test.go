@@ -0,0 +1,200 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"crypto"
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
+	cmfake "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/fake"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_RequestLimiter(t *testing.T) {
+	var inflight []int
+	l := NewRequestLimiter(2, 0, func(n int) { inflight = append(inflight, n) }, nil)
+	clientForMeta := l.WithLimit(func(metadata.Metadata) (cmclient.Interface, error) {
+		return cmfake.NewSimpleClientset(), nil
+	})
+
+	create := func(ctx context.Context, volumeID, name string) error {
+		client, err := clientForMeta(metadata.Metadata{VolumeID: volumeID})
+		require.NoError(t, err)
+		cr := &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", Name: name}}
+		_, err = client.CertmanagerV1().CertificateRequests("my-namespace").Create(ctx, cr, metav1.CreateOptions{})
+		return err
+	}
+
+	require.NoError(t, create(context.Background(), "vol-1", "cr-1"))
+	require.NoError(t, create(context.Background(), "vol-2", "cr-2"))
+
+	// A retry for a volume replaces its outstanding request, so should not
+	// block.
+	require.NoError(t, create(context.Background(), "vol-2", "cr-3"))
+
+	// Once the limit is reached, creating a request should block until the
+	// context is cancelled.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	assert.ErrorIs(t, create(ctx, "vol-3", "cr-4"), context.DeadlineExceeded)
+
+	// A blocked request should be created once another completes.
+	done := make(chan error)
+	go func() { done <- create(context.Background(), "vol-3", "cr-5") }()
+
+	writeKeypair := l.InstrumentWriteKeypair(func(metadata.Metadata, crypto.PrivateKey, []byte, []byte) error {
+		return nil
+	})
+	require.NoError(t, writeKeypair(metadata.Metadata{VolumeID: "vol-1"}, nil, nil, nil))
+	require.NoError(t, <-done)
+
+	// Removing a volume should release its request.
+	store := &LimitedStore{Interface: storage.NewMemoryFS(), Limiter: l}
+	_, err := store.RegisterMetadata(metadata.Metadata{VolumeID: "vol-2"})
+	require.NoError(t, err)
+	require.NoError(t, store.RemoveVolume("vol-2"))
+
+	assert.Equal(t, []int{1, 2, 1, 2, 1, 2, 1}, inflight)
+}
+
+func Test_RequestLimiter_unlimited(t *testing.T) {
+	var inflight int
+	l := NewRequestLimiter(0, 0, func(n int) { inflight = n }, nil)
+	clientForMeta := l.WithLimit(func(metadata.Metadata) (cmclient.Interface, error) {
+		return cmfake.NewSimpleClientset(), nil
+	})
+
+	for _, volumeID := range []string{"vol-1", "vol-2", "vol-3"} {
+		client, err := clientForMeta(metadata.Metadata{VolumeID: volumeID})
+		require.NoError(t, err)
+		cr := &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", Name: volumeID}}
+		_, err = client.CertmanagerV1().CertificateRequests("my-namespace").Create(context.Background(), cr, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 3, inflight)
+}
+
+func Test_RequestLimiter_renewals(t *testing.T) {
+	var waiting [2]int
+	l := NewRequestLimiter(3, 1, nil, func(initial, renewals int) { waiting = [2]int{initial, renewals} })
+	clientForMeta := l.WithLimit(func(metadata.Metadata) (cmclient.Interface, error) {
+		return cmfake.NewSimpleClientset(), nil
+	})
+
+	issued := time.Now()
+	create := func(ctx context.Context, volumeID string, renewal bool) error {
+		meta := metadata.Metadata{VolumeID: volumeID}
+		if renewal {
+			meta.NextIssuanceTime = &issued
+		}
+		client, err := clientForMeta(meta)
+		require.NoError(t, err)
+		cr := &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", Name: volumeID}}
+		_, err = client.CertmanagerV1().CertificateRequests("my-namespace").Create(ctx, cr, metav1.CreateOptions{})
+		return err
+	}
+	writeKeypair := l.InstrumentWriteKeypair(func(metadata.Metadata, crypto.PrivateKey, []byte, []byte) error {
+		return nil
+	})
+
+	// Once the renewal limit is reached, further renewals should block while
+	// mounts are still allowed.
+	require.NoError(t, create(context.Background(), "vol-renew-1", true))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	assert.ErrorIs(t, create(ctx, "vol-renew-2", true), context.DeadlineExceeded)
+	require.NoError(t, create(context.Background(), "vol-mount-1", false))
+	require.NoError(t, create(context.Background(), "vol-mount-2", false))
+
+	// With every request outstanding, a waiting mount should be given the
+	// request released by a renewal ahead of a waiting renewal.
+	renewDone, mountDone := make(chan error), make(chan error)
+	go func() { renewDone <- create(context.Background(), "vol-renew-2", true) }()
+	assert.Eventually(t, func() bool { return l.waitingCount() == [2]int{0, 1} }, time.Second, time.Millisecond)
+	go func() { mountDone <- create(context.Background(), "vol-mount-3", false) }()
+	assert.Eventually(t, func() bool { return l.waitingCount() == [2]int{1, 1} }, time.Second, time.Millisecond)
+
+	require.NoError(t, writeKeypair(metadata.Metadata{VolumeID: "vol-renew-1"}, nil, nil, nil))
+	require.NoError(t, <-mountDone)
+	select {
+	case err := <-renewDone:
+		t.Fatalf("renewal should still be waiting, got: %v", err)
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	// The renewal should proceed once another request completes.
+	require.NoError(t, writeKeypair(metadata.Metadata{VolumeID: "vol-mount-1"}, nil, nil, nil))
+	require.NoError(t, <-renewDone)
+	assert.Equal(t, [2]int{0, 0}, waiting)
+}
+
+// waitingCount returns the number of mounts and renewals waiting.
+func (l *RequestLimiter) waitingCount() [2]int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return [2]int{l.waitingInitial, l.waitingRenewals}
+}
+
+func Test_RequestLimiter_Stop(t *testing.T) {
+	l := NewRequestLimiter(1, 0, nil, nil)
+	clientForMeta := l.WithLimit(func(metadata.Metadata) (cmclient.Interface, error) {
+		return cmfake.NewSimpleClientset(), nil
+	})
+
+	create := func(volumeID string) error {
+		client, err := clientForMeta(metadata.Metadata{VolumeID: volumeID})
+		require.NoError(t, err)
+		cr := &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", Name: volumeID}}
+		_, err = client.CertmanagerV1().CertificateRequests("my-namespace").Create(context.Background(), cr, metav1.CreateOptions{})
+		return err
+	}
+
+	require.NoError(t, create("vol-1"))
+
+	// A request waiting for the limit should fail once stopped.
+	blocked := make(chan error)
+	go func() { blocked <- create("vol-2") }()
+	require.Eventually(t, func() bool {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		return l.waitingInitial == 1
+	}, time.Second, time.Millisecond*10)
+	l.Stop()
+	assert.ErrorIs(t, <-blocked, errStopped)
+	assert.ErrorIs(t, create("vol-3"), errStopped)
+
+	// Draining should wait for the outstanding request.
+	assert.Equal(t, []string{"vol-1"}, l.Outstanding())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	assert.ErrorIs(t, l.Drain(ctx), context.DeadlineExceeded)
+
+	drained := make(chan error)
+	go func() { drained <- l.Drain(context.Background()) }()
+	l.Release("vol-1")
+	require.NoError(t, <-drained)
+	assert.Empty(t, l.Outstanding())
+}
@@ -0,0 +1,140 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"text/template"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmv1client "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/typed/certmanager/v1"
+	"github.com/cert-manager/csi-lib/manager"
+	"github.com/cert-manager/csi-lib/metadata"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/cert-manager/csi-driver/pkg/apis/defaults"
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+)
+
+// RequestNameData holds the fields available to a request name template.
+type RequestNameData struct {
+	PodNamespace string
+	PodName      string
+	PodUID       string
+	VolumeID     string
+	IssuerName   string
+	IssuerKind   string
+}
+
+// ParseRequestNameTemplate parses a request name template, and checks that it
+// executes.
+func ParseRequestNameTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("request-name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(new(strings.Builder), RequestNameData{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// WithRequestName wraps the given ClientForMetadataFunc so that every
+// CertificateRequest created with the returned clients is named from the
+// given template, executed with the RequestNameData of the volume.
+//
+// The result is sanitised to a legal object name: lower cased, with runs of
+// any other character than a letter or digit replaced by "-". It is then
+// truncated, and suffixed with a hash of the name csi-lib generated, so that
+// every request remains unique. If the template renders no legal characters,
+// the generated name is used unchanged.
+//
+// WithRequestName must wrap WithRetry, rather than be wrapped by it, so that a
+// retry which finds the request already exists looks it up by the rendered
+// name.
+func WithRequestName(clientForMeta manager.ClientForMetadataFunc, tmpl *template.Template) manager.ClientForMetadataFunc {
+	return interceptCreate(clientForMeta, func(ctx context.Context, meta metadata.Metadata, client cmv1client.CertificateRequestInterface,
+		cr *cmapi.CertificateRequest, opts metav1.CreateOptions) (*cmapi.CertificateRequest, error) {
+		name, err := requestName(tmpl, meta, cr.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		cr = cr.DeepCopy()
+		cr.Name = name
+
+		return client.Create(ctx, cr, opts)
+	})
+}
+
+// requestName returns the name of a request for the given volume, from the
+// template and the name generated by csi-lib.
+func requestName(tmpl *template.Template, meta metadata.Metadata, generated string) (string, error) {
+	attrs, err := defaults.SetDefaultAttributes(meta.VolumeContext)
+	if err != nil {
+		attrs = meta.VolumeContext
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, RequestNameData{
+		PodNamespace: attrs[csiapi.K8sVolumeContextKeyPodNamespace],
+		PodName:      attrs[csiapi.K8sVolumeContextKeyPodName],
+		PodUID:       attrs[csiapi.K8sVolumeContextKeyPodUID],
+		VolumeID:     meta.VolumeID,
+		IssuerName:   attrs[csiapi.IssuerNameKey],
+		IssuerKind:   attrs[csiapi.IssuerKindKey],
+	}); err != nil {
+		return "", fmt.Errorf("executing request name template: %w", err)
+	}
+
+	prefix := sanitizeName(b.String())
+	if len(prefix) == 0 {
+		return generated, nil
+	}
+
+	sum := sha256.Sum256([]byte(generated))
+	suffix := hex.EncodeToString(sum[:])[:hashSuffixLength]
+	if max := validation.DNS1123SubdomainMaxLength - len(suffix) - 1; len(prefix) > max {
+		prefix = strings.TrimRight(prefix[:max], "-")
+	}
+	return prefix + "-" + suffix, nil
+}
+
+// sanitizeName lower cases the given name, and replaces each run of
+// characters other than letters and digits with a single "-", trimming any
+// from either end.
+func sanitizeName(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return b.String()
+}
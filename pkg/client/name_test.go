@@ -0,0 +1,160 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
+	cmfake "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/fake"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func Test_ParseRequestNameTemplate(t *testing.T) {
+	tests := map[string]struct {
+		template string
+		expErr   bool
+	}{
+		"a template using known fields should parse": {
+			template: "{{.PodNamespace}}-{{.PodName}}-{{.VolumeID}}",
+			expErr:   false,
+		},
+		"a malformed template should error": {
+			template: "{{.PodName",
+			expErr:   true,
+		},
+		"a template using an unknown field should error": {
+			template: "{{.Pod}}",
+			expErr:   true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseRequestNameTemplate(test.template)
+			assert.Equal(t, test.expErr, err != nil, "%v", err)
+		})
+	}
+}
+
+func Test_WithRequestName(t *testing.T) {
+	tests := map[string]struct {
+		template string
+		podName  string
+		expName  string
+	}{
+		"the rendered name should be suffixed with a hash of the generated name": {
+			template: "{{.PodNamespace}}-{{.PodName}}",
+			podName:  "my-pod",
+			expName:  "my-namespace-my-pod-a058bbfb0dc2fc47",
+		},
+		"illegal characters should be replaced": {
+			template: "{{.PodNamespace}}/{{.PodName}}",
+			podName:  "My_Pod.",
+			expName:  "my-namespace-my-pod-a058bbfb0dc2fc47",
+		},
+		"a template rendering no legal characters should keep the generated name": {
+			template: "--",
+			podName:  "my-pod",
+			expName:  "generated-uuid",
+		},
+		"long names should be truncated to a legal length": {
+			template: "{{.PodName}}",
+			podName:  strings.Repeat("a", 300),
+			expName:  strings.Repeat("a", validation.DNS1123SubdomainMaxLength-17) + "-a058bbfb0dc2fc47",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tmpl, err := ParseRequestNameTemplate(test.template)
+			require.NoError(t, err)
+
+			fakeClient := cmfake.NewSimpleClientset()
+			clientForMeta := WithRequestName(func(metadata.Metadata) (cmclient.Interface, error) {
+				return fakeClient, nil
+			}, tmpl)
+
+			meta := metadata.Metadata{VolumeID: "vol-id", VolumeContext: map[string]string{
+				"csi.storage.k8s.io/pod.namespace": "my-namespace",
+				"csi.storage.k8s.io/pod.name":      test.podName,
+			}}
+			client, err := clientForMeta(meta)
+			require.NoError(t, err)
+
+			cr := &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", Name: "generated-uuid"}}
+			created, err := client.CertmanagerV1().CertificateRequests("my-namespace").Create(context.Background(), cr, metav1.CreateOptions{})
+			require.NoError(t, err)
+
+			assert.Equal(t, test.expName, created.Name)
+			assert.Empty(t, validation.IsDNS1123Subdomain(created.Name))
+			assert.Equal(t, "generated-uuid", cr.Name, "the request passed in should not be modified")
+		})
+	}
+}
+
+func Test_WithRequestName_retry(t *testing.T) {
+	tmpl, err := ParseRequestNameTemplate("{{.PodName}}")
+	require.NoError(t, err)
+
+	// The first create is persisted, but returns a transient error.
+	fakeClient := cmfake.NewSimpleClientset()
+	var creates int
+	fakeClient.PrependReactor("create", "certificaterequests", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		creates++
+		if creates > 1 {
+			return false, nil, nil
+		}
+		require.NoError(t, fakeClient.Tracker().Add(action.(k8stesting.CreateAction).GetObject()))
+		return true, nil, apierrors.NewServiceUnavailable("unavailable")
+	})
+
+	// Requests are named before they are retried, as in the driver.
+	clientForMeta := WithRequestName(WithRetry(logr.Discard(), func(metadata.Metadata) (cmclient.Interface, error) {
+		return fakeClient, nil
+	}, wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3}), tmpl)
+
+	meta := metadata.Metadata{VolumeID: "vol-id", VolumeContext: map[string]string{
+		"csi.storage.k8s.io/pod.namespace": "my-namespace",
+		"csi.storage.k8s.io/pod.name":      "my-pod",
+	}}
+	client, err := clientForMeta(meta)
+	require.NoError(t, err)
+
+	cr := &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", Name: "generated-uuid"}}
+	created, err := client.CertmanagerV1().CertificateRequests("my-namespace").Create(context.Background(), cr, metav1.CreateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "my-pod-a058bbfb0dc2fc47", created.Name)
+	assert.Equal(t, 2, creates)
+
+	list, err := fakeClient.CertmanagerV1().CertificateRequests("my-namespace").List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, list.Items, 1)
+}
@@ -0,0 +1,44 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmv1client "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/typed/certmanager/v1"
+	"github.com/cert-manager/csi-lib/manager"
+	"github.com/cert-manager/csi-lib/metadata"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WithCreateObserver wraps the given ClientForMetadataFunc so that observe is
+// called with every CertificateRequest successfully created with the returned
+// clients, and the volume it was created for.
+func WithCreateObserver(clientForMeta manager.ClientForMetadataFunc, observe func(metadata.Metadata, *cmapi.CertificateRequest)) manager.ClientForMetadataFunc {
+	return interceptCreate(clientForMeta, func(ctx context.Context, meta metadata.Metadata, client cmv1client.CertificateRequestInterface,
+		cr *cmapi.CertificateRequest, opts metav1.CreateOptions) (*cmapi.CertificateRequest, error) {
+		created, err := client.Create(ctx, cr, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		observe(meta, created)
+
+		return created, nil
+	})
+}
@@ -0,0 +1,52 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"testing"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
+	cmfake "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/fake"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_WithCreateObserver(t *testing.T) {
+	var observed []string
+	clientForMeta := WithCreateObserver(func(metadata.Metadata) (cmclient.Interface, error) {
+		return cmfake.NewSimpleClientset(), nil
+	}, func(meta metadata.Metadata, cr *cmapi.CertificateRequest) {
+		observed = append(observed, meta.VolumeID+"/"+cr.Name)
+	})
+
+	client, err := clientForMeta(metadata.Metadata{VolumeID: "vol-id"})
+	require.NoError(t, err)
+
+	cr := &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", Name: "my-cr"}}
+	_, err = client.CertmanagerV1().CertificateRequests("my-namespace").Create(context.Background(), cr, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	// Failed creates should not be observed.
+	_, err = client.CertmanagerV1().CertificateRequests("my-namespace").Create(context.Background(), cr, metav1.CreateOptions{})
+	require.Error(t, err)
+
+	assert.Equal(t, []string{"vol-id/my-cr"}, observed)
+}
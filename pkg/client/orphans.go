@@ -0,0 +1,139 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
+	cmv1client "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/typed/certmanager/v1"
+	"github.com/cert-manager/csi-lib/manager"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/clock"
+)
+
+// WithNodeID wraps the given ClientForMetadataFunc so that every
+// CertificateRequest created with the returned clients is annotated with the
+// ID of the node whose driver created it, so that the OrphanReaper of that
+// node can find it.
+func WithNodeID(clientForMeta manager.ClientForMetadataFunc, nodeID string) manager.ClientForMetadataFunc {
+	return interceptCreate(clientForMeta, func(ctx context.Context, meta metadata.Metadata, client cmv1client.CertificateRequestInterface,
+		cr *cmapi.CertificateRequest, opts metav1.CreateOptions) (*cmapi.CertificateRequest, error) {
+		cr = cr.DeepCopy()
+		if cr.Annotations == nil {
+			cr.Annotations = make(map[string]string)
+		}
+		cr.Annotations[NodeIDAnnotationKey] = nodeID
+
+		return client.Create(ctx, cr, opts)
+	})
+}
+
+// VolumeLister lists the IDs of the volumes in a storage backend.
+type VolumeLister interface {
+	ListVolumes() ([]string, error)
+}
+
+// OrphanReaper periodically deletes the CertificateRequests created by the
+// driver on this node whose volume no longer exists, such as those left
+// behind when the node stopped without unpublishing its volumes.
+//
+// Only requests which are labelled as managed by the driver, labelled with
+// their volume ID and the hash of this node's ID, and annotated with the ID of
+// this node are considered. Selecting on the node hash label keeps each list
+// to the requests of this node, rather than every request in the cluster.
+// Requests are listed before volumes, and a volume is always registered before
+// its requests are created, so a listed request whose volume is not found has
+// been orphaned.
+type OrphanReaper struct {
+	Log    logr.Logger
+	Client cmclient.Interface
+	Store  VolumeLister
+	Clock  clock.Clock
+
+	// NodeID is the name of the node which is hosting this driver instance.
+	NodeID string
+
+	// Interval is the time waited between each cleanup.
+	Interval time.Duration
+}
+
+// Run deletes orphaned requests every interval, until the context is
+// cancelled.
+func (r *OrphanReaper) Run(ctx context.Context) error {
+	for {
+		if err := r.reap(ctx); err != nil {
+			r.Log.Error(err, "Failed to delete orphaned CertificateRequests")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-r.Clock.After(r.Interval):
+		}
+	}
+}
+
+// reap deletes the requests of this node whose volume no longer exists.
+func (r *OrphanReaper) reap(ctx context.Context) error {
+	list, err := r.Client.CertmanagerV1().CertificateRequests(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		LabelSelector: NodeSelector(r.NodeID) + "," + VolumeIDLabelKey,
+	})
+	if err != nil {
+		return fmt.Errorf("listing CertificateRequests: %w", err)
+	}
+
+	ids, err := r.Store.ListVolumes()
+	if err != nil {
+		return fmt.Errorf("listing volumes: %w", err)
+	}
+
+	// Requests are labelled with the volume ID as a label value, which may be
+	// truncated, so compare the label values.
+	volumes := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		volumes[VolumeIDLabelValue(id)] = true
+	}
+
+	var errs []error
+	for _, cr := range list.Items {
+		if cr.Annotations[NodeIDAnnotationKey] != r.NodeID || cr.DeletionTimestamp != nil {
+			continue
+		}
+		volumeID := cr.Labels[VolumeIDLabelKey]
+		if len(volumeID) == 0 || volumes[volumeID] {
+			continue
+		}
+
+		r.Log.Info("Deleting CertificateRequest whose volume no longer exists", "namespace", cr.Namespace, "name", cr.Name, "volume_id", volumeID)
+		err := r.Client.CertmanagerV1().CertificateRequests(cr.Namespace).Delete(ctx, cr.Name, metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &cr.UID},
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("deleting %s/%s: %w", cr.Namespace, cr.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,144 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
+	cmfake "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/fake"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func Test_WithNodeID(t *testing.T) {
+	fakeClient := cmfake.NewSimpleClientset()
+	clientForMeta := WithNodeID(func(metadata.Metadata) (cmclient.Interface, error) {
+		return fakeClient, nil
+	}, "node-1")
+
+	client, err := clientForMeta(metadata.Metadata{VolumeID: "vol-id"})
+	require.NoError(t, err)
+	cr := &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", Name: "cr-1"}}
+	created, err := client.CertmanagerV1().CertificateRequests("my-namespace").Create(context.Background(), cr, metav1.CreateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{NodeIDAnnotationKey: "node-1"}, created.Annotations)
+}
+
+func Test_OrphanReaper_reap(t *testing.T) {
+	longVolumeID := "csi-" + strings.Repeat("a", 64)
+
+	request := func(name, nodeID, volumeID string) runtime.Object {
+		cr := &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "my-namespace",
+			Name:      name,
+			Labels:    map[string]string{ManagedByLabelKey: ManagedByLabelValue},
+		}}
+		if len(nodeID) > 0 {
+			cr.Labels[NodeIDHashLabelKey] = HashIdentifier(nodeID)
+			cr.Annotations = map[string]string{NodeIDAnnotationKey: nodeID}
+		}
+		if len(volumeID) > 0 {
+			cr.Labels[VolumeIDLabelKey] = VolumeIDLabelValue(volumeID)
+		}
+		return cr
+	}
+
+	tests := map[string]struct {
+		volumes     []string
+		requests    []runtime.Object
+		expRequests []string
+	}{
+		"if the volume of a request exists, expect it kept": {
+			volumes:     []string{"vol-1"},
+			requests:    []runtime.Object{request("cr-1", "node-1", "vol-1")},
+			expRequests: []string{"cr-1"},
+		},
+		"if the volume of a request no longer exists, expect it deleted": {
+			volumes:     []string{"vol-1"},
+			requests:    []runtime.Object{request("cr-1", "node-1", "vol-1"), request("cr-2", "node-1", "vol-2")},
+			expRequests: []string{"cr-1"},
+		},
+		"if the volume ID label is truncated, expect the request matched to its volume": {
+			volumes:     []string{longVolumeID},
+			requests:    []runtime.Object{request("cr-1", "node-1", longVolumeID)},
+			expRequests: []string{"cr-1"},
+		},
+		"if a request was created on another node, expect it kept": {
+			requests:    []runtime.Object{request("cr-1", "node-2", "vol-1")},
+			expRequests: []string{"cr-1"},
+		},
+		"if a request is labelled with the hash of another node, expect it kept": {
+			requests: []runtime.Object{&cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "my-namespace",
+				Name:        "cr-1",
+				Labels:      map[string]string{ManagedByLabelKey: ManagedByLabelValue, VolumeIDLabelKey: "vol-1", NodeIDHashLabelKey: HashIdentifier("node-2")},
+				Annotations: map[string]string{NodeIDAnnotationKey: "node-1"},
+			}}},
+			expRequests: []string{"cr-1"},
+		},
+		"if a request has no node annotation, expect it kept": {
+			requests:    []runtime.Object{request("cr-1", "", "vol-1")},
+			expRequests: []string{"cr-1"},
+		},
+		"if a request has no volume ID label, expect it kept": {
+			requests:    []runtime.Object{request("cr-1", "node-1", "")},
+			expRequests: []string{"cr-1"},
+		},
+		"if a request is not managed by the driver, expect it kept": {
+			requests: []runtime.Object{&cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "my-namespace",
+				Name:        "cr-1",
+				Labels:      map[string]string{VolumeIDLabelKey: "vol-1"},
+				Annotations: map[string]string{NodeIDAnnotationKey: "node-1"},
+			}}},
+			expRequests: []string{"cr-1"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			store := storage.NewMemoryFS()
+			for _, id := range test.volumes {
+				_, err := store.RegisterMetadata(metadata.Metadata{VolumeID: id})
+				require.NoError(t, err)
+			}
+
+			fakeClient := cmfake.NewSimpleClientset(test.requests...)
+			r := &OrphanReaper{Log: logr.Discard(), Client: fakeClient, Store: store, NodeID: "node-1"}
+			require.NoError(t, r.reap(context.Background()))
+
+			list, err := fakeClient.CertmanagerV1().CertificateRequests("my-namespace").List(context.Background(), metav1.ListOptions{})
+			require.NoError(t, err)
+			var names []string
+			for _, cr := range list.Items {
+				names = append(names, cr.Name)
+			}
+			sort.Strings(names)
+			assert.Equal(t, test.expRequests, names)
+		})
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmv1client "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/typed/certmanager/v1"
+	"github.com/cert-manager/csi-lib/manager"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/cert-manager/csi-driver/pkg/volumelog"
+)
+
+// DefaultRetryBackoff is the default backoff used when retrying transient
+// errors creating a CertificateRequest. Retries are spread over roughly 15
+// seconds, which is well within the time the kubelet waits for a volume to be
+// published.
+var DefaultRetryBackoff = wait.Backoff{
+	Duration: time.Second,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    5,
+}
+
+// WithRetry wraps the given ClientForMetadataFunc so that creating a
+// CertificateRequest is retried with the given backoff when the API server
+// returns a transient error, such as the cert-manager webhook being
+// unavailable during an upgrade. Permanent errors are returned immediately.
+func WithRetry(log logr.Logger, clientForMeta manager.ClientForMetadataFunc, backoff wait.Backoff) manager.ClientForMetadataFunc {
+	return interceptCreate(clientForMeta, func(ctx context.Context, meta metadata.Metadata, client cmv1client.CertificateRequestInterface,
+		cr *cmapi.CertificateRequest, opts metav1.CreateOptions) (*cmapi.CertificateRequest, error) {
+		var (
+			created *cmapi.CertificateRequest
+			lastErr error
+			retried bool
+		)
+
+		err := wait.ExponentialBackoffWithContext(ctx, backoff, func(ctx context.Context) (bool, error) {
+			var err error
+			created, err = client.Create(ctx, cr, opts)
+			switch {
+			case err == nil:
+				return true, nil
+
+			case retried && apierrors.IsAlreadyExists(err):
+				// A previous attempt may have been persisted despite returning an
+				// error, so use the existing request.
+				created, err = client.Get(ctx, cr.Name, metav1.GetOptions{})
+				return err == nil, err
+
+			case IsTransient(err):
+				volumelog.ForMetadata(log, meta).V(2).Info("Transient error creating CertificateRequest, retrying", "error", err.Error())
+				lastErr, retried = err, true
+				return false, nil
+
+			default:
+				return false, err
+			}
+		})
+		// Surface the last transient error rather than the backoff timeout.
+		if lastErr != nil && wait.Interrupted(err) {
+			return nil, lastErr
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return created, nil
+	})
+}
+
+// IsTransient returns true if the given error from creating a
+// CertificateRequest is likely to resolve itself, such as the API server
+// being briefly unreachable or overloaded, being unable to reach the
+// cert-manager webhook, or failing to convert the resource while cert-manager
+// is being upgraded.
+func IsTransient(err error) bool {
+	switch {
+	case apierrors.IsServiceUnavailable(err),
+		apierrors.IsServerTimeout(err),
+		apierrors.IsTimeout(err),
+		apierrors.IsTooManyRequests(err),
+		isStatusCode(err, http.StatusBadGateway):
+		return true
+
+	case utilnet.IsConnectionRefused(err),
+		utilnet.IsConnectionReset(err),
+		utilnet.IsProbableEOF(err):
+		return true
+
+	case apierrors.IsInternalError(err):
+		msg := err.Error()
+		return strings.Contains(msg, "failed calling webhook") ||
+			strings.Contains(msg, "conversion webhook")
+	}
+
+	return false
+}
+
+func isStatusCode(err error, code int32) bool {
+	var status apierrors.APIStatus
+	return errors.As(err, &status) && status.Status().Code == code
+}
@@ -0,0 +1,147 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
+	cmfake "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/fake"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var (
+	webhookErr    = apierrors.NewInternalError(errors.New(`failed calling webhook "webhook.cert-manager.io": failed to call webhook: connection refused`))
+	conversionErr = apierrors.NewInternalError(errors.New(`conversion webhook for cert-manager.io/v1, Kind=CertificateRequest failed: connection refused`))
+	forbiddenErr  = apierrors.NewForbidden(schema.GroupResource{Group: "cert-manager.io", Resource: "certificaterequests"}, "my-cr", errors.New("denied"))
+)
+
+func Test_WithRetry(t *testing.T) {
+	tests := map[string]struct {
+		// errs are the errors returned by each create, before the create is
+		// allowed to succeed.
+		errs []error
+
+		// persist records the request even when returning the error.
+		persist bool
+
+		expErr     error
+		expCreates int
+	}{
+		"no error should create once": {
+			expCreates: 1,
+		},
+		"transient webhook errors should be retried": {
+			errs:       []error{webhookErr, conversionErr},
+			expCreates: 3,
+		},
+		"permanent errors should not be retried": {
+			errs:       []error{forbiddenErr},
+			expErr:     forbiddenErr,
+			expCreates: 1,
+		},
+		"transient errors should return the last error once retries are exhausted": {
+			errs:       []error{webhookErr, webhookErr, conversionErr, webhookErr},
+			expErr:     conversionErr,
+			expCreates: 3,
+		},
+		"a flaky API server connection should be retried": {
+			errs:       []error{syscall.ECONNREFUSED, apierrors.NewGenericServerResponse(http.StatusBadGateway, "POST", schema.GroupResource{}, "", "", 0, true)},
+			expCreates: 3,
+		},
+		"a request persisted by a failed attempt should be returned": {
+			errs:       []error{apierrors.NewServiceUnavailable("unavailable")},
+			persist:    true,
+			expCreates: 2,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeClient := cmfake.NewSimpleClientset()
+
+			var creates int
+			fakeClient.PrependReactor("create", "certificaterequests", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				creates++
+				if creates > len(test.errs) {
+					return false, nil, nil
+				}
+				if test.persist {
+					cr := action.(k8stesting.CreateAction).GetObject()
+					require.NoError(t, fakeClient.Tracker().Add(cr))
+				}
+				return true, nil, test.errs[creates-1]
+			})
+
+			clientForMeta := WithRetry(logr.Discard(), func(metadata.Metadata) (cmclient.Interface, error) {
+				return fakeClient, nil
+			}, wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3})
+
+			client, err := clientForMeta(metadata.Metadata{VolumeID: "vol-id"})
+			require.NoError(t, err)
+
+			cr := &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", Name: "my-cr"}}
+			created, err := client.CertmanagerV1().CertificateRequests("my-namespace").Create(context.Background(), cr, metav1.CreateOptions{})
+			assert.Equal(t, test.expErr, err)
+			assert.Equal(t, test.expCreates, creates)
+			if test.expErr == nil {
+				require.NotNil(t, created)
+				assert.Equal(t, "my-cr", created.Name)
+			}
+		})
+	}
+}
+
+func Test_IsTransient(t *testing.T) {
+	tests := map[string]struct {
+		err    error
+		expect bool
+	}{
+		"webhook unavailable is transient":         {err: webhookErr, expect: true},
+		"conversion failure is transient":          {err: conversionErr, expect: true},
+		"service unavailable is transient":         {err: apierrors.NewServiceUnavailable("unavailable"), expect: true},
+		"too many requests is transient":           {err: apierrors.NewTooManyRequests("slow down", 1), expect: true},
+		"connection refused is transient":          {err: fmt.Errorf("dial tcp: %w", syscall.ECONNREFUSED), expect: true},
+		"connection reset is transient":            {err: fmt.Errorf("read tcp: %w", syscall.ECONNRESET), expect: true},
+		"bad gateway is transient":                 {err: apierrors.NewGenericServerResponse(http.StatusBadGateway, "POST", schema.GroupResource{}, "", "", 0, true), expect: true},
+		"other internal errors are permanent":      {err: apierrors.NewInternalError(errors.New("boom")), expect: false},
+		"forbidden is permanent":                   {err: forbiddenErr, expect: false},
+		"webhook denying the request is permanent": {err: apierrors.NewBadRequest(`admission webhook "webhook.cert-manager.io" denied the request`), expect: false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.expect, IsTransient(test.err))
+		})
+	}
+}
@@ -0,0 +1,246 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	cmapiutil "github.com/cert-manager/cert-manager/pkg/api/util"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/clock"
+
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+)
+
+// requestTimeoutInterval is the time waited between each check for
+// CertificateRequests which have exceeded the request timeout.
+const requestTimeoutInterval = time.Second * 10
+
+// RequestTimeout periodically deletes the CertificateRequests of the volumes
+// on this node which have not been signed or denied within the timeout, such
+// as those of a stuck issuer or which are never approved.
+//
+// csi-lib resumes a pending request on every attempt, so without a timeout a
+// request which is never signed is waited on forever, leaving the pod in
+// ContainerCreating. Once its request is deleted, the next attempt for the
+// volume fails with the reason, which the kubelet reports for the mount, and
+// the attempt after creates a fresh request.
+//
+// Only the requests labelled with the hash of this node's ID are listed, so
+// that each node lists its own requests rather than every request in the
+// cluster.
+//
+// A volume may request its own timeout with the
+// csi.cert-manager.io/request-timeout attribute, which is clamped to
+// MaxTimeout.
+type RequestTimeout struct {
+	Log    logr.Logger
+	Client cmclient.Interface
+	Store  VolumeReader
+	Clock  clock.Clock
+
+	// NodeID is the name of the node which is hosting this driver instance.
+	NodeID string
+
+	// Protector, if set, releases the in-flight finalizer of each request
+	// which is deleted. A deleted request which keeps the finalizer stays
+	// terminating, and is resumed by every later attempt for the volume.
+	Protector *InflightProtector
+
+	// Timeout is how long a request may be pending before it is deleted,
+	// for volumes which do not request their own timeout. The value 0
+	// disables the timeout for those volumes.
+	Timeout time.Duration
+
+	// MaxTimeout is the longest timeout a volume may request. Longer
+	// requested timeouts are clamped to it. The value 0 ignores requested
+	// timeouts, so that every volume uses Timeout.
+	MaxTimeout time.Duration
+
+	lock sync.Mutex
+	// timedOut holds the last request of each volume which was deleted,
+	// keyed by volume ID label value, until it is reported.
+	timedOut map[string]timedOutRequest
+}
+
+// timedOutRequest is a request which was deleted for exceeding the timeout.
+type timedOutRequest struct {
+	reason  string
+	deleted time.Time
+	timeout time.Duration
+}
+
+// VolumeReader lists the volumes in a storage backend, and reads their
+// metadata.
+type VolumeReader interface {
+	VolumeLister
+	ReadMetadata(volumeID string) (metadata.Metadata, error)
+}
+
+// Run deletes timed out requests every interval, until the context is
+// cancelled.
+func (t *RequestTimeout) Run(ctx context.Context) error {
+	for {
+		if err := t.expire(ctx); err != nil {
+			t.Log.Error(err, "Failed to delete timed out CertificateRequests")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.Clock.After(requestTimeoutInterval):
+		}
+	}
+}
+
+// ReadyToRequest returns false, once, for a volume whose last request was
+// deleted for timing out, so that the attempt fails with the reason.
+func (t *RequestTimeout) ReadyToRequest(meta metadata.Metadata) (bool, string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	key := VolumeIDLabelValue(meta.VolumeID)
+	req, ok := t.timedOut[key]
+	if !ok {
+		return true, ""
+	}
+	delete(t.timedOut, key)
+	return false, req.reason
+}
+
+// expire deletes the pending requests of the volumes on this node which were
+// created longer than the timeout ago.
+func (t *RequestTimeout) expire(ctx context.Context) error {
+	list, err := t.Client.CertmanagerV1().CertificateRequests(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		LabelSelector: NodeSelector(t.NodeID) + "," + VolumeIDLabelKey,
+	})
+	if err != nil {
+		return fmt.Errorf("listing CertificateRequests: %w", err)
+	}
+
+	ids, err := t.Store.ListVolumes()
+	if err != nil {
+		return fmt.Errorf("listing volumes: %w", err)
+	}
+	volumes := make(map[string]string, len(ids))
+	for _, id := range ids {
+		volumes[VolumeIDLabelValue(id)] = id
+	}
+
+	now := t.Clock.Now()
+
+	// Forget requests which were never reported, such as those of volumes
+	// which were not published again.
+	t.lock.Lock()
+	for key, req := range t.timedOut {
+		if now.Sub(req.deleted) >= req.timeout {
+			delete(t.timedOut, key)
+		}
+	}
+	t.lock.Unlock()
+
+	var errs []error
+	for _, cr := range list.Items {
+		volumeID := cr.Labels[VolumeIDLabelKey]
+		id, ok := volumes[volumeID]
+		if !ok || cr.DeletionTimestamp != nil || !requestIsPending(&cr) {
+			continue
+		}
+		timeout := t.timeoutFor(id)
+		age := now.Sub(cr.CreationTimestamp.Time)
+		if timeout <= 0 || age < timeout {
+			continue
+		}
+
+		reason := fmt.Sprintf("CertificateRequest %s/%s was not signed or denied within the request timeout of %s and has been deleted, check the issuer and approver; the next attempt creates a new request",
+			cr.Namespace, cr.Name, timeout)
+		t.Log.Info("Deleting CertificateRequest which exceeded the request timeout", "namespace", cr.Namespace, "name", cr.Name, "volume_id", volumeID, "age", age.Round(time.Second).String())
+		err := t.Client.CertmanagerV1().CertificateRequests(cr.Namespace).Delete(ctx, cr.Name, metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &cr.UID},
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("deleting %s/%s: %w", cr.Namespace, cr.Name, err))
+			continue
+		}
+		if t.Protector != nil && slices.Contains(cr.Finalizers, InflightFinalizer) {
+			// Release the volume, so the request is no longer tracked, and
+			// remove the finalizer from the request itself in case it was
+			// protected by an earlier run of the driver.
+			t.Protector.Release(id)
+			if err := t.Protector.removeFinalizer(ctx, types.NamespacedName{Namespace: cr.Namespace, Name: cr.Name}); err != nil {
+				errs = append(errs, fmt.Errorf("removing in-flight finalizer from %s/%s: %w", cr.Namespace, cr.Name, err))
+			}
+		}
+
+		t.lock.Lock()
+		if t.timedOut == nil {
+			t.timedOut = make(map[string]timedOutRequest)
+		}
+		t.timedOut[volumeID] = timedOutRequest{reason: reason, deleted: now, timeout: timeout}
+		t.lock.Unlock()
+	}
+
+	return errors.Join(errs...)
+}
+
+// timeoutFor returns the request timeout of the volume: the timeout it
+// requested clamped to MaxTimeout, or otherwise Timeout.
+func (t *RequestTimeout) timeoutFor(volumeID string) time.Duration {
+	if t.MaxTimeout <= 0 {
+		return t.Timeout
+	}
+	meta, err := t.Store.ReadMetadata(volumeID)
+	if err != nil {
+		t.Log.Error(err, "Failed to read volume metadata, using the default request timeout", "volume_id", volumeID)
+		return t.Timeout
+	}
+	s, ok := meta.VolumeContext[csiapi.RequestTimeoutKey]
+	if !ok {
+		return t.Timeout
+	}
+	// The attribute is validated when the volume is published.
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return t.Timeout
+	}
+	return min(d, t.MaxTimeout)
+}
+
+// requestIsPending returns true if the request has not been denied, and is
+// neither issued nor failed.
+func requestIsPending(cr *cmapi.CertificateRequest) bool {
+	if cmapiutil.CertificateRequestIsDenied(cr) {
+		return false
+	}
+	switch cmapiutil.CertificateRequestReadyReason(cr) {
+	case "", cmapi.CertificateRequestReasonPending:
+		return true
+	default:
+		return false
+	}
+}
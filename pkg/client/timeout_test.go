@@ -0,0 +1,282 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
+	cmfake "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/fake"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+)
+
+func Test_RequestTimeout_expire(t *testing.T) {
+	now := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	request := func(name, volumeID string, age time.Duration, conditions ...cmapi.CertificateRequestCondition) runtime.Object {
+		return &cmapi.CertificateRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:         "my-namespace",
+				Name:              name,
+				Labels:            map[string]string{ManagedByLabelKey: ManagedByLabelValue, VolumeIDLabelKey: VolumeIDLabelValue(volumeID), NodeIDHashLabelKey: HashIdentifier("node-1")},
+				CreationTimestamp: metav1.NewTime(now.Add(-age)),
+			},
+			Status: cmapi.CertificateRequestStatus{Conditions: conditions},
+		}
+	}
+	ready := func(status cmmeta.ConditionStatus, reason string) cmapi.CertificateRequestCondition {
+		return cmapi.CertificateRequestCondition{Type: cmapi.CertificateRequestConditionReady, Status: status, Reason: reason}
+	}
+
+	tests := map[string]struct {
+		volumes     []string
+		requested   map[string]string
+		maxTimeout  time.Duration
+		requests    []runtime.Object
+		expRequests []string
+		expTimedOut []string
+		expReason   string
+	}{
+		"if a pending request is younger than the timeout, expect it kept": {
+			volumes:     []string{"vol-1"},
+			requests:    []runtime.Object{request("cr-1", "vol-1", time.Minute)},
+			expRequests: []string{"cr-1"},
+		},
+		"if a request without conditions is older than the timeout, expect it deleted": {
+			volumes:     []string{"vol-1"},
+			requests:    []runtime.Object{request("cr-1", "vol-1", time.Minute*6)},
+			expTimedOut: []string{"vol-1"},
+		},
+		"if a pending request is older than the timeout, expect it deleted": {
+			volumes:     []string{"vol-1", "vol-2"},
+			requests:    []runtime.Object{request("cr-1", "vol-1", time.Minute*6, ready(cmmeta.ConditionFalse, cmapi.CertificateRequestReasonPending)), request("cr-2", "vol-2", time.Minute)},
+			expRequests: []string{"cr-2"},
+			expTimedOut: []string{"vol-1"},
+		},
+		"if an old request is issued, failed or denied, expect it kept": {
+			volumes: []string{"vol-1", "vol-2", "vol-3"},
+			requests: []runtime.Object{
+				request("cr-1", "vol-1", time.Hour, ready(cmmeta.ConditionTrue, cmapi.CertificateRequestReasonIssued)),
+				request("cr-2", "vol-2", time.Hour, ready(cmmeta.ConditionFalse, cmapi.CertificateRequestReasonFailed)),
+				request("cr-3", "vol-3", time.Hour, cmapi.CertificateRequestCondition{Type: cmapi.CertificateRequestConditionDenied, Status: cmmeta.ConditionTrue}),
+			},
+			expRequests: []string{"cr-1", "cr-2", "cr-3"},
+		},
+		"if an old request was created on another node, expect it kept": {
+			volumes: []string{"vol-1"},
+			requests: []runtime.Object{&cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{
+				Namespace:         "my-namespace",
+				Name:              "cr-1",
+				Labels:            map[string]string{ManagedByLabelKey: ManagedByLabelValue, VolumeIDLabelKey: "vol-1", NodeIDHashLabelKey: HashIdentifier("node-2")},
+				CreationTimestamp: metav1.NewTime(now.Add(-time.Hour)),
+			}}},
+			expRequests: []string{"cr-1"},
+		},
+		"if the volume of an old request is not on this node, expect it kept": {
+			requests:    []runtime.Object{request("cr-1", "vol-1", time.Hour)},
+			expRequests: []string{"cr-1"},
+		},
+		"if a volume requests a shorter timeout, expect its request deleted once it is exceeded": {
+			volumes:     []string{"vol-1", "vol-2"},
+			requested:   map[string]string{"vol-1": "1m", "vol-2": "3m"},
+			maxTimeout:  time.Minute * 30,
+			requests:    []runtime.Object{request("cr-1", "vol-1", time.Minute*2), request("cr-2", "vol-2", time.Minute*2)},
+			expRequests: []string{"cr-2"},
+			expTimedOut: []string{"vol-1"},
+			expReason:   "CertificateRequest my-namespace/cr-1 was not signed or denied within the request timeout of 1m0s and has been deleted, check the issuer and approver; the next attempt creates a new request",
+		},
+		"if a volume requests a longer timeout, expect its request kept past the default timeout": {
+			volumes:     []string{"vol-1"},
+			requested:   map[string]string{"vol-1": "15m"},
+			maxTimeout:  time.Minute * 30,
+			requests:    []runtime.Object{request("cr-1", "vol-1", time.Minute*10)},
+			expRequests: []string{"cr-1"},
+		},
+		"if a volume requests a timeout longer than the maximum, expect it clamped to the maximum": {
+			volumes:     []string{"vol-1"},
+			requested:   map[string]string{"vol-1": "2h"},
+			maxTimeout:  time.Minute * 30,
+			requests:    []runtime.Object{request("cr-1", "vol-1", time.Minute*40)},
+			expTimedOut: []string{"vol-1"},
+			expReason:   "CertificateRequest my-namespace/cr-1 was not signed or denied within the request timeout of 30m0s and has been deleted, check the issuer and approver; the next attempt creates a new request",
+		},
+		"if requested timeouts are ignored, expect the default timeout used": {
+			volumes:     []string{"vol-1"},
+			requested:   map[string]string{"vol-1": "1m"},
+			requests:    []runtime.Object{request("cr-1", "vol-1", time.Minute*2)},
+			expRequests: []string{"cr-1"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			store := storage.NewMemoryFS()
+			for _, id := range test.volumes {
+				meta := metadata.Metadata{VolumeID: id}
+				if timeout, ok := test.requested[id]; ok {
+					meta.VolumeContext = map[string]string{csiapi.RequestTimeoutKey: timeout}
+				}
+				_, err := store.RegisterMetadata(meta)
+				require.NoError(t, err)
+			}
+
+			fakeClient := cmfake.NewSimpleClientset(test.requests...)
+			r := &RequestTimeout{Log: logr.Discard(), Client: fakeClient, Store: store, Clock: clocktesting.NewFakeClock(now), NodeID: "node-1", Timeout: time.Minute * 5, MaxTimeout: test.maxTimeout}
+			require.NoError(t, r.expire(context.Background()))
+
+			list, err := fakeClient.CertmanagerV1().CertificateRequests("my-namespace").List(context.Background(), metav1.ListOptions{})
+			require.NoError(t, err)
+			var names []string
+			for _, cr := range list.Items {
+				names = append(names, cr.Name)
+			}
+			sort.Strings(names)
+			assert.Equal(t, test.expRequests, names)
+
+			// Each volume whose request timed out fails its next attempt
+			// only.
+			for _, id := range test.volumes {
+				ready, reason := r.ReadyToRequest(metadata.Metadata{VolumeID: id})
+				assert.Equal(t, !slices.Contains(test.expTimedOut, id), ready, id)
+				if !ready && len(test.expReason) > 0 {
+					assert.Equal(t, test.expReason, reason)
+				} else if !ready {
+					assert.Contains(t, reason, "request timeout of 5m0s")
+				}
+				ready, _ = r.ReadyToRequest(metadata.Metadata{VolumeID: id})
+				assert.True(t, ready, id)
+			}
+		})
+	}
+}
+
+func Test_RequestTimeout_forgetsUnreported(t *testing.T) {
+	now := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	fakeClock := clocktesting.NewFakeClock(now)
+
+	store := storage.NewMemoryFS()
+	_, err := store.RegisterMetadata(metadata.Metadata{VolumeID: "vol-1"})
+	require.NoError(t, err)
+	fakeClient := cmfake.NewSimpleClientset(&cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{
+		Namespace:         "my-namespace",
+		Name:              "cr-1",
+		Labels:            map[string]string{ManagedByLabelKey: ManagedByLabelValue, VolumeIDLabelKey: VolumeIDLabelValue("vol-1"), NodeIDHashLabelKey: HashIdentifier("node-1")},
+		CreationTimestamp: metav1.NewTime(now.Add(-time.Hour)),
+	}})
+
+	r := &RequestTimeout{Log: logr.Discard(), Client: fakeClient, Store: store, Clock: fakeClock, NodeID: "node-1", Timeout: time.Minute * 5}
+	require.NoError(t, r.expire(context.Background()))
+	fakeClock.Step(time.Minute * 5)
+	require.NoError(t, r.expire(context.Background()))
+
+	ready, _ := r.ReadyToRequest(metadata.Metadata{VolumeID: "vol-1"})
+	assert.True(t, ready)
+}
+
+// withFinalizerDeletion makes the fake client keep a deleted request which
+// holds a finalizer, marked as terminating, until its last finalizer is
+// removed, as the API server does.
+func withFinalizerDeletion(fakeClient *cmfake.Clientset) {
+	tracker := fakeClient.Tracker()
+	gvr := cmapi.SchemeGroupVersion.WithResource("certificaterequests")
+	fakeClient.PrependReactor("delete", "certificaterequests", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		deleteAction := action.(k8stesting.DeleteAction)
+		obj, err := tracker.Get(gvr, deleteAction.GetNamespace(), deleteAction.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		cr := obj.(*cmapi.CertificateRequest).DeepCopy()
+		if len(cr.Finalizers) == 0 {
+			return false, nil, nil
+		}
+		now := metav1.Now()
+		cr.DeletionTimestamp = &now
+		return true, nil, tracker.Update(gvr, cr, cr.Namespace)
+	})
+	fakeClient.PrependReactor("update", "certificaterequests", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		cr := action.(k8stesting.UpdateAction).GetObject().(*cmapi.CertificateRequest)
+		if cr.DeletionTimestamp == nil || len(cr.Finalizers) > 0 {
+			return false, nil, nil
+		}
+		return true, cr, tracker.Delete(gvr, cr.Namespace, cr.Name)
+	})
+}
+
+func Test_RequestTimeout_releasesInflightFinalizer(t *testing.T) {
+	now := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	labels := map[string]string{ManagedByLabelKey: ManagedByLabelValue, VolumeIDLabelKey: VolumeIDLabelValue("vol-1"), NodeIDHashLabelKey: HashIdentifier("node-1")}
+
+	store := storage.NewMemoryFS()
+	_, err := store.RegisterMetadata(metadata.Metadata{VolumeID: "vol-1"})
+	require.NoError(t, err)
+
+	// A request protected by an earlier run of the driver, which is not
+	// tracked by the protector.
+	fakeClient := cmfake.NewSimpleClientset(&cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{
+		Namespace:         "my-namespace",
+		Name:              "cr-1",
+		Labels:            labels,
+		Finalizers:        []string{InflightFinalizer},
+		CreationTimestamp: metav1.NewTime(now.Add(-time.Hour)),
+	}})
+	withFinalizerDeletion(fakeClient)
+
+	p := &InflightProtector{Log: logr.Discard(), Client: fakeClient, NodeID: "node-1"}
+	clientForMeta := p.WithFinalizer(func(metadata.Metadata) (cmclient.Interface, error) {
+		return fakeClient, nil
+	})
+	r := &RequestTimeout{Log: logr.Discard(), Client: fakeClient, Store: store, Clock: clocktesting.NewFakeClock(now), NodeID: "node-1", Protector: p, Timeout: time.Minute * 5}
+
+	// A request protected by this run of the driver.
+	client, err := clientForMeta(metadata.Metadata{VolumeID: "vol-1"})
+	require.NoError(t, err)
+	_, err = client.CertmanagerV1().CertificateRequests("my-namespace").Create(context.Background(), &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{
+		Namespace:         "my-namespace",
+		Name:              "cr-2",
+		Labels:            labels,
+		CreationTimestamp: metav1.NewTime(now.Add(-time.Hour)),
+	}}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	// Both requests are deleted, rather than left terminating where the next
+	// attempt would resume them, and the next attempt reports the timeout.
+	require.NoError(t, r.expire(context.Background()))
+	list, err := fakeClient.CertmanagerV1().CertificateRequests("my-namespace").List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, list.Items)
+	assert.Empty(t, p.requests["vol-1"])
+
+	ready, reason := r.ReadyToRequest(metadata.Metadata{VolumeID: "vol-1"})
+	assert.False(t, ready)
+	assert.Contains(t, reason, "request timeout of 5m0s")
+}
@@ -0,0 +1,100 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+
+	cmclient "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
+	"github.com/cert-manager/csi-lib/manager"
+	"github.com/cert-manager/csi-lib/metadata"
+	"k8s.io/client-go/rest"
+
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+	csivalidation "github.com/cert-manager/csi-driver/pkg/apis/validation"
+)
+
+// ClientForMetadataTokenRequest returns a ClientForMetadataFunc whose clients
+// authenticate with a service account token of the mounting pod, passed in
+// the volume context by the kubelet. CertificateRequests are created with the
+// identity of the pod.
+//
+// Volumes use the empty audience token by default, as with csi-lib's
+// ClientForMetadataTokenRequestEmptyAud. Volumes which set the token
+// audiences attribute are instead authenticated with the token of the first
+// audience, which the API server must accept. The token of every listed
+// audience must be present, so that a missing token request on the CSIDriver
+// manifest is reported rather than an audience silently going unused.
+//
+// The Host, TLSClientConfig, UserAgent, Timeout, and Proxy are preserved from
+// the given rest config.
+func ClientForMetadataTokenRequest(restConfig *rest.Config) manager.ClientForMetadataFunc {
+	seed := rest.CopyConfig(restConfig)
+	return func(meta metadata.Metadata) (cmclient.Interface, error) {
+		audiences, tokens, err := TokensFromMetadata(meta)
+		if err != nil {
+			return nil, err
+		}
+		return cmclient.NewForConfig(&rest.Config{
+			Host:            seed.Host,
+			TLSClientConfig: seed.TLSClientConfig,
+			UserAgent:       seed.UserAgent,
+			Timeout:         seed.Timeout,
+			Proxy:           seed.Proxy,
+			BearerToken:     tokens[audiences[0]],
+		})
+	}
+}
+
+// TokensFromMetadata returns the audiences requested by the volume, in order,
+// and the service account token of each. The empty audience is requested if
+// the volume does not set the token audiences attribute. Returns an error if
+// the token of any requested audience is not present in the volume context.
+func TokensFromMetadata(meta metadata.Metadata) ([]string, map[string]string, error) {
+	audiences := []string{""}
+	if v, ok := meta.VolumeContext[csiapi.TokenAudiencesKey]; ok {
+		var err error
+		audiences, err = csivalidation.ParseTokenAudiences(v)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%q: %w", csiapi.TokenAudiencesKey, err)
+		}
+	}
+
+	tokensJSON, ok := meta.VolumeContext[csiapi.K8sVolumeContextKeyServiceAccountTokens]
+	if !ok {
+		return nil, nil, fmt.Errorf("%q not present in volume context, the CSIDriver manifest must declare token requests for the audiences %q",
+			csiapi.K8sVolumeContextKeyServiceAccountTokens, audiences)
+	}
+	var parsed map[string]struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal([]byte(tokensJSON), &parsed); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse service account tokens from volume context: %w", err)
+	}
+
+	tokens := make(map[string]string, len(audiences))
+	for _, audience := range audiences {
+		token := parsed[audience].Token
+		if len(token) == 0 {
+			return nil, nil, fmt.Errorf("service account token for audience %q not present in volume context, the CSIDriver manifest must declare a token request for it", audience)
+		}
+		tokens[audience] = token
+	}
+
+	return audiences, tokens, nil
+}
@@ -0,0 +1,98 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"testing"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/rest"
+)
+
+func Test_TokensFromMetadata(t *testing.T) {
+	const tokens = `{"":{"token":"api-token"},"vault":{"token":"vault-token"},"sts.amazonaws.com":{"token":"sts-token"}}`
+
+	tests := map[string]struct {
+		volumeContext map[string]string
+		expAudiences  []string
+		expTokens     map[string]string
+		expErr        string
+	}{
+		"if no audiences are requested, expect the empty audience token": {
+			volumeContext: map[string]string{"csi.storage.k8s.io/serviceAccount.tokens": tokens},
+			expAudiences:  []string{""},
+			expTokens:     map[string]string{"": "api-token"},
+		},
+		"if audiences are requested, expect the token of each in order": {
+			volumeContext: map[string]string{
+				"csi.storage.k8s.io/serviceAccount.tokens": tokens,
+				"csi.cert-manager.io/token-audiences":      "sts.amazonaws.com,vault",
+			},
+			expAudiences: []string{"sts.amazonaws.com", "vault"},
+			expTokens:    map[string]string{"sts.amazonaws.com": "sts-token", "vault": "vault-token"},
+		},
+		"if the token of a requested audience is missing, expect an error": {
+			volumeContext: map[string]string{
+				"csi.storage.k8s.io/serviceAccount.tokens": tokens,
+				"csi.cert-manager.io/token-audiences":      "vault,spire",
+			},
+			expErr: `service account token for audience "spire" not present in volume context, the CSIDriver manifest must declare a token request for it`,
+		},
+		"if the empty audience token is missing, expect an error": {
+			volumeContext: map[string]string{"csi.storage.k8s.io/serviceAccount.tokens": `{"vault":{"token":"vault-token"}}`},
+			expErr:        `service account token for audience "" not present in volume context, the CSIDriver manifest must declare a token request for it`,
+		},
+		"if no tokens are present, expect an error": {
+			volumeContext: map[string]string{"csi.cert-manager.io/token-audiences": "vault"},
+			expErr:        `"csi.storage.k8s.io/serviceAccount.tokens" not present in volume context, the CSIDriver manifest must declare token requests for the audiences ["vault"]`,
+		},
+		"if the tokens cannot be parsed, expect an error": {
+			volumeContext: map[string]string{"csi.storage.k8s.io/serviceAccount.tokens": "not-json"},
+			expErr:        "failed to parse service account tokens from volume context: invalid character 'o' in literal null (expecting 'u')",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			audiences, tokens, err := TokensFromMetadata(metadata.Metadata{VolumeID: "vol-id", VolumeContext: test.volumeContext})
+			if len(test.expErr) > 0 {
+				assert.EqualError(t, err, test.expErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expAudiences, audiences)
+			assert.Equal(t, test.expTokens, tokens)
+		})
+	}
+}
+
+func Test_ClientForMetadataTokenRequest(t *testing.T) {
+	clientForMeta := ClientForMetadataTokenRequest(&rest.Config{Host: "https://my-host"})
+
+	_, err := clientForMeta(metadata.Metadata{VolumeContext: map[string]string{
+		"csi.storage.k8s.io/serviceAccount.tokens": `{"vault":{"token":"vault-token"}}`,
+		"csi.cert-manager.io/token-audiences":      "vault",
+	}})
+	assert.NoError(t, err)
+
+	_, err = clientForMeta(metadata.Metadata{VolumeContext: map[string]string{
+		"csi.storage.k8s.io/serviceAccount.tokens": `{"vault":{"token":"vault-token"}}`,
+	}})
+	assert.Error(t, err, "expected an error when the empty audience token is not declared")
+}
@@ -0,0 +1,241 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fifo serves certificate data to consumers over named pipes, so
+// that the data is never written to a regular file in the volume.
+//
+// Each pipe is served by a goroutine which blocks until a reader opens the
+// pipe, writes the full contents, and closes its end so the reader sees EOF.
+// The goroutine then waits briefly for the reader to close before serving the
+// next reader, which blocks in open until then. Pipes therefore only support a
+// single reader at a time: concurrent readers may each receive partial
+// contents, and a reader which is slow to read to EOF may receive the contents
+// twice. When the data for a pipe is updated, such as on renewal, the next
+// reader receives the new data.
+package fifo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/go-logr/logr"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// readerGracePeriod is the time waited after serving a reader before
+	// serving the next.
+	readerGracePeriod = time.Millisecond * 100
+
+	// stopTimeout is the maximum time waited for a pipe to stop being served.
+	stopTimeout = time.Second * 5
+)
+
+// Feeder serves data over named pipes in volume data directories.
+type Feeder struct {
+	log logr.Logger
+
+	lock  sync.Mutex
+	pipes map[string]map[string]*pipe
+}
+
+// NewFeeder returns a new Feeder.
+func NewFeeder(log logr.Logger) *Feeder {
+	return &Feeder{
+		log:   log,
+		pipes: make(map[string]map[string]*pipe),
+	}
+}
+
+// pipe is a single named pipe being served.
+type pipe struct {
+	path string
+
+	lock sync.Mutex
+	data []byte
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// Write serves each of the given files as a named pipe in the given directory
+// for the volume. Pipes which are already being served are updated with the
+// new data. If gid is non-nil, the pipes are owned by that group.
+func (f *Feeder) Write(volumeID, dir string, files map[string][]byte, gid *int64) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if _, ok := f.pipes[volumeID]; !ok {
+		f.pipes[volumeID] = make(map[string]*pipe)
+	}
+
+	for name, data := range files {
+		if p, ok := f.pipes[volumeID][name]; ok {
+			p.lock.Lock()
+			p.data = data
+			p.lock.Unlock()
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		if err := mkfifo(path, gid); err != nil {
+			return fmt.Errorf("creating named pipe %q: %w", name, err)
+		}
+
+		p := &pipe{
+			path:   path,
+			data:   data,
+			stopCh: make(chan struct{}),
+			doneCh: make(chan struct{}),
+		}
+		f.pipes[volumeID][name] = p
+		go p.serve(f.log.WithValues("volume_id", volumeID, "file", name))
+	}
+
+	return nil
+}
+
+// Stop stops serving all named pipes for the given volume.
+func (f *Feeder) Stop(volumeID string) {
+	f.lock.Lock()
+	pipes := f.pipes[volumeID]
+	delete(f.pipes, volumeID)
+	f.lock.Unlock()
+
+	for _, p := range pipes {
+		p.stop()
+	}
+}
+
+// mkfifo creates a named pipe at the given path, replacing any existing file
+// which is not a named pipe.
+func mkfifo(path string, gid *int64) error {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeNamedPipe == 0 {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	if err := unix.Mkfifo(path, 0440); err != nil && !errors.Is(err, unix.EEXIST) {
+		return err
+	}
+
+	// Ensure the mode is not affected by the umask.
+	if err := os.Chmod(path, 0440); err != nil {
+		return err
+	}
+
+	if gid != nil {
+		if err := os.Chown(path, -1, int(*gid)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// serve writes the pipe data to each reader in turn, until stopped.
+func (p *pipe) serve(log logr.Logger) {
+	defer close(p.doneCh)
+
+	for {
+		// Opening a named pipe for writing blocks until a reader opens it.
+		file, err := os.OpenFile(p.path, os.O_WRONLY, 0)
+		if p.stopped() {
+			if err == nil {
+				file.Close()
+			}
+			return
+		}
+		if err != nil {
+			log.Error(err, "Failed to open named pipe, retrying")
+			if !p.wait(time.Second) {
+				return
+			}
+			continue
+		}
+
+		p.lock.Lock()
+		data := p.data
+		p.lock.Unlock()
+
+		if _, err := file.Write(data); err != nil {
+			log.V(2).Info("Failed to write named pipe", "error", err.Error())
+		}
+		file.Close()
+
+		// Give the reader time to read to EOF and close its end, so that it
+		// is not served the data twice.
+		if !p.wait(readerGracePeriod) {
+			return
+		}
+	}
+}
+
+// wait waits for the given duration, returning false if the pipe was stopped.
+func (p *pipe) wait(d time.Duration) bool {
+	select {
+	case <-p.stopCh:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+func (p *pipe) stopped() bool {
+	select {
+	case <-p.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// stop stops serving the pipe, and waits for the serving goroutine to exit.
+func (p *pipe) stop() {
+	close(p.stopCh)
+
+	// Unblock the goroutine if it is waiting for a reader by opening the pipe
+	// for reading ourselves.
+	if fd, err := unix.Open(p.path, unix.O_RDONLY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0); err == nil {
+		defer unix.Close(fd)
+	}
+
+	select {
+	case <-p.doneCh:
+	case <-time.After(stopTimeout):
+	}
+}
+
+// Store wraps a storage backend to stop serving the named pipes of a volume
+// when it is removed.
+type Store struct {
+	storage.Interface
+
+	Feeder *Feeder
+}
+
+// RemoveVolume stops serving any named pipes for the volume, and removes it
+// from the storage backend.
+func (s *Store) RemoveVolume(volumeID string) error {
+	s.Feeder.Stop(volumeID)
+	return s.Interface.RemoveVolume(volumeID)
+}
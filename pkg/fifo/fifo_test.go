@@ -0,0 +1,85 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fifo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Feeder(t *testing.T) {
+	dir := t.TempDir()
+	feeder := NewFeeder(logr.Discard())
+
+	require.NoError(t, feeder.Write("vol-id", dir, map[string][]byte{
+		"tls.crt": []byte("cert"),
+		"tls.key": []byte("key"),
+	}, nil))
+
+	info, err := os.Stat(filepath.Join(dir, "tls.key"))
+	require.NoError(t, err)
+	assert.Equal(t, os.ModeNamedPipe|0440, info.Mode())
+
+	// Each reader should receive the full contents once.
+	for range 2 {
+		data, err := os.ReadFile(filepath.Join(dir, "tls.crt"))
+		require.NoError(t, err)
+		assert.Equal(t, "cert", string(data))
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "tls.key"))
+	require.NoError(t, err)
+	assert.Equal(t, "key", string(data))
+
+	// Updated data should be served to the next reader.
+	require.NoError(t, feeder.Write("vol-id", dir, map[string][]byte{
+		"tls.crt": []byte("renewed-cert"),
+		"tls.key": []byte("renewed-key"),
+	}, nil))
+	assert.Eventually(t, func() bool {
+		data, err := os.ReadFile(filepath.Join(dir, "tls.crt"))
+		return err == nil && string(data) == "renewed-cert"
+	}, time.Second, time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		feeder.Stop("vol-id")
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("expected feeder to stop serving pipes while they are waiting for a reader")
+	}
+}
+
+func Test_mkfifo_replacesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tls.crt")
+	require.NoError(t, os.WriteFile(path, []byte("on disk"), 0600))
+
+	require.NoError(t, mkfifo(path, nil))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.ModeNamedPipe|0440, info.Mode())
+}
@@ -0,0 +1,195 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filestore
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"strings"
+)
+
+// certInfoTimeLayout is the layout of times in the certificate info file,
+// matching openssl.
+const certInfoTimeLayout = "Jan _2 15:04:05 2006 GMT"
+
+var (
+	oidExtensionKeyUsage         = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionSubjectAltName   = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidExtensionBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+	oidExtensionExtKeyUsage      = asn1.ObjectIdentifier{2, 5, 29, 37}
+)
+
+// keyUsageNames are the names openssl gives each key usage, in bit order.
+var keyUsageNames = []struct {
+	usage x509.KeyUsage
+	name  string
+}{
+	{x509.KeyUsageDigitalSignature, "Digital Signature"},
+	{x509.KeyUsageContentCommitment, "Non Repudiation"},
+	{x509.KeyUsageKeyEncipherment, "Key Encipherment"},
+	{x509.KeyUsageDataEncipherment, "Data Encipherment"},
+	{x509.KeyUsageKeyAgreement, "Key Agreement"},
+	{x509.KeyUsageCertSign, "Certificate Sign"},
+	{x509.KeyUsageCRLSign, "CRL Sign"},
+	{x509.KeyUsageEncipherOnly, "Encipher Only"},
+	{x509.KeyUsageDecipherOnly, "Decipher Only"},
+}
+
+// extKeyUsageNames are the names openssl gives each extended key usage.
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:             "Any Extended Key Usage",
+	x509.ExtKeyUsageServerAuth:      "TLS Web Server Authentication",
+	x509.ExtKeyUsageClientAuth:      "TLS Web Client Authentication",
+	x509.ExtKeyUsageCodeSigning:     "Code Signing",
+	x509.ExtKeyUsageEmailProtection: "E-mail Protection",
+	x509.ExtKeyUsageTimeStamping:    "Time Stamping",
+	x509.ExtKeyUsageOCSPSigning:     "OCSP Signing",
+}
+
+// certInfo returns a human readable description of the certificate, in the
+// style of `openssl x509 -text`. Names are written in RFC 2253 form.
+func certInfo(crt *x509.Certificate) string {
+	var b strings.Builder
+	line := func(indent int, format string, args ...any) {
+		b.WriteString(strings.Repeat("    ", indent))
+		fmt.Fprintf(&b, format, args...)
+		b.WriteByte('\n')
+	}
+
+	line(0, "Certificate:")
+	line(1, "Data:")
+	line(2, "Version: %d (0x%x)", crt.Version, crt.Version-1)
+	line(2, "Serial Number:")
+	line(3, "%s", colonHex(crt.SerialNumber.Bytes()))
+	line(2, "Signature Algorithm: %s", crt.SignatureAlgorithm)
+	line(2, "Issuer: %s", crt.Issuer)
+	line(2, "Validity")
+	line(3, "Not Before: %s", crt.NotBefore.UTC().Format(certInfoTimeLayout))
+	line(3, "Not After : %s", crt.NotAfter.UTC().Format(certInfoTimeLayout))
+	line(2, "Subject: %s", crt.Subject)
+	line(2, "Subject Public Key Info:")
+	switch pub := crt.PublicKey.(type) {
+	case *rsa.PublicKey:
+		line(3, "Public Key Algorithm: rsaEncryption")
+		line(4, "Public-Key: (%d bit)", pub.N.BitLen())
+	case *ecdsa.PublicKey:
+		line(3, "Public Key Algorithm: id-ecPublicKey")
+		line(4, "Public-Key: (%d bit)", pub.Curve.Params().BitSize)
+		line(4, "NIST CURVE: %s", pub.Curve.Params().Name)
+	case ed25519.PublicKey:
+		line(3, "Public Key Algorithm: ED25519")
+	default:
+		line(3, "Public Key Algorithm: %s", crt.PublicKeyAlgorithm)
+	}
+
+	var extensions []func()
+	if crt.KeyUsage != 0 {
+		extensions = append(extensions, func() {
+			var names []string
+			for _, ku := range keyUsageNames {
+				if crt.KeyUsage&ku.usage != 0 {
+					names = append(names, ku.name)
+				}
+			}
+			line(3, "X509v3 Key Usage:%s", critical(crt, oidExtensionKeyUsage))
+			line(4, "%s", strings.Join(names, ", "))
+		})
+	}
+	if len(crt.ExtKeyUsage) > 0 || len(crt.UnknownExtKeyUsage) > 0 {
+		extensions = append(extensions, func() {
+			var names []string
+			for _, eku := range crt.ExtKeyUsage {
+				name, ok := extKeyUsageNames[eku]
+				if !ok {
+					name = fmt.Sprintf("Unknown (%d)", eku)
+				}
+				names = append(names, name)
+			}
+			for _, oid := range crt.UnknownExtKeyUsage {
+				names = append(names, oid.String())
+			}
+			line(3, "X509v3 Extended Key Usage:%s", critical(crt, oidExtensionExtKeyUsage))
+			line(4, "%s", strings.Join(names, ", "))
+		})
+	}
+	if crt.BasicConstraintsValid {
+		extensions = append(extensions, func() {
+			line(3, "X509v3 Basic Constraints:%s", critical(crt, oidExtensionBasicConstraints))
+			line(4, "CA:%s", strings.ToUpper(fmt.Sprint(crt.IsCA)))
+		})
+	}
+	if sans := subjectAltNames(crt); len(sans) > 0 {
+		extensions = append(extensions, func() {
+			line(3, "X509v3 Subject Alternative Name:%s", critical(crt, oidExtensionSubjectAltName))
+			line(4, "%s", strings.Join(sans, ", "))
+		})
+	}
+	if len(extensions) > 0 {
+		line(2, "X509v3 extensions:")
+		for _, ext := range extensions {
+			ext()
+		}
+	}
+
+	return b.String()
+}
+
+// subjectAltNames returns the SANs of the certificate, named as by openssl.
+func subjectAltNames(crt *x509.Certificate) []string {
+	var sans []string
+	for _, name := range crt.DNSNames {
+		sans = append(sans, "DNS:"+name)
+	}
+	for _, ip := range crt.IPAddresses {
+		sans = append(sans, "IP Address:"+ip.String())
+	}
+	for _, uri := range crt.URIs {
+		sans = append(sans, "URI:"+uri.String())
+	}
+	for _, email := range crt.EmailAddresses {
+		sans = append(sans, "email:"+email)
+	}
+	return sans
+}
+
+// critical returns the suffix marking the extension with the given OID as
+// critical, if it is.
+func critical(crt *x509.Certificate, oid asn1.ObjectIdentifier) string {
+	for _, ext := range crt.Extensions {
+		if ext.Id.Equal(oid) && ext.Critical {
+			return " critical"
+		}
+	}
+	return ""
+}
+
+// colonHex returns the bytes as colon separated hex, as openssl writes serial
+// numbers.
+func colonHex(data []byte) string {
+	if len(data) == 0 {
+		return "00"
+	}
+	hex := make([]string, len(data))
+	for i, b := range data {
+		hex[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(hex, ":")
+}
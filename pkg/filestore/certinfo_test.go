@@ -0,0 +1,81 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filestore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_certInfo(t *testing.T) {
+	pk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(0x0102abcd),
+		Subject:               pkix.Name{CommonName: "my-pod", Organization: []string{"cert-manager"}},
+		NotBefore:             time.Date(2000, time.January, 2, 3, 4, 5, 0, time.UTC),
+		NotAfter:              time.Date(2000, time.April, 12, 3, 4, 5, 0, time.UTC),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"my-pod.my-namespace.svc"},
+		IPAddresses:           []net.IP{net.ParseIP("10.0.0.1")},
+		URIs:                  []*url.URL{{Scheme: "spiffe", Host: "cluster.local", Path: "/ns/my-namespace/sa/default"}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pk.Public(), pk)
+	require.NoError(t, err)
+	crt, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	assert.Equal(t, `Certificate:
+    Data:
+        Version: 3 (0x2)
+        Serial Number:
+            01:02:ab:cd
+        Signature Algorithm: ECDSA-SHA256
+        Issuer: CN=my-pod,O=cert-manager
+        Validity
+            Not Before: Jan  2 03:04:05 2000 GMT
+            Not After : Apr 12 03:04:05 2000 GMT
+        Subject: CN=my-pod,O=cert-manager
+        Subject Public Key Info:
+            Public Key Algorithm: id-ecPublicKey
+                Public-Key: (256 bit)
+                NIST CURVE: P-256
+        X509v3 extensions:
+            X509v3 Key Usage: critical
+                Digital Signature, Key Encipherment
+            X509v3 Extended Key Usage:
+                TLS Web Server Authentication, TLS Web Client Authentication
+            X509v3 Basic Constraints: critical
+                CA:FALSE
+            X509v3 Subject Alternative Name:
+                DNS:my-pod.my-namespace.svc, IP Address:10.0.0.1, URI:spiffe://cluster.local/ns/my-namespace/sa/default
+`, certInfo(crt))
+}
@@ -0,0 +1,99 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filestore
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"slices"
+
+	cmpki "github.com/cert-manager/cert-manager/pkg/util/pki"
+)
+
+// preferredChain returns the chain for the leaf certificate which terminates
+// in the CA with the preferred common name, in the style of the ACME issuer's
+// preferred chain. Issuers offer alternative chains by returning cross-signed
+// intermediates in the chain or CA. Every chain which can be built from the
+// leaf using those certificates is considered, in the order the issuer
+// returned them, and the first whose top-most certificate is issued by the
+// preferred CA is returned, without any self-signed root.
+//
+// If no chain matches, the issued chain is returned unchanged, and false.
+func preferredChain(preferred string, chain, ca []byte) ([]byte, bool, error) {
+	certs, err := cmpki.DecodeX509CertificateChainBytes(chain)
+	if err != nil {
+		return nil, false, fmt.Errorf("parsing issued certificate chain: %w", err)
+	}
+
+	pool := slices.Clone(certs[1:])
+	if len(bytes.TrimSpace(ca)) > 0 {
+		cas, err := cmpki.DecodeX509CertificateChainBytes(ca)
+		if err != nil {
+			return nil, false, fmt.Errorf("parsing issued CA: %w", err)
+		}
+		pool = append(pool, cas...)
+	}
+
+	path := findChain([]*x509.Certificate{certs[0]}, pool, preferred)
+	if path == nil {
+		return chain, false, nil
+	}
+
+	var out []byte
+	for _, crt := range path {
+		if isSelfSigned(crt) {
+			continue
+		}
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw})...)
+	}
+
+	return out, true, nil
+}
+
+// findChain returns the first chain extending the given path with
+// certificates from the pool whose top-most certificate is issued by the
+// preferred CA, or nil if there is none. Only chains which cannot be extended
+// any further are considered, so that intermediates are never dropped.
+func findChain(path, pool []*x509.Certificate, preferred string) []*x509.Certificate {
+	top := path[len(path)-1]
+
+	extended := false
+	if !isSelfSigned(top) {
+		for _, parent := range pool {
+			if slices.ContainsFunc(path, parent.Equal) || top.CheckSignatureFrom(parent) != nil {
+				continue
+			}
+			extended = true
+			if found := findChain(append(slices.Clip(path), parent), pool, preferred); found != nil {
+				return found
+			}
+		}
+	}
+
+	if !extended && top.Issuer.CommonName == preferred {
+		return path
+	}
+
+	return nil
+}
+
+// isSelfSigned returns true if the given certificate is a self-signed root.
+func isSelfSigned(crt *x509.Certificate) bool {
+	return bytes.Equal(crt.RawIssuer, crt.RawSubject) && crt.CheckSignatureFrom(crt) == nil
+}
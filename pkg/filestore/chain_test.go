@@ -0,0 +1,134 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filestore
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signCertificate returns a PEM encoded certificate for the given subject and
+// public key, signed by the given parent's key. A nil parent self-signs the
+// certificate with the parent's key.
+func signCertificate(t *testing.T, cn string, isCA bool, pub crypto.PublicKey, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, []byte) {
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		parent = template
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, parentKey)
+	require.NoError(t, err)
+	crt, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return crt, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func Test_preferredChain(t *testing.T) {
+	newKey := func() *ecdsa.PrivateKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		return key
+	}
+	rootAKey, rootBKey, intermediateKey, leafKey := newKey(), newKey(), newKey(), newKey()
+
+	// The intermediate is signed by root-a, and cross-signed by root-b.
+	rootA, rootAPEM := signCertificate(t, "root-a", true, rootAKey.Public(), nil, rootAKey)
+	rootB, rootBPEM := signCertificate(t, "root-b", true, rootBKey.Public(), nil, rootBKey)
+	intermediate, intermediatePEM := signCertificate(t, "intermediate", true, intermediateKey.Public(), rootA, rootAKey)
+	_, crossSignedPEM := signCertificate(t, "intermediate", true, intermediateKey.Public(), rootB, rootBKey)
+	_, leafPEM := signCertificate(t, "leaf", false, leafKey.Public(), intermediate, intermediateKey)
+
+	join := func(pems ...[]byte) []byte { return bytes.Join(pems, nil) }
+
+	tests := map[string]struct {
+		preferred string
+		chain     []byte
+		ca        []byte
+		expChain  []byte
+		expFound  bool
+	}{
+		"chain terminating in the CA should be returned without its root": {
+			preferred: "root-a",
+			chain:     join(leafPEM, crossSignedPEM, intermediatePEM),
+			ca:        rootAPEM,
+			expChain:  join(leafPEM, intermediatePEM),
+			expFound:  true,
+		},
+		"cross-signed chain should be returned if its issuer is preferred": {
+			preferred: "root-b",
+			chain:     join(leafPEM, intermediatePEM, crossSignedPEM),
+			ca:        rootAPEM,
+			expChain:  join(leafPEM, crossSignedPEM),
+			expFound:  true,
+		},
+		"chain terminating in a root in the CA should be returned without the root": {
+			preferred: "root-b",
+			chain:     join(leafPEM, intermediatePEM, crossSignedPEM),
+			ca:        join(rootAPEM, rootBPEM),
+			expChain:  join(leafPEM, crossSignedPEM),
+			expFound:  true,
+		},
+		"cross-signed intermediate in the CA should be considered": {
+			preferred: "root-b",
+			chain:     join(leafPEM, intermediatePEM),
+			ca:        join(rootAPEM, crossSignedPEM),
+			expChain:  join(leafPEM, crossSignedPEM),
+			expFound:  true,
+		},
+		"intermediate should not be preferred over the chain it is part of": {
+			preferred: "intermediate",
+			chain:     join(leafPEM, intermediatePEM, crossSignedPEM),
+			ca:        rootAPEM,
+			expChain:  join(leafPEM, intermediatePEM, crossSignedPEM),
+			expFound:  false,
+		},
+		"no matching chain should return the issued chain": {
+			preferred: "root-c",
+			chain:     join(leafPEM, intermediatePEM, crossSignedPEM),
+			expChain:  join(leafPEM, intermediatePEM, crossSignedPEM),
+			expFound:  false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			chain, found, err := preferredChain(test.preferred, test.chain, test.ca)
+			require.NoError(t, err)
+			assert.Equal(t, test.expFound, found)
+			assert.Equal(t, string(test.expChain), string(chain))
+		})
+	}
+}
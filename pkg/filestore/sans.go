@@ -0,0 +1,123 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filestore
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	cmpki "github.com/cert-manager/cert-manager/pkg/util/pki"
+	"github.com/cert-manager/csi-lib/metadata"
+
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+	"github.com/cert-manager/csi-driver/pkg/requestgen"
+)
+
+// verifySANs checks that the issued certificate contains every SAN which was
+// requested for the volume. If mode is exact, the certificate must also not
+// contain any SAN which was not requested. An empty mode disables the check.
+func verifySANs(meta metadata.Metadata, mode string, chain []byte) error {
+	if len(mode) == 0 {
+		return nil
+	}
+
+	crt, err := cmpki.DecodeX509CertificateBytes(chain)
+	if err != nil {
+		return fmt.Errorf("parsing issued certificate: %w", err)
+	}
+
+	requested, issued, err := requestedAndIssuedSANs(meta, crt)
+	if err != nil {
+		return err
+	}
+
+	if missing := difference(requested, issued); len(missing) > 0 {
+		return fmt.Errorf("issued certificate is missing requested SANs: %s", strings.Join(missing, ", "))
+	}
+	if mode == csiapi.RequireSANsExact {
+		if extra := difference(issued, requested); len(extra) > 0 {
+			return fmt.Errorf("issued certificate contains SANs which were not requested: %s", strings.Join(extra, ", "))
+		}
+	}
+
+	return nil
+}
+
+// SANDrift returns the SANs requested for the volume described by the given
+// metadata which the certificate does not contain. If exact, the SANs the
+// certificate contains which are not requested are also returned. The SANs are
+// requested from the current volume context, so that any which have changed
+// since the certificate was issued are found.
+func SANDrift(meta metadata.Metadata, crt *x509.Certificate, exact bool) ([]string, error) {
+	requested, issued, err := requestedAndIssuedSANs(meta, crt)
+	if err != nil {
+		return nil, err
+	}
+
+	drift := difference(requested, issued)
+	if exact {
+		drift = append(drift, difference(issued, requested)...)
+	}
+	return drift, nil
+}
+
+// requestedAndIssuedSANs returns the SANs requested for the volume, and the
+// SANs of the given certificate, in the form returned by sansOf.
+func requestedAndIssuedSANs(meta metadata.Metadata, crt *x509.Certificate) ([]string, []string, error) {
+	bundle, err := requestgen.RequestForMetadata(meta)
+	if err != nil {
+		return nil, nil, fmt.Errorf("building requested SANs: %w", err)
+	}
+
+	return sansOf(bundle.Request.DNSNames, bundle.Request.IPAddresses, bundle.Request.URIs),
+		sansOf(crt.DNSNames, crt.IPAddresses, crt.URIs), nil
+}
+
+// sansOf returns the given SANs in a comparable form, prefixed with their
+// type. DNS names are compared case-insensitively.
+func sansOf(dnsNames []string, ips []net.IP, uris []*url.URL) []string {
+	var sans []string
+	for _, name := range dnsNames {
+		sans = append(sans, "dns:"+strings.ToLower(name))
+	}
+	for _, ip := range ips {
+		sans = append(sans, "ip:"+ip.String())
+	}
+	for _, uri := range uris {
+		sans = append(sans, "uri:"+uri.String())
+	}
+	return sans
+}
+
+// difference returns the entries of a which are not in b, in order.
+func difference(a, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, s := range b {
+		in[s] = true
+	}
+
+	var out []string
+	for _, s := range a {
+		if !in[s] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
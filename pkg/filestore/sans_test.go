@@ -0,0 +1,108 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filestore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"testing"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func certificateWithSANs(t *testing.T, dnsNames []string, ips []net.IP) []byte {
+	pk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pk.Public(), pk)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func Test_verifySANs(t *testing.T) {
+	meta := metadata.Metadata{
+		VolumeID: "vol-id",
+		VolumeContext: map[string]string{
+			"csi.cert-manager.io/issuer-name": "ca-issuer",
+			"csi.cert-manager.io/dns-names":   "foo.example.com,bar.example.com",
+			"csi.cert-manager.io/ip-sans":     "10.0.0.1",
+		},
+	}
+
+	tests := map[string]struct {
+		mode     string
+		dnsNames []string
+		ips      []net.IP
+		expErr   string
+	}{
+		"if no mode given, any certificate should be accepted": {
+			mode: "",
+		},
+		"if all SANs present, superset should be accepted": {
+			mode:     "superset",
+			dnsNames: []string{"foo.example.com", "bar.example.com", "extra.example.com"},
+			ips:      []net.IP{net.ParseIP("10.0.0.1")},
+		},
+		"if DNS names only differ by case, superset should be accepted": {
+			mode:     "superset",
+			dnsNames: []string{"FOO.example.com", "bar.example.com"},
+			ips:      []net.IP{net.ParseIP("10.0.0.1")},
+		},
+		"if SANs are missing, superset should error with the missing SANs": {
+			mode:     "superset",
+			dnsNames: []string{"bar.example.com"},
+			expErr:   "issued certificate is missing requested SANs: dns:foo.example.com, ip:10.0.0.1",
+		},
+		"if all SANs present and no others, exact should be accepted": {
+			mode:     "exact",
+			dnsNames: []string{"bar.example.com", "foo.example.com"},
+			ips:      []net.IP{net.ParseIP("10.0.0.1")},
+		},
+		"if extra SANs present, exact should error with the extra SANs": {
+			mode:     "exact",
+			dnsNames: []string{"foo.example.com", "bar.example.com", "extra.example.com"},
+			ips:      []net.IP{net.ParseIP("10.0.0.1")},
+			expErr:   "issued certificate contains SANs which were not requested: dns:extra.example.com",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := verifySANs(meta, test.mode, certificateWithSANs(t, test.dnsNames, test.ips))
+			if len(test.expErr) > 0 {
+				assert.EqualError(t, err, test.expErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-logr/logr"
+
+	"github.com/cert-manager/csi-driver/pkg/apis/defaults"
+	"github.com/cert-manager/csi-driver/pkg/volumelog"
+)
+
+// dataDirName is the symlink in a volume's data directory which points to the
+// directory holding the current set of files.
+const dataDirName = "..data"
+
+// Watcher watches the files written to volumes by a Writer, and writes them
+// again if they are modified or removed by anything else, such as a process
+// in the pod truncating a mounted certificate. Files are restored from the
+// contents last written by the Writer, so are watched from the first time
+// they are written by this driver process.
+//
+// The Writer holds a volume while writing it, and the watcher only compares
+// files while the volume is not held, so the Writer's own writes are never
+// mistaken for the files being modified.
+type Watcher struct {
+	Log    logr.Logger
+	Writer *Writer
+
+	watcher *fsnotify.Watcher
+
+	lock sync.Mutex
+	// volumes holds the files last written to each volume.
+	volumes map[string]*watchedVolume
+	// dirs maps each watched directory to the ID of its volume.
+	dirs map[string]string
+}
+
+// watchedVolume is the state of a volume whose files are watched.
+type watchedVolume struct {
+	// lock is held while the volume is written or compared.
+	lock sync.Mutex
+
+	// meta and files are the metadata and files of the last write, or nil if
+	// the volume has not yet been written or has been removed.
+	meta  metadata.Metadata
+	files map[string][]byte
+}
+
+// NewWatcher returns a Watcher which restores the files written by the given
+// Writer. The Writer must be given the returned Watcher.
+func NewWatcher(log logr.Logger, writer *Writer) (*Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("creating file watcher: %w", err)
+	}
+
+	return &Watcher{
+		Log:     log,
+		Writer:  writer,
+		watcher: watcher,
+		volumes: make(map[string]*watchedVolume),
+		dirs:    make(map[string]string),
+	}, nil
+}
+
+// Run restores modified files until the context is cancelled.
+func (w *Watcher) Run(ctx context.Context) error {
+	defer w.watcher.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return nil
+			}
+			w.handle(event)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return nil
+			}
+			w.Log.Error(err, "Error watching managed files")
+		}
+	}
+}
+
+// volume returns the state of the volume with the given ID.
+func (w *Watcher) volume(volumeID string) *watchedVolume {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	vol, ok := w.volumes[volumeID]
+	if !ok {
+		vol = new(watchedVolume)
+		w.volumes[volumeID] = vol
+	}
+	return vol
+}
+
+// watch records the files written to the volume, and watches the directories
+// which hold them. Must be called with the volume held.
+func (w *Watcher) watch(vol *watchedVolume, meta metadata.Metadata, files map[string][]byte) {
+	vol.meta, vol.files = meta, files
+
+	// The files of the filesystem backend are symlinks into the directory of
+	// the current write, which must also be watched to see changes to their
+	// contents.
+	dir := w.Writer.Store.PathForVolume(meta.VolumeID)
+	dirs := []string{dir}
+	if target, err := os.Readlink(filepath.Join(dir, dataDirName)); err == nil {
+		dirs = append(dirs, filepath.Join(dir, target))
+	}
+
+	for _, dir := range dirs {
+		if err := w.watcher.Add(dir); err != nil {
+			volumelog.ForMetadata(w.Log, meta).Error(err, "Failed to watch managed files", "dir", dir)
+			continue
+		}
+		w.lock.Lock()
+		w.dirs[dir] = meta.VolumeID
+		w.lock.Unlock()
+	}
+}
+
+// forget stops watching the files of the volume with the given ID, waiting
+// for any restore of the volume in progress.
+func (w *Watcher) forget(volumeID string) {
+	w.lock.Lock()
+	vol := w.volumes[volumeID]
+	delete(w.volumes, volumeID)
+	for dir, id := range w.dirs {
+		if id == volumeID {
+			delete(w.dirs, dir)
+			_ = w.watcher.Remove(dir)
+		}
+	}
+	w.lock.Unlock()
+
+	if vol != nil {
+		vol.lock.Lock()
+		vol.meta, vol.files = metadata.Metadata{}, nil
+		vol.lock.Unlock()
+	}
+}
+
+// handle restores the files of the volume the event is for, if they are no
+// longer as last written.
+func (w *Watcher) handle(event fsnotify.Event) {
+	w.lock.Lock()
+	// Watched directories are removed when a later write replaces them, or
+	// when the volume is removed.
+	if volumeID, ok := w.dirs[event.Name]; ok && event.Has(fsnotify.Remove) {
+		delete(w.dirs, event.Name)
+		if event.Name == w.Writer.Store.PathForVolume(volumeID) {
+			delete(w.volumes, volumeID)
+			w.lock.Unlock()
+			return
+		}
+	}
+	volumeID, ok := w.dirs[filepath.Dir(event.Name)]
+	vol := w.volumes[volumeID]
+	w.lock.Unlock()
+
+	if ok && vol != nil {
+		w.restore(volumeID, vol)
+	}
+}
+
+// restore writes the files of the volume again if any are no longer as last
+// written.
+func (w *Watcher) restore(volumeID string, vol *watchedVolume) {
+	vol.lock.Lock()
+	defer vol.lock.Unlock()
+
+	if vol.files == nil {
+		return
+	}
+
+	dir := w.Writer.Store.PathForVolume(volumeID)
+	var changed []string
+	for name, data := range vol.files {
+		if current, err := os.ReadFile(filepath.Join(dir, name)); err != nil || !bytes.Equal(current, data) {
+			changed = append(changed, name)
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+	sort.Strings(changed)
+
+	log := w.Log.WithValues("volume_id", volumeID, "files", changed)
+	log.Info("Managed files were modified or removed, restoring them")
+
+	attrs, err := defaults.SetDefaultAttributes(vol.meta.VolumeContext)
+	if err != nil {
+		log.Error(err, "Failed to restore managed files")
+		return
+	}
+	if err := w.Writer.writeFiles(vol.meta, attrs, vol.files); err != nil {
+		log.Error(err, "Failed to restore managed files")
+		return
+	}
+
+	w.watch(vol, vol.meta, vol.files)
+}
+
+// WatchedStore wraps a storage backend so that the files of volumes are no
+// longer watched once they are removed, and are not restored while the
+// volume is being removed.
+type WatchedStore struct {
+	storage.Interface
+
+	Watcher *Watcher
+}
+
+// RemoveVolume stops watching the files of the volume, then removes it from
+// the storage backend.
+func (s *WatchedStore) RemoveVolume(volumeID string) error {
+	s.Watcher.forget(volumeID)
+	return s.Interface.RemoveVolume(volumeID)
+}
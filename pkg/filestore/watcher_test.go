@@ -0,0 +1,106 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filestore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Watcher(t *testing.T) {
+	meta := metadata.Metadata{
+		VolumeID:   "vol-id",
+		TargetPath: "/target-path",
+		VolumeContext: map[string]string{
+			"csi.cert-manager.io/issuer-name":            "ca-issuer",
+			"csi.cert-manager.io/privatekey-permissions": "0400",
+		},
+	}
+
+	store := &dirStore{Interface: storage.NewMemoryFS(), dir: t.TempDir()}
+	_, err := store.RegisterMetadata(meta)
+	require.NoError(t, err)
+
+	w := &Writer{Store: store}
+	watcher, err := NewWatcher(logr.Discard(), w)
+	require.NoError(t, err)
+	w.Watcher = watcher
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error)
+	go func() { errCh <- watcher.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		require.NoError(t, <-errCh)
+	})
+
+	expFiles := func(t *testing.T, bundle testBundle) {
+		t.Helper()
+		assert.EventuallyWithT(t, func(t *assert.CollectT) {
+			for name, exp := range map[string][]byte{
+				"tls.crt": bundle.certPEM,
+				"tls.key": bundle.pkPEM,
+				"ca.crt":  bundle.caPEM,
+			} {
+				data, err := os.ReadFile(filepath.Join(store.dir, name))
+				assert.NoError(t, err, name)
+				assert.Equal(t, exp, data, name)
+			}
+			info, err := os.Stat(filepath.Join(store.dir, "tls.key"))
+			if assert.NoError(t, err) {
+				assert.Equal(t, os.FileMode(0400), info.Mode().Perm())
+			}
+		}, time.Second*5, time.Millisecond*10)
+	}
+
+	bundle := newTestBundle(t, pkcs1Encoder)
+	require.NoError(t, w.WriteKeypair(meta, bundle.pk, bundle.certPEM, bundle.caPEM))
+	expFiles(t, bundle)
+
+	// A truncated certificate should be restored.
+	require.NoError(t, os.Truncate(filepath.Join(store.dir, "tls.crt"), 0))
+	expFiles(t, bundle)
+
+	// A removed private key should be restored, with its permissions.
+	require.NoError(t, os.Remove(filepath.Join(store.dir, "tls.key")))
+	expFiles(t, bundle)
+
+	// Renewals must not be reverted to the files previously written.
+	renewed := newTestBundle(t, pkcs1Encoder)
+	require.NoError(t, w.WriteKeypair(meta, renewed.pk, renewed.certPEM, renewed.caPEM))
+	time.Sleep(time.Millisecond * 100)
+	expFiles(t, renewed)
+
+	// Removing the volume should stop the files being watched, so that they
+	// are not restored as they are removed.
+	watched := &WatchedStore{Interface: store, Watcher: watcher}
+	require.NoError(t, watched.RemoveVolume("vol-id"))
+	require.NoError(t, os.RemoveAll(store.dir))
+	watcher.lock.Lock()
+	defer watcher.lock.Unlock()
+	assert.Empty(t, watcher.volumes)
+	assert.Empty(t, watcher.dirs)
+}
@@ -17,31 +17,104 @@ limitations under the License.
 package filestore
 
 import (
+	"context"
 	"crypto"
-	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"hash/maphash"
+	"os"
+	"path/filepath"
+	"strconv"
 	"time"
 
 	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmpki "github.com/cert-manager/cert-manager/pkg/util/pki"
 	"github.com/cert-manager/csi-lib/metadata"
 	"github.com/cert-manager/csi-lib/storage"
+	"github.com/go-logr/logr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/clock"
 
 	"github.com/cert-manager/csi-driver/pkg/apis/defaults"
 	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
 	"github.com/cert-manager/csi-driver/pkg/apis/validation"
+	"github.com/cert-manager/csi-driver/pkg/keystore/combined"
+	"github.com/cert-manager/csi-driver/pkg/keystore/der"
 	"github.com/cert-manager/csi-driver/pkg/keystore/pkcs12"
+	"github.com/cert-manager/csi-driver/pkg/volumelog"
 )
 
+// shortCertificateDuration is the certificate lifetime below which a
+// requested renew-before is clamped to at most half of the lifetime.
+const shortCertificateDuration = time.Hour
+
+// durationMismatchPercentage is how far, as a percentage of the requested
+// duration, the duration granted by the issuer may differ before it is logged.
+const durationMismatchPercentage = 10
+
+// secretTimeout bounds reading the PKCS12 keystore password from its Secret.
+const secretTimeout = time.Second * 10
+
+// jitterSeed is chosen once per process, so the renewal jitter of a volume is
+// stable across reissuance for the lifetime of the driver.
+var jitterSeed = maphash.MakeSeed()
+
 // Writer wraps the storage backend to allow access for writing data.
 type Writer struct {
 	Store storage.Interface
+
+	// FIFOs serves the certificate and private key over named pipes for
+	// volumes which request it. Named pipe output is unsupported if nil.
+	FIFOs FIFOWriter
+
+	// MinReissueInterval is the shortest time after a certificate is written
+	// that it will be renewed, regardless of the computed renewal time. The
+	// value 0 disables the limit.
+	MinReissueInterval time.Duration
+
+	// ReissueClamped, if set, is called for each renewal time which was
+	// delayed to MinReissueInterval.
+	ReissueClamped func(volumeID string)
+
+	// RenewalJitter is the upper bound of a per-volume offset added to the
+	// computed renewal time, so that volumes issued together do not all renew
+	// at once. The value 0 disables jitter.
+	RenewalJitter time.Duration
+
+	// KeystoreWritten, if set, is called with the format of each keystore
+	// written to a volume, once the write has succeeded.
+	KeystoreWritten func(volumeID, format string)
+
+	// Client, if set, is used to read PKCS12 keystore passwords from the
+	// Secrets named by volumes. Password Secrets are unsupported if nil.
+	Client kubernetes.Interface
+
+	// Watcher, if set, restores the files written to each volume if they are
+	// modified or removed by anything other than the Writer.
+	Watcher *Watcher
+
+	Log   logr.Logger
+	Clock clock.Clock
+}
+
+// FIFOWriter serves files over named pipes in a directory.
+type FIFOWriter interface {
+	Write(volumeID, dir string, files map[string][]byte, gid *int64) error
 }
 
 // WriteKeypair writes the given certificate, CA, and private key data to their
 // respective file locations, according to the volume attributes. Also writes
 // or updates the metadata file, including a calculated NextIssuanceTime.
+//
+// All files are written to the storage backend in a single WriteFiles call.
+// The filesystem backend writes the set atomically, swapping the whole data
+// directory at once, so consumers watching any one file (such as the leaf
+// certificate) never observe it without its matching CA and private key.
+// Requested file permissions are only applied after the swap, so the new
+// files are briefly readable by their owner and group only; see
+// setPermissions.
 func (w *Writer) WriteKeypair(meta metadata.Metadata, key crypto.PrivateKey, chain []byte, ca []byte) error {
 	attrs, err := defaults.SetDefaultAttributes(meta.VolumeContext)
 	if err != nil {
@@ -50,30 +123,54 @@ func (w *Writer) WriteKeypair(meta metadata.Metadata, key crypto.PrivateKey, cha
 	if err := validation.ValidateAttributes(attrs); err != nil {
 		return err.ToAggregate()
 	}
+	log := volumelog.ForMetadata(w.Log, meta)
 
-	var pemBlock *pem.Block
+	// Go's tls.LoadX509KeyPair expects the leaf first, followed by its
+	// intermediates. Order the chain before verifying the leaf.
+	if attrs[csiapi.FileLayoutKey] == csiapi.FileLayoutGoTLS {
+		bundle, err := cmpki.ParseSingleCertificateChainPEM(chain)
+		if err != nil {
+			return fmt.Errorf("ordering issued certificate chain for %q layout: %w", csiapi.FileLayoutGoTLS, err)
+		}
+		chain = bundle.ChainPEM
+	}
 
-	switch keyEncodingFormat := attrs[csiapi.KeyEncodingKey]; keyEncodingFormat {
-	case string(cmapi.PKCS1):
-		pemBlock = &pem.Block{
-			Type:  "RSA PRIVATE KEY",
-			Bytes: x509.MarshalPKCS1PrivateKey(key.(*rsa.PrivateKey)),
+	if attrs[csiapi.SkipCertVerificationKey] == "true" {
+		log.Info("WARNING: certificate verification is disabled for this volume, the issued certificate is written without checking it matches the private key or the request")
+	} else {
+		// Ensure the issued certificate was signed for the private key we
+		// generated, before writing anything to the volume.
+		if err := verifyKeyPair(key, chain); err != nil {
+			return err
 		}
-	case string(cmapi.PKCS8):
-		bytes, err := x509.MarshalPKCS8PrivateKey(key.(*rsa.PrivateKey))
-		if err != nil {
-			return fmt.Errorf("marshalling pkcs8 private key: %w", err)
+
+		// If requested, ensure the issuer did not drop or alter any
+		// requested SANs.
+		if err := verifySANs(meta, attrs[csiapi.RequireExactSANsKey], chain); err != nil {
+			return err
 		}
+	}
 
-		pemBlock = &pem.Block{
-			Type:  "PRIVATE KEY",
-			Bytes: bytes,
+	// If requested, write the chain which terminates in the preferred CA, if
+	// the issuer returned one.
+	if name, ok := attrs[csiapi.PreferredChainKey]; ok {
+		preferred, found, err := preferredChain(name, chain, ca)
+		if err != nil {
+			return err
+		}
+		if !found {
+			log.Info("The issuer returned no chain terminating in the preferred CA, using the issued chain",
+				"preferred_chain", name)
 		}
-	default:
-		return fmt.Errorf("invalid key encoding format: %s", keyEncodingFormat)
+		chain = preferred
 	}
 
-	keyPEM := pem.EncodeToMemory(pemBlock)
+	// PKCS1 encodes RSA keys as PKCS#1 and ECDSA keys as SEC 1. Ed25519 keys
+	// have no PKCS#1 form, so are always encoded as PKCS#8.
+	keyPEM, err := cmpki.EncodePrivateKey(key, cmapi.PrivateKeyEncoding(attrs[csiapi.KeyEncodingKey]))
+	if err != nil {
+		return fmt.Errorf("encoding private key: %w", err)
+	}
 
 	files := map[string][]byte{
 		attrs[csiapi.KeyFileKey]:  keyPEM,
@@ -81,11 +178,84 @@ func (w *Writer) WriteKeypair(meta metadata.Metadata, key crypto.PrivateKey, cha
 		attrs[csiapi.CAFileKey]:   ca,
 	}
 
+	// A keystore password held in a Secret is read on every write, so that
+	// renewed keystores use the current password. It is only set on this
+	// copy of the attributes, and never written to disk.
+	if _, ok := attrs[csiapi.KeyStorePKCS12PasswordSecretKey]; ok && attrs[csiapi.KeyStorePKCS12EnableKey] == "true" {
+		ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+		password, err := pkcs12.SecretPassword(ctx, w.Client, attrs)
+		cancel()
+		if err != nil {
+			return err
+		}
+		attrs[csiapi.KeyStorePKCS12PasswordKey] = password
+	}
+
 	// Handle PKCS12 keystore attributes.
-	if err := pkcs12.Handle(attrs, files, key, chain); err != nil {
+	if err := pkcs12.Handle(attrs, files, key, chain, ca); err != nil {
+		return err
+	}
+
+	// Handle combined file attributes.
+	if err := combined.Handle(attrs, files, keyPEM, chain); err != nil {
 		return err
 	}
 
+	// Handle the encoding attribute, after every other file has been
+	// derived from the PEM encoded private key, chain, and CA.
+	if err := der.Handle(attrs, files, keyPEM, chain, ca); err != nil {
+		return err
+	}
+
+	// If requested, write the issuer DN of the leaf certificate so that
+	// applications need not parse the certificate to discover its CA, and a
+	// human readable description of the certificate for debugging on the
+	// node.
+	issuerDNFile, writeIssuerDN := attrs[csiapi.IssuerDNFileKey]
+	certInfoFile, writeCertInfo := attrs[csiapi.CertInfoFileKey]
+	if writeIssuerDN || writeCertInfo {
+		crt, err := cmpki.DecodeX509CertificateBytes(chain)
+		if err != nil {
+			return fmt.Errorf("parsing issued certificate: %w", err)
+		}
+		if writeIssuerDN {
+			files[issuerDNFile] = []byte(crt.Issuer.String() + "\n")
+		}
+		if writeCertInfo {
+			files[certInfoFile] = []byte(certInfo(crt))
+		}
+	}
+
+	// If requested, record when the certificate was written, so that renewal
+	// can be monitored from the node without metrics.
+	if file, ok := attrs[csiapi.LastRenewalFileKey]; ok {
+		now := time.Now()
+		if w.Clock != nil {
+			now = w.Clock.Now()
+		}
+		files[file] = []byte(now.UTC().Format(time.RFC3339) + "\n")
+	}
+
+	// If requested, write the CA as a trust bundle. The bundle is written
+	// with every other file, so readers never observe a partial bundle.
+	if file, ok := attrs[csiapi.TrustBundleFileKey]; ok {
+		files[file] = ca
+	}
+
+	// If requested, serve the certificate and private key over named pipes
+	// rather than writing them as files.
+	var pipes map[string][]byte
+	if attrs[csiapi.OutputFIFOKey] == "true" {
+		if w.FIFOs == nil {
+			return errors.New("named pipe output is not supported")
+		}
+		pipes = make(map[string][]byte)
+		for _, k := range []string{csiapi.KeyFileKey, csiapi.CertFileKey} {
+			pipes[attrs[k]] = files[attrs[k]]
+			delete(files, attrs[k])
+		}
+	}
+
 	// Calculate the next issuance time and check errors before writing files.
 	// This prevents cases where we write files but also have errors in the
 	// nextIssuanceTime, putting the volume into a bad state.
@@ -93,9 +263,39 @@ func (w *Writer) WriteKeypair(meta metadata.Metadata, key crypto.PrivateKey, cha
 	if err != nil {
 		return fmt.Errorf("calculating next issuance time: %w", err)
 	}
+	nextIssuanceTime = w.jitterNextIssuanceTime(meta.VolumeID, nextIssuanceTime, chain)
+	nextIssuanceTime, err = w.cooldownNextIssuanceTime(attrs, nextIssuanceTime)
+	if err != nil {
+		return fmt.Errorf("calculating next issuance time: %w", err)
+	}
+	nextIssuanceTime = w.clampNextIssuanceTime(meta, nextIssuanceTime)
+	w.checkGrantedDuration(meta, attrs[csiapi.DurationKey], chain)
 
-	if err := w.Store.WriteFiles(meta, files); err != nil {
-		return fmt.Errorf("writing data: %w", err)
+	// Hold the volume while it is written, so that the watcher does not
+	// mistake the write for the files being modified.
+	var watched *watchedVolume
+	if w.Watcher != nil {
+		watched = w.Watcher.volume(meta.VolumeID)
+		watched.lock.Lock()
+		defer watched.lock.Unlock()
+	}
+
+	if err := w.writeFiles(meta, attrs, files); err != nil {
+		return err
+	}
+
+	if watched != nil {
+		w.Watcher.watch(watched, meta, files)
+	}
+
+	if pipes != nil {
+		gid, err := fsGroup(attrs)
+		if err != nil {
+			return err
+		}
+		if err := w.FIFOs.Write(meta.VolumeID, w.Store.PathForVolume(meta.VolumeID), pipes, gid); err != nil {
+			return fmt.Errorf("writing named pipes: %w", err)
+		}
 	}
 
 	meta.NextIssuanceTime = &nextIssuanceTime
@@ -103,9 +303,256 @@ func (w *Writer) WriteKeypair(meta metadata.Metadata, key crypto.PrivateKey, cha
 		return fmt.Errorf("writing metadata: %w", err)
 	}
 
+	if w.KeystoreWritten != nil && attrs[csiapi.KeyStorePKCS12EnableKey] == "true" {
+		w.KeystoreWritten(meta.VolumeID, pkcs12.Format)
+	}
+
 	return nil
 }
 
+// writeFiles writes the given files to the volume in a single WriteFiles call,
+// then applies any requested permissions.
+func (w *Writer) writeFiles(meta metadata.Metadata, attrs map[string]string, files map[string][]byte) error {
+	// Write every file in one call so that the backend can update them
+	// together. Never split this into multiple writes.
+	if err := w.Store.WriteFiles(meta, files); err != nil {
+		return fmt.Errorf("writing data: %w", err)
+	}
+
+	return w.setPermissions(meta.VolumeID, attrs, files)
+}
+
+// cooldownNextIssuanceTime delays the given renewal time to at least the
+// requested post-issue cooldown from now, allowing the issuer time to settle
+// after issuance. The cooldown is measured from when the certificate is
+// written rather than its NotBefore, which issuers may backdate.
+// The cooldown only delays renewal. The key pair and SAN checks made before
+// writing are local to the issued chain and do not depend on the issuer
+// replicating it, so they are intentionally not delayed.
+func (w *Writer) cooldownNextIssuanceTime(attrs map[string]string, nextIssuanceTime time.Time) (time.Time, error) {
+	v, ok := attrs[csiapi.PostIssueCooldownKey]
+	if !ok {
+		return nextIssuanceTime, nil
+	}
+	cooldown, err := time.ParseDuration(v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parsing requested post-issue cooldown %q: %w", csiapi.PostIssueCooldownKey, err)
+	}
+
+	now := time.Now()
+	if w.Clock != nil {
+		now = w.Clock.Now()
+	}
+
+	if earliest := now.Add(cooldown); nextIssuanceTime.Before(earliest) {
+		return earliest, nil
+	}
+	return nextIssuanceTime, nil
+}
+
+// clampNextIssuanceTime delays the given renewal time to at least
+// MinReissueInterval from now. This is a backstop against configurations
+// which would otherwise renew near continuously, so the limit applies even if
+// the certificate expires first.
+func (w *Writer) clampNextIssuanceTime(meta metadata.Metadata, nextIssuanceTime time.Time) time.Time {
+	if w.MinReissueInterval <= 0 {
+		return nextIssuanceTime
+	}
+
+	now := time.Now()
+	if w.Clock != nil {
+		now = w.Clock.Now()
+	}
+
+	earliest := now.Add(w.MinReissueInterval)
+	if !nextIssuanceTime.Before(earliest) {
+		return nextIssuanceTime
+	}
+
+	volumelog.ForMetadata(w.Log, meta).Info("Renewal would happen sooner than the minimum reissue interval, delaying renewal. Check the renew-before and duration of the volume",
+		"computed_next_issuance_time", nextIssuanceTime, "next_issuance_time", earliest)
+	if w.ReissueClamped != nil {
+		w.ReissueClamped(meta.VolumeID)
+	}
+
+	return earliest
+}
+
+// jitterNextIssuanceTime delays the given renewal time by an offset of up to
+// RenewalJitter, derived from the volume ID. The offset is limited to half of
+// the time remaining between the renewal time and the expiry of the issued
+// certificate, so that jitter never delays renewal past expiry.
+func (w *Writer) jitterNextIssuanceTime(volumeID string, nextIssuanceTime time.Time, chain []byte) time.Time {
+	if w.RenewalJitter <= 0 {
+		return nextIssuanceTime
+	}
+	crt, err := cmpki.DecodeX509CertificateBytes(chain)
+	if err != nil {
+		return nextIssuanceTime
+	}
+
+	limit := min(w.RenewalJitter, crt.NotAfter.Sub(nextIssuanceTime)/2)
+	if limit <= 0 {
+		return nextIssuanceTime
+	}
+
+	offset := time.Duration(maphash.String(jitterSeed, volumeID) % uint64(limit))
+	return nextIssuanceTime.Add(offset)
+}
+
+// setPermissions applies any requested permissions to the given files written
+// to the volume. The file mode applies to every file, and the certificate and
+// private key permissions override it for the certificate, private key, and
+// combined PEM files. The backend writes every file as readable by its owner
+// and group only, which is left unchanged unless requested. Does nothing if
+// the backend does not store files on the local filesystem.
+//
+// The backend does not accept file modes, so permissions can only be applied
+// once the new files have been swapped into the volume. Until they are, the
+// new files keep the backend's mode: a consumer outside their owner and group
+// is denied and should retry, and a mode more restrictive than the backend's
+// does not yet apply.
+func (w *Writer) setPermissions(volumeID string, attrs map[string]string, files map[string][]byte) error {
+	dir := w.Store.PathForVolume(volumeID)
+	if !filepath.IsAbs(dir) {
+		return nil
+	}
+
+	modes := make(map[string]os.FileMode)
+	if v, ok := attrs[csiapi.FileModeKey]; ok {
+		mode, err := validation.ParsePermissions(v)
+		if err != nil {
+			return fmt.Errorf("parsing %q: %w", csiapi.FileModeKey, err)
+		}
+		for name := range files {
+			modes[name] = mode
+		}
+	}
+
+	// The combined PEM file holds the private key, so is given the same
+	// permissions as the private key file.
+	for _, f := range []struct{ permissionsKey, fileKey string }{
+		{csiapi.CertificatePermissionsKey, csiapi.CertFileKey},
+		{csiapi.PrivateKeyPermissionsKey, csiapi.KeyFileKey},
+		{csiapi.PrivateKeyPermissionsKey, csiapi.CombinedPEMFileKey},
+	} {
+		v, ok := attrs[f.permissionsKey]
+		if !ok {
+			continue
+		}
+		if _, ok := files[attrs[f.fileKey]]; !ok {
+			continue
+		}
+		mode, err := validation.ParsePermissions(v)
+		if err != nil {
+			return fmt.Errorf("parsing %q: %w", f.permissionsKey, err)
+		}
+		modes[attrs[f.fileKey]] = mode
+	}
+
+	for name, mode := range modes {
+		path, err := volumeFilePath(dir, name)
+		if err != nil {
+			return fmt.Errorf("setting permissions: %w", err)
+		}
+		if err := os.Chmod(path, mode); err != nil {
+			return fmt.Errorf("setting permissions of %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// volumeFilePath returns the path of the named file within the given volume
+// directory, after resolving any symlinks. Returns an error if the name is not
+// a plain filename, or if the file resolves outside of the volume directory.
+// Filenames are validated with the volume attributes, this guards against
+// anything else in the volume directory pointing outside of it.
+func volumeFilePath(dir, name string) (string, error) {
+	if !filepath.IsLocal(name) || filepath.Base(name) != name {
+		return "", fmt.Errorf("file %q resolves outside of the volume", name)
+	}
+
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	path, err := filepath.EvalSymlinks(filepath.Join(root, name))
+	if err != nil {
+		return "", err
+	}
+
+	if rel, err := filepath.Rel(root, path); err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("file %q resolves outside of the volume", name)
+	}
+
+	return path, nil
+}
+
+// fsGroup returns the group that should own files in the volume, or nil if
+// ownership should not be changed.
+func fsGroup(attrs map[string]string) (*int64, error) {
+	v, ok := attrs[csiapi.FSGroupKey]
+	if !ok {
+		return nil, nil
+	}
+
+	gid, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q, value must be a valid integer: %w", csiapi.FSGroupKey, err)
+	}
+
+	return &gid, nil
+}
+
+// verifyKeyPair returns an error if the public key of the leaf certificate in
+// the given chain does not match the given private key.
+func verifyKeyPair(key crypto.PrivateKey, chain []byte) error {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("unsupported private key type: %T", key)
+	}
+
+	crt, err := cmpki.DecodeX509CertificateBytes(chain)
+	if err != nil {
+		return fmt.Errorf("parsing issued certificate: %w", err)
+	}
+
+	matches, err := cmpki.PublicKeyMatchesCertificate(signer.Public(), crt)
+	if err != nil {
+		return fmt.Errorf("comparing issued certificate public key: %w", err)
+	}
+	if !matches {
+		return errors.New("issued certificate public key does not match the generated private key")
+	}
+
+	return nil
+}
+
+// checkGrantedDuration logs if the lifetime of the issued certificate differs
+// significantly from the requested duration, such as when the issuer clamps
+// it. Renewal is always scheduled from the granted lifetime.
+func (w *Writer) checkGrantedDuration(meta metadata.Metadata, requested string, chain []byte) {
+	requestedDuration, err := time.ParseDuration(requested)
+	if err != nil || requestedDuration <= 0 {
+		return
+	}
+	crt, err := cmpki.DecodeX509CertificateBytes(chain)
+	if err != nil {
+		return
+	}
+
+	granted := crt.NotAfter.Sub(crt.NotBefore)
+	diff := granted - requestedDuration
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff*100 > requestedDuration*durationMismatchPercentage {
+		volumelog.ForMetadata(w.Log, meta).Info("The issuer granted a certificate duration which differs from the requested duration, renewal is scheduled from the granted duration",
+			"requested_duration", requestedDuration, "granted_duration", granted)
+	}
+}
+
 // calculateNextIssuanceTime will return the time at when the certificate
 // should be renewed by the driver. By default, this will return the time at
 // when the issued certificate is 2/3rds through its lifetime (NotAfter -
@@ -115,6 +562,11 @@ func (w *Writer) WriteKeypair(meta metadata.Metadata, key crypto.PrivateKey, cha
 // overwrite the default behaviour with a custom renew time. If this duration
 // results in a renew time before the NotBefore of the signed certificate
 // itself, it will fall back to returning 2/3rds the certificate lifetime.
+//
+// Alternatively, the volume attribute
+// `csi.cert-manager.io/renew-before-percentage` renews the certificate that
+// percentage of its actual lifetime before it expires, so that renewal
+// follows the duration granted by the issuer rather than the one requested.
 func calculateNextIssuanceTime(attrs map[string]string, chain []byte) (time.Time, error) {
 	block, _ := pem.Decode(chain)
 	crt, err := x509.ParseCertificate(block.Bytes)
@@ -140,6 +592,19 @@ func calculateNextIssuanceTime(attrs map[string]string, chain []byte) (time.Time
 		if crt.NotBefore.Add(renewBeforeDuration).Before(crt.NotAfter) {
 			renewBeforeNotAfter = renewBeforeDuration
 		}
+	} else if v, ok := attrs[csiapi.RenewBeforePercentageKey]; ok {
+		percentage, err := strconv.Atoi(v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("parsing requested renew-before percentage %q: %w", csiapi.RenewBeforePercentageKey, err)
+		}
+		renewBeforeNotAfter = actualDuration * time.Duration(percentage) / 100
+	}
+
+	// Short-lived certificates are renewed no earlier than half way through
+	// their lifetime, so that issuance latency cannot cause renewal to fall
+	// behind.
+	if actualDuration < shortCertificateDuration {
+		renewBeforeNotAfter = min(renewBeforeNotAfter, actualDuration/2)
 	}
 
 	return crt.NotAfter.Add(-renewBeforeNotAfter), nil
@@ -17,18 +17,36 @@ limitations under the License.
 package filestore
 
 import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/pem"
 	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/cert-manager/csi-lib/metadata"
 	"github.com/cert-manager/csi-lib/storage"
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	clocktesting "k8s.io/utils/clock/testing"
 	"software.sslmate.com/src/go-pkcs12"
 )
 
@@ -74,6 +92,7 @@ func newTestBundle(t *testing.T, encoder keyEncoder) testBundle {
 
 	template := x509.Certificate{
 		SerialNumber:          new(big.Int).Lsh(big.NewInt(1), 128),
+		Subject:               pkix.Name{CommonName: "test-ca", Organization: []string{"cert-manager"}},
 		NotBefore:             notBefore,
 		NotAfter:              notAfter,
 		BasicConstraintsValid: true,
@@ -135,6 +154,20 @@ func Test_calculateNextIssuanceTime(t *testing.T) {
 			expTime: time.Time{},
 			expErr:  true,
 		},
+		"if renew before percentage present, return that percentage of the lifetime before NotAfter": {
+			attrs: map[string]string{
+				"csi.cert-manager.io/renew-before-percentage": "25",
+			},
+			expTime: notBefore.Add(time.Hour * 54),
+			expErr:  false,
+		},
+		"if renew before percentage present but given a bad string, return error": {
+			attrs: map[string]string{
+				"csi.cert-manager.io/renew-before-percentage": "quarter",
+			},
+			expTime: time.Time{},
+			expErr:  true,
+		},
 	}
 
 	for name, test := range tests {
@@ -146,6 +179,167 @@ func Test_calculateNextIssuanceTime(t *testing.T) {
 	}
 }
 
+func Test_calculateNextIssuanceTime_shortLived(t *testing.T) {
+	pk, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.Add(time.Minute * 10),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &pk.PublicKey, pk)
+	require.NoError(t, err)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	// A renew-before which would renew almost immediately should be clamped
+	// to half of the lifetime.
+	renewTime, err := calculateNextIssuanceTime(map[string]string{
+		"csi.cert-manager.io/renew-before": "9m50s",
+	}, certPEM)
+	require.NoError(t, err)
+	assert.Equal(t, notBefore.Add(time.Minute*5), renewTime)
+
+	// A renew-before within half of the lifetime should be used.
+	renewTime, err = calculateNextIssuanceTime(map[string]string{
+		"csi.cert-manager.io/renew-before": "2m",
+	}, certPEM)
+	require.NoError(t, err)
+	assert.Equal(t, notBefore.Add(time.Minute*8), renewTime)
+
+	// A renew-before percentage above half of the lifetime should also be
+	// clamped.
+	renewTime, err = calculateNextIssuanceTime(map[string]string{
+		"csi.cert-manager.io/renew-before-percentage": "90",
+	}, certPEM)
+	require.NoError(t, err)
+	assert.Equal(t, notBefore.Add(time.Minute*5), renewTime)
+}
+
+func Test_cooldownNextIssuanceTime(t *testing.T) {
+	// The certificate is written an hour after its NotBefore, such as when it
+	// is backdated by the issuer.
+	now := notBefore.Add(time.Hour)
+
+	tests := map[string]struct {
+		attrs   map[string]string
+		renewal time.Time
+		expTime time.Time
+		expErr  bool
+	}{
+		"if no post-issue cooldown, return renewal time": {
+			renewal: now.Add(time.Minute),
+			expTime: now.Add(time.Minute),
+		},
+		"if post-issue cooldown present and renewal is later, return renewal time": {
+			attrs: map[string]string{
+				"csi.cert-manager.io/post-issue-cooldown": "5m",
+			},
+			renewal: now.Add(time.Minute * 10),
+			expTime: now.Add(time.Minute * 10),
+		},
+		"if post-issue cooldown present and renewal is sooner, return end of cooldown from the write": {
+			attrs: map[string]string{
+				"csi.cert-manager.io/post-issue-cooldown": "5m",
+			},
+			renewal: notBefore.Add(time.Minute * 30),
+			expTime: now.Add(time.Minute * 5),
+		},
+		"if post-issue cooldown present but given a bad string, return error": {
+			attrs: map[string]string{
+				"csi.cert-manager.io/post-issue-cooldown": "bad-duration",
+			},
+			renewal: now,
+			expTime: time.Time{},
+			expErr:  true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := &Writer{Log: logr.Discard(), Clock: clocktesting.NewFakeClock(now)}
+			renewTime, err := w.cooldownNextIssuanceTime(test.attrs, test.renewal)
+			assert.Equal(t, test.expErr, err != nil)
+			assert.Equal(t, test.expTime, renewTime)
+		})
+	}
+}
+
+func Test_clampNextIssuanceTime(t *testing.T) {
+	now := notBefore.Add(time.Hour)
+
+	var clamped []string
+	w := &Writer{
+		MinReissueInterval: time.Minute * 5,
+		ReissueClamped:     func(volumeID string) { clamped = append(clamped, volumeID) },
+		Log:                logr.Discard(),
+		Clock:              clocktesting.NewFakeClock(now),
+	}
+
+	assert.Equal(t, now.Add(time.Minute*10), w.clampNextIssuanceTime(metadata.Metadata{VolumeID: "vol-later"}, now.Add(time.Minute*10)))
+	assert.Equal(t, now.Add(time.Minute*5), w.clampNextIssuanceTime(metadata.Metadata{VolumeID: "vol-soon"}, now.Add(time.Second)))
+	assert.Equal(t, now.Add(time.Minute*5), w.clampNextIssuanceTime(metadata.Metadata{VolumeID: "vol-past"}, now.Add(-time.Minute)))
+	assert.Equal(t, []string{"vol-soon", "vol-past"}, clamped)
+
+	w.MinReissueInterval = 0
+	assert.Equal(t, now.Add(time.Second), w.clampNextIssuanceTime(metadata.Metadata{VolumeID: "vol-soon"}, now.Add(time.Second)))
+}
+
+func Test_jitterNextIssuanceTime(t *testing.T) {
+	testBundle := newTestBundle(t, pkcs8Encoder)
+	renewal := notAfter.Add(-time.Hour * 24)
+
+	w := &Writer{RenewalJitter: time.Hour}
+	jittered := w.jitterNextIssuanceTime("vol-id", renewal, testBundle.certPEM)
+	assert.False(t, jittered.Before(renewal))
+	assert.True(t, jittered.Before(renewal.Add(time.Hour)))
+
+	// The offset is stable for the same volume.
+	assert.Equal(t, jittered, w.jitterNextIssuanceTime("vol-id", renewal, testBundle.certPEM))
+
+	// The offset never exceeds half of the time remaining until expiry.
+	w.RenewalJitter = time.Hour * 24 * 365
+	for _, id := range []string{"vol-a", "vol-b", "vol-c", "vol-d"} {
+		assert.False(t, w.jitterNextIssuanceTime(id, renewal, testBundle.certPEM).After(renewal.Add(time.Hour*12)))
+	}
+	assert.Equal(t, notAfter, w.jitterNextIssuanceTime("vol-id", notAfter, testBundle.certPEM))
+
+	w.RenewalJitter = 0
+	assert.Equal(t, renewal, w.jitterNextIssuanceTime("vol-id", renewal, testBundle.certPEM))
+}
+
+func Test_volumeFilePath(t *testing.T) {
+	outside := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0600))
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tls.crt"), []byte("crt"), 0600))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "..data"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "..data", "tls.key"), []byte("key"), 0600))
+	require.NoError(t, os.Symlink(filepath.Join("..data", "tls.key"), filepath.Join(dir, "tls.key")))
+	require.NoError(t, os.Symlink(filepath.Join(outside, "secret"), filepath.Join(dir, "escape")))
+
+	tests := map[string]struct {
+		name   string
+		expErr bool
+	}{
+		"a file in the volume should resolve":                      {name: "tls.crt"},
+		"a symlink within the volume should resolve":               {name: "tls.key"},
+		"a symlink outside of the volume should error":             {name: "escape", expErr: true},
+		"a parent directory should error":                          {name: "..", expErr: true},
+		"a relative path outside of the volume should error":       {name: "../secret", expErr: true},
+		"an absolute path should error":                            {name: filepath.Join(outside, "secret"), expErr: true},
+		"a path through a subdirectory of the volume should error": {name: "..data/tls.key", expErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := volumeFilePath(dir, test.name)
+			assert.Equal(t, test.expErr, err != nil, "%v", err)
+		})
+	}
+}
+
 func Test_WriteKeypair(t *testing.T) {
 	pkcs1Bundle := newTestBundle(t, pkcs1Encoder)
 	pkcs8Bundle := newTestBundle(t, pkcs8Encoder)
@@ -235,6 +429,68 @@ func Test_WriteKeypair(t *testing.T) {
 			},
 			expErr: false,
 		},
+		"if secret-tls file layout, write exactly the files of a tls Secret": {
+			testBundle: pkcs1Bundle,
+			meta: metadata.Metadata{
+				VolumeID:   "vol-id",
+				TargetPath: "/target-path",
+				VolumeContext: map[string]string{
+					"csi.cert-manager.io/issuer-name": "ca-issuer",
+					"csi.cert-manager.io/file-layout": "secret-tls",
+				},
+			},
+			expFiles: map[string][]byte{
+				"ca.crt":  pkcs1Bundle.caPEM,
+				"tls.crt": pkcs1Bundle.certPEM,
+				"tls.key": pkcs1Bundle.pkPEM,
+				"metadata.json": []byte(
+					`{"volumeID":"vol-id","targetPath":"/target-path","nextIssuanceTime":"1970-01-03T00:00:00Z","volumeContext":{"csi.cert-manager.io/file-layout":"secret-tls","csi.cert-manager.io/issuer-name":"ca-issuer"}}`,
+				),
+			},
+			expErr: false,
+		},
+		"if issuer dn file present, write the issuer dn of the certificate": {
+			testBundle: pkcs1Bundle,
+			meta: metadata.Metadata{
+				VolumeID:   "vol-id",
+				TargetPath: "/target-path",
+				VolumeContext: map[string]string{
+					"csi.cert-manager.io/issuer-name":    "ca-issuer",
+					"csi.cert-manager.io/issuer-dn-file": "issuer-dn",
+				},
+			},
+			expFiles: map[string][]byte{
+				"ca.crt":    pkcs1Bundle.caPEM,
+				"tls.crt":   pkcs1Bundle.certPEM,
+				"tls.key":   pkcs1Bundle.pkPEM,
+				"issuer-dn": []byte("CN=test-ca,O=cert-manager\n"),
+				"metadata.json": []byte(
+					`{"volumeID":"vol-id","targetPath":"/target-path","nextIssuanceTime":"1970-01-03T00:00:00Z","volumeContext":{"csi.cert-manager.io/issuer-dn-file":"issuer-dn","csi.cert-manager.io/issuer-name":"ca-issuer"}}`,
+				),
+			},
+			expErr: false,
+		},
+		"if cert info file present, write a description of the certificate": {
+			testBundle: pkcs1Bundle,
+			meta: metadata.Metadata{
+				VolumeID:   "vol-id",
+				TargetPath: "/target-path",
+				VolumeContext: map[string]string{
+					"csi.cert-manager.io/issuer-name":    "ca-issuer",
+					"csi.cert-manager.io/cert-info-file": "cert-info.txt",
+				},
+			},
+			expFiles: map[string][]byte{
+				"ca.crt":        pkcs1Bundle.caPEM,
+				"tls.crt":       pkcs1Bundle.certPEM,
+				"tls.key":       pkcs1Bundle.pkPEM,
+				"cert-info.txt": []byte(certInfo(pkcs1Bundle.cert)),
+				"metadata.json": []byte(
+					`{"volumeID":"vol-id","targetPath":"/target-path","nextIssuanceTime":"1970-01-03T00:00:00Z","volumeContext":{"csi.cert-manager.io/cert-info-file":"cert-info.txt","csi.cert-manager.io/issuer-name":"ca-issuer"}}`,
+				),
+			},
+			expErr: false,
+		},
 
 		"if encoder is PKCS8, use the correct encoder": {
 			testBundle: pkcs8Bundle,
@@ -379,6 +635,50 @@ func Test_WriteKeypair(t *testing.T) {
 			},
 			expErr: false,
 		},
+		"keystore PKCS12 with chain excluded should only contain the leaf certificate": {
+			testBundle: pkcs8Bundle,
+			meta: metadata.Metadata{
+				VolumeID:   "vol-id",
+				TargetPath: "/target-path",
+				VolumeContext: map[string]string{
+					"csi.cert-manager.io/issuer-name":          "ca-issuer",
+					"csi.cert-manager.io/key-encoding":         "PKCS8",
+					"csi.cert-manager.io/pkcs12-enable":        "true",
+					"csi.cert-manager.io/pkcs12-password":      "my-password",
+					"csi.cert-manager.io/pkcs12-include-chain": "false",
+				},
+			},
+			expFiles: map[string][]byte{
+				"ca.crt":  pkcs8Bundle.caPEM,
+				"tls.crt": pkcs8Bundle.certPEM,
+				"tls.key": pkcs8Bundle.pkPEM,
+				"metadata.json": []byte(
+					`{"volumeID":"vol-id","targetPath":"/target-path","nextIssuanceTime":"1970-01-03T00:00:00Z","volumeContext":{"csi.cert-manager.io/issuer-name":"ca-issuer","csi.cert-manager.io/key-encoding":"PKCS8","csi.cert-manager.io/pkcs12-enable":"true","csi.cert-manager.io/pkcs12-include-chain":"false","csi.cert-manager.io/pkcs12-password":"my-password"}}`,
+				),
+			},
+			expErr: false,
+		},
+		"combined format haproxy should write the certificate followed by the key": {
+			testBundle: pkcs1Bundle,
+			meta: metadata.Metadata{
+				VolumeID:   "vol-id",
+				TargetPath: "/target-path",
+				VolumeContext: map[string]string{
+					"csi.cert-manager.io/issuer-name":     "ca-issuer",
+					"csi.cert-manager.io/combined-format": "haproxy",
+				},
+			},
+			expFiles: map[string][]byte{
+				"ca.crt":           pkcs1Bundle.caPEM,
+				"tls.crt":          pkcs1Bundle.certPEM,
+				"tls.key":          pkcs1Bundle.pkPEM,
+				"tls-combined.pem": append(append([]byte{}, pkcs1Bundle.certPEM...), pkcs1Bundle.pkPEM...),
+				"metadata.json": []byte(
+					`{"volumeID":"vol-id","targetPath":"/target-path","nextIssuanceTime":"1970-01-03T00:00:00Z","volumeContext":{"csi.cert-manager.io/combined-format":"haproxy","csi.cert-manager.io/issuer-name":"ca-issuer"}}`,
+				),
+			},
+			expErr: false,
+		},
 		"keystore PKCS12 with no password and breakout file should error": {
 			testBundle: pkcs8Bundle,
 			meta: metadata.Metadata{
@@ -424,7 +724,7 @@ func Test_WriteKeypair(t *testing.T) {
 	for name, test := range tests {
 		t.Run(name, func(t *testing.T) {
 			store := storage.NewMemoryFS()
-			w := &Writer{store}
+			w := &Writer{Store: store}
 
 			_, err := w.Store.RegisterMetadata(test.meta)
 			assert.NoError(t, err)
@@ -449,7 +749,11 @@ func Test_WriteKeypair(t *testing.T) {
 
 				assert.Equal(t, test.testBundle.pk, pk)
 				assert.Equal(t, test.testBundle.cert, cert)
-				assert.Empty(t, cas)
+				if test.meta.VolumeContext["csi.cert-manager.io/pkcs12-include-chain"] == "false" {
+					assert.Empty(t, cas)
+				} else {
+					assert.Equal(t, []*x509.Certificate{test.testBundle.ca}, cas)
+				}
 
 				// Delete the pksc12 file to let the assertion for expFiles proceed.
 				delete(files, pkcs12File)
@@ -459,3 +763,601 @@ func Test_WriteKeypair(t *testing.T) {
 		})
 	}
 }
+
+// recordingStore records the order of the writes made to the storage backend.
+type recordingStore struct {
+	storage.Interface
+
+	writes [][]string
+}
+
+func (r *recordingStore) WriteFiles(meta metadata.Metadata, files map[string][]byte) error {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	r.writes = append(r.writes, names)
+	return r.Interface.WriteFiles(meta, files)
+}
+
+func (r *recordingStore) WriteMetadata(volumeID string, meta metadata.Metadata) error {
+	r.writes = append(r.writes, []string{"metadata.json"})
+	return r.Interface.WriteMetadata(volumeID, meta)
+}
+
+func Test_WriteKeypair_writesFilesTogether(t *testing.T) {
+	bundle := newTestBundle(t, pkcs8Encoder)
+	meta := metadata.Metadata{
+		VolumeID:   "vol-id",
+		TargetPath: "/target-path",
+		VolumeContext: map[string]string{
+			"csi.cert-manager.io/issuer-name":     "ca-issuer",
+			"csi.cert-manager.io/key-encoding":    "PKCS8",
+			"csi.cert-manager.io/pkcs12-enable":   "true",
+			"csi.cert-manager.io/pkcs12-password": "my-password",
+		},
+	}
+
+	store := &recordingStore{Interface: storage.NewMemoryFS()}
+	_, err := store.RegisterMetadata(meta)
+	require.NoError(t, err)
+
+	w := &Writer{Store: store}
+	require.NoError(t, w.WriteKeypair(meta, bundle.pk, bundle.certPEM, bundle.caPEM))
+
+	// The CA, key, certificate, and keystore must be written in a single call,
+	// before the metadata is updated.
+	assert.Equal(t, [][]string{
+		{"ca.crt", "keystore.p12", "tls.crt", "tls.key"},
+		{"metadata.json"},
+	}, store.writes)
+}
+
+func Test_WriteKeypair_keystoreWritten(t *testing.T) {
+	bundle := newTestBundle(t, pkcs8Encoder)
+
+	meta := metadata.Metadata{
+		VolumeID:   "vol-id",
+		TargetPath: "/target-path",
+		VolumeContext: map[string]string{
+			"csi.cert-manager.io/issuer-name":     "ca-issuer",
+			"csi.cert-manager.io/pkcs12-enable":   "true",
+			"csi.cert-manager.io/pkcs12-filename": "keystore.p12",
+			"csi.cert-manager.io/pkcs12-password": "my-password",
+		},
+	}
+
+	store := storage.NewMemoryFS()
+	_, err := store.RegisterMetadata(meta)
+	require.NoError(t, err)
+
+	var written []string
+	w := &Writer{Store: store, KeystoreWritten: func(volumeID, format string) {
+		written = append(written, volumeID+"/"+format)
+	}}
+	require.NoError(t, w.WriteKeypair(meta, bundle.pk, bundle.certPEM, bundle.caPEM))
+	assert.Equal(t, []string{"vol-id/pkcs12"}, written)
+
+	// Volumes without a keystore are not recorded.
+	meta.VolumeContext["csi.cert-manager.io/pkcs12-enable"] = "false"
+	require.NoError(t, w.WriteKeypair(meta, bundle.pk, bundle.certPEM, bundle.caPEM))
+	assert.Equal(t, []string{"vol-id/pkcs12"}, written)
+}
+
+func Test_WriteKeypair_pkcs12PasswordSecret(t *testing.T) {
+	bundle := newTestBundle(t, pkcs8Encoder)
+
+	meta := metadata.Metadata{
+		VolumeID:   "vol-id",
+		TargetPath: "/target-path",
+		VolumeContext: map[string]string{
+			"csi.cert-manager.io/issuer-name":            "ca-issuer",
+			"csi.cert-manager.io/pkcs12-enable":          "true",
+			"csi.cert-manager.io/pkcs12-filename":        "keystore.p12",
+			"csi.cert-manager.io/pkcs12-password-secret": "keystore-password",
+			"csi.storage.k8s.io/pod.namespace":           "my-namespace",
+		},
+	}
+
+	store := storage.NewMemoryFS()
+	_, err := store.RegisterMetadata(meta)
+	require.NoError(t, err)
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", Name: "keystore-password"},
+		Data:       map[string][]byte{"password": []byte("my-password")},
+	}
+	client := fake.NewSimpleClientset(secret)
+	w := &Writer{Store: store, Client: client}
+
+	// The keystore is encrypted with the password read from the Secret, which
+	// is re-read on every write.
+	for _, password := range []string{"my-password", "new-password"} {
+		secret.Data["password"] = []byte(password)
+		_, err := client.CoreV1().Secrets("my-namespace").Update(context.Background(), secret, metav1.UpdateOptions{})
+		require.NoError(t, err)
+
+		require.NoError(t, w.WriteKeypair(meta, bundle.pk, bundle.certPEM, bundle.caPEM))
+		files, err := store.ReadFiles("vol-id")
+		require.NoError(t, err)
+		_, _, _, err = pkcs12.DecodeChain(files["keystore.p12"], password)
+		require.NoError(t, err, password)
+
+		// The password is never written to the volume's metadata.
+		written, err := store.ReadMetadata("vol-id")
+		require.NoError(t, err)
+		assert.NotContains(t, written.VolumeContext, "csi.cert-manager.io/pkcs12-password")
+	}
+
+	// Without the Secret, nothing is written.
+	require.NoError(t, client.CoreV1().Secrets("my-namespace").Delete(context.Background(), "keystore-password", metav1.DeleteOptions{}))
+	otherBundle := newTestBundle(t, pkcs8Encoder)
+	assert.EqualError(t, w.WriteKeypair(meta, otherBundle.pk, otherBundle.certPEM, otherBundle.caPEM),
+		"PKCS12 password Secret my-namespace/keystore-password does not exist")
+	files, err := store.ReadFiles("vol-id")
+	require.NoError(t, err)
+	assert.Equal(t, bundle.certPEM, files["tls.crt"])
+}
+
+func Test_WriteKeypair_lastRenewalFile(t *testing.T) {
+	bundle := newTestBundle(t, pkcs8Encoder)
+
+	meta := metadata.Metadata{
+		VolumeID:   "vol-id",
+		TargetPath: "/target-path",
+		VolumeContext: map[string]string{
+			"csi.cert-manager.io/issuer-name":       "ca-issuer",
+			"csi.cert-manager.io/last-renewal-file": "last-renewal",
+		},
+	}
+
+	store := storage.NewMemoryFS()
+	_, err := store.RegisterMetadata(meta)
+	require.NoError(t, err)
+
+	fakeClock := clocktesting.NewFakeClock(time.Date(2024, time.March, 1, 12, 30, 0, 0, time.FixedZone("", 3600)))
+	w := &Writer{Store: store, Clock: fakeClock}
+
+	// The file is rewritten with the time of every write.
+	for _, exp := range []string{"2024-03-01T11:30:00Z\n", "2024-03-01T12:30:00Z\n"} {
+		require.NoError(t, w.WriteKeypair(meta, bundle.pk, bundle.certPEM, bundle.caPEM))
+		files, err := store.ReadFiles("vol-id")
+		require.NoError(t, err)
+		assert.Equal(t, exp, string(files["last-renewal"]))
+		fakeClock.Step(time.Hour)
+	}
+}
+
+func Test_WriteKeypair_trustBundleFile(t *testing.T) {
+	bundle := newTestBundle(t, pkcs8Encoder)
+
+	meta := metadata.Metadata{
+		VolumeID:   "vol-id",
+		TargetPath: "/target-path",
+		VolumeContext: map[string]string{
+			"csi.cert-manager.io/issuer-name":       "ca-issuer",
+			"csi.cert-manager.io/trust-bundle-file": "bundle.pem",
+		},
+	}
+
+	store := storage.NewMemoryFS()
+	_, err := store.RegisterMetadata(meta)
+	require.NoError(t, err)
+
+	w := &Writer{Store: store}
+	require.NoError(t, w.WriteKeypair(meta, bundle.pk, bundle.certPEM, bundle.caPEM))
+	files, err := store.ReadFiles("vol-id")
+	require.NoError(t, err)
+	assert.Equal(t, bundle.caPEM, files["bundle.pem"])
+
+	// The bundle is rewritten with the CA of every issuance, and stays PEM
+	// encoded when the other files are DER encoded.
+	otherBundle := newTestBundle(t, pkcs8Encoder)
+	meta.VolumeContext["csi.cert-manager.io/encoding"] = "DER"
+	require.NoError(t, w.WriteKeypair(meta, bundle.pk, bundle.certPEM, otherBundle.caPEM))
+	files, err = store.ReadFiles("vol-id")
+	require.NoError(t, err)
+	assert.Equal(t, otherBundle.caPEM, files["bundle.pem"])
+	assert.Equal(t, otherBundle.ca.Raw, files["ca.crt"])
+}
+
+func Test_WriteKeypair_mismatchedKey(t *testing.T) {
+	bundle := newTestBundle(t, pkcs1Encoder)
+	otherBundle := newTestBundle(t, pkcs1Encoder)
+
+	meta := metadata.Metadata{
+		VolumeID:   "vol-id",
+		TargetPath: "/target-path",
+		VolumeContext: map[string]string{
+			"csi.cert-manager.io/issuer-name": "ca-issuer",
+		},
+	}
+
+	store := storage.NewMemoryFS()
+	_, err := store.RegisterMetadata(meta)
+	require.NoError(t, err)
+
+	w := &Writer{Store: store}
+	err = w.WriteKeypair(meta, otherBundle.pk, bundle.certPEM, bundle.caPEM)
+	assert.EqualError(t, err, "issued certificate public key does not match the generated private key")
+
+	// No files should have been written to the volume.
+	files, err := store.ReadFiles("vol-id")
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.Contains(t, files, "metadata.json")
+}
+
+func Test_WriteKeypair_skipCertVerification(t *testing.T) {
+	bundle := newTestBundle(t, pkcs1Encoder)
+	otherBundle := newTestBundle(t, pkcs1Encoder)
+
+	meta := metadata.Metadata{
+		VolumeID:   "vol-id",
+		TargetPath: "/target-path",
+		VolumeContext: map[string]string{
+			"csi.cert-manager.io/issuer-name":            "ca-issuer",
+			"csi.cert-manager.io/skip-cert-verification": "true",
+		},
+	}
+
+	store := storage.NewMemoryFS()
+	_, err := store.RegisterMetadata(meta)
+	require.NoError(t, err)
+
+	// A certificate which does not match the key should be written when
+	// verification is skipped.
+	w := &Writer{Store: store}
+	require.NoError(t, w.WriteKeypair(meta, otherBundle.pk, bundle.certPEM, bundle.caPEM))
+
+	files, err := store.ReadFiles("vol-id")
+	require.NoError(t, err)
+	assert.Equal(t, bundle.certPEM, files["tls.crt"])
+}
+
+// fakeFIFOWriter records the files served over named pipes.
+type fakeFIFOWriter struct {
+	files map[string][]byte
+	gid   *int64
+}
+
+func (f *fakeFIFOWriter) Write(volumeID, dir string, files map[string][]byte, gid *int64) error {
+	f.files, f.gid = files, gid
+	return nil
+}
+
+func Test_WriteKeypair_outputFIFO(t *testing.T) {
+	bundle := newTestBundle(t, pkcs1Encoder)
+	meta := metadata.Metadata{
+		VolumeID:   "vol-id",
+		TargetPath: "/target-path",
+		VolumeContext: map[string]string{
+			"csi.cert-manager.io/issuer-name": "ca-issuer",
+			"csi.cert-manager.io/fs-group":    "2000",
+			"csi.cert-manager.io/output-fifo": "true",
+		},
+	}
+
+	store := storage.NewMemoryFS()
+	_, err := store.RegisterMetadata(meta)
+	require.NoError(t, err)
+
+	assert.EqualError(t, (&Writer{Store: store}).WriteKeypair(meta, bundle.pk, bundle.certPEM, bundle.caPEM),
+		"named pipe output is not supported")
+
+	fifos := new(fakeFIFOWriter)
+	w := &Writer{Store: store, FIFOs: fifos}
+	require.NoError(t, w.WriteKeypair(meta, bundle.pk, bundle.certPEM, bundle.caPEM))
+
+	// The certificate and key should be served over named pipes, and not
+	// written to the volume.
+	assert.Equal(t, int64(2000), *fifos.gid)
+	assert.Equal(t, bundle.certPEM, fifos.files["tls.crt"])
+	assert.Contains(t, fifos.files, "tls.key")
+
+	files, err := store.ReadFiles("vol-id")
+	require.NoError(t, err)
+	assert.Contains(t, files, "ca.crt")
+	assert.NotContains(t, files, "tls.crt")
+	assert.NotContains(t, files, "tls.key")
+}
+
+// dirStore writes files to a directory on the local filesystem, replacing
+// each file on every write in the same way as the filesystem backend.
+type dirStore struct {
+	storage.Interface
+
+	dir string
+}
+
+func (d *dirStore) PathForVolume(string) string {
+	return d.dir
+}
+
+func (d *dirStore) WriteFiles(_ metadata.Metadata, files map[string][]byte) error {
+	for name, data := range files {
+		tmp := filepath.Join(d.dir, "."+name+".tmp")
+		if err := os.WriteFile(tmp, data, 0600); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, filepath.Join(d.dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Test_WriteKeypair_permissions(t *testing.T) {
+	bundle := newTestBundle(t, pkcs1Encoder)
+	meta := metadata.Metadata{
+		VolumeID:   "vol-id",
+		TargetPath: "/target-path",
+		VolumeContext: map[string]string{
+			"csi.cert-manager.io/issuer-name":             "ca-issuer",
+			"csi.cert-manager.io/certificate-permissions": "0644",
+			"csi.cert-manager.io/privatekey-permissions":  "0400",
+			"csi.cert-manager.io/combined-pem-file":       "tls-combined.pem",
+		},
+	}
+
+	store := &dirStore{Interface: storage.NewMemoryFS(), dir: t.TempDir()}
+	_, err := store.RegisterMetadata(meta)
+	require.NoError(t, err)
+
+	w := &Writer{Store: store}
+
+	// Permissions should be applied on the initial write, and again on every
+	// renewal since the backend rewrites the files.
+	for range 2 {
+		require.NoError(t, w.WriteKeypair(meta, bundle.pk, bundle.certPEM, bundle.caPEM))
+
+		for name, expMode := range map[string]os.FileMode{
+			"tls.crt":          0644,
+			"tls.key":          0400,
+			"tls-combined.pem": 0400,
+			"ca.crt":           0600,
+		} {
+			info, err := os.Stat(filepath.Join(store.dir, name))
+			require.NoError(t, err)
+			assert.Equal(t, expMode, info.Mode().Perm(), name)
+		}
+	}
+}
+
+func Test_WriteKeypair_fileMode(t *testing.T) {
+	bundle := newTestBundle(t, pkcs1Encoder)
+	meta := metadata.Metadata{
+		VolumeID:   "vol-id",
+		TargetPath: "/target-path",
+		VolumeContext: map[string]string{
+			"csi.cert-manager.io/issuer-name":            "ca-issuer",
+			"csi.cert-manager.io/file-mode":              "0640",
+			"csi.cert-manager.io/privatekey-permissions": "0400",
+		},
+	}
+
+	store := &dirStore{Interface: storage.NewMemoryFS(), dir: t.TempDir()}
+	_, err := store.RegisterMetadata(meta)
+	require.NoError(t, err)
+
+	w := &Writer{Store: store}
+
+	// The file mode applies to every file unless overridden, and is applied
+	// again on every renewal.
+	for range 2 {
+		require.NoError(t, w.WriteKeypair(meta, bundle.pk, bundle.certPEM, bundle.caPEM))
+
+		for name, expMode := range map[string]os.FileMode{
+			"tls.crt": 0640,
+			"tls.key": 0400,
+			"ca.crt":  0640,
+		} {
+			info, err := os.Stat(filepath.Join(store.dir, name))
+			require.NoError(t, err)
+			assert.Equal(t, expMode, info.Mode().Perm(), name)
+		}
+	}
+}
+
+func Test_WriteKeypair_goTLSLayout(t *testing.T) {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	intermediateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	bundle := newTestBundle(t, pkcs8Encoder)
+
+	root, rootPEM := signCertificate(t, "root", true, rootKey.Public(), nil, rootKey)
+	intermediate, intermediatePEM := signCertificate(t, "intermediate", true, intermediateKey.Public(), root, rootKey)
+	leaf, leafPEM := signCertificate(t, "leaf", false, bundle.pk.Public(), intermediate, intermediateKey)
+
+	meta := metadata.Metadata{
+		VolumeID:   "vol-id",
+		TargetPath: "/target-path",
+		VolumeContext: map[string]string{
+			"csi.cert-manager.io/issuer-name":  "ca-issuer",
+			"csi.cert-manager.io/key-encoding": "PKCS8",
+			"csi.cert-manager.io/file-layout":  "go-tls",
+		},
+	}
+
+	store := &dirStore{Interface: storage.NewMemoryFS(), dir: t.TempDir()}
+	_, err = store.RegisterMetadata(meta)
+	require.NoError(t, err)
+
+	// The issuer returns the chain out of order, including the root.
+	w := &Writer{Store: store}
+	chain := bytes.Join([][]byte{intermediatePEM, rootPEM, leafPEM}, nil)
+	require.NoError(t, w.WriteKeypair(meta, bundle.pk, chain, rootPEM))
+
+	keyPair, err := tls.LoadX509KeyPair(filepath.Join(store.dir, "tls.crt"), filepath.Join(store.dir, "tls.key"))
+	require.NoError(t, err)
+	require.Len(t, keyPair.Certificate, 2)
+	assert.Equal(t, leaf.Raw, keyPair.Certificate[0])
+	assert.Equal(t, intermediate.Raw, keyPair.Certificate[1])
+
+	// A chain which is broken should fail.
+	otherBundle := newTestBundle(t, pkcs8Encoder)
+	brokenChain := bytes.Join([][]byte{leafPEM, otherBundle.caPEM}, nil)
+	assert.Error(t, w.WriteKeypair(meta, bundle.pk, brokenChain, rootPEM))
+}
+
+func Test_WriteKeypair_derEncoding(t *testing.T) {
+	bundle := newTestBundle(t, pkcs8Encoder)
+
+	meta := metadata.Metadata{
+		VolumeID:   "vol-id",
+		TargetPath: "/target-path",
+		VolumeContext: map[string]string{
+			"csi.cert-manager.io/issuer-name":  "ca-issuer",
+			"csi.cert-manager.io/key-encoding": "PKCS8",
+			"csi.cert-manager.io/encoding":     "DER",
+		},
+	}
+
+	store := storage.NewMemoryFS()
+	_, err := store.RegisterMetadata(meta)
+	require.NoError(t, err)
+
+	w := &Writer{Store: store}
+	require.NoError(t, w.WriteKeypair(meta, bundle.pk, bundle.certPEM, bundle.caPEM))
+
+	files, err := store.ReadFiles("vol-id")
+	require.NoError(t, err)
+	key, err := x509.ParsePKCS8PrivateKey(files["tls.key"])
+	require.NoError(t, err)
+	assert.True(t, bundle.pk.Equal(key))
+	assert.Equal(t, bundle.cert.Raw, files["tls.crt"])
+	assert.Equal(t, bundle.ca.Raw, files["ca.crt"])
+
+	written, err := store.ReadMetadata("vol-id")
+	require.NoError(t, err)
+	assert.NotNil(t, written.NextIssuanceTime)
+
+	// A CA of more than one certificate cannot be DER encoded.
+	otherBundle := newTestBundle(t, pkcs8Encoder)
+	err = w.WriteKeypair(meta, bundle.pk, bundle.certPEM, bytes.Join([][]byte{bundle.caPEM, otherBundle.caPEM}, nil))
+	assert.ErrorContains(t, err, "single CA certificate")
+}
+
+func Test_WriteKeypair_clampedDuration(t *testing.T) {
+	bundle := newTestBundle(t, pkcs1Encoder)
+
+	tests := map[string]struct {
+		duration    string
+		renewBefore string
+		expLogged   bool
+	}{
+		"if the issuer grants the requested duration, nothing is logged": {
+			duration:  "72h",
+			expLogged: false,
+		},
+		"if the issuer clamps the requested duration, renewal follows the granted duration and is logged": {
+			duration:  "2160h",
+			expLogged: true,
+		},
+		"if the issuer clamps below the requested renew before, renewal follows the granted duration and is logged": {
+			duration:    "2160h",
+			renewBefore: "720h",
+			expLogged:   true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			meta := metadata.Metadata{
+				VolumeID:   "vol-id",
+				TargetPath: "/target-path",
+				VolumeContext: map[string]string{
+					"csi.cert-manager.io/issuer-name": "ca-issuer",
+					"csi.cert-manager.io/duration":    test.duration,
+				},
+			}
+			if len(test.renewBefore) > 0 {
+				meta.VolumeContext["csi.cert-manager.io/renew-before"] = test.renewBefore
+			}
+
+			store := storage.NewMemoryFS()
+			_, err := store.RegisterMetadata(meta)
+			require.NoError(t, err)
+
+			var logged bool
+			log := funcr.New(func(_, args string) {
+				if strings.Contains(args, `"granted_duration"="72h0m0s"`) {
+					logged = true
+				}
+			}, funcr.Options{})
+
+			w := &Writer{Store: store, Log: log}
+			require.NoError(t, w.WriteKeypair(meta, bundle.pk, bundle.certPEM, bundle.caPEM))
+
+			// The certificate granted by the issuer is valid for 3 days, so
+			// should be renewed 2/3rds of the way through that lifetime.
+			written, err := store.ReadMetadata("vol-id")
+			require.NoError(t, err)
+			require.NotNil(t, written.NextIssuanceTime)
+			assert.Equal(t, notBefore.AddDate(0, 0, 2), *written.NextIssuanceTime)
+			assert.Equal(t, test.expLogged, logged)
+		})
+	}
+}
+
+func Test_WriteKeypair_keyAlgorithms(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		key        crypto.Signer
+		attrs      map[string]string
+		expPEMType string
+	}{
+		"ECDSA key with PKCS1 encoding should be written as SEC 1": {
+			key:        ecdsaKey,
+			attrs:      map[string]string{"csi.cert-manager.io/key-algorithm": "ECDSA", "csi.cert-manager.io/key-size": "384"},
+			expPEMType: "EC PRIVATE KEY",
+		},
+		"ECDSA key with PKCS8 encoding should be written as PKCS8": {
+			key:        ecdsaKey,
+			attrs:      map[string]string{"csi.cert-manager.io/key-algorithm": "ECDSA", "csi.cert-manager.io/key-encoding": "PKCS8"},
+			expPEMType: "PRIVATE KEY",
+		},
+		"Ed25519 key should always be written as PKCS8": {
+			key:        ed25519Key,
+			attrs:      map[string]string{"csi.cert-manager.io/key-algorithm": "Ed25519"},
+			expPEMType: "PRIVATE KEY",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, certPEM := signCertificate(t, "leaf", false, test.key.Public(), nil, test.key)
+			meta := metadata.Metadata{
+				VolumeID:      "vol-id",
+				TargetPath:    "/target-path",
+				VolumeContext: map[string]string{"csi.cert-manager.io/issuer-name": "ca-issuer"},
+			}
+			for k, v := range test.attrs {
+				meta.VolumeContext[k] = v
+			}
+
+			store := storage.NewMemoryFS()
+			_, err := store.RegisterMetadata(meta)
+			require.NoError(t, err)
+
+			w := &Writer{Store: store}
+			require.NoError(t, w.WriteKeypair(meta, test.key, certPEM, certPEM))
+
+			files, err := store.ReadFiles("vol-id")
+			require.NoError(t, err)
+			block, _ := pem.Decode(files["tls.key"])
+			require.NotNil(t, block)
+			assert.Equal(t, test.expPEMType, block.Type)
+
+			// The written key should load together with the certificate.
+			_, err = tls.X509KeyPair(files["tls.crt"], files["tls.key"])
+			assert.NoError(t, err)
+		})
+	}
+}
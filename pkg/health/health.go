@@ -0,0 +1,137 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package health serves the liveness and readiness probes of the driver.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/go-logr/logr"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+// shutdownTimeout is the time allowed for in progress probes to complete when
+// the server is stopped.
+const shutdownTimeout = time.Second * 5
+
+// Checks holds the state of the driver reported by its probes.
+//
+// The driver is ready once its CSI socket has been bound, and it has reached
+// the cert-manager API. It is live until its gRPC server stops serving. A
+// panic in the issuance loops is not recovered, so exits the driver rather
+// than being reported here.
+type Checks struct {
+	// Client is used to check the cert-manager API can be reached.
+	Client discovery.DiscoveryInterface
+
+	registered   atomic.Bool
+	stopped      atomic.Bool
+	apiReachable atomic.Bool
+}
+
+// DriverRegistered records that the CSI socket has been bound.
+func (c *Checks) DriverRegistered() {
+	c.registered.Store(true)
+}
+
+// DriverStopped records that the gRPC server has stopped serving.
+func (c *Checks) DriverStopped() {
+	c.stopped.Store(true)
+}
+
+// Registered returns an error until the CSI socket has been bound.
+func (c *Checks) Registered(_ *http.Request) error {
+	if !c.registered.Load() {
+		return errors.New("CSI socket has not been registered")
+	}
+	return nil
+}
+
+// APIReachable returns an error until the cert-manager API has been reached
+// once. Once reached, later errors talking to the API do not make the driver
+// unready, since those are retried by issuance.
+func (c *Checks) APIReachable(_ *http.Request) error {
+	if c.apiReachable.Load() {
+		return nil
+	}
+	if _, err := c.Client.ServerResourcesForGroupVersion(cmapi.SchemeGroupVersion.String()); err != nil {
+		return fmt.Errorf("cert-manager API has not been reached: %w", err)
+	}
+	c.apiReachable.Store(true)
+	return nil
+}
+
+// Serving returns an error once the gRPC server has stopped serving.
+func (c *Checks) Serving(_ *http.Request) error {
+	if c.stopped.Load() {
+		return errors.New("gRPC server has stopped serving")
+	}
+	return nil
+}
+
+// Handler returns the handler serving the liveness probe on /healthz, and the
+// readiness probe on /readyz.
+func (c *Checks) Handler() http.Handler {
+	livez := &healthz.Handler{Checks: map[string]healthz.Checker{
+		"grpc": c.Serving,
+	}}
+	readyz := &healthz.Handler{Checks: map[string]healthz.Checker{
+		"csi-socket":       c.Registered,
+		"cert-manager-api": c.APIReachable,
+	}}
+
+	// Register each endpoint both with and without a trailing slash, as the
+	// controller-runtime manager does, so that individual checks may be
+	// requested at /healthz/<name>.
+	mux := http.NewServeMux()
+	for name, handler := range map[string]http.Handler{"/healthz": livez, "/readyz": readyz} {
+		mux.Handle(name, http.StripPrefix(name, handler))
+		mux.Handle(name+"/", http.StripPrefix(name, handler))
+	}
+	return mux
+}
+
+// Serve serves the probes on the given address until the context is
+// cancelled.
+func (c *Checks) Serve(ctx context.Context, log logr.Logger, address string) error {
+	lis, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("listening for health probes on %q: %w", address, err)
+	}
+
+	server := &http.Server{Handler: c.Handler(), ReadHeaderTimeout: time.Second * 10}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	log.Info("Serving health probes", "address", lis.Addr().String())
+	if err := server.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serving health probes: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cmfake "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+)
+
+func Test_Checks(t *testing.T) {
+	client := cmfake.NewSimpleClientset()
+	discovery := client.Discovery().(*fakediscovery.FakeDiscovery)
+	checks := &Checks{Client: discovery}
+	handler := checks.Handler()
+
+	status := func(path string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	// Not ready until the socket is registered and the API has been reached.
+	assert.Equal(t, http.StatusOK, status("/healthz"))
+	assert.Equal(t, http.StatusInternalServerError, status("/readyz"))
+
+	checks.DriverRegistered()
+	assert.Equal(t, http.StatusOK, status("/readyz/csi-socket"))
+	assert.Equal(t, http.StatusInternalServerError, status("/readyz"))
+
+	discovery.Resources = []*metav1.APIResourceList{{GroupVersion: "cert-manager.io/v1"}}
+	assert.Equal(t, http.StatusOK, status("/readyz"))
+
+	// Once reached, losing the API should not make the driver unready.
+	discovery.Resources = nil
+	assert.Equal(t, http.StatusOK, status("/readyz/"))
+
+	// The driver is no longer live once the gRPC server stops.
+	checks.DriverStopped()
+	assert.Equal(t, http.StatusInternalServerError, status("/healthz"))
+	assert.Equal(t, http.StatusInternalServerError, status("/healthz/grpc"))
+}
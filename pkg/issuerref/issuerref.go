@@ -0,0 +1,54 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package issuerref handles the issuer references used to configure the
+// driver per issuer. References take the form "<kind>.<group>/<name>", or
+// "<kind>.<group>/<namespace>/<name>" to only match an issuer referenced from
+// the given namespace.
+package issuerref
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cert-manager/csi-driver/pkg/apis/defaults"
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+)
+
+// Validate returns an error if the given issuer reference is malformed.
+func Validate(ref string) error {
+	parts := strings.Split(ref, "/")
+	if len(parts) < 2 || len(parts) > 3 || !strings.Contains(parts[0], ".") || slices.Contains(parts, "") {
+		return fmt.Errorf("invalid issuer reference %q, must be of the form <kind>.<group>/[<namespace>/]<name>", ref)
+	}
+	return nil
+}
+
+// ForAttributes returns the issuer references which match the issuer of a
+// volume with the given attributes, the most specific first.
+func ForAttributes(attr map[string]string) ([]string, error) {
+	attr, err := defaults.SetDefaultAttributes(attr)
+	if err != nil {
+		return nil, err
+	}
+
+	kindGroup := attr[csiapi.IssuerKindKey] + "." + attr[csiapi.IssuerGroupKey]
+	return []string{
+		kindGroup + "/" + attr[csiapi.K8sVolumeContextKeyPodNamespace] + "/" + attr[csiapi.IssuerNameKey],
+		kindGroup + "/" + attr[csiapi.IssuerNameKey],
+	}, nil
+}
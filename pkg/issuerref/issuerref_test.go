@@ -0,0 +1,68 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package issuerref
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Validate(t *testing.T) {
+	tests := map[string]struct {
+		ref    string
+		expErr bool
+	}{
+		"cluster reference should return no error": {
+			ref:    "ClusterIssuer.cert-manager.io/ca",
+			expErr: false,
+		},
+		"namespaced reference should return no error": {
+			ref:    "Issuer.cert-manager.io/sandbox/vault",
+			expErr: false,
+		},
+		"reference without group should error": {
+			ref:    "ClusterIssuer/ca",
+			expErr: true,
+		},
+		"reference with too many parts should error": {
+			ref:    "Issuer.cert-manager.io/a/b/c",
+			expErr: true,
+		},
+		"reference with empty name should error": {
+			ref:    "Issuer.cert-manager.io/sandbox/",
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := Validate(test.ref)
+			assert.Equal(t, test.expErr, err != nil, "%v", err)
+		})
+	}
+}
+
+func Test_ForAttributes(t *testing.T) {
+	refs, err := ForAttributes(map[string]string{
+		"csi.cert-manager.io/issuer-name":  "vault",
+		"csi.storage.k8s.io/pod.namespace": "sandbox",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Issuer.cert-manager.io/sandbox/vault", "Issuer.cert-manager.io/vault"}, refs)
+}
@@ -0,0 +1,104 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package issuerref
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+)
+
+// podTimeout is the timeout for getting the pod of a volume.
+const podTimeout = time.Second * 10
+
+// issuerKeys are the attributes of the issuer reference which may be set by
+// annotations on the pod.
+var issuerKeys = []string{csiapi.IssuerNameKey, csiapi.IssuerKindKey, csiapi.IssuerGroupKey}
+
+// PodAnnotationStore wraps a storage backend to resolve the issuer reference
+// of volumes from annotations on the pod, so that the issuer can be chosen by
+// whoever owns the pod rather than the volume. Each of the issuer name, kind,
+// and group attributes absent from the volume context is set from the
+// annotation with the same key on the pod, if present. Attributes set on the
+// volume always take precedence.
+//
+// The issuer is resolved when the volume is registered, and stored with the
+// volume context, so that the pod is only read once per publish and the
+// resolved issuer is kept across driver restarts.
+type PodAnnotationStore struct {
+	storage.Interface
+
+	Client kubernetes.Interface
+}
+
+// RegisterMetadata registers the volume with the storage backend, after
+// resolving its issuer reference from the annotations of its pod.
+func (s *PodAnnotationStore) RegisterMetadata(meta metadata.Metadata) (bool, error) {
+	vc, err := s.resolve(meta.VolumeContext)
+	if err != nil {
+		return false, fmt.Errorf("volume %q cannot be published: %w", meta.VolumeID, err)
+	}
+	meta.VolumeContext = vc
+
+	return s.Interface.RegisterMetadata(meta)
+}
+
+// resolve returns the volume context with any absent issuer attributes set
+// from the annotations on the pod. The pod is only read if an issuer
+// attribute is absent.
+func (s *PodAnnotationStore) resolve(vc map[string]string) (map[string]string, error) {
+	var absent []string
+	for _, k := range issuerKeys {
+		if _, ok := vc[k]; !ok {
+			absent = append(absent, k)
+		}
+	}
+	if len(absent) == 0 {
+		return vc, nil
+	}
+
+	namespace := vc[csiapi.K8sVolumeContextKeyPodNamespace]
+	name := vc[csiapi.K8sVolumeContextKeyPodName]
+	if len(namespace) == 0 || len(name) == 0 {
+		return vc, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), podTimeout)
+	defer cancel()
+
+	pod, err := s.Client.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("getting pod %s/%s to resolve issuer from its annotations: %w", namespace, name, err)
+	}
+
+	resolved := maps.Clone(vc)
+	for _, k := range absent {
+		if v, ok := pod.Annotations[k]; ok {
+			resolved[k] = v
+		}
+	}
+
+	return resolved, nil
+}
@@ -0,0 +1,121 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package issuerref
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_PodAnnotationStore(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "my-namespace",
+		Name:      "my-pod",
+		Annotations: map[string]string{
+			"csi.cert-manager.io/issuer-name":  "pod-issuer",
+			"csi.cert-manager.io/issuer-kind":  "ClusterIssuer",
+			"csi.cert-manager.io/issuer-group": "cert-manager.io",
+		},
+	}}
+	podInfo := map[string]string{
+		"csi.storage.k8s.io/pod.namespace": "my-namespace",
+		"csi.storage.k8s.io/pod.name":      "my-pod",
+	}
+	with := func(base map[string]string, extra map[string]string) map[string]string {
+		out := maps.Clone(base)
+		maps.Copy(out, extra)
+		return out
+	}
+
+	tests := map[string]struct {
+		objects          []runtime.Object
+		volumeContext    map[string]string
+		expVolumeContext map[string]string
+		expErr           bool
+	}{
+		"if the issuer is absent from the volume, expect it resolved from the pod": {
+			objects:       []runtime.Object{pod},
+			volumeContext: podInfo,
+			expVolumeContext: with(podInfo, map[string]string{
+				"csi.cert-manager.io/issuer-name":  "pod-issuer",
+				"csi.cert-manager.io/issuer-kind":  "ClusterIssuer",
+				"csi.cert-manager.io/issuer-group": "cert-manager.io",
+			}),
+		},
+		"if the issuer name is set on the volume, expect it to take precedence": {
+			objects:       []runtime.Object{pod},
+			volumeContext: with(podInfo, map[string]string{"csi.cert-manager.io/issuer-name": "volume-issuer"}),
+			expVolumeContext: with(podInfo, map[string]string{
+				"csi.cert-manager.io/issuer-name":  "volume-issuer",
+				"csi.cert-manager.io/issuer-kind":  "ClusterIssuer",
+				"csi.cert-manager.io/issuer-group": "cert-manager.io",
+			}),
+		},
+		"if the whole issuer is set on the volume, expect the pod not read": {
+			volumeContext: with(podInfo, map[string]string{
+				"csi.cert-manager.io/issuer-name":  "volume-issuer",
+				"csi.cert-manager.io/issuer-kind":  "Issuer",
+				"csi.cert-manager.io/issuer-group": "cert-manager.io",
+			}),
+			expVolumeContext: with(podInfo, map[string]string{
+				"csi.cert-manager.io/issuer-name":  "volume-issuer",
+				"csi.cert-manager.io/issuer-kind":  "Issuer",
+				"csi.cert-manager.io/issuer-group": "cert-manager.io",
+			}),
+		},
+		"if the pod has no issuer annotations, expect the volume context unchanged": {
+			objects:          []runtime.Object{&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", Name: "my-pod"}}},
+			volumeContext:    podInfo,
+			expVolumeContext: podInfo,
+		},
+		"if the pod information is missing, expect the volume context unchanged": {
+			volumeContext:    map[string]string{"csi.storage.k8s.io/ephemeral": "true"},
+			expVolumeContext: map[string]string{"csi.storage.k8s.io/ephemeral": "true"},
+		},
+		"if the pod cannot be read, expect an error": {
+			volumeContext: podInfo,
+			expErr:        true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			backend := storage.NewMemoryFS()
+			s := &PodAnnotationStore{Interface: backend, Client: fake.NewSimpleClientset(test.objects...)}
+
+			_, err := s.RegisterMetadata(metadata.Metadata{VolumeID: "vol-id", VolumeContext: test.volumeContext})
+			if test.expErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			meta, err := backend.ReadMetadata("vol-id")
+			require.NoError(t, err)
+			assert.Equal(t, test.expVolumeContext, meta.VolumeContext)
+		})
+	}
+}
@@ -0,0 +1,259 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package issuerstore routes volumes to a separate storage backend per
+// issuer, so that the keys of volumes using one issuer never share a
+// directory with those of another.
+package issuerstore
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+
+	"github.com/cert-manager/csi-driver/pkg/issuerref"
+)
+
+// reservedSubpaths are directories in the data root which are used by the
+// driver, so cannot be used for an issuer.
+var reservedSubpaths = []string{"inmemfs", "tmp"}
+
+// Backend is a storage backend which volumes can be routed to.
+type Backend interface {
+	storage.Interface
+
+	// ReadFile reads a single named file from the data directory of the
+	// given volume.
+	ReadFile(volumeID, name string) ([]byte, error)
+}
+
+// Store routes each volume to the backend for its issuer, or to the default
+// backend if its issuer has none. Volumes remain in the backend they were
+// registered with for their lifetime.
+type Store struct {
+	def     Backend
+	issuers map[string]Backend
+
+	lock    sync.RWMutex
+	volumes map[string]Backend
+}
+
+// Ensure Store is a fully featured storage backend.
+var _ Backend = &Store{}
+
+// New returns a Store routing volumes to the given backends, keyed by issuer
+// reference.
+func New(def Backend, issuers map[string]Backend) *Store {
+	return &Store{
+		def:     def,
+		issuers: issuers,
+		volumes: make(map[string]Backend),
+	}
+}
+
+// ValidateSubpaths validates a mapping of issuer reference to data root
+// subpath. Subpaths must be relative paths within the data root, and must
+// not be nested within, or shared with, another issuer.
+func ValidateSubpaths(subpaths map[string]string) error {
+	var (
+		refs []string
+		seen = make(map[string]string)
+	)
+	for ref := range subpaths {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	var errs []error
+	for _, ref := range refs {
+		if err := issuerref.Validate(ref); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		subpath := subpaths[ref]
+		if subpath == "." || !filepath.IsLocal(subpath) || filepath.Clean(subpath) != subpath {
+			errs = append(errs, fmt.Errorf("invalid subpath %q for issuer %q, must be a clean relative path within the data root", subpath, ref))
+			continue
+		}
+
+		top := strings.Split(subpath, string(filepath.Separator))[0]
+		for _, reserved := range reservedSubpaths {
+			if top == reserved {
+				errs = append(errs, fmt.Errorf("invalid subpath %q for issuer %q, %q is reserved", subpath, ref, reserved))
+			}
+		}
+
+		for other, otherRef := range seen {
+			if other == subpath || strings.HasPrefix(subpath, other+string(filepath.Separator)) || strings.HasPrefix(other, subpath+string(filepath.Separator)) {
+				errs = append(errs, fmt.Errorf("subpath %q for issuer %q overlaps with subpath %q for issuer %q", subpath, ref, other, otherRef))
+			}
+		}
+		seen[subpath] = ref
+	}
+
+	return errors.Join(errs...)
+}
+
+// backendForMetadata returns the backend for the issuer of the given volume.
+func (s *Store) backendForMetadata(meta metadata.Metadata) Backend {
+	refs, err := issuerref.ForAttributes(meta.VolumeContext)
+	if err != nil {
+		return s.def
+	}
+
+	for _, ref := range refs {
+		if b, ok := s.issuers[ref]; ok {
+			return b
+		}
+	}
+
+	return s.def
+}
+
+// backendForVolume returns the backend holding the given volume, or the
+// default backend if no backend holds it.
+func (s *Store) backendForVolume(volumeID string) Backend {
+	if b, ok := s.find(volumeID); ok {
+		return b
+	}
+	return s.def
+}
+
+// find returns the backend holding the given volume. Volumes which are not yet
+// known, such as those written before a restart, are looked up in each backend.
+func (s *Store) find(volumeID string) (Backend, bool) {
+	s.lock.RLock()
+	b, ok := s.volumes[volumeID]
+	s.lock.RUnlock()
+	if ok {
+		return b, true
+	}
+
+	for _, b := range s.backends() {
+		if _, err := b.ReadMetadata(volumeID); err == nil {
+			s.track(volumeID, b)
+			return b, true
+		}
+	}
+
+	return nil, false
+}
+
+// backends returns every backend, starting with the default backend.
+func (s *Store) backends() []Backend {
+	var refs []string
+	for ref := range s.issuers {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	backends := []Backend{s.def}
+	for _, ref := range refs {
+		backends = append(backends, s.issuers[ref])
+	}
+	return backends
+}
+
+func (s *Store) track(volumeID string, b Backend) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.volumes[volumeID] = b
+}
+
+func (s *Store) PathForVolume(volumeID string) string {
+	return s.backendForVolume(volumeID).PathForVolume(volumeID)
+}
+
+// RemoveVolume removes the volume from the backend holding it. A volume which
+// no backend holds, such as one whose metadata was lost, is removed from every
+// backend so that no residual data is left behind.
+func (s *Store) RemoveVolume(volumeID string) error {
+	if b, ok := s.find(volumeID); ok {
+		if err := b.RemoveVolume(volumeID); err != nil {
+			return err
+		}
+	} else {
+		var errs []error
+		for _, b := range s.backends() {
+			errs = append(errs, b.RemoveVolume(volumeID))
+		}
+		if err := errors.Join(errs...); err != nil {
+			return err
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.volumes, volumeID)
+
+	return nil
+}
+
+func (s *Store) ReadMetadata(volumeID string) (metadata.Metadata, error) {
+	return s.backendForVolume(volumeID).ReadMetadata(volumeID)
+}
+
+// ListVolumes returns the volumes held by every backend.
+func (s *Store) ListVolumes() ([]string, error) {
+	var all []string
+	for _, b := range s.backends() {
+		ids, err := b.ListVolumes()
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			s.track(id, b)
+		}
+		all = append(all, ids...)
+	}
+	return all, nil
+}
+
+func (s *Store) WriteMetadata(volumeID string, meta metadata.Metadata) error {
+	return s.backendForVolume(volumeID).WriteMetadata(volumeID, meta)
+}
+
+// RegisterMetadata registers the volume with the backend for its issuer. A
+// volume which is already registered stays in the backend holding it.
+func (s *Store) RegisterMetadata(meta metadata.Metadata) (bool, error) {
+	b, ok := s.find(meta.VolumeID)
+	if !ok {
+		b = s.backendForMetadata(meta)
+	}
+
+	registered, err := b.RegisterMetadata(meta)
+	if err != nil {
+		return registered, err
+	}
+	s.track(meta.VolumeID, b)
+
+	return registered, nil
+}
+
+func (s *Store) WriteFiles(meta metadata.Metadata, files map[string][]byte) error {
+	return s.backendForVolume(meta.VolumeID).WriteFiles(meta, files)
+}
+
+func (s *Store) ReadFile(volumeID, name string) ([]byte, error) {
+	return s.backendForVolume(volumeID).ReadFile(volumeID, name)
+}
@@ -0,0 +1,211 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package issuerstore
+
+import (
+	"testing"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryBackend adds ReadFile to the in-memory storage backend.
+type memoryBackend struct {
+	*storage.MemoryFS
+}
+
+func (m memoryBackend) ReadFile(volumeID, name string) ([]byte, error) {
+	files, err := m.ReadFiles(volumeID)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := files[name]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return data, nil
+}
+
+func newMemoryBackend() memoryBackend {
+	return memoryBackend{storage.NewMemoryFS()}
+}
+
+func volumeFor(id, kind, name, namespace string) metadata.Metadata {
+	return metadata.Metadata{
+		VolumeID:   id,
+		TargetPath: "/target/" + id,
+		VolumeContext: map[string]string{
+			"csi.cert-manager.io/issuer-kind":  kind,
+			"csi.cert-manager.io/issuer-name":  name,
+			"csi.storage.k8s.io/pod.namespace": namespace,
+		},
+	}
+}
+
+func Test_ValidateSubpaths(t *testing.T) {
+	tests := map[string]struct {
+		subpaths map[string]string
+		expErr   bool
+	}{
+		"no subpaths should return no error": {
+			subpaths: nil,
+			expErr:   false,
+		},
+		"cluster and namespaced issuers should return no error": {
+			subpaths: map[string]string{
+				"ClusterIssuer.cert-manager.io/ca":             "ca",
+				"Issuer.cert-manager.io/sandbox/vault":         "issuers/vault",
+				"AWSPCAClusterIssuer.awspca.cert-manager.io/a": "issuers/aws",
+			},
+			expErr: false,
+		},
+		"issuer reference without group should error": {
+			subpaths: map[string]string{"ClusterIssuer/ca": "ca"},
+			expErr:   true,
+		},
+		"absolute subpath should error": {
+			subpaths: map[string]string{"ClusterIssuer.cert-manager.io/ca": "/ca"},
+			expErr:   true,
+		},
+		"subpath escaping the data root should error": {
+			subpaths: map[string]string{"ClusterIssuer.cert-manager.io/ca": "../ca"},
+			expErr:   true,
+		},
+		"unclean subpath should error": {
+			subpaths: map[string]string{"ClusterIssuer.cert-manager.io/ca": "issuers//ca"},
+			expErr:   true,
+		},
+		"data root itself should error": {
+			subpaths: map[string]string{"ClusterIssuer.cert-manager.io/ca": "."},
+			expErr:   true,
+		},
+		"reserved subpath should error": {
+			subpaths: map[string]string{"ClusterIssuer.cert-manager.io/ca": "inmemfs/ca"},
+			expErr:   true,
+		},
+		"shared subpath should error": {
+			subpaths: map[string]string{
+				"ClusterIssuer.cert-manager.io/a": "ca",
+				"ClusterIssuer.cert-manager.io/b": "ca",
+			},
+			expErr: true,
+		},
+		"nested subpath should error": {
+			subpaths: map[string]string{
+				"ClusterIssuer.cert-manager.io/a": "ca",
+				"ClusterIssuer.cert-manager.io/b": "ca/b",
+			},
+			expErr: true,
+		},
+		"subpaths sharing a prefix should return no error": {
+			subpaths: map[string]string{
+				"ClusterIssuer.cert-manager.io/a": "ca",
+				"ClusterIssuer.cert-manager.io/b": "ca-b",
+			},
+			expErr: false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateSubpaths(test.subpaths)
+			assert.Equal(t, test.expErr, err != nil, "%v", err)
+		})
+	}
+}
+
+func Test_Store_routing(t *testing.T) {
+	def, ca, sandbox := newMemoryBackend(), newMemoryBackend(), newMemoryBackend()
+	store := New(def, map[string]Backend{
+		"ClusterIssuer.cert-manager.io/ca":     ca,
+		"Issuer.cert-manager.io/sandbox/vault": sandbox,
+	})
+
+	for _, meta := range []metadata.Metadata{
+		volumeFor("vol-ca", "ClusterIssuer", "ca", "default"),
+		volumeFor("vol-sandbox", "Issuer", "vault", "sandbox"),
+		volumeFor("vol-other-ns", "Issuer", "vault", "default"),
+		volumeFor("vol-default", "Issuer", "other", "default"),
+	} {
+		_, err := store.RegisterMetadata(meta)
+		require.NoError(t, err)
+		require.NoError(t, store.WriteFiles(meta, map[string][]byte{"tls.crt": []byte(meta.VolumeID)}))
+	}
+
+	for backend, expIDs := range map[memoryBackend][]string{
+		def:     {"vol-default", "vol-other-ns"},
+		ca:      {"vol-ca"},
+		sandbox: {"vol-sandbox"},
+	} {
+		ids, err := backend.ListVolumes()
+		require.NoError(t, err)
+		assert.ElementsMatch(t, expIDs, ids)
+	}
+
+	ids, err := store.ListVolumes()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"vol-ca", "vol-sandbox", "vol-other-ns", "vol-default"}, ids)
+
+	data, err := store.ReadFile("vol-sandbox", "tls.crt")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("vol-sandbox"), data)
+
+	require.NoError(t, store.RemoveVolume("vol-ca"))
+	_, err = ca.ReadMetadata("vol-ca")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func Test_Store_existingVolumes(t *testing.T) {
+	def, ca := newMemoryBackend(), newMemoryBackend()
+	_, err := ca.RegisterMetadata(volumeFor("vol-ca", "ClusterIssuer", "ca", "default"))
+	require.NoError(t, err)
+
+	// A new Store, such as after a restart, must find volumes which were
+	// registered before it was built.
+	store := New(def, map[string]Backend{"ClusterIssuer.cert-manager.io/ca": ca})
+
+	meta, err := store.ReadMetadata("vol-ca")
+	require.NoError(t, err)
+	assert.Equal(t, "vol-ca", meta.VolumeID)
+
+	registered, err := store.RegisterMetadata(volumeFor("vol-ca", "ClusterIssuer", "ca", "default"))
+	require.NoError(t, err)
+	assert.False(t, registered)
+
+	ids, err := def.ListVolumes()
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+}
+
+func Test_Store_removeUnknownVolume(t *testing.T) {
+	def, ca := newMemoryBackend(), newMemoryBackend()
+
+	// Data left behind with unreadable metadata is not found by lookup.
+	meta := volumeFor("vol-ca", "ClusterIssuer", "ca", "default")
+	_, err := ca.RegisterMetadata(meta)
+	require.NoError(t, err)
+	require.NoError(t, ca.WriteFiles(meta, map[string][]byte{"metadata.json": []byte("{"), "tls.crt": []byte("crt")}))
+
+	store := New(def, map[string]Backend{"ClusterIssuer.cert-manager.io/ca": ca})
+	require.NoError(t, store.RemoveVolume("vol-ca"))
+	require.NoError(t, store.RemoveVolume("vol-ca"))
+
+	_, err = ca.ReadFiles("vol-ca")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
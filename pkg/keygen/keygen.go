@@ -18,28 +18,50 @@ package keygen
 
 import (
 	"crypto"
-	"crypto/rand"
-	"crypto/rsa"
 	"errors"
+	"fmt"
+	"strconv"
 
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	"github.com/cert-manager/cert-manager/pkg/util/pki"
 	"github.com/cert-manager/csi-lib/metadata"
 	"github.com/cert-manager/csi-lib/storage"
+	"github.com/go-logr/logr"
 
 	"github.com/cert-manager/csi-driver/pkg/apis/defaults"
 	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
 	"github.com/cert-manager/csi-driver/pkg/apis/validation"
+	"github.com/cert-manager/csi-driver/pkg/keystore/der"
+	"github.com/cert-manager/csi-driver/pkg/volumelog"
 )
 
+// KeyType returns the type and size of the private key generated for a volume
+// with the given defaulted attributes, in the form used by
+// --known-issuer-constraints, such as "RSA-2048" or "Ed25519".
+func KeyType(attrs map[string]string) string {
+	algorithm := attrs[csiapi.KeyAlgorithmKey]
+	if algorithm == string(cmapi.Ed25519KeyAlgorithm) {
+		return algorithm
+	}
+	return algorithm + "-" + attrs[csiapi.KeySizeKey]
+}
+
 // Generator wraps the storage backend to allow for re-using private keys when
 // re-issuing a certificate.
-// It generates 2048-bit RSA private keys.
+// It generates private keys of the algorithm and size given by the key
+// algorithm and key size attributes, 2048-bit RSA by default.
 type Generator struct {
-	Store *storage.Filesystem
+	Store interface {
+		ReadFile(volumeID, name string) ([]byte, error)
+	}
+
+	Log logr.Logger
 }
 
-// KeyForMetadata generates a 2048-bit RSA private key, or returns an existing
-// one if the reuse private key attribute is present.
+// KeyForMetadata generates a private key for the volume, or returns an
+// existing one if the reuse private key attribute is present. An existing key which
+// cannot be read or decoded is handled according to the on key read error
+// attribute.
 func (k *Generator) KeyForMetadata(meta metadata.Metadata) (crypto.PrivateKey, error) {
 	attrs, err := defaults.SetDefaultAttributes(meta.VolumeContext)
 	if err != nil {
@@ -51,27 +73,51 @@ func (k *Generator) KeyForMetadata(meta metadata.Metadata) (crypto.PrivateKey, e
 
 	// By default, generate a new private key each time.
 	if attrs[csiapi.ReusePrivateKey] != "true" {
-		return new2048BitRSAKey()
+		return newKey(attrs)
 	}
 
 	bytes, err := k.Store.ReadFile(meta.VolumeID, attrs[csiapi.KeyFileKey])
 	if errors.Is(err, storage.ErrNotFound) {
 		// Generate a new key if one is not found on disk
-		return new2048BitRSAKey()
+		return newKey(attrs)
 	}
 	if err != nil {
-		return nil, err
+		return k.onKeyReadError(meta, attrs, fmt.Errorf("reading existing private key: %w", err))
 	}
 
-	pk, err := pki.DecodePrivateKeyBytes(bytes)
+	var pk crypto.PrivateKey
+	if attrs[csiapi.EncodingKey] == csiapi.EncodingDER {
+		pk, err = der.DecodePrivateKey(bytes)
+	} else {
+		pk, err = pki.DecodePrivateKeyBytes(bytes)
+	}
 	if err != nil {
-		// Generate a new key if the existing one cannot be decoded
-		return new2048BitRSAKey()
+		return k.onKeyReadError(meta, attrs, fmt.Errorf("decoding existing private key: %w", err))
 	}
 
 	return pk, nil
 }
 
-func new2048BitRSAKey() (crypto.PrivateKey, error) {
-	return rsa.GenerateKey(rand.Reader, 2048)
+// onKeyReadError returns the error if the volume fails on key read errors,
+// otherwise logs it and generates a new private key.
+func (k *Generator) onKeyReadError(meta metadata.Metadata, attrs map[string]string, err error) (crypto.PrivateKey, error) {
+	if attrs[csiapi.OnKeyReadErrorKey] == csiapi.OnKeyReadErrorFail {
+		return nil, err
+	}
+
+	volumelog.ForMetadata(k.Log, meta).Info("WARNING: existing private key could not be reused, generating a new private key", "error", err.Error())
+	return newKey(attrs)
+}
+
+// newKey generates a private key of the algorithm and size given by the
+// defaulted, validated attributes.
+func newKey(attrs map[string]string) (crypto.PrivateKey, error) {
+	// The key size is unset, and so ignored, for Ed25519 keys.
+	size, _ := strconv.Atoi(attrs[csiapi.KeySizeKey])
+	return pki.GeneratePrivateKeyForCertificate(&cmapi.Certificate{Spec: cmapi.CertificateSpec{
+		PrivateKey: &cmapi.CertificatePrivateKey{
+			Algorithm: cmapi.PrivateKeyAlgorithm(attrs[csiapi.KeyAlgorithmKey]),
+			Size:      size,
+		},
+	}})
 }
@@ -0,0 +1,197 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keygen
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/fs"
+	"testing"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cert-manager/csi-driver/pkg/apis/defaults"
+)
+
+// fakeStore returns the configured private key file, or error.
+type fakeStore struct {
+	key []byte
+	err error
+}
+
+func (f *fakeStore) ReadFile(volumeID, name string) ([]byte, error) {
+	return f.key, f.err
+}
+
+func Test_KeyForMetadata_reuse(t *testing.T) {
+	existing, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	existingPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(existing)})
+
+	tests := map[string]struct {
+		encoding       string
+		onKeyReadError string
+		store          *fakeStore
+		expExisting    bool
+		expErr         string
+	}{
+		"existing key should be reused": {
+			store:       &fakeStore{key: existingPEM},
+			expExisting: true,
+		},
+		"existing DER key should be reused": {
+			encoding:    "DER",
+			store:       &fakeStore{key: x509.MarshalPKCS1PrivateKey(existing)},
+			expExisting: true,
+		},
+		"existing PEM key should fail in fail mode when DER is requested": {
+			encoding:       "DER",
+			onKeyReadError: "fail",
+			store:          &fakeStore{key: existingPEM},
+			expErr:         "decoding existing private key: failed to decode DER private key as PKCS#8, PKCS#1, or SEC 1",
+		},
+		"missing key should be regenerated": {
+			onKeyReadError: "fail",
+			store:          &fakeStore{err: storage.ErrNotFound},
+		},
+		"corrupt key should be regenerated by default": {
+			store: &fakeStore{key: []byte("not a key")},
+		},
+		"unreadable key should be regenerated by default": {
+			store: &fakeStore{err: fs.ErrPermission},
+		},
+		"corrupt key should be regenerated in regenerate mode": {
+			onKeyReadError: "regenerate",
+			store:          &fakeStore{key: existingPEM[:len(existingPEM)/2]},
+		},
+		"corrupt key should fail in fail mode": {
+			onKeyReadError: "fail",
+			store:          &fakeStore{key: []byte("not a key")},
+			expErr:         "decoding existing private key: error decoding private key PEM block",
+		},
+		"unreadable key should fail in fail mode": {
+			onKeyReadError: "fail",
+			store:          &fakeStore{err: fs.ErrPermission},
+			expErr:         "reading existing private key: permission denied",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			meta := metadata.Metadata{
+				VolumeID: "vol-id",
+				VolumeContext: map[string]string{
+					"csi.cert-manager.io/issuer-name":       "ca-issuer",
+					"csi.cert-manager.io/reuse-private-key": "true",
+				},
+			}
+			if len(test.onKeyReadError) > 0 {
+				meta.VolumeContext["csi.cert-manager.io/on-key-read-error"] = test.onKeyReadError
+			}
+			if len(test.encoding) > 0 {
+				meta.VolumeContext["csi.cert-manager.io/encoding"] = test.encoding
+			}
+
+			k := &Generator{Store: test.store}
+			pk, err := k.KeyForMetadata(meta)
+			if len(test.expErr) > 0 {
+				assert.EqualError(t, err, test.expErr)
+				return
+			}
+			require.NoError(t, err)
+			require.IsType(t, &rsa.PrivateKey{}, pk)
+			assert.Equal(t, test.expExisting, existing.Equal(pk))
+		})
+	}
+}
+
+func Test_KeyForMetadata_algorithm(t *testing.T) {
+	tests := map[string]struct {
+		algorithm string
+		size      string
+		expKey    func(t *testing.T, pk any)
+		expType   string
+	}{
+		"default should be a 2048-bit RSA key": {
+			expKey: func(t *testing.T, pk any) {
+				require.IsType(t, &rsa.PrivateKey{}, pk)
+				assert.Equal(t, 2048, pk.(*rsa.PrivateKey).N.BitLen())
+			},
+			expType: "RSA-2048",
+		},
+		"RSA key size should be the modulus size": {
+			algorithm: "RSA",
+			size:      "3072",
+			expKey: func(t *testing.T, pk any) {
+				require.IsType(t, &rsa.PrivateKey{}, pk)
+				assert.Equal(t, 3072, pk.(*rsa.PrivateKey).N.BitLen())
+			},
+			expType: "RSA-3072",
+		},
+		"ECDSA key size should be the curve": {
+			algorithm: "ECDSA",
+			size:      "384",
+			expKey: func(t *testing.T, pk any) {
+				require.IsType(t, &ecdsa.PrivateKey{}, pk)
+				assert.Equal(t, elliptic.P384(), pk.(*ecdsa.PrivateKey).Curve)
+			},
+			expType: "ECDSA-384",
+		},
+		"Ed25519 key size should be ignored": {
+			algorithm: "Ed25519",
+			size:      "256",
+			expKey: func(t *testing.T, pk any) {
+				require.IsType(t, ed25519.PrivateKey{}, pk)
+			},
+			expType: "Ed25519",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			meta := metadata.Metadata{
+				VolumeID: "vol-id",
+				VolumeContext: map[string]string{
+					"csi.cert-manager.io/issuer-name": "ca-issuer",
+				},
+			}
+			if len(test.algorithm) > 0 {
+				meta.VolumeContext["csi.cert-manager.io/key-algorithm"] = test.algorithm
+			}
+			if len(test.size) > 0 {
+				meta.VolumeContext["csi.cert-manager.io/key-size"] = test.size
+			}
+
+			k := &Generator{Store: &fakeStore{err: storage.ErrNotFound}}
+			pk, err := k.KeyForMetadata(meta)
+			require.NoError(t, err)
+			test.expKey(t, pk)
+
+			attrs, err := defaults.SetDefaultAttributes(meta.VolumeContext)
+			require.NoError(t, err)
+			assert.Equal(t, test.expType, KeyType(attrs))
+		})
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package combined
+
+import (
+	"bytes"
+	"fmt"
+
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+)
+
+// Handle will handle combined file options in the given Volume attributes. If
+// a combined format is set, a file combining the certificate chain and private
+// key in the layout expected by that format will be written to the given file
+// store.
+//
+// Independently, if a combined PEM file is set, a file holding the private key
+// followed by the leaf certificate and any intermediates, in that order, will
+// be written to the given file store.
+func Handle(attributes map[string]string, files map[string][]byte, keyPEM, chainPEM []byte) error {
+	if file, ok := attributes[csiapi.CombinedPEMFileKey]; ok {
+		files[file] = join(keyPEM, chainPEM)
+	}
+
+	format, ok := attributes[csiapi.CombinedFormatKey]
+	if !ok {
+		return nil
+	}
+
+	var combined []byte
+	switch format {
+	case csiapi.CombinedFormatHAProxy:
+		// HAProxy expects the leaf certificate, followed by any intermediates,
+		// followed by the private key in a single file.
+		combined = join(chainPEM, keyPEM)
+	case csiapi.CombinedFormatNginx, csiapi.CombinedFormatPostgres:
+		// NGINX and PostgreSQL expect the leaf certificate followed by any
+		// intermediates, with the private key kept in its own file. The root CA
+		// must not be included. PostgreSQL only loads a group readable private
+		// key if it is owned by root and no more permissive than 0640, which
+		// the read-only files written by the driver satisfy.
+		combined = join(chainPEM)
+	default:
+		return fmt.Errorf("unsupported combined format: %q", format)
+	}
+
+	files[attributes[csiapi.CombinedFileKey]] = combined
+
+	return nil
+}
+
+// join concatenates the given PEM data, ensuring each is separated by a new
+// line.
+func join(pems ...[]byte) []byte {
+	var buf bytes.Buffer
+	for _, p := range pems {
+		p = bytes.TrimSpace(p)
+		if len(p) == 0 {
+			continue
+		}
+		buf.Write(p)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,101 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package der
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+)
+
+// Handle will handle the encoding option in the given Volume attributes. If
+// the encoding is DER, the private key, certificate, and CA files in the given
+// file store are replaced with their DER encoded form. The certificate file
+// holds only the leaf certificate, since DER cannot hold a chain.
+func Handle(attributes map[string]string, files map[string][]byte, keyPEM, chainPEM, caPEM []byte) error {
+	if attributes[csiapi.EncodingKey] != csiapi.EncodingDER {
+		return nil
+	}
+
+	key, _ := pem.Decode(keyPEM)
+	if key == nil {
+		return errors.New("encoding private key as DER: no PEM block found")
+	}
+	leaf, _ := pem.Decode(chainPEM)
+	if leaf == nil || leaf.Type != "CERTIFICATE" {
+		return errors.New("encoding certificate as DER: no certificate found")
+	}
+	ca, err := EncodeCA(attributes, caPEM)
+	if err != nil {
+		return err
+	}
+
+	files[attributes[csiapi.KeyFileKey]] = key.Bytes
+	files[attributes[csiapi.CertFileKey]] = leaf.Bytes
+	files[attributes[csiapi.CAFileKey]] = ca
+
+	return nil
+}
+
+// EncodeCA returns the CA file contents for the given PEM encoded CA, in the
+// encoding of the given Volume attributes. A DER encoded CA holds a single
+// certificate, so more than one CA certificate is an error.
+func EncodeCA(attributes map[string]string, caPEM []byte) ([]byte, error) {
+	if attributes[csiapi.EncodingKey] != csiapi.EncodingDER {
+		return caPEM, nil
+	}
+
+	var certs [][]byte
+	for rest := caPEM; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			certs = append(certs, block.Bytes)
+		}
+	}
+
+	switch len(certs) {
+	case 0:
+		return nil, nil
+	case 1:
+		return certs[0], nil
+	default:
+		return nil, fmt.Errorf("%q %q supports a single CA certificate, but the issuer returned %d", csiapi.EncodingKey, csiapi.EncodingDER, len(certs))
+	}
+}
+
+// DecodePrivateKey decodes a DER encoded private key, in any of the key
+// encodings the driver writes.
+func DecodePrivateKey(data []byte) (crypto.PrivateKey, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(data); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(data); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(data); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("failed to decode DER private key as PKCS#8, PKCS#1, or SEC 1")
+}
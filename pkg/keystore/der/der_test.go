@@ -0,0 +1,147 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package der
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Handle(t *testing.T) {
+	block := func(typ, data string) []byte {
+		return pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: []byte(data)})
+	}
+	keyPEM := block("PRIVATE KEY", "key")
+	chainPEM := append(block("CERTIFICATE", "leaf"), block("CERTIFICATE", "int")...)
+
+	pemFiles := func() map[string][]byte {
+		return map[string][]byte{
+			"tls.key": keyPEM,
+			"tls.crt": chainPEM,
+			"ca.crt":  block("CERTIFICATE", "ca"),
+		}
+	}
+	attributes := func(encoding string) map[string]string {
+		return map[string]string{
+			"csi.cert-manager.io/encoding":         encoding,
+			"csi.cert-manager.io/privatekey-file":  "tls.key",
+			"csi.cert-manager.io/certificate-file": "tls.crt",
+			"csi.cert-manager.io/ca-file":          "ca.crt",
+		}
+	}
+
+	tests := map[string]struct {
+		attributes map[string]string
+		caPEM      []byte
+		expFiles   map[string][]byte
+		expErr     bool
+	}{
+		"if no encoding provided, expect files unchanged": {
+			attributes: map[string]string{},
+			caPEM:      block("CERTIFICATE", "ca"),
+			expFiles:   pemFiles(),
+		},
+		"if PEM encoding, expect files unchanged": {
+			attributes: attributes("PEM"),
+			caPEM:      block("CERTIFICATE", "ca"),
+			expFiles:   pemFiles(),
+		},
+		"if DER encoding, expect key, leaf, and CA as DER": {
+			attributes: attributes("DER"),
+			caPEM:      block("CERTIFICATE", "ca"),
+			expFiles: map[string][]byte{
+				"tls.key": []byte("key"),
+				"tls.crt": []byte("leaf"),
+				"ca.crt":  []byte("ca"),
+			},
+		},
+		"if DER encoding with no CA, expect an empty CA": {
+			attributes: attributes("DER"),
+			caPEM:      nil,
+			expFiles: map[string][]byte{
+				"tls.key": []byte("key"),
+				"tls.crt": []byte("leaf"),
+				"ca.crt":  nil,
+			},
+		},
+		"if DER encoding with multiple CA certificates, expect error": {
+			attributes: attributes("DER"),
+			caPEM:      append(block("CERTIFICATE", "ca1"), block("CERTIFICATE", "ca2")...),
+			expFiles:   pemFiles(),
+			expErr:     true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			files := pemFiles()
+			err := Handle(test.attributes, files, keyPEM, chainPEM, test.caPEM)
+			assert.Equal(t, test.expErr, err != nil, "%v", err)
+			assert.Equal(t, test.expFiles, files)
+		})
+	}
+}
+
+func Test_DecodePrivateKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	pkcs8 := func(key any) []byte {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		require.NoError(t, err)
+		return der
+	}
+	sec1, err := x509.MarshalECPrivateKey(ecKey)
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		data   []byte
+		expKey any
+		expErr bool
+	}{
+		"PKCS#1 RSA key":     {data: x509.MarshalPKCS1PrivateKey(rsaKey), expKey: rsaKey},
+		"PKCS#8 RSA key":     {data: pkcs8(rsaKey), expKey: rsaKey},
+		"SEC 1 ECDSA key":    {data: sec1, expKey: ecKey},
+		"PKCS#8 ECDSA key":   {data: pkcs8(ecKey), expKey: ecKey},
+		"PKCS#8 Ed25519 key": {data: pkcs8(edKey), expKey: edKey},
+		"invalid key":        {data: []byte("not a key"), expErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			key, err := DecodePrivateKey(test.data)
+			assert.Equal(t, test.expErr, err != nil, "%v", err)
+			if !test.expErr {
+				assert.True(t, test.expKey.(interface{ Equal(crypto.PrivateKey) bool }).Equal(key))
+			}
+		})
+	}
+}
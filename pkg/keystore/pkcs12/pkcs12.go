@@ -17,26 +17,41 @@ limitations under the License.
 package pkcs12
 
 import (
+	"bytes"
+	"context"
 	"crypto"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"slices"
 
 	"github.com/cert-manager/cert-manager/pkg/util/pki"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 	"software.sslmate.com/src/go-pkcs12"
 
 	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
 )
 
+// Format identifies PKCS12 keystores, such as in metrics.
+const Format = "pkcs12"
+
+// PasswordSecretDataKey is the key of the Secret data holding the keystore
+// password, for volumes which set the password secret attribute.
+const PasswordSecretDataKey = "password"
+
 // Handle will handle PKCS12 keystore options in the given Volume attributes.
 // If enabled, A PKCS12 keystore file will be encoded and written to the given
 // file store.
-func Handle(attributes map[string]string, files map[string][]byte, pk crypto.PrivateKey, chainPEM []byte) error {
+func Handle(attributes map[string]string, files map[string][]byte, pk crypto.PrivateKey, chainPEM, caPEM []byte) error {
 	// If PKCS12 support is not enabled, return early.
 	if attributes[csiapi.KeyStorePKCS12EnableKey] != "true" {
 		return nil
 	}
 
-	pfx, err := create(attributes[csiapi.KeyStorePKCS12PasswordKey], pk, chainPEM)
+	includeChain := attributes[csiapi.KeyStorePKCS12IncludeChainKey] != "false"
+	pfx, err := create(attributes[csiapi.KeyStorePKCS12PasswordKey], pk, chainPEM, caPEM, includeChain)
 	if err != nil {
 		return fmt.Errorf("failed to create pkcs12 file: %w", err)
 	}
@@ -47,9 +62,38 @@ func Handle(attributes map[string]string, files map[string][]byte, pk crypto.Pri
 	return nil
 }
 
+// SecretPassword returns the keystore password held by the Secret named by
+// the password secret attribute, in the namespace of the volume's pod. A
+// missing Secret, or one without a password, is an error.
+func SecretPassword(ctx context.Context, client kubernetes.Interface, attributes map[string]string) (string, error) {
+	namespace := attributes[csiapi.K8sVolumeContextKeyPodNamespace]
+	name := attributes[csiapi.KeyStorePKCS12PasswordSecretKey]
+	if client == nil {
+		return "", fmt.Errorf("%q is not supported by this driver", csiapi.KeyStorePKCS12PasswordSecretKey)
+	}
+
+	secret, err := client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "", fmt.Errorf("PKCS12 password Secret %s/%s does not exist", namespace, name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("getting PKCS12 password Secret %s/%s: %w", namespace, name, err)
+	}
+
+	password := secret.Data[PasswordSecretDataKey]
+	if len(password) == 0 {
+		return "", fmt.Errorf("PKCS12 password Secret %s/%s has no %q key", namespace, name, PasswordSecretDataKey)
+	}
+
+	return string(password), nil
+}
+
 // create combines the inputs to a single PKCS12 keystore file. Private key
-// must be PKCS1 or PKCS8 encoded. Certificates must be PEM encoded.
-func create(password string, pk crypto.PrivateKey, chainPEM []byte) ([]byte, error) {
+// must be PKCS1 or PKCS8 encoded. Certificates must be PEM encoded. If
+// includeChain is true, the intermediates in the chain and the certificates in
+// the CA bundle are embedded as CA certificate entries, otherwise only the leaf
+// certificate is encoded.
+func create(password string, pk crypto.PrivateKey, chainPEM, caPEM []byte, includeChain bool) ([]byte, error) {
 	chain, err := pki.DecodeX509CertificateChainBytes(chainPEM)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode certificate chain: %w", err)
@@ -59,7 +103,26 @@ func create(password string, pk crypto.PrivateKey, chainPEM []byte) ([]byte, err
 		return nil, errors.New("no certificates decoded in certificate chain")
 	}
 
-	pfx, err := pkcs12.LegacyRC2.Encode(pk, chain[0], chain[1:], password)
+	var cas []*x509.Certificate
+	if includeChain {
+		cas = chain[1:]
+
+		if len(bytes.TrimSpace(caPEM)) > 0 {
+			caCerts, err := pki.DecodeX509CertificateSetBytes(caPEM)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode CA certificates: %w", err)
+			}
+
+			// Skip CA certificates which are already present in the chain.
+			for _, caCert := range caCerts {
+				if !slices.ContainsFunc(cas, caCert.Equal) {
+					cas = append(cas, caCert)
+				}
+			}
+		}
+	}
+
+	pfx, err := pkcs12.LegacyRC2.Encode(pk, chain[0], cas, password)
 	if err != nil {
 		return nil, fmt.Errorf("failed to encode the PKCS12 certificate chain file: %v", err)
 	}
@@ -18,12 +18,18 @@ package pkcs12
 
 import (
 	"bytes"
+	"context"
 	"crypto"
 	"crypto/x509"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
 	"software.sslmate.com/src/go-pkcs12"
 
 	"github.com/cert-manager/csi-driver/test/unit"
@@ -62,7 +68,7 @@ func Test_Handle(t *testing.T) {
 	for name, test := range tests {
 		t.Run(name, func(t *testing.T) {
 			files := make(map[string][]byte)
-			err := Handle(test.attributes, files, test.pk, test.chainPEM)
+			err := Handle(test.attributes, files, test.pk, test.chainPEM, nil)
 			assert.NoError(t, err)
 
 			var gotFiles []string
@@ -80,12 +86,14 @@ func Test_create(t *testing.T) {
 	int2 := unit.MustCreateBundle(t, int1, "int2")
 
 	tests := map[string]struct {
-		pk       crypto.PrivateKey
-		chainPEM []byte
-		expPK    crypto.PrivateKey
-		expCert  *x509.Certificate
-		expCAs   []*x509.Certificate
-		expErr   bool
+		pk           crypto.PrivateKey
+		chainPEM     []byte
+		caPEM        []byte
+		excludeChain bool
+		expPK        crypto.PrivateKey
+		expCert      *x509.Certificate
+		expCAs       []*x509.Certificate
+		expErr       bool
 	}{
 		"if chain is empty, then expect error": {
 			pk:       int2.PK,
@@ -111,11 +119,36 @@ func Test_create(t *testing.T) {
 			expCAs:   []*x509.Certificate{int1.Cert, root.Cert},
 			expErr:   false,
 		},
+		"if CA bundle given, expect CA certificates not in the chain are added": {
+			pk:       int2.PK,
+			chainPEM: bytes.Join([][]byte{int2.PEM, int1.PEM}, []byte("\n")),
+			caPEM:    bytes.Join([][]byte{int1.PEM, root.PEM}, []byte("\n")),
+			expPK:    int2.PK,
+			expCert:  int2.Cert,
+			expCAs:   []*x509.Certificate{int1.Cert, root.Cert},
+			expErr:   false,
+		},
+		"if chain is excluded, expect only the leaf certificate is encoded": {
+			pk:           int2.PK,
+			chainPEM:     bytes.Join([][]byte{int2.PEM, int1.PEM}, []byte("\n")),
+			caPEM:        root.PEM,
+			excludeChain: true,
+			expPK:        int2.PK,
+			expCert:      int2.Cert,
+			expCAs:       nil,
+			expErr:       false,
+		},
+		"if CA bundle is malformed, expect error": {
+			pk:       int2.PK,
+			chainPEM: int2.PEM,
+			caPEM:    []byte("not a certificate"),
+			expErr:   true,
+		},
 	}
 
 	for name, test := range tests {
 		t.Run(name, func(t *testing.T) {
-			resp, err := create("test-password", test.pk, test.chainPEM)
+			resp, err := create("test-password", test.pk, test.chainPEM, test.caPEM, !test.excludeChain)
 			require.Equal(t, test.expErr, err != nil, "%v", err)
 
 			if !test.expErr {
@@ -129,3 +162,63 @@ func Test_create(t *testing.T) {
 		})
 	}
 }
+
+func Test_SecretPassword(t *testing.T) {
+	attributes := map[string]string{
+		"csi.storage.k8s.io/pod.namespace":           "my-namespace",
+		"csi.cert-manager.io/pkcs12-password-secret": "keystore-password",
+	}
+	secret := func(data map[string][]byte) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", Name: "keystore-password"},
+			Data:       data,
+		}
+	}
+
+	tests := map[string]struct {
+		objects     []runtime.Object
+		nilClient   bool
+		expPassword string
+		expErr      string
+	}{
+		"if the Secret holds a password, expect it returned": {
+			objects:     []runtime.Object{secret(map[string][]byte{"password": []byte("my-password")})},
+			expPassword: "my-password",
+		},
+		"if the Secret does not exist, expect error": {
+			expErr: `PKCS12 password Secret my-namespace/keystore-password does not exist`,
+		},
+		"if the Secret is in another namespace, expect error": {
+			objects: []runtime.Object{&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "other-namespace", Name: "keystore-password"},
+				Data:       map[string][]byte{"password": []byte("my-password")},
+			}},
+			expErr: `PKCS12 password Secret my-namespace/keystore-password does not exist`,
+		},
+		"if the Secret has no password, expect error": {
+			objects: []runtime.Object{secret(map[string][]byte{"pass": []byte("my-password")})},
+			expErr:  `PKCS12 password Secret my-namespace/keystore-password has no "password" key`,
+		},
+		"if there is no client, expect error": {
+			nilClient: true,
+			expErr:    `"csi.cert-manager.io/pkcs12-password-secret" is not supported by this driver`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var client kubernetes.Interface
+			if !test.nilClient {
+				client = fake.NewSimpleClientset(test.objects...)
+			}
+
+			password, err := SecretPassword(context.Background(), client, attributes)
+			if len(test.expErr) > 0 {
+				assert.EqualError(t, err, test.expErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expPassword, password)
+		})
+	}
+}
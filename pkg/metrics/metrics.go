@@ -0,0 +1,576 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"crypto"
+	"sync"
+	"time"
+
+	cmapiutil "github.com/cert-manager/cert-manager/pkg/api/util"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/cert-manager/cert-manager/pkg/util/pki"
+	"github.com/cert-manager/csi-lib/manager"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/cert-manager/csi-driver/pkg/apis/defaults"
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+)
+
+const (
+	namespace = "certmanager"
+	subsystem = "csi"
+)
+
+const (
+	// Values of the phase label of the issuance attempts metric.
+	PhaseInitial = "initial"
+	PhaseRenewal = "renewal"
+)
+
+const (
+	// Values of the result label of the issuance attempts metric.
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	ResultTimeout = "timeout"
+	ResultDenied  = "denied"
+)
+
+const (
+	// Values of the outcome label of the issuance metric. OutcomeError is
+	// the outcome of an attempt with the failure result.
+	OutcomeSuccess = "success"
+	OutcomeDenied  = "denied"
+	OutcomeError   = "error"
+	OutcomeTimeout = "timeout"
+)
+
+// issuanceDurationBuckets span from sub-second, for in-cluster CA issuers, to
+// several minutes, for slow external or ACME issuers.
+var issuanceDurationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
+// Metrics holds the Prometheus metrics exposed by the driver about the volumes
+// it manages.
+type Metrics struct {
+	volumeInfo            *prometheus.GaugeVec
+	certificateExpiration *prometheus.GaugeVec
+	oldestCertificateAge  prometheus.Gauge
+	renewalHealthy        *prometheus.GaugeVec
+	reissueClamped        prometheus.Counter
+	issuanceAttempts      *prometheus.CounterVec
+	nearExpiry            *prometheus.GaugeVec
+	inflightRequests      prometheus.Gauge
+	waitingRequests       *prometheus.GaugeVec
+	keystoreRegenerations *prometheus.CounterVec
+	dryRuns               *prometheus.CounterVec
+	issuanceDuration      prometheus.Histogram
+	issuance              *prometheus.CounterVec
+
+	// lock protects volumes and nearExpiryVolumes.
+	lock sync.Mutex
+	// volumes holds the managed volumes, and the issuance attempt currently
+	// in progress for each, if any.
+	volumes map[string]*attempt
+	// nearExpiryVolumes holds the volumes last recorded as near expiry.
+	nearExpiryVolumes map[string]bool
+}
+
+// attempt is an issuance attempt in progress.
+type attempt struct {
+	phase string
+
+	// request is the CertificateRequest created by the attempt, if any.
+	request *types.NamespacedName
+	// created is when the CertificateRequest was created.
+	created time.Time
+}
+
+// New builds the driver metrics, and registers them with the given
+// registerer.
+func New(registerer prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		volumeInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "volume_info",
+				Help:      "Information about each volume managed by the driver. The value is always 1.",
+			},
+			[]string{"volume_id", "pod_namespace", "pod_name", "issuer_name", "issuer_kind"},
+		),
+		certificateExpiration: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "certificate_expiration_timestamp_seconds",
+				Help:      "The time at which the certificate currently written to each volume managed by the driver expires, in seconds since the Unix epoch.",
+			},
+			[]string{"volume_id", "pod_namespace", "pod_name", "issuer_name", "issuer_kind"},
+		),
+		oldestCertificateAge: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "oldest_certificate_age_seconds",
+				Help:      "The age of the oldest certificate currently served by a volume managed by the driver. A value which keeps climbing indicates renewal is failing.",
+			},
+		),
+		renewalHealthy: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "volume_renewal_healthy",
+				Help:      "Whether the last issuance attempt for each volume managed by the driver succeeded (1) or failed (0).",
+			},
+			[]string{"volume_id"},
+		),
+		reissueClamped: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "reissue_interval_clamped_total",
+				Help:      "The number of renewals delayed to the minimum reissue interval. A value which keeps increasing indicates a volume is misconfigured to renew near continuously.",
+			},
+		),
+		issuanceAttempts: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "issuance_attempts_total",
+				Help:      "The number of issuance attempts completed, by result (success, failure, timeout, or denied) and phase (initial or renewal).",
+			},
+			[]string{"result", "phase"},
+		),
+		nearExpiry: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "certificate_near_expiry",
+				Help:      "The volumes whose certificate is within the expiry warning threshold without having been renewed. The value is always 1.",
+			},
+			[]string{"volume_id"},
+		),
+		inflightRequests: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "inflight_certificate_requests",
+				Help:      "The number of CertificateRequests created by the driver whose certificate has not yet been written to a volume.",
+			},
+		),
+		waitingRequests: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "waiting_certificate_requests",
+				Help:      "The number of issuance attempts waiting for an outstanding CertificateRequest to complete before creating their own, by phase (initial or renewal).",
+			},
+			[]string{"phase"},
+		),
+		keystoreRegenerations: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "keystore_regenerations_total",
+				Help:      "The number of keystores written to volumes, by format. The rate should follow the rate of renewals, a higher rate indicates keystores are being rebuilt needlessly.",
+			},
+			[]string{"format"},
+		),
+		dryRuns: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "dry_runs_total",
+				Help:      "The number of dry-run volumes whose CertificateRequest was removed, by result (success, failure, timeout or denied).",
+			},
+			[]string{"result"},
+		),
+		issuanceDuration: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "issuance_duration_seconds",
+				Help:      "The time from a CertificateRequest being created to its signed certificate being returned, for successful issuance attempts.",
+				Buckets:   issuanceDurationBuckets,
+			},
+		),
+		issuance: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "issuance_total",
+				Help:      "The number of issuance attempts completed, by outcome (success, denied, error, or timeout).",
+			},
+			[]string{"outcome"},
+		),
+		volumes:           make(map[string]*attempt),
+		nearExpiryVolumes: make(map[string]bool),
+	}
+
+	registerer.MustRegister(m.volumeInfo, m.certificateExpiration, m.oldestCertificateAge, m.renewalHealthy, m.reissueClamped, m.issuanceAttempts, m.nearExpiry, m.inflightRequests, m.waitingRequests, m.keystoreRegenerations, m.dryRuns, m.issuanceDuration, m.issuance)
+
+	return m
+}
+
+// VolumeRegistered records that the volume described by the given metadata is
+// managed by the driver.
+func (m *Metrics) VolumeRegistered(meta metadata.Metadata) {
+	m.lock.Lock()
+	if _, ok := m.volumes[meta.VolumeID]; !ok {
+		m.volumes[meta.VolumeID] = nil
+	}
+	m.lock.Unlock()
+
+	attrs, err := defaults.SetDefaultAttributes(meta.VolumeContext)
+	if err != nil {
+		return
+	}
+
+	// Remove any existing series for the volume in case the volume context
+	// has changed.
+	m.volumeInfo.DeletePartialMatch(prometheus.Labels{"volume_id": meta.VolumeID})
+	m.volumeInfo.WithLabelValues(
+		meta.VolumeID,
+		attrs[csiapi.K8sVolumeContextKeyPodNamespace],
+		attrs[csiapi.K8sVolumeContextKeyPodName],
+		attrs[csiapi.IssuerNameKey],
+		attrs[csiapi.IssuerKindKey],
+	).Set(1)
+}
+
+// VolumeRemoved deletes all series for the given volume. An issuance attempt
+// still in progress is recorded as not having completed.
+func (m *Metrics) VolumeRemoved(volumeID string) {
+	m.lock.Lock()
+	a := m.volumes[volumeID]
+	delete(m.volumes, volumeID)
+	m.volumeInfo.DeletePartialMatch(prometheus.Labels{"volume_id": volumeID})
+	m.certificateExpiration.DeletePartialMatch(prometheus.Labels{"volume_id": volumeID})
+	m.renewalHealthy.DeletePartialMatch(prometheus.Labels{"volume_id": volumeID})
+	m.nearExpiry.DeleteLabelValues(volumeID)
+	delete(m.nearExpiryVolumes, volumeID)
+	m.lock.Unlock()
+
+	if a != nil {
+		m.attemptCompleted(a, m.incompleteResult(a))
+	}
+}
+
+// RenewalStarted records that an issuance attempt in the given phase has
+// started for the volume. If the previous attempt never completed, it failed
+// part way through, so the volume is marked unhealthy.
+func (m *Metrics) RenewalStarted(volumeID, phase string) {
+	m.lock.Lock()
+	previous, ok := m.volumes[volumeID]
+	if !ok {
+		m.lock.Unlock()
+		return
+	}
+	if previous != nil {
+		m.renewalHealthy.WithLabelValues(volumeID).Set(0)
+	}
+	m.volumes[volumeID] = &attempt{phase: phase}
+	m.lock.Unlock()
+
+	if previous != nil {
+		m.attemptCompleted(previous, m.incompleteResult(previous))
+	}
+}
+
+// RequestCreated records the CertificateRequest created by the in progress
+// issuance attempt for the volume.
+func (m *Metrics) RequestCreated(meta metadata.Metadata, cr *cmapi.CertificateRequest) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if a := m.volumes[meta.VolumeID]; a != nil {
+		a.request = &types.NamespacedName{Namespace: cr.Namespace, Name: cr.Name}
+		a.created = time.Now()
+	}
+}
+
+// RenewalCompleted records the result of the in progress issuance attempt for
+// the volume. Volumes which have been removed are ignored, so that an attempt
+// completing during unpublish does not leave a series behind.
+func (m *Metrics) RenewalCompleted(volumeID string, err error) {
+	result := ResultSuccess
+	if err != nil {
+		result = ResultFailure
+	}
+	m.renewalCompleted(volumeID, result)
+}
+
+// renewalCompleted records the given result for the in progress issuance
+// attempt for the volume.
+func (m *Metrics) renewalCompleted(volumeID, result string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	a, ok := m.volumes[volumeID]
+	if !ok {
+		return
+	}
+	m.volumes[volumeID] = nil
+
+	healthy := 0.0
+	if result == ResultSuccess {
+		healthy = 1
+	}
+	m.renewalHealthy.WithLabelValues(volumeID).Set(healthy)
+	if a != nil {
+		m.attemptCompleted(a, result)
+	}
+}
+
+// RequestUpdated records the result of the in progress issuance attempt which
+// created the given CertificateRequest, once the request is denied or has
+// failed. It is called for every update seen by a CertificateRequest
+// informer, so that the attempt is recorded as soon as it ends without
+// looking the request up from the API.
+func (m *Metrics) RequestUpdated(cr *cmapi.CertificateRequest) {
+	var result string
+	switch {
+	case cmapiutil.CertificateRequestIsDenied(cr):
+		result = ResultDenied
+	case cmapiutil.CertificateRequestReadyReason(cr) == cmapi.CertificateRequestReasonFailed:
+		result = ResultFailure
+	default:
+		return
+	}
+
+	m.lock.Lock()
+	var volumeID string
+	for id, a := range m.volumes {
+		if a != nil && a.request != nil && a.request.Namespace == cr.Namespace && a.request.Name == cr.Name {
+			volumeID = id
+			break
+		}
+	}
+	m.lock.Unlock()
+
+	if len(volumeID) > 0 {
+		m.renewalCompleted(volumeID, result)
+	}
+}
+
+// WatchRequests records the result of issuance attempts from the updates seen
+// by the given CertificateRequest informer.
+func (m *Metrics) WatchRequests(informer cache.SharedInformer) error {
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(_, obj any) {
+			if cr, ok := obj.(*cmapi.CertificateRequest); ok {
+				m.RequestUpdated(cr)
+			}
+		},
+	})
+	return err
+}
+
+// attemptCompleted records the result of the given issuance attempt, and how
+// long its CertificateRequest took to be signed if it succeeded.
+func (m *Metrics) attemptCompleted(a *attempt, result string) {
+	m.issuanceAttempts.WithLabelValues(result, a.phase).Inc()
+
+	outcome := result
+	if result == ResultFailure {
+		outcome = OutcomeError
+	}
+	m.issuance.WithLabelValues(outcome).Inc()
+
+	if result == ResultSuccess && !a.created.IsZero() {
+		m.issuanceDuration.Observe(time.Since(a.created).Seconds())
+	}
+}
+
+// CertificateWritten records the expiry of the certificate written to the
+// volume described by the given metadata. Volumes which have been removed are
+// ignored.
+func (m *Metrics) CertificateWritten(meta metadata.Metadata, notAfter time.Time) {
+	attrs, err := defaults.SetDefaultAttributes(meta.VolumeContext)
+	if err != nil {
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.volumes[meta.VolumeID]; !ok {
+		return
+	}
+
+	m.certificateExpiration.DeletePartialMatch(prometheus.Labels{"volume_id": meta.VolumeID})
+	m.certificateExpiration.WithLabelValues(
+		meta.VolumeID,
+		attrs[csiapi.K8sVolumeContextKeyPodNamespace],
+		attrs[csiapi.K8sVolumeContextKeyPodName],
+		attrs[csiapi.IssuerNameKey],
+		attrs[csiapi.IssuerKindKey],
+	).Set(float64(notAfter.Unix()))
+}
+
+// incompleteResult returns the result of an issuance attempt which was
+// abandoned without completing. A request which was denied or failed is
+// recorded by RequestUpdated as it happens, so an attempt whose request was
+// created timed out waiting for it, and one which never created a request
+// failed.
+func (m *Metrics) incompleteResult(a *attempt) string {
+	if a.request == nil {
+		return ResultFailure
+	}
+	return ResultTimeout
+}
+
+// InstrumentGeneratePrivateKey wraps the given function, which csi-lib calls
+// at the start of every issuance attempt, to record renewal health.
+func (m *Metrics) InstrumentGeneratePrivateKey(f manager.GeneratePrivateKeyFunc) manager.GeneratePrivateKeyFunc {
+	return func(meta metadata.Metadata) (crypto.PrivateKey, error) {
+		m.RenewalStarted(meta.VolumeID, phaseForMetadata(meta))
+		return f(meta)
+	}
+}
+
+// InstrumentReadyToRequest wraps the given precheck, which csi-lib calls
+// before every issuance attempt which does not resume a pending request, so
+// that an attempt it rejects is recorded with the given result.
+func (m *Metrics) InstrumentReadyToRequest(result string, f manager.ReadyToRequestFunc) manager.ReadyToRequestFunc {
+	return func(meta metadata.Metadata) (bool, string) {
+		ready, reason := f(meta)
+		if !ready {
+			m.RenewalStarted(meta.VolumeID, phaseForMetadata(meta))
+			m.renewalCompleted(meta.VolumeID, result)
+		}
+		return ready, reason
+	}
+}
+
+// phaseForMetadata returns the phase of an issuance attempt for the volume.
+// Volumes which have never been issued a certificate are in the initial
+// phase.
+func phaseForMetadata(meta metadata.Metadata) string {
+	if meta.NextIssuanceTime == nil || meta.NextIssuanceTime.IsZero() {
+		return PhaseInitial
+	}
+	return PhaseRenewal
+}
+
+// InstrumentWriteKeypair wraps the given function, which csi-lib calls at the
+// end of every successful issuance attempt, to record renewal health and the
+// expiry of the certificate written.
+func (m *Metrics) InstrumentWriteKeypair(f manager.WriteKeypairFunc) manager.WriteKeypairFunc {
+	return func(meta metadata.Metadata, key crypto.PrivateKey, chain []byte, ca []byte) error {
+		err := f(meta, key, chain, ca)
+		m.RenewalCompleted(meta.VolumeID, err)
+		if err == nil {
+			if cert, err := pki.DecodeX509CertificateBytes(chain); err == nil {
+				m.CertificateWritten(meta, cert.NotAfter)
+			}
+		}
+		return err
+	}
+}
+
+// ReissueClamped records that the renewal of a volume was delayed to the
+// minimum reissue interval.
+func (m *Metrics) ReissueClamped(_ string) {
+	m.reissueClamped.Inc()
+}
+
+// KeystoreWritten records that a keystore of the given format was written to
+// a volume.
+func (m *Metrics) KeystoreWritten(_, format string) {
+	m.keystoreRegenerations.WithLabelValues(format).Inc()
+}
+
+// DryRunCompleted records the result of the CertificateRequest of a dry-run
+// volume.
+func (m *Metrics) DryRunCompleted(_, result string) {
+	m.dryRuns.WithLabelValues(result).Inc()
+}
+
+// SetOldestCertificateAge records the age of the oldest certificate served by
+// a managed volume.
+func (m *Metrics) SetOldestCertificateAge(age time.Duration) {
+	m.oldestCertificateAge.Set(age.Seconds())
+}
+
+// SetNearExpiry records the volumes whose certificate is within the expiry
+// warning threshold, replacing those previously recorded.
+func (m *Metrics) SetNearExpiry(volumeIDs []string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	nearExpiry := make(map[string]bool, len(volumeIDs))
+	for _, id := range volumeIDs {
+		nearExpiry[id] = true
+		m.nearExpiry.WithLabelValues(id).Set(1)
+	}
+	for id := range m.nearExpiryVolumes {
+		if !nearExpiry[id] {
+			m.nearExpiry.DeleteLabelValues(id)
+		}
+	}
+	m.nearExpiryVolumes = nearExpiry
+}
+
+// SetInflightRequests records the number of CertificateRequests outstanding.
+func (m *Metrics) SetInflightRequests(n int) {
+	m.inflightRequests.Set(float64(n))
+}
+
+// SetWaitingRequests records the number of mounts and renewals waiting to
+// create a CertificateRequest.
+func (m *Metrics) SetWaitingRequests(initial, renewals int) {
+	m.waitingRequests.WithLabelValues(PhaseInitial).Set(float64(initial))
+	m.waitingRequests.WithLabelValues(PhaseRenewal).Set(float64(renewals))
+}
+
+// Store wraps a storage backend to keep the per-volume metrics in step with
+// the volumes which are registered with, and removed from, the backend.
+type Store struct {
+	storage.Interface
+
+	Metrics *Metrics
+}
+
+// RegisterMetadata registers the volume with the storage backend, and records
+// the volume in the metrics.
+func (s *Store) RegisterMetadata(meta metadata.Metadata) (bool, error) {
+	registered, err := s.Interface.RegisterMetadata(meta)
+	if err != nil {
+		return registered, err
+	}
+
+	s.Metrics.VolumeRegistered(meta)
+
+	return registered, nil
+}
+
+// RemoveVolume removes the volume from the storage backend, and deletes the
+// series for the volume from the metrics.
+func (s *Store) RemoveVolume(volumeID string) error {
+	if err := s.Interface.RemoveVolume(volumeID); err != nil {
+		return err
+	}
+
+	s.Metrics.VolumeRemoved(volumeID)
+
+	return nil
+}
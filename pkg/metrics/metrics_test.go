@@ -0,0 +1,385 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testMetadata(volumeID, podName string) metadata.Metadata {
+	return metadata.Metadata{
+		VolumeID: volumeID,
+		VolumeContext: map[string]string{
+			"csi.cert-manager.io/issuer-name":  "ca-issuer",
+			"csi.cert-manager.io/issuer-kind":  "ClusterIssuer",
+			"csi.storage.k8s.io/pod.name":      podName,
+			"csi.storage.k8s.io/pod.namespace": "my-namespace",
+		},
+	}
+}
+
+func Test_Store_volumeInfo(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	store := &Store{Interface: storage.NewMemoryFS(), Metrics: New(registry)}
+
+	_, err := store.RegisterMetadata(testMetadata("vol-1", "pod-1"))
+	require.NoError(t, err)
+	_, err = store.RegisterMetadata(testMetadata("vol-2", "pod-2"))
+	require.NoError(t, err)
+
+	expected := `
+# HELP certmanager_csi_volume_info Information about each volume managed by the driver. The value is always 1.
+# TYPE certmanager_csi_volume_info gauge
+certmanager_csi_volume_info{issuer_kind="ClusterIssuer",issuer_name="ca-issuer",pod_name="pod-1",pod_namespace="my-namespace",volume_id="vol-1"} 1
+certmanager_csi_volume_info{issuer_kind="ClusterIssuer",issuer_name="ca-issuer",pod_name="pod-2",pod_namespace="my-namespace",volume_id="vol-2"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "certmanager_csi_volume_info"))
+
+	require.NoError(t, store.RemoveVolume("vol-1"))
+
+	expected = `
+# HELP certmanager_csi_volume_info Information about each volume managed by the driver. The value is always 1.
+# TYPE certmanager_csi_volume_info gauge
+certmanager_csi_volume_info{issuer_kind="ClusterIssuer",issuer_name="ca-issuer",pod_name="pod-2",pod_namespace="my-namespace",volume_id="vol-2"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "certmanager_csi_volume_info"))
+}
+
+func Test_VolumeRegistered_replacesSeries(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	m := New(registry)
+
+	m.VolumeRegistered(testMetadata("vol-1", "pod-1"))
+	m.VolumeRegistered(testMetadata("vol-1", "pod-renamed"))
+
+	expected := `
+# HELP certmanager_csi_volume_info Information about each volume managed by the driver. The value is always 1.
+# TYPE certmanager_csi_volume_info gauge
+certmanager_csi_volume_info{issuer_kind="ClusterIssuer",issuer_name="ca-issuer",pod_name="pod-renamed",pod_namespace="my-namespace",volume_id="vol-1"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "certmanager_csi_volume_info"))
+}
+
+func Test_renewalHealthy(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	m := New(registry)
+	store := &Store{Interface: storage.NewMemoryFS(), Metrics: m}
+
+	_, err := store.RegisterMetadata(testMetadata("vol-1", "pod-1"))
+	require.NoError(t, err)
+	_, err = store.RegisterMetadata(testMetadata("vol-2", "pod-2"))
+	require.NoError(t, err)
+
+	// vol-1 issues successfully. vol-2 fails part way through its first
+	// attempt, and is retried.
+	m.RenewalStarted("vol-1", PhaseRenewal)
+	m.RenewalCompleted("vol-1", nil)
+	m.RenewalStarted("vol-2", PhaseRenewal)
+	m.RenewalStarted("vol-2", PhaseRenewal)
+
+	expected := `
+# HELP certmanager_csi_volume_renewal_healthy Whether the last issuance attempt for each volume managed by the driver succeeded (1) or failed (0).
+# TYPE certmanager_csi_volume_renewal_healthy gauge
+certmanager_csi_volume_renewal_healthy{volume_id="vol-1"} 1
+certmanager_csi_volume_renewal_healthy{volume_id="vol-2"} 0
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "certmanager_csi_volume_renewal_healthy"))
+
+	// vol-1 fails to write its renewed certificate, and vol-2 recovers.
+	m.RenewalStarted("vol-1", PhaseRenewal)
+	m.RenewalCompleted("vol-1", errors.New("writing data"))
+	m.RenewalCompleted("vol-2", nil)
+
+	expected = `
+# HELP certmanager_csi_volume_renewal_healthy Whether the last issuance attempt for each volume managed by the driver succeeded (1) or failed (0).
+# TYPE certmanager_csi_volume_renewal_healthy gauge
+certmanager_csi_volume_renewal_healthy{volume_id="vol-1"} 0
+certmanager_csi_volume_renewal_healthy{volume_id="vol-2"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "certmanager_csi_volume_renewal_healthy"))
+
+	// Removed volumes should have their series deleted, and not be recreated
+	// by an attempt completing after removal.
+	m.RenewalStarted("vol-1", PhaseRenewal)
+	require.NoError(t, store.RemoveVolume("vol-1"))
+	m.RenewalCompleted("vol-1", errors.New("volume removed"))
+
+	expected = `
+# HELP certmanager_csi_volume_renewal_healthy Whether the last issuance attempt for each volume managed by the driver succeeded (1) or failed (0).
+# TYPE certmanager_csi_volume_renewal_healthy gauge
+certmanager_csi_volume_renewal_healthy{volume_id="vol-2"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "certmanager_csi_volume_renewal_healthy"))
+}
+
+func Test_reissueClamped(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	m := New(registry)
+
+	m.ReissueClamped("vol-1")
+	m.ReissueClamped("vol-1")
+
+	expected := `
+# HELP certmanager_csi_reissue_interval_clamped_total The number of renewals delayed to the minimum reissue interval. A value which keeps increasing indicates a volume is misconfigured to renew near continuously.
+# TYPE certmanager_csi_reissue_interval_clamped_total counter
+certmanager_csi_reissue_interval_clamped_total 2
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "certmanager_csi_reissue_interval_clamped_total"))
+}
+
+func Test_keystoreRegenerations(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	m := New(registry)
+
+	m.KeystoreWritten("vol-1", "pkcs12")
+	m.KeystoreWritten("vol-2", "pkcs12")
+
+	expected := `
+# HELP certmanager_csi_keystore_regenerations_total The number of keystores written to volumes, by format. The rate should follow the rate of renewals, a higher rate indicates keystores are being rebuilt needlessly.
+# TYPE certmanager_csi_keystore_regenerations_total counter
+certmanager_csi_keystore_regenerations_total{format="pkcs12"} 2
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "certmanager_csi_keystore_regenerations_total"))
+}
+
+func Test_dryRuns(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	m := New(registry)
+
+	m.DryRunCompleted("vol-1", ResultSuccess)
+	m.DryRunCompleted("vol-2", ResultDenied)
+	m.DryRunCompleted("vol-3", ResultSuccess)
+
+	expected := `
+# HELP certmanager_csi_dry_runs_total The number of dry-run volumes whose CertificateRequest was removed, by result (success, failure, timeout or denied).
+# TYPE certmanager_csi_dry_runs_total counter
+certmanager_csi_dry_runs_total{result="denied"} 1
+certmanager_csi_dry_runs_total{result="success"} 2
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "certmanager_csi_dry_runs_total"))
+}
+
+func Test_issuanceAttempts(t *testing.T) {
+	denied := &cmapi.CertificateRequest{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", Name: "denied"},
+		Status: cmapi.CertificateRequestStatus{Conditions: []cmapi.CertificateRequestCondition{
+			{Type: cmapi.CertificateRequestConditionDenied, Status: cmmeta.ConditionTrue},
+			{Type: cmapi.CertificateRequestConditionReady, Status: cmmeta.ConditionFalse, Reason: cmapi.CertificateRequestReasonDenied},
+		}},
+	}
+	failed := &cmapi.CertificateRequest{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", Name: "failed"},
+		Status: cmapi.CertificateRequestStatus{Conditions: []cmapi.CertificateRequestCondition{
+			{Type: cmapi.CertificateRequestConditionReady, Status: cmmeta.ConditionFalse, Reason: cmapi.CertificateRequestReasonFailed},
+		}},
+	}
+	pending := &cmapi.CertificateRequest{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", Name: "pending"},
+	}
+
+	registry := prometheus.NewPedanticRegistry()
+	m := New(registry)
+	store := &Store{Interface: storage.NewMemoryFS(), Metrics: m}
+
+	meta := testMetadata("vol-1", "pod-1")
+	_, err := store.RegisterMetadata(meta)
+	require.NoError(t, err)
+
+	// The initial attempt is denied, the retry fails, the next retry times
+	// out, and the final retry succeeds. Updates to requests of other
+	// attempts, or which are still pending, are ignored.
+	m.RenewalStarted("vol-1", PhaseInitial)
+	m.RequestCreated(meta, denied)
+	m.RequestUpdated(failed)
+	m.RequestUpdated(denied)
+	m.RenewalStarted("vol-1", PhaseInitial)
+	m.RequestCreated(meta, failed)
+	m.RequestUpdated(failed)
+	m.RequestUpdated(failed)
+	m.RenewalStarted("vol-1", PhaseInitial)
+	m.RequestCreated(meta, pending)
+	m.RequestUpdated(pending)
+	m.RenewalStarted("vol-1", PhaseInitial)
+	m.RenewalCompleted("vol-1", nil)
+
+	// A renewal which never creates a request fails, and a renewal which
+	// created a request times out when the next attempt is rejected by the
+	// denied check. Rejections are recorded with the result of their check.
+	renewal := meta
+	nextIssuanceTime := time.Now()
+	renewal.NextIssuanceTime = &nextIssuanceTime
+	reject := func(metadata.Metadata) (bool, string) { return false, "rejected" }
+	m.RenewalStarted("vol-1", PhaseRenewal)
+	m.RenewalStarted("vol-1", PhaseRenewal)
+	m.RequestCreated(meta, pending)
+	ready, reason := m.InstrumentReadyToRequest(ResultDenied, reject)(renewal)
+	assert.False(t, ready)
+	assert.Equal(t, "rejected", reason)
+	m.InstrumentReadyToRequest(ResultFailure, reject)(renewal)
+	m.InstrumentReadyToRequest(ResultFailure, func(metadata.Metadata) (bool, string) { return true, "" })(renewal)
+
+	// The volume is then removed part way through a renewal which created a
+	// request.
+	m.RenewalStarted("vol-1", PhaseRenewal)
+	m.RequestCreated(meta, pending)
+	require.NoError(t, store.RemoveVolume("vol-1"))
+
+	expected := `
+# HELP certmanager_csi_issuance_attempts_total The number of issuance attempts completed, by result (success, failure, timeout, or denied) and phase (initial or renewal).
+# TYPE certmanager_csi_issuance_attempts_total counter
+certmanager_csi_issuance_attempts_total{phase="initial",result="denied"} 1
+certmanager_csi_issuance_attempts_total{phase="initial",result="failure"} 1
+certmanager_csi_issuance_attempts_total{phase="initial",result="success"} 1
+certmanager_csi_issuance_attempts_total{phase="initial",result="timeout"} 1
+certmanager_csi_issuance_attempts_total{phase="renewal",result="denied"} 1
+certmanager_csi_issuance_attempts_total{phase="renewal",result="failure"} 2
+certmanager_csi_issuance_attempts_total{phase="renewal",result="timeout"} 2
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "certmanager_csi_issuance_attempts_total"))
+
+	expected = `
+# HELP certmanager_csi_issuance_total The number of issuance attempts completed, by outcome (success, denied, error, or timeout).
+# TYPE certmanager_csi_issuance_total counter
+certmanager_csi_issuance_total{outcome="denied"} 2
+certmanager_csi_issuance_total{outcome="error"} 3
+certmanager_csi_issuance_total{outcome="success"} 1
+certmanager_csi_issuance_total{outcome="timeout"} 3
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "certmanager_csi_issuance_total"))
+}
+
+func Test_issuanceDuration(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	m := New(registry)
+	store := &Store{Interface: storage.NewMemoryFS(), Metrics: m}
+
+	meta := testMetadata("vol-1", "pod-1")
+	_, err := store.RegisterMetadata(meta)
+	require.NoError(t, err)
+	cr := &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", Name: "cr"}}
+
+	// Only successful attempts which created a request are observed.
+	m.RenewalStarted("vol-1", PhaseInitial)
+	m.RequestCreated(meta, cr)
+	m.RenewalCompleted("vol-1", errors.New("failed"))
+	m.RenewalStarted("vol-1", PhaseRenewal)
+	m.RenewalCompleted("vol-1", nil)
+	m.RenewalStarted("vol-1", PhaseRenewal)
+	m.RequestCreated(meta, cr)
+	m.RenewalCompleted("vol-1", nil)
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	var sampleCount uint64
+	for _, f := range families {
+		if f.GetName() == "certmanager_csi_issuance_duration_seconds" {
+			require.Len(t, f.GetMetric(), 1)
+			sampleCount = f.GetMetric()[0].GetHistogram().GetSampleCount()
+		}
+	}
+	assert.Equal(t, uint64(1), sampleCount)
+}
+
+func mustCertificatePEM(t testing.TB, notAfter time.Time) []byte {
+	pk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    notAfter.Add(-time.Hour * 24),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pk.Public(), pk)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func Test_certificateExpiration(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	m := New(registry)
+	store := &Store{Interface: storage.NewMemoryFS(), Metrics: m}
+
+	var writeErr error
+	writeKeypair := m.InstrumentWriteKeypair(func(metadata.Metadata, crypto.PrivateKey, []byte, []byte) error {
+		return writeErr
+	})
+
+	meta1, meta2 := testMetadata("vol-1", "pod-1"), testMetadata("vol-2", "pod-2")
+	_, err := store.RegisterMetadata(meta1)
+	require.NoError(t, err)
+	_, err = store.RegisterMetadata(meta2)
+	require.NoError(t, err)
+
+	require.NoError(t, writeKeypair(meta1, nil, mustCertificatePEM(t, time.Unix(1000, 0)), nil))
+	require.NoError(t, writeKeypair(meta2, nil, mustCertificatePEM(t, time.Unix(2000, 0)), nil))
+
+	expected := `
+# HELP certmanager_csi_certificate_expiration_timestamp_seconds The time at which the certificate currently written to each volume managed by the driver expires, in seconds since the Unix epoch.
+# TYPE certmanager_csi_certificate_expiration_timestamp_seconds gauge
+certmanager_csi_certificate_expiration_timestamp_seconds{issuer_kind="ClusterIssuer",issuer_name="ca-issuer",pod_name="pod-1",pod_namespace="my-namespace",volume_id="vol-1"} 1000
+certmanager_csi_certificate_expiration_timestamp_seconds{issuer_kind="ClusterIssuer",issuer_name="ca-issuer",pod_name="pod-2",pod_namespace="my-namespace",volume_id="vol-2"} 2000
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "certmanager_csi_certificate_expiration_timestamp_seconds"))
+
+	// vol-1 is renewed, and a certificate which fails to be written for vol-2
+	// should not be recorded.
+	require.NoError(t, writeKeypair(meta1, nil, mustCertificatePEM(t, time.Unix(3000, 0)), nil))
+	writeErr = errors.New("writing data")
+	require.Error(t, writeKeypair(meta2, nil, mustCertificatePEM(t, time.Unix(4000, 0)), nil))
+
+	expected = `
+# HELP certmanager_csi_certificate_expiration_timestamp_seconds The time at which the certificate currently written to each volume managed by the driver expires, in seconds since the Unix epoch.
+# TYPE certmanager_csi_certificate_expiration_timestamp_seconds gauge
+certmanager_csi_certificate_expiration_timestamp_seconds{issuer_kind="ClusterIssuer",issuer_name="ca-issuer",pod_name="pod-1",pod_namespace="my-namespace",volume_id="vol-1"} 3000
+certmanager_csi_certificate_expiration_timestamp_seconds{issuer_kind="ClusterIssuer",issuer_name="ca-issuer",pod_name="pod-2",pod_namespace="my-namespace",volume_id="vol-2"} 2000
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "certmanager_csi_certificate_expiration_timestamp_seconds"))
+
+	// Removed volumes should have their series deleted, and not be recreated
+	// by a certificate written after removal.
+	require.NoError(t, store.RemoveVolume("vol-1"))
+	writeErr = nil
+	require.NoError(t, writeKeypair(meta1, nil, mustCertificatePEM(t, time.Unix(5000, 0)), nil))
+
+	expected = `
+# HELP certmanager_csi_certificate_expiration_timestamp_seconds The time at which the certificate currently written to each volume managed by the driver expires, in seconds since the Unix epoch.
+# TYPE certmanager_csi_certificate_expiration_timestamp_seconds gauge
+certmanager_csi_certificate_expiration_timestamp_seconds{issuer_kind="ClusterIssuer",issuer_name="ca-issuer",pod_name="pod-2",pod_namespace="my-namespace",volume_id="vol-2"} 2000
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "certmanager_csi_certificate_expiration_timestamp_seconds"))
+}
@@ -0,0 +1,65 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mounter makes the mount operations of the driver's node server
+// tolerate target paths which no longer exist, so that unpublishing a volume
+// is idempotent.
+package mounter
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+
+	"k8s.io/mount-utils"
+)
+
+// Mounter wraps a mount.Interface for use by csi-lib's node server.
+//
+// The kubelet may call NodeUnpublishVolume for a volume more than once, or for
+// a volume the driver has no record of, such as after the driver lost its
+// state. The target path may then already have been removed, or be a mount
+// whose backing data is gone. Checking such a path for a mount point fails,
+// which csi-lib returns as an error, so the pod never finishes terminating.
+// Mounter instead reports a missing target path as not mounted, and a
+// corrupted mount as mounted so that it is unmounted.
+type Mounter struct {
+	mount.Interface
+}
+
+// IsMountPoint returns whether the given path is a mount point. A path which
+// does not exist is not a mount point, and a corrupted mount is.
+func (m *Mounter) IsMountPoint(file string) (bool, error) {
+	isMnt, err := m.Interface.IsMountPoint(file)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return false, nil
+	case mount.IsCorruptedMnt(err):
+		return true, nil
+	default:
+		return isMnt, err
+	}
+}
+
+// Mount mounts source at target, first creating target if it does not exist.
+// csi-lib only creates the target path when checking it for a mount point
+// fails because it does not exist, which IsMountPoint no longer reports.
+func (m *Mounter) Mount(source, target, fstype string, options []string) error {
+	if err := os.MkdirAll(target, 0440); err != nil {
+		return err
+	}
+	return m.Interface.Mount(source, target, fstype, options)
+}
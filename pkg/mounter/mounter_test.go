@@ -0,0 +1,106 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mounter
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	testdriver "github.com/cert-manager/csi-lib/test/driver"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/mount-utils"
+)
+
+func Test_NodeUnpublishVolume_unknownVolume(t *testing.T) {
+	store := storage.NewMemoryFS()
+	fakeMounter := mount.NewFakeMounter(nil)
+	_, cl, stop := testdriver.Run(t, testdriver.Options{
+		Store:   store,
+		Mounter: &Mounter{Interface: fakeMounter},
+	})
+	defer stop()
+
+	tests := map[string]struct {
+		// targetPath returns the target path to unpublish, after setting up
+		// the state left behind.
+		targetPath func(t *testing.T) string
+	}{
+		"target path which does not exist": {
+			targetPath: func(t *testing.T) string {
+				return filepath.Join(t.TempDir(), "missing")
+			},
+		},
+		"target path which is still mounted": {
+			targetPath: func(t *testing.T) string {
+				target := t.TempDir()
+				require.NoError(t, fakeMounter.Mount("/source", target, "", []string{"bind", "ro"}))
+				return target
+			},
+		},
+		"target path with residual volume data": {
+			targetPath: func(t *testing.T) string {
+				meta := metadata.Metadata{VolumeID: "vol-unknown"}
+				_, err := store.RegisterMetadata(meta)
+				require.NoError(t, err)
+				require.NoError(t, store.WriteFiles(meta, map[string][]byte{"tls.crt": []byte("crt")}))
+				return t.TempDir()
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := &csi.NodeUnpublishVolumeRequest{VolumeId: "vol-unknown", TargetPath: test.targetPath(t)}
+
+			// Unpublishing should succeed, and be idempotent.
+			for range 2 {
+				_, err := cl.NodeUnpublishVolume(context.Background(), req)
+				require.NoError(t, err)
+			}
+
+			mountPoints, err := fakeMounter.List()
+			require.NoError(t, err)
+			assert.Empty(t, mountPoints)
+			_, err = store.ReadFiles("vol-unknown")
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+		})
+	}
+}
+
+func Test_Mounter_Mount(t *testing.T) {
+	fakeMounter := mount.NewFakeMounter(nil)
+	m := &Mounter{Interface: fakeMounter}
+
+	// A target path which does not exist is reported as not mounted, so
+	// mounting must create it.
+	target := filepath.Join(t.TempDir(), "target")
+	isMnt, err := m.IsMountPoint(target)
+	require.NoError(t, err)
+	assert.False(t, isMnt)
+
+	require.NoError(t, m.Mount("/source", target, "", []string{"bind", "ro"}))
+	assert.DirExists(t, target)
+
+	isMnt, err = m.IsMountPoint(target)
+	require.NoError(t, err)
+	assert.True(t, isMnt)
+}
@@ -0,0 +1,59 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precheck
+
+import (
+	"fmt"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+
+	"github.com/cert-manager/csi-driver/pkg/apis/defaults"
+	"github.com/cert-manager/csi-driver/pkg/apis/validation"
+)
+
+// Attributes wraps a storage backend to validate a volume's attributes before
+// it is registered. Invalid attributes otherwise only surface from the
+// renewal loop, as repeated issuance failures which never fail the mount.
+// Rejecting the volume at registration fails the mount with every problem
+// found, so that it can be fixed in one pass.
+type Attributes struct {
+	storage.Interface
+
+	// AllowUnknown permits attributes with the driver's prefix which are not
+	// recognised, such as those meant for a newer version of the driver.
+	AllowUnknown bool
+}
+
+// RegisterMetadata registers the volume with the storage backend, if its
+// attributes are valid.
+func (a *Attributes) RegisterMetadata(meta metadata.Metadata) (bool, error) {
+	attrs, err := defaults.SetDefaultAttributes(meta.VolumeContext)
+	if err != nil {
+		return false, fmt.Errorf("volume %q cannot be published: %w", meta.VolumeID, err)
+	}
+
+	el := validation.ValidateAttributes(attrs)
+	if !a.AllowUnknown {
+		el = append(el, validation.ValidateAttributeKeys(meta.VolumeContext)...)
+	}
+	if len(el) > 0 {
+		return false, fmt.Errorf("volume %q cannot be published: %w", meta.VolumeID, el.ToAggregate())
+	}
+
+	return a.Interface.RegisterMetadata(meta)
+}
@@ -0,0 +1,95 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precheck
+
+import (
+	"testing"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Attributes(t *testing.T) {
+	tests := map[string]struct {
+		volumeContext map[string]string
+		allowUnknown  bool
+		expErr        bool
+	}{
+		"volume with valid attributes should be registered": {
+			volumeContext: map[string]string{
+				"csi.cert-manager.io/issuer-name": "ca-issuer",
+				"csi.cert-manager.io/ip-sans":     "10.0.0.1, ::1",
+			},
+			expErr: false,
+		},
+		"volume with an invalid IP SAN should be rejected": {
+			volumeContext: map[string]string{
+				"csi.cert-manager.io/issuer-name": "ca-issuer",
+				"csi.cert-manager.io/ip-sans":     "10.0.0.1,10.0.0.300",
+			},
+			expErr: true,
+		},
+		"volume without an issuer should be rejected": {
+			volumeContext: map[string]string{},
+			expErr:        true,
+		},
+		"volume with an unknown attribute should be rejected": {
+			volumeContext: map[string]string{
+				"csi.cert-manager.io/issuer-name": "ca-issuer",
+				"csi.cert-manager.io/dns-name":    "example.com",
+			},
+			expErr: true,
+		},
+		"volume with an unknown attribute should be registered if allowed": {
+			volumeContext: map[string]string{
+				"csi.cert-manager.io/issuer-name": "ca-issuer",
+				"csi.cert-manager.io/dns-name":    "example.com",
+			},
+			allowUnknown: true,
+			expErr:       false,
+		},
+		"volume with attributes of other prefixes should be registered": {
+			volumeContext: map[string]string{
+				"csi.cert-manager.io/issuer-name":  "ca-issuer",
+				"csi.storage.k8s.io/pod.namespace": "my-namespace",
+				"example.com/foo":                  "bar",
+			},
+			expErr: false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			backend := storage.NewMemoryFS()
+			a := &Attributes{Interface: backend, AllowUnknown: test.allowUnknown}
+
+			registered, err := a.RegisterMetadata(metadata.Metadata{VolumeID: "vol-id", VolumeContext: test.volumeContext})
+			assert.Equal(t, test.expErr, err != nil, "%v", err)
+			assert.Equal(t, !test.expErr, registered)
+
+			ids, err := backend.ListVolumes()
+			require.NoError(t, err)
+			if test.expErr {
+				assert.Empty(t, ids)
+			} else {
+				assert.Equal(t, []string{"vol-id"}, ids)
+			}
+		})
+	}
+}
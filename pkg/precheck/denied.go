@@ -0,0 +1,70 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precheck
+
+import (
+	"fmt"
+
+	apiutil "github.com/cert-manager/cert-manager/pkg/api/util"
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmlisters "github.com/cert-manager/cert-manager/pkg/client/listers/certmanager/v1"
+	"github.com/cert-manager/csi-lib/metadata"
+	"k8s.io/apimachinery/pkg/labels"
+
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+	"github.com/cert-manager/csi-driver/pkg/client"
+)
+
+// Denied refuses to request a certificate for a volume whose most recent
+// CertificateRequest was denied. A denial is a terminal decision by an
+// approver, so unlike a failed request it is not retried with backoff.
+// Requests resume once the denied CertificateRequest is deleted, or the pod
+// is recreated with a new volume.
+//
+// Requests are found by the volume ID hash label csi-lib adds to every
+// request, in a cache of the requests created on this node, so that the
+// check makes no API call.
+type Denied struct {
+	// Lister lists the CertificateRequests created on this node, such as from
+	// an informer of client.NewNodeInformerFactory.
+	Lister cmlisters.CertificateRequestLister
+}
+
+// ReadyToRequest returns false if the most recent CertificateRequest for the
+// volume was denied.
+func (d *Denied) ReadyToRequest(meta metadata.Metadata) (bool, string) {
+	namespace := meta.VolumeContext[csiapi.K8sVolumeContextKeyPodNamespace]
+	selector := labels.SelectorFromSet(labels.Set{client.VolumeIDHashLabelKey: client.HashIdentifier(meta.VolumeID)})
+
+	requests, err := d.Lister.CertificateRequests(namespace).List(selector)
+	if err != nil {
+		return true, ""
+	}
+
+	var latest *cmapi.CertificateRequest
+	for _, cr := range requests {
+		if latest == nil || latest.CreationTimestamp.Before(&cr.CreationTimestamp) {
+			latest = cr
+		}
+	}
+	if latest == nil || !apiutil.CertificateRequestIsDenied(latest) {
+		return true, ""
+	}
+
+	cond := apiutil.GetCertificateRequestCondition(latest, cmapi.CertificateRequestConditionDenied)
+	return false, fmt.Sprintf("CertificateRequest %s/%s was denied, delete it to retry: %s", latest.Namespace, latest.Name, cond.Message)
+}
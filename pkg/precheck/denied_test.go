@@ -0,0 +1,113 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precheck
+
+import (
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	cmlisters "github.com/cert-manager/cert-manager/pkg/client/listers/certmanager/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/cert-manager/csi-driver/pkg/client"
+)
+
+func Test_Denied(t *testing.T) {
+	created := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	request := func(name, volumeID string, age time.Duration, conditions ...cmapi.CertificateRequestCondition) *cmapi.CertificateRequest {
+		return &cmapi.CertificateRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:         "my-namespace",
+				Name:              name,
+				CreationTimestamp: metav1.NewTime(created.Add(-age)),
+				Labels: map[string]string{
+					client.ManagedByLabelKey:    client.ManagedByLabelValue,
+					client.VolumeIDHashLabelKey: client.HashIdentifier(volumeID),
+				},
+			},
+			Status: cmapi.CertificateRequestStatus{Conditions: conditions},
+		}
+	}
+	denied := cmapi.CertificateRequestCondition{
+		Type:    cmapi.CertificateRequestConditionDenied,
+		Status:  cmmeta.ConditionTrue,
+		Message: "not allowed by policy",
+	}
+	failed := cmapi.CertificateRequestCondition{
+		Type:   cmapi.CertificateRequestConditionReady,
+		Status: cmmeta.ConditionFalse,
+		Reason: cmapi.CertificateRequestReasonFailed,
+	}
+
+	tests := map[string]struct {
+		objects   []*cmapi.CertificateRequest
+		expReady  bool
+		expReason string
+	}{
+		"volume with no requests should be ready": {
+			expReady: true,
+		},
+		"volume whose latest request failed should be ready": {
+			objects:  []*cmapi.CertificateRequest{request("cr-1", "vol-id", 0, failed)},
+			expReady: true,
+		},
+		"volume whose latest request was denied should not be ready": {
+			objects:   []*cmapi.CertificateRequest{request("cr-1", "vol-id", 0, denied)},
+			expReady:  false,
+			expReason: "CertificateRequest my-namespace/cr-1 was denied, delete it to retry: not allowed by policy",
+		},
+		"volume with a request newer than a denied request should be ready": {
+			objects: []*cmapi.CertificateRequest{
+				request("cr-1", "vol-id", time.Hour, denied),
+				request("cr-2", "vol-id", 0),
+			},
+			expReady: true,
+		},
+		"denied request for another volume should be ready": {
+			objects:  []*cmapi.CertificateRequest{request("cr-1", "other-vol-id", 0, denied)},
+			expReady: true,
+		},
+		"denied request in another namespace should be ready": {
+			objects: []*cmapi.CertificateRequest{func() *cmapi.CertificateRequest {
+				cr := request("cr-1", "vol-id", 0, denied)
+				cr.Namespace = "other-namespace"
+				return cr
+			}()},
+			expReady: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			for _, obj := range test.objects {
+				require.NoError(t, indexer.Add(obj))
+			}
+
+			check := &Denied{Lister: cmlisters.NewCertificateRequestLister(indexer)}
+			ready, reason := check.ReadyToRequest(metaForNamespace("my-namespace"))
+			assert.Equal(t, test.expReady, ready)
+			assert.Equal(t, test.expReason, reason)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precheck
+
+import (
+	"fmt"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/go-logr/logr"
+
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+	"github.com/cert-manager/csi-driver/pkg/volumelog"
+)
+
+// Duration checks that the certificate duration requested for the volume is
+// long enough for renewal to keep up reliably, given the latency of issuing a
+// certificate. Requests for shorter durations are logged, or refused if
+// Reject is set.
+type Duration struct {
+	Log logr.Logger
+
+	// Min is the minimum duration which can be renewed reliably.
+	Min time.Duration
+
+	// Reject refuses to request certificates shorter than Min, rather than
+	// logging a warning.
+	Reject bool
+}
+
+// ReadyToRequest returns false if Reject is set and the requested duration is
+// shorter than Min.
+func (d *Duration) ReadyToRequest(meta metadata.Metadata) (bool, string) {
+	duration := cmapi.DefaultCertificateDuration
+	if v, ok := meta.VolumeContext[csiapi.DurationKey]; ok {
+		var err error
+		if duration, err = time.ParseDuration(v); err != nil {
+			// Invalid durations are reported when the request is generated.
+			return true, ""
+		}
+	}
+
+	if duration >= d.Min {
+		return true, ""
+	}
+
+	reason := fmt.Sprintf("requested duration %s is shorter than the minimum reliable duration %s", duration, d.Min)
+	if d.Reject {
+		return false, reason
+	}
+
+	volumelog.ForMetadata(d.Log, meta).Info("Requesting certificate with a duration renewal may not keep up with", "reason", reason)
+	return true, ""
+}
@@ -0,0 +1,73 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precheck
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Duration(t *testing.T) {
+	tests := map[string]struct {
+		duration  string
+		reject    bool
+		expReady  bool
+		expReason string
+	}{
+		"default duration should be ready": {
+			expReady: true,
+		},
+		"duration at the minimum should be ready": {
+			duration: "10m",
+			reject:   true,
+			expReady: true,
+		},
+		"short duration should be ready if only warning": {
+			duration: "2m",
+			expReady: true,
+		},
+		"short duration should not be ready if rejecting": {
+			duration:  "2m",
+			reject:    true,
+			expReady:  false,
+			expReason: "requested duration 2m0s is shorter than the minimum reliable duration 10m0s",
+		},
+		"invalid duration should be left to request generation": {
+			duration: "bad-duration",
+			reject:   true,
+			expReady: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			meta := metadata.Metadata{VolumeID: "vol-id", VolumeContext: map[string]string{}}
+			if len(test.duration) > 0 {
+				meta.VolumeContext["csi.cert-manager.io/duration"] = test.duration
+			}
+
+			check := &Duration{Log: logr.Discard(), Min: time.Minute * 10, Reject: test.reject}
+			ready, reason := check.ReadyToRequest(meta)
+			assert.Equal(t, test.expReady, ready)
+			assert.Equal(t, test.expReason, reason)
+		})
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precheck
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/cert-manager/csi-lib/metadata"
+
+	"github.com/cert-manager/csi-driver/pkg/apis/defaults"
+	"github.com/cert-manager/csi-driver/pkg/issuerref"
+	"github.com/cert-manager/csi-driver/pkg/keygen"
+)
+
+// keyTypeRegexp matches the key types accepted in issuer constraints, such as
+// "RSA-2048", "ECDSA-256" or "Ed25519".
+var keyTypeRegexp = regexp.MustCompile(`^(RSA-[0-9]+|ECDSA-(256|384|521)|Ed25519)$`)
+
+// KeyType checks that the type of private key generated by the driver for the
+// volume is accepted by the issuer of the volume, for issuers with known
+// constraints. This fails the mount with a clear reason, rather than waiting
+// for the issuer to deny the request.
+type KeyType struct {
+	// Allowed maps issuer references to the key types they accept. Issuers
+	// which are not present accept any key type.
+	Allowed map[string][]string
+}
+
+// ParseKeyTypeConstraints parses issuer constraints of the form
+// "<issuer reference>=<key type>[;<key type>...]", split into a map by the
+// flag parser.
+func ParseKeyTypeConstraints(constraints map[string]string) (map[string][]string, error) {
+	var refs []string
+	for ref := range constraints {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	var errs []error
+	allowed := make(map[string][]string, len(constraints))
+	for _, ref := range refs {
+		if err := issuerref.Validate(ref); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, keyType := range strings.Split(constraints[ref], ";") {
+			if !keyTypeRegexp.MatchString(keyType) {
+				errs = append(errs, fmt.Errorf("invalid key type %q for issuer %q, must be one of RSA-<size>, ECDSA-<256|384|521> or Ed25519", keyType, ref))
+				continue
+			}
+			allowed[ref] = append(allowed[ref], keyType)
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return allowed, nil
+}
+
+// ReadyToRequest returns false if the issuer of the volume is known not to
+// accept the key type generated by the driver.
+func (k *KeyType) ReadyToRequest(meta metadata.Metadata) (bool, string) {
+	refs, err := issuerref.ForAttributes(meta.VolumeContext)
+	if err != nil {
+		// Invalid attributes are reported when the request is generated.
+		return true, ""
+	}
+	attrs, err := defaults.SetDefaultAttributes(meta.VolumeContext)
+	if err != nil {
+		return true, ""
+	}
+	keyType := keygen.KeyType(attrs)
+
+	for _, ref := range refs {
+		allowed, ok := k.Allowed[ref]
+		if !ok {
+			continue
+		}
+		if slices.Contains(allowed, keyType) {
+			return true, ""
+		}
+		return false, fmt.Sprintf("issuer %q is known to only accept key types %s, but the driver generates %s keys",
+			ref, strings.Join(allowed, ", "), keyType)
+	}
+
+	return true, ""
+}
@@ -0,0 +1,148 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precheck
+
+import (
+	"testing"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseKeyTypeConstraints(t *testing.T) {
+	tests := map[string]struct {
+		constraints map[string]string
+		expAllowed  map[string][]string
+		expErr      bool
+	}{
+		"no constraints should return no error": {
+			constraints: nil,
+			expAllowed:  map[string][]string{},
+		},
+		"valid constraints should be split": {
+			constraints: map[string]string{
+				"ClusterIssuer.cert-manager.io/ca":     "ECDSA-256;ECDSA-384",
+				"Issuer.cert-manager.io/sandbox/vault": "RSA-4096",
+			},
+			expAllowed: map[string][]string{
+				"ClusterIssuer.cert-manager.io/ca":     {"ECDSA-256", "ECDSA-384"},
+				"Issuer.cert-manager.io/sandbox/vault": {"RSA-4096"},
+			},
+		},
+		"invalid issuer reference should error": {
+			constraints: map[string]string{"ca": "RSA-2048"},
+			expErr:      true,
+		},
+		"invalid key type should error": {
+			constraints: map[string]string{"ClusterIssuer.cert-manager.io/ca": "ECDSA-128"},
+			expErr:      true,
+		},
+		"empty key type should error": {
+			constraints: map[string]string{"ClusterIssuer.cert-manager.io/ca": ""},
+			expErr:      true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			allowed, err := ParseKeyTypeConstraints(test.constraints)
+			assert.Equal(t, test.expErr, err != nil, "%v", err)
+			if !test.expErr {
+				assert.Equal(t, test.expAllowed, allowed)
+			}
+		})
+	}
+}
+
+func Test_KeyType(t *testing.T) {
+	check := &KeyType{
+		Allowed: map[string][]string{
+			"ClusterIssuer.cert-manager.io/ecdsa-only":  {"ECDSA-256", "ECDSA-384"},
+			"ClusterIssuer.cert-manager.io/rsa":         {"RSA-2048", "RSA-4096"},
+			"Issuer.cert-manager.io/sandbox/ecdsa-only": {"ECDSA-256"},
+		},
+	}
+
+	tests := map[string]struct {
+		attr      map[string]string
+		expReady  bool
+		expReason string
+	}{
+		"issuer without constraints should be ready": {
+			attr: map[string]string{
+				"csi.cert-manager.io/issuer-name": "ca",
+			},
+			expReady: true,
+		},
+		"issuer accepting the key type should be ready": {
+			attr: map[string]string{
+				"csi.cert-manager.io/issuer-name": "rsa",
+				"csi.cert-manager.io/issuer-kind": "ClusterIssuer",
+			},
+			expReady: true,
+		},
+		"issuer not accepting the key type should not be ready": {
+			attr: map[string]string{
+				"csi.cert-manager.io/issuer-name": "ecdsa-only",
+				"csi.cert-manager.io/issuer-kind": "ClusterIssuer",
+			},
+			expReady:  false,
+			expReason: `issuer "ClusterIssuer.cert-manager.io/ecdsa-only" is known to only accept key types ECDSA-256, ECDSA-384, but the driver generates RSA-2048 keys`,
+		},
+		"namespaced issuer not accepting the key type should not be ready": {
+			attr: map[string]string{
+				"csi.cert-manager.io/issuer-name":  "ecdsa-only",
+				"csi.storage.k8s.io/pod.namespace": "sandbox",
+			},
+			expReady:  false,
+			expReason: `issuer "Issuer.cert-manager.io/sandbox/ecdsa-only" is known to only accept key types ECDSA-256, but the driver generates RSA-2048 keys`,
+		},
+		"issuer accepting the key type requested by the volume should be ready": {
+			attr: map[string]string{
+				"csi.cert-manager.io/issuer-name":   "ecdsa-only",
+				"csi.cert-manager.io/issuer-kind":   "ClusterIssuer",
+				"csi.cert-manager.io/key-algorithm": "ECDSA",
+				"csi.cert-manager.io/key-size":      "384",
+			},
+			expReady: true,
+		},
+		"issuer not accepting the key type requested by the volume should not be ready": {
+			attr: map[string]string{
+				"csi.cert-manager.io/issuer-name":   "rsa",
+				"csi.cert-manager.io/issuer-kind":   "ClusterIssuer",
+				"csi.cert-manager.io/key-algorithm": "Ed25519",
+			},
+			expReady:  false,
+			expReason: `issuer "ClusterIssuer.cert-manager.io/rsa" is known to only accept key types RSA-2048, RSA-4096, but the driver generates Ed25519 keys`,
+		},
+		"issuer in another namespace should be ready": {
+			attr: map[string]string{
+				"csi.cert-manager.io/issuer-name":  "ecdsa-only",
+				"csi.storage.k8s.io/pod.namespace": "default",
+			},
+			expReady: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ready, reason := check.ReadyToRequest(metadata.Metadata{VolumeID: "vol-id", VolumeContext: test.attr})
+			assert.Equal(t, test.expReady, ready)
+			assert.Equal(t, test.expReason, reason)
+		})
+	}
+}
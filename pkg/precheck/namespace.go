@@ -0,0 +1,83 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precheck
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+	"github.com/cert-manager/csi-driver/pkg/volumelog"
+)
+
+// Namespace checks that the namespace of the pod mounting the volume is not
+// being deleted, since CertificateRequests cannot be created in a terminating
+// namespace.
+// If the driver is not permitted to get namespaces, the check is disabled and
+// always passes.
+type Namespace struct {
+	Log    logr.Logger
+	Client kubernetes.Interface
+
+	disabled atomic.Bool
+}
+
+// ReadyToRequest returns false if the namespace of the pod is terminating.
+func (n *Namespace) ReadyToRequest(meta metadata.Metadata) (bool, string) {
+	if n.disabled.Load() {
+		return true, ""
+	}
+
+	name := meta.VolumeContext[csiapi.K8sVolumeContextKeyPodNamespace]
+	if len(name) == 0 {
+		return true, ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), apiTimeout)
+	defer cancel()
+
+	ns, err := n.Client.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsForbidden(err):
+		if !n.disabled.Swap(true) {
+			n.Log.Error(err, "Driver is not permitted to get namespaces, disabling namespace terminating check")
+		}
+		return true, ""
+	case apierrors.IsNotFound(err):
+		return false, fmt.Sprintf("namespace %q does not exist, not requesting certificate", name)
+	case err != nil:
+		// Don't block issuance on a failure to perform the check. If the
+		// namespace is terminating, the CertificateRequest creation will fail
+		// anyway.
+		volumelog.ForMetadata(n.Log, meta).V(2).Info("Failed to get namespace, skipping namespace terminating check", "namespace", name, "error", err.Error())
+		return true, ""
+	}
+
+	if ns.DeletionTimestamp != nil || ns.Status.Phase == corev1.NamespaceTerminating {
+		return false, fmt.Sprintf("namespace %q is terminating, not requesting certificate", name)
+	}
+
+	return true, ""
+}
@@ -0,0 +1,129 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precheck
+
+import (
+	"testing"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func metaForNamespace(namespace string) metadata.Metadata {
+	return metadata.Metadata{
+		VolumeID: "vol-id",
+		VolumeContext: map[string]string{
+			"csi.storage.k8s.io/pod.namespace": namespace,
+		},
+	}
+}
+
+func Test_Namespace(t *testing.T) {
+	now := metav1.Now()
+
+	tests := map[string]struct {
+		objects   []runtime.Object
+		forbidden bool
+		expReady  bool
+		expReason string
+	}{
+		"active namespace should be ready": {
+			objects: []runtime.Object{&corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: "my-namespace"},
+				Status:     corev1.NamespaceStatus{Phase: corev1.NamespaceActive},
+			}},
+			expReady: true,
+		},
+		"namespace in terminating phase should not be ready": {
+			objects: []runtime.Object{&corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: "my-namespace"},
+				Status:     corev1.NamespaceStatus{Phase: corev1.NamespaceTerminating},
+			}},
+			expReady:  false,
+			expReason: `namespace "my-namespace" is terminating, not requesting certificate`,
+		},
+		"namespace with deletion timestamp should not be ready": {
+			objects: []runtime.Object{&corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: "my-namespace", DeletionTimestamp: &now},
+			}},
+			expReady:  false,
+			expReason: `namespace "my-namespace" is terminating, not requesting certificate`,
+		},
+		"namespace which does not exist should not be ready": {
+			expReady:  false,
+			expReason: `namespace "my-namespace" does not exist, not requesting certificate`,
+		},
+		"if forbidden from getting namespaces, should be ready": {
+			forbidden: true,
+			expReady:  true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(test.objects...)
+			if test.forbidden {
+				client.PrependReactor("get", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "namespaces"}, "my-namespace", nil)
+				})
+			}
+
+			check := &Namespace{Log: logr.Discard(), Client: client}
+			ready, reason := check.ReadyToRequest(metaForNamespace("my-namespace"))
+			assert.Equal(t, test.expReady, ready)
+			assert.Equal(t, test.expReason, reason)
+		})
+	}
+}
+
+func Test_Namespace_forbiddenDisablesCheck(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("get", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "namespaces"}, "my-namespace", nil)
+	})
+
+	check := &Namespace{Log: logr.Discard(), Client: client}
+	for range 3 {
+		ready, _ := check.ReadyToRequest(metaForNamespace("my-namespace"))
+		assert.True(t, ready)
+	}
+
+	assert.Len(t, client.Actions(), 1, "expected namespace lookup to be disabled after a forbidden response")
+}
+
+func Test_All(t *testing.T) {
+	ready := func(metadata.Metadata) (bool, string) { return true, "" }
+	notReady := func(reason string) func(metadata.Metadata) (bool, string) {
+		return func(metadata.Metadata) (bool, string) { return false, reason }
+	}
+
+	ok, reason := All()(metadata.Metadata{})
+	assert.True(t, ok)
+	assert.Empty(t, reason)
+
+	ok, reason = All(ready, notReady("first"), notReady("second"))(metadata.Metadata{})
+	assert.False(t, ok)
+	assert.Equal(t, "first", reason)
+}
@@ -0,0 +1,53 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precheck
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"k8s.io/client-go/kubernetes"
+
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+	"github.com/cert-manager/csi-driver/pkg/keystore/pkcs12"
+)
+
+// PKCS12PasswordSecret wraps a storage backend to check the Secret holding a
+// volume's PKCS12 keystore password before the volume is registered. Without
+// it, a missing Secret only surfaces once the certificate has been issued,
+// as a failure to write the volume's files.
+type PKCS12PasswordSecret struct {
+	storage.Interface
+
+	Client kubernetes.Interface
+}
+
+// RegisterMetadata registers the volume with the storage backend, if its
+// PKCS12 keystore password can be read from the Secret it names.
+func (p *PKCS12PasswordSecret) RegisterMetadata(meta metadata.Metadata) (bool, error) {
+	if _, ok := meta.VolumeContext[csiapi.KeyStorePKCS12PasswordSecretKey]; ok && meta.VolumeContext[csiapi.KeyStorePKCS12EnableKey] == "true" {
+		ctx, cancel := context.WithTimeout(context.Background(), apiTimeout)
+		defer cancel()
+		if _, err := pkcs12.SecretPassword(ctx, p.Client, meta.VolumeContext); err != nil {
+			return false, fmt.Errorf("volume %q cannot be published: %w", meta.VolumeID, err)
+		}
+	}
+
+	return p.Interface.RegisterMetadata(meta)
+}
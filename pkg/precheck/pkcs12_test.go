@@ -0,0 +1,90 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precheck
+
+import (
+	"testing"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_PKCS12PasswordSecret(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", Name: "keystore-password"},
+		Data:       map[string][]byte{"password": []byte("my-password")},
+	}
+
+	tests := map[string]struct {
+		volumeContext map[string]string
+		objects       []runtime.Object
+		expErr        string
+	}{
+		"volume without a password Secret should be registered": {
+			volumeContext: map[string]string{
+				"csi.cert-manager.io/pkcs12-enable":   "true",
+				"csi.cert-manager.io/pkcs12-password": "my-password",
+			},
+		},
+		"volume with an existing password Secret should be registered": {
+			volumeContext: map[string]string{
+				"csi.cert-manager.io/pkcs12-enable":          "true",
+				"csi.cert-manager.io/pkcs12-password-secret": "keystore-password",
+				"csi.storage.k8s.io/pod.namespace":           "my-namespace",
+			},
+			objects: []runtime.Object{secret},
+		},
+		"volume with a missing password Secret should be rejected": {
+			volumeContext: map[string]string{
+				"csi.cert-manager.io/pkcs12-enable":          "true",
+				"csi.cert-manager.io/pkcs12-password-secret": "keystore-password",
+				"csi.storage.k8s.io/pod.namespace":           "my-namespace",
+			},
+			expErr: `volume "vol-id" cannot be published: PKCS12 password Secret my-namespace/keystore-password does not exist`,
+		},
+		"volume with PKCS12 disabled should not check the password Secret": {
+			volumeContext: map[string]string{
+				"csi.cert-manager.io/pkcs12-enable":          "false",
+				"csi.cert-manager.io/pkcs12-password-secret": "keystore-password",
+				"csi.storage.k8s.io/pod.namespace":           "my-namespace",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			backend := storage.NewMemoryFS()
+			p := &PKCS12PasswordSecret{Interface: backend, Client: fake.NewSimpleClientset(test.objects...)}
+
+			_, err := p.RegisterMetadata(metadata.Metadata{VolumeID: "vol-id", TargetPath: "/target-path", VolumeContext: test.volumeContext})
+			ids, listErr := backend.ListVolumes()
+			assert.NoError(t, listErr)
+			if len(test.expErr) > 0 {
+				assert.EqualError(t, err, test.expErr)
+				assert.Empty(t, ids)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"vol-id"}, ids)
+		})
+	}
+}
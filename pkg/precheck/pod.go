@@ -0,0 +1,72 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precheck
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+)
+
+// Pod cross-checks the pod information passed by the kubelet in the volume
+// context against the API server. The pod must exist with the same UID and
+// service account, and be scheduled to this node. Unlike the other checks,
+// Pod fails closed: if the pod cannot be confirmed for any reason, no
+// certificate is requested.
+type Pod struct {
+	Client kubernetes.Interface
+
+	// NodeID is the name of the node which is hosting this driver instance.
+	NodeID string
+}
+
+// ReadyToRequest returns false if the pod in the volume context cannot be
+// confirmed to exist and be scheduled to this node.
+func (p *Pod) ReadyToRequest(meta metadata.Metadata) (bool, string) {
+	namespace := meta.VolumeContext[csiapi.K8sVolumeContextKeyPodNamespace]
+	name := meta.VolumeContext[csiapi.K8sVolumeContextKeyPodName]
+	if len(namespace) == 0 || len(name) == 0 {
+		return false, "pod name and namespace missing from volume context, cannot verify pod"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), apiTimeout)
+	defer cancel()
+
+	pod, err := p.Client.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return false, fmt.Sprintf("failed to verify pod %s/%s: %s", namespace, name, err)
+	}
+
+	if uid := meta.VolumeContext[csiapi.K8sVolumeContextKeyPodUID]; string(pod.UID) != uid {
+		return false, fmt.Sprintf("pod %s/%s has UID %q, but volume context has %q", namespace, name, pod.UID, uid)
+	}
+
+	if sa, ok := meta.VolumeContext[csiapi.K8sVolumeContextKeyServiceAccountName]; ok && pod.Spec.ServiceAccountName != sa {
+		return false, fmt.Sprintf("pod %s/%s has service account %q, but volume context has %q", namespace, name, pod.Spec.ServiceAccountName, sa)
+	}
+
+	if pod.Spec.NodeName != p.NodeID {
+		return false, fmt.Sprintf("pod %s/%s is scheduled to node %q, not this node %q", namespace, name, pod.Spec.NodeName, p.NodeID)
+	}
+
+	return true, ""
+}
@@ -0,0 +1,117 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precheck
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func Test_Pod(t *testing.T) {
+	meta := metadata.Metadata{
+		VolumeID: "vol-id",
+		VolumeContext: map[string]string{
+			"csi.storage.k8s.io/pod.namespace":       "my-namespace",
+			"csi.storage.k8s.io/pod.name":            "my-pod",
+			"csi.storage.k8s.io/pod.uid":             "my-uid",
+			"csi.storage.k8s.io/serviceAccount.name": "my-sa",
+		},
+	}
+
+	podWith := func(uid, sa, node string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", Name: "my-pod", UID: types.UID(uid)},
+			Spec:       corev1.PodSpec{ServiceAccountName: sa, NodeName: node},
+		}
+	}
+
+	tests := map[string]struct {
+		objects   []runtime.Object
+		forbidden bool
+		meta      metadata.Metadata
+		expReady  bool
+		expReason string
+	}{
+		"pod matching the volume context on this node should be ready": {
+			objects:  []runtime.Object{podWith("my-uid", "my-sa", "my-node")},
+			meta:     meta,
+			expReady: true,
+		},
+		"missing pod information should not be ready": {
+			meta:      metadata.Metadata{VolumeID: "vol-id"},
+			expReady:  false,
+			expReason: "pod name and namespace missing from volume context, cannot verify pod",
+		},
+		"pod which does not exist should not be ready": {
+			meta:      meta,
+			expReady:  false,
+			expReason: `failed to verify pod my-namespace/my-pod: pods "my-pod" not found`,
+		},
+		"if forbidden from getting pods, should not be ready": {
+			objects:   []runtime.Object{podWith("my-uid", "my-sa", "my-node")},
+			forbidden: true,
+			meta:      meta,
+			expReady:  false,
+			expReason: `failed to verify pod my-namespace/my-pod: pods "my-pod" is forbidden: access denied`,
+		},
+		"pod with a different UID should not be ready": {
+			objects:   []runtime.Object{podWith("other-uid", "my-sa", "my-node")},
+			meta:      meta,
+			expReady:  false,
+			expReason: `pod my-namespace/my-pod has UID "other-uid", but volume context has "my-uid"`,
+		},
+		"pod with a different service account should not be ready": {
+			objects:   []runtime.Object{podWith("my-uid", "other-sa", "my-node")},
+			meta:      meta,
+			expReady:  false,
+			expReason: `pod my-namespace/my-pod has service account "other-sa", but volume context has "my-sa"`,
+		},
+		"pod scheduled to another node should not be ready": {
+			objects:   []runtime.Object{podWith("my-uid", "my-sa", "other-node")},
+			meta:      meta,
+			expReady:  false,
+			expReason: `pod my-namespace/my-pod is scheduled to node "other-node", not this node "my-node"`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(test.objects...)
+			if test.forbidden {
+				client.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "my-pod", errors.New("access denied"))
+				})
+			}
+
+			check := &Pod{Client: client, NodeID: "my-node"}
+			ready, reason := check.ReadyToRequest(test.meta)
+			assert.Equal(t, test.expReady, ready)
+			assert.Equal(t, test.expReason, reason)
+		})
+	}
+}
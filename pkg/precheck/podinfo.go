@@ -0,0 +1,49 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precheck
+
+import (
+	"fmt"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+
+	"github.com/cert-manager/csi-driver/pkg/apis/validation"
+)
+
+// PodInfo wraps a storage backend to reject volumes whose volume context is
+// missing pod information they need, which happens when the CSIDriver object
+// does not have podInfoOnMount set. Rejecting the volume at registration
+// fails the mount with guidance for the operator, rather than with a
+// confusing error from templating or issuance.
+type PodInfo struct {
+	storage.Interface
+
+	// RequiredKeys are volume context keys which every volume must have,
+	// such as those needed by driver wide checks.
+	RequiredKeys []string
+}
+
+// RegisterMetadata registers the volume with the storage backend, if its
+// volume context holds the pod information it needs.
+func (p *PodInfo) RegisterMetadata(meta metadata.Metadata) (bool, error) {
+	if el := validation.ValidatePodInfo(meta.VolumeContext, p.RequiredKeys...); len(el) > 0 {
+		return false, fmt.Errorf("volume %q cannot be published: %w", meta.VolumeID, el.ToAggregate())
+	}
+
+	return p.Interface.RegisterMetadata(meta)
+}
@@ -0,0 +1,85 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precheck
+
+import (
+	"testing"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_PodInfo(t *testing.T) {
+	tests := map[string]struct {
+		volumeContext map[string]string
+		requiredKeys  []string
+		expErr        bool
+	}{
+		"volume with pod information should be registered": {
+			volumeContext: map[string]string{
+				"csi.cert-manager.io/issuer-name":  "ca-issuer",
+				"csi.cert-manager.io/dns-names":    "${POD_NAME}.svc",
+				"csi.storage.k8s.io/pod.name":      "my-pod",
+				"csi.storage.k8s.io/pod.namespace": "my-namespace",
+			},
+			expErr: false,
+		},
+		"volume without pod information should be rejected": {
+			volumeContext: map[string]string{
+				"csi.cert-manager.io/issuer-name": "ca-issuer",
+			},
+			expErr: true,
+		},
+		"volume missing a templated pod field should be rejected": {
+			volumeContext: map[string]string{
+				"csi.cert-manager.io/issuer-name":  "ca-issuer",
+				"csi.cert-manager.io/dns-names":    "${POD_NAME}.svc",
+				"csi.storage.k8s.io/pod.namespace": "my-namespace",
+			},
+			expErr: true,
+		},
+		"volume missing a required key should be rejected": {
+			volumeContext: map[string]string{
+				"csi.cert-manager.io/issuer-name":  "ca-issuer",
+				"csi.storage.k8s.io/pod.namespace": "my-namespace",
+			},
+			requiredKeys: []string{"csi.storage.k8s.io/pod.uid"},
+			expErr:       true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			backend := storage.NewMemoryFS()
+			p := &PodInfo{Interface: backend, RequiredKeys: test.requiredKeys}
+
+			registered, err := p.RegisterMetadata(metadata.Metadata{VolumeID: "vol-id", VolumeContext: test.volumeContext})
+			assert.Equal(t, test.expErr, err != nil, "%v", err)
+			assert.Equal(t, !test.expErr, registered)
+
+			ids, err := backend.ListVolumes()
+			require.NoError(t, err)
+			if test.expErr {
+				assert.Empty(t, ids)
+			} else {
+				assert.Equal(t, []string{"vol-id"}, ids)
+			}
+		})
+	}
+}
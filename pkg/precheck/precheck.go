@@ -0,0 +1,44 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package precheck contains checks that are run before the driver requests a
+// certificate for a volume. A failing check prevents the request from being
+// created, and its reason is surfaced as the NodePublishVolume error.
+package precheck
+
+import (
+	"time"
+
+	"github.com/cert-manager/csi-lib/manager"
+	"github.com/cert-manager/csi-lib/metadata"
+)
+
+// apiTimeout is the timeout for API calls made by checks.
+const apiTimeout = time.Second * 10
+
+// All returns a ReadyToRequestFunc which is ready only when all of the given
+// checks are ready. The reason of the first check which is not ready is
+// returned.
+func All(checks ...manager.ReadyToRequestFunc) manager.ReadyToRequestFunc {
+	return func(meta metadata.Metadata) (bool, string) {
+		for _, check := range checks {
+			if ready, reason := check(meta); !ready {
+				return false, reason
+			}
+		}
+		return true, ""
+	}
+}
@@ -0,0 +1,161 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precheck
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/go-logr/logr"
+	authzv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/clock"
+
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+	"github.com/cert-manager/csi-driver/pkg/volumelog"
+)
+
+const (
+	// rbacAllowedTTL is how long a result permitting the driver to create
+	// CertificateRequests in a namespace is cached for.
+	rbacAllowedTTL = time.Minute * 10
+
+	// rbacDeniedTTL is how long a result denying the driver is cached for.
+	// This is kept short so that fixes to RBAC take effect quickly.
+	rbacDeniedTTL = time.Second * 30
+)
+
+// RBAC checks that the driver is permitted to create CertificateRequests in
+// the namespace of the pod mounting the volume, using a
+// SelfSubjectAccessReview. Results are cached per namespace.
+// If the review itself fails, the check passes, so that issuance is never
+// blocked by a failure to perform the check.
+type RBAC struct {
+	Log    logr.Logger
+	Client kubernetes.Interface
+	Clock  clock.Clock
+
+	lock  sync.Mutex
+	cache map[string]rbacResult
+}
+
+type rbacResult struct {
+	allowed bool
+	reason  string
+	expires time.Time
+}
+
+// LogClusterAccess logs whether the driver is permitted to create
+// CertificateRequests in every namespace. Permission may still be granted in
+// individual namespaces, so a denial is not an error.
+func (r *RBAC) LogClusterAccess(ctx context.Context) {
+	allowed, reason, err := r.review(ctx, metav1.NamespaceAll)
+	switch {
+	case err != nil:
+		r.Log.Error(err, "Failed to check permission to create CertificateRequests")
+	case allowed:
+		r.Log.Info("Driver is permitted to create CertificateRequests in all namespaces")
+	default:
+		r.Log.Info("Driver is not permitted to create CertificateRequests in all namespaces, volumes in namespaces without permission will fail to mount", "reason", reason)
+	}
+}
+
+// ReadyToRequest returns false if the driver is not permitted to create
+// CertificateRequests in the namespace of the pod.
+func (r *RBAC) ReadyToRequest(meta metadata.Metadata) (bool, string) {
+	namespace := meta.VolumeContext[csiapi.K8sVolumeContextKeyPodNamespace]
+	if len(namespace) == 0 {
+		return true, ""
+	}
+
+	result, ok := r.cached(namespace)
+	if !ok {
+		ctx, cancel := context.WithTimeout(context.Background(), apiTimeout)
+		defer cancel()
+
+		allowed, reason, err := r.review(ctx, namespace)
+		if err != nil {
+			volumelog.ForMetadata(r.Log, meta).V(2).Info("Failed to review permission to create CertificateRequests, skipping RBAC check", "namespace", namespace, "error", err.Error())
+			return true, ""
+		}
+		result = r.store(namespace, allowed, reason)
+	}
+
+	if result.allowed {
+		return true, ""
+	}
+
+	msg := fmt.Sprintf("driver is not permitted to create CertificateRequests in namespace %q, grant the driver's service account create on certificaterequests.%s", namespace, cmapi.SchemeGroupVersion.Group)
+	if len(result.reason) > 0 {
+		msg += ": " + result.reason
+	}
+	return false, msg
+}
+
+func (r *RBAC) cached(namespace string) (rbacResult, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	result, ok := r.cache[namespace]
+	if !ok || !r.Clock.Now().Before(result.expires) {
+		return rbacResult{}, false
+	}
+	return result, true
+}
+
+func (r *RBAC) store(namespace string, allowed bool, reason string) rbacResult {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	ttl := rbacDeniedTTL
+	if allowed {
+		ttl = rbacAllowedTTL
+	}
+	result := rbacResult{allowed: allowed, reason: reason, expires: r.Clock.Now().Add(ttl)}
+
+	if r.cache == nil {
+		r.cache = make(map[string]rbacResult)
+	}
+	r.cache[namespace] = result
+
+	return result
+}
+
+// review returns whether the driver may create CertificateRequests in the
+// given namespace, and the reason given by the API server.
+func (r *RBAC) review(ctx context.Context, namespace string) (bool, string, error) {
+	review, err := r.Client.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authzv1.SelfSubjectAccessReview{
+		Spec: authzv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authzv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      "create",
+				Group:     cmapi.SchemeGroupVersion.Group,
+				Resource:  "certificaterequests",
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return false, "", err
+	}
+
+	return review.Status.Allowed, review.Status.Reason, nil
+}
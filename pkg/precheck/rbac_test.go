@@ -0,0 +1,118 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precheck
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	authzv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+// reviewReactor responds to SelfSubjectAccessReviews with the given result,
+// counting the reviews made.
+func reviewReactor(client *fake.Clientset, count *int, allowed bool, err error) {
+	client.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		*count++
+		if err != nil {
+			return true, nil, err
+		}
+		review := action.(k8stesting.CreateAction).GetObject().(*authzv1.SelfSubjectAccessReview).DeepCopy()
+		review.Status = authzv1.SubjectAccessReviewStatus{Allowed: allowed}
+		if !allowed {
+			review.Status.Reason = "no RBAC policy matched"
+		}
+		return true, review, nil
+	})
+}
+
+func Test_RBAC(t *testing.T) {
+	tests := map[string]struct {
+		allowed   bool
+		err       error
+		expReady  bool
+		expReason string
+	}{
+		"allowed should be ready": {
+			allowed:  true,
+			expReady: true,
+		},
+		"denied should not be ready": {
+			allowed:   false,
+			expReady:  false,
+			expReason: `driver is not permitted to create CertificateRequests in namespace "my-namespace", grant the driver's service account create on certificaterequests.cert-manager.io: no RBAC policy matched`,
+		},
+		"failing review should be ready": {
+			err:      errors.New("connection refused"),
+			expReady: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			var count int
+			reviewReactor(client, &count, test.allowed, test.err)
+
+			check := &RBAC{Log: logr.Discard(), Client: client, Clock: clocktesting.NewFakeClock(time.Now())}
+			ready, reason := check.ReadyToRequest(metaForNamespace("my-namespace"))
+			assert.Equal(t, test.expReady, ready)
+			assert.Equal(t, test.expReason, reason)
+		})
+	}
+}
+
+func Test_RBAC_cache(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	var count int
+	reviewReactor(client, &count, false, nil)
+
+	fakeClock := clocktesting.NewFakeClock(time.Now())
+	check := &RBAC{Log: logr.Discard(), Client: client, Clock: fakeClock}
+
+	for range 3 {
+		ready, _ := check.ReadyToRequest(metaForNamespace("my-namespace"))
+		assert.False(t, ready)
+	}
+	assert.Equal(t, 1, count, "expected result to be cached")
+
+	ready, _ := check.ReadyToRequest(metaForNamespace("other-namespace"))
+	assert.False(t, ready)
+	assert.Equal(t, 2, count, "expected results to be cached per namespace")
+
+	fakeClock.Step(rbacDeniedTTL)
+	check.ReadyToRequest(metaForNamespace("my-namespace"))
+	assert.Equal(t, 3, count, "expected denied result to expire")
+}
+
+func Test_RBAC_failureNotCached(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	var count int
+	reviewReactor(client, &count, false, errors.New("connection refused"))
+
+	check := &RBAC{Log: logr.Discard(), Client: client, Clock: clocktesting.NewFakeClock(time.Now())}
+	check.ReadyToRequest(metaForNamespace("my-namespace"))
+	check.ReadyToRequest(metaForNamespace("my-namespace"))
+	assert.Equal(t, 2, count, "expected failed reviews not to be cached")
+}
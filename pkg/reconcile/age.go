@@ -0,0 +1,98 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/utils/clock"
+
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+	"github.com/cert-manager/csi-driver/pkg/metrics"
+)
+
+// CertificateAge periodically records the age of the oldest certificate
+// served by the volumes in the storage backend. Since certificates are
+// replaced on renewal, a value which keeps climbing indicates renewal is
+// failing for at least one volume.
+//
+// Volumes which have never completed issuance have no certificate, and
+// volumes serving their certificate over named pipes cannot be read back, so
+// both are excluded.
+type CertificateAge struct {
+	Log     logr.Logger
+	Store   Store
+	Metrics *metrics.Metrics
+	Clock   clock.Clock
+
+	// Interval is the time waited between each computation.
+	Interval time.Duration
+}
+
+// Run records the oldest certificate age every interval, until the context is
+// cancelled.
+func (c *CertificateAge) Run(ctx context.Context) error {
+	for {
+		if err := c.record(); err != nil {
+			c.Log.Error(err, "Failed to compute oldest certificate age")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.Clock.After(c.Interval):
+		}
+	}
+}
+
+// record computes and records the age of the oldest certificate.
+func (c *CertificateAge) record() error {
+	ids, err := c.Store.ListVolumes()
+	if err != nil {
+		return fmt.Errorf("listing volumes: %w", err)
+	}
+
+	now := c.Clock.Now()
+
+	var oldest time.Duration
+	for _, id := range ids {
+		meta, err := c.Store.ReadMetadata(id)
+		if err != nil {
+			// The volume may have been removed since listing.
+			c.Log.V(4).Info("Failed to read volume metadata", "volume_id", id, "error", err.Error())
+			continue
+		}
+		if meta.NextIssuanceTime == nil || meta.VolumeContext[csiapi.OutputFIFOKey] == "true" {
+			continue
+		}
+
+		cert, err := readCertificate(c.Store, id, meta)
+		if err != nil {
+			c.Log.V(4).Info("Failed to read volume certificate", "volume_id", id, "error", err.Error())
+			continue
+		}
+
+		oldest = max(oldest, now.Sub(cert.NotBefore))
+	}
+
+	c.Metrics.SetOldestCertificateAge(oldest)
+
+	return nil
+}
@@ -0,0 +1,69 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcile
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/cert-manager/csi-driver/pkg/metrics"
+)
+
+func Test_CertificateAge(t *testing.T) {
+	store := newFakeStore()
+	// Certificates are valid for 24h, so these were issued 4h and 12h ago.
+	store.addVolume(t, "vol-new", fakeNow.Add(time.Hour*10), fakeNow.Add(time.Hour*20))
+	store.addVolume(t, "vol-old", fakeNow.Add(time.Hour*2), fakeNow.Add(time.Hour*12))
+
+	// Volumes served over named pipes, and volumes which have never been
+	// issued, should be excluded.
+	store.addVolume(t, "vol-fifo", fakeNow, fakeNow.Add(time.Hour))
+	store.metas["vol-fifo"].VolumeContext["csi.cert-manager.io/output-fifo"] = "true"
+	store.metas["vol-pending"] = metadata.Metadata{VolumeID: "vol-pending"}
+
+	registry := prometheus.NewPedanticRegistry()
+	c := &CertificateAge{
+		Log:     logr.Discard(),
+		Store:   store,
+		Metrics: metrics.New(registry),
+		Clock:   clocktesting.NewFakeClock(fakeNow),
+	}
+	require.NoError(t, c.record())
+
+	expected := `
+# HELP certmanager_csi_oldest_certificate_age_seconds The age of the oldest certificate currently served by a volume managed by the driver. A value which keeps climbing indicates renewal is failing.
+# TYPE certmanager_csi_oldest_certificate_age_seconds gauge
+certmanager_csi_oldest_certificate_age_seconds 43200
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "certmanager_csi_oldest_certificate_age_seconds"))
+
+	// Once the oldest certificate is renewed, the age should drop.
+	store.files["vol-old"]["tls.crt"] = mustCertificatePEM(t, fakeNow.Add(time.Hour*24))
+	require.NoError(t, c.record())
+
+	expected = strings.Replace(expected, "43200", "14400", 1)
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "certmanager_csi_oldest_certificate_age_seconds"))
+}
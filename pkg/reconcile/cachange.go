@@ -0,0 +1,170 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcile
+
+import (
+	"bytes"
+	"crypto"
+	"strings"
+	"sync"
+
+	"github.com/cert-manager/csi-lib/manager"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/go-logr/logr"
+	"k8s.io/utils/clock"
+
+	"github.com/cert-manager/csi-driver/pkg/apis/defaults"
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+	"github.com/cert-manager/csi-driver/pkg/issuerref"
+	"github.com/cert-manager/csi-driver/pkg/keystore/der"
+	"github.com/cert-manager/csi-driver/pkg/volumelog"
+)
+
+// CAChange reissues the volumes of an issuer once its CA is seen to rotate,
+// rather than leaving them serving the previous CA until their certificates
+// are next renewed.
+//
+// A rotation is seen when the CA returned in the CertificateRequest status
+// for a volume differs from the CA file currently written to that volume.
+// Every other volume of the same issuer whose CA file differs from the new CA
+// is then scheduled for immediate renewal, which rewrites all of its files,
+// including the CA, and resets its renewal time. Volumes of a ClusterIssuer
+// are matched across namespaces, and those of any other issuer within their
+// namespace. Volumes which have not yet been issued a certificate, or which
+// are already due for renewal, are skipped.
+type CAChange struct {
+	Backend Backend
+
+	Log   logr.Logger
+	Clock clock.Clock
+
+	lock sync.Mutex
+	// rotated holds the last CA each issuer was seen rotating to, so that the
+	// volumes of an issuer are only checked once per rotation.
+	rotated map[string][]byte
+}
+
+// InstrumentWriteKeypair wraps the given function to reissue the other
+// volumes of the issuer if the CA written differs from the CA the volume had
+// on disk.
+func (c *CAChange) InstrumentWriteKeypair(f manager.WriteKeypairFunc) manager.WriteKeypairFunc {
+	return func(meta metadata.Metadata, key crypto.PrivateKey, chain []byte, ca []byte) error {
+		attrs, err := defaults.SetDefaultAttributes(meta.VolumeContext)
+		if err != nil {
+			return f(meta, key, chain, ca)
+		}
+		previous, readErr := c.Backend.ReadFile(meta.VolumeID, attrs[csiapi.CAFileKey])
+
+		if err := f(meta, key, chain, ca); err != nil {
+			return err
+		}
+		if readErr != nil || len(ca) == 0 || bytes.Equal(previous, caFile(attrs, ca)) {
+			return nil
+		}
+
+		issuer, ok := caIssuerKey(attrs)
+		if !ok {
+			return nil
+		}
+
+		c.lock.Lock()
+		if c.rotated == nil {
+			c.rotated = make(map[string][]byte)
+		}
+		seen := bytes.Equal(c.rotated[issuer], ca)
+		c.rotated[issuer] = ca
+		c.lock.Unlock()
+		if seen {
+			return nil
+		}
+
+		volumelog.ForMetadata(c.Log, meta).Info("CA of issuer has changed, reissuing volumes with the previous CA", "issuer", issuer)
+		c.reissueStale(issuer, meta.VolumeID, ca)
+		return nil
+	}
+}
+
+// reissueStale schedules every volume of the given issuer, other than the
+// given volume, whose CA file differs from ca for immediate renewal.
+func (c *CAChange) reissueStale(issuer, volumeID string, ca []byte) {
+	volumeIDs, err := c.Backend.ListVolumes()
+	if err != nil {
+		c.Log.Error(err, "Failed to list volumes to reissue after CA change", "issuer", issuer)
+		return
+	}
+
+	now := c.Clock.Now()
+	for _, id := range volumeIDs {
+		if id == volumeID {
+			continue
+		}
+		log := c.Log.WithValues("volume_id", id, "issuer", issuer)
+
+		meta, err := c.Backend.ReadMetadata(id)
+		if err != nil {
+			log.Error(err, "Failed to read metadata of volume to check its CA")
+			continue
+		}
+		if meta.NextIssuanceTime == nil || meta.NextIssuanceTime.IsZero() || !meta.NextIssuanceTime.After(now) {
+			continue
+		}
+		attrs, err := defaults.SetDefaultAttributes(meta.VolumeContext)
+		if err != nil {
+			continue
+		}
+		if key, ok := caIssuerKey(attrs); !ok || key != issuer {
+			continue
+		}
+
+		current, err := c.Backend.ReadFile(id, attrs[csiapi.CAFileKey])
+		if err != nil || bytes.Equal(current, caFile(attrs, ca)) {
+			continue
+		}
+
+		next := now
+		meta.NextIssuanceTime = &next
+		if err := c.Backend.WriteMetadata(id, meta); err != nil {
+			log.Error(err, "Failed to write metadata to reissue volume after CA change")
+			continue
+		}
+		log.Info("Volume has the previous CA of its issuer, reissuing")
+	}
+}
+
+// caFile returns the contents of the CA file of a volume with the given
+// attributes holding the given PEM encoded CA.
+func caFile(attrs map[string]string, ca []byte) []byte {
+	data, err := der.EncodeCA(attrs, ca)
+	if err != nil {
+		return ca
+	}
+	return data
+}
+
+// caIssuerKey returns the key under which the CA of the issuer of a volume
+// with the given attributes is tracked. ClusterIssuers share a CA across
+// namespaces, so are keyed without one.
+func caIssuerKey(attrs map[string]string) (string, bool) {
+	refs, err := issuerref.ForAttributes(attrs)
+	if err != nil {
+		return "", false
+	}
+	if strings.HasSuffix(attrs[csiapi.IssuerKindKey], "ClusterIssuer") {
+		return refs[1], true
+	}
+	return refs[0], true
+}
@@ -0,0 +1,122 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcile
+
+import (
+	"crypto"
+	"testing"
+	"time"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+)
+
+func Test_CAChange(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	renewal := now.Add(time.Hour)
+
+	type volume struct {
+		namespace  string
+		issuerKind string
+		ca         string
+		// issued is false for volumes which have not yet been issued a
+		// certificate.
+		issued bool
+	}
+
+	tests := map[string]struct {
+		volumes    map[string]volume
+		writtenCA  string
+		expReissue []string
+	}{
+		"an unchanged CA should not reissue any volume": {
+			volumes: map[string]volume{
+				"vol-1": {namespace: "ns-1", ca: "ca-1", issued: true},
+				"vol-2": {namespace: "ns-1", ca: "ca-1", issued: true},
+			},
+			writtenCA:  "ca-1",
+			expReissue: nil,
+		},
+		"a changed CA of an Issuer should reissue stale volumes in its namespace": {
+			volumes: map[string]volume{
+				"vol-1": {namespace: "ns-1", ca: "ca-1", issued: true},
+				"vol-2": {namespace: "ns-1", ca: "ca-1", issued: true},
+				"vol-3": {namespace: "ns-1", ca: "ca-2", issued: true},
+				"vol-4": {namespace: "ns-1", ca: "ca-1", issued: false},
+				"vol-5": {namespace: "ns-2", ca: "ca-1", issued: true},
+			},
+			writtenCA:  "ca-2",
+			expReissue: []string{"vol-2"},
+		},
+		"a changed CA of a ClusterIssuer should reissue stale volumes in every namespace": {
+			volumes: map[string]volume{
+				"vol-1": {namespace: "ns-1", issuerKind: "ClusterIssuer", ca: "ca-1", issued: true},
+				"vol-2": {namespace: "ns-2", issuerKind: "ClusterIssuer", ca: "ca-1", issued: true},
+				"vol-3": {namespace: "ns-1", ca: "ca-1", issued: true},
+			},
+			writtenCA:  "ca-2",
+			expReissue: []string{"vol-2"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			backend := memoryBackend{storage.NewMemoryFS()}
+			for id, vol := range test.volumes {
+				meta := metadata.Metadata{VolumeID: id, VolumeContext: map[string]string{
+					csiapi.IssuerNameKey:                   "ca-issuer",
+					csiapi.K8sVolumeContextKeyPodNamespace: vol.namespace,
+				}}
+				if len(vol.issuerKind) > 0 {
+					meta.VolumeContext[csiapi.IssuerKindKey] = vol.issuerKind
+				}
+				if vol.issued {
+					next := renewal
+					meta.NextIssuanceTime = &next
+				}
+				_, err := backend.RegisterMetadata(meta)
+				require.NoError(t, err)
+				require.NoError(t, backend.WriteFiles(meta, map[string][]byte{"ca.crt": []byte(vol.ca)}))
+			}
+
+			c := &CAChange{Backend: backend, Log: logr.Discard(), Clock: clocktesting.NewFakeClock(now)}
+			writeKeypair := c.InstrumentWriteKeypair(func(meta metadata.Metadata, _ crypto.PrivateKey, _, ca []byte) error {
+				return backend.WriteFiles(meta, map[string][]byte{"ca.crt": ca})
+			})
+
+			meta, err := backend.ReadMetadata("vol-1")
+			require.NoError(t, err)
+			require.NoError(t, writeKeypair(meta, nil, nil, []byte(test.writtenCA)))
+
+			var reissued []string
+			for id := range test.volumes {
+				meta, err := backend.ReadMetadata(id)
+				require.NoError(t, err)
+				if meta.NextIssuanceTime != nil && meta.NextIssuanceTime.Equal(now) {
+					reissued = append(reissued, id)
+				}
+			}
+			assert.ElementsMatch(t, test.expReissue, reissued)
+		})
+	}
+}
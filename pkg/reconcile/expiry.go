@@ -0,0 +1,123 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/utils/clock"
+
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+	"github.com/cert-manager/csi-driver/pkg/metrics"
+)
+
+// ExpiryWatchdog periodically checks the certificates served by the volumes
+// in the storage backend, and warns about those which are within Threshold of
+// expiring. Certificates are replaced on renewal, so any such certificate has
+// not been renewed in time. The watchdog reads the storage backend directly
+// rather than going through the manager, so that it keeps working if renewal
+// has stopped altogether.
+//
+// Warnings escalate as expiry approaches: a certificate within the threshold
+// is logged as a warning, one within a quarter of the threshold is logged as
+// an error, and one which has expired is logged as an error on every check.
+//
+// Volumes which have never completed issuance have no certificate, and
+// volumes serving their certificate over named pipes cannot be read back, so
+// both are excluded.
+type ExpiryWatchdog struct {
+	Log     logr.Logger
+	Store   Store
+	Metrics *metrics.Metrics
+	Clock   clock.Clock
+
+	// Threshold is the time before expiry from which a certificate which has
+	// not been renewed is warned about.
+	Threshold time.Duration
+
+	// Interval is the time waited between each check.
+	Interval time.Duration
+}
+
+// Run checks the certificates of all volumes every interval, until the
+// context is cancelled.
+func (e *ExpiryWatchdog) Run(ctx context.Context) error {
+	for {
+		if err := e.check(); err != nil {
+			e.Log.Error(err, "Failed to check certificates for expiry")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-e.Clock.After(e.Interval):
+		}
+	}
+}
+
+// check warns about the certificates within the threshold of expiring, and
+// records them in the metrics.
+func (e *ExpiryWatchdog) check() error {
+	ids, err := e.Store.ListVolumes()
+	if err != nil {
+		return fmt.Errorf("listing volumes: %w", err)
+	}
+
+	now := e.Clock.Now()
+
+	var nearExpiry []string
+	for _, id := range ids {
+		meta, err := e.Store.ReadMetadata(id)
+		if err != nil {
+			// The volume may have been removed since listing.
+			e.Log.V(4).Info("Failed to read volume metadata", "volume_id", id, "error", err.Error())
+			continue
+		}
+		if meta.NextIssuanceTime == nil || meta.VolumeContext[csiapi.OutputFIFOKey] == "true" {
+			continue
+		}
+
+		cert, err := readCertificate(e.Store, id, meta)
+		if err != nil {
+			e.Log.V(4).Info("Failed to read volume certificate", "volume_id", id, "error", err.Error())
+			continue
+		}
+
+		remaining := cert.NotAfter.Sub(now)
+		if remaining > e.Threshold {
+			continue
+		}
+		nearExpiry = append(nearExpiry, id)
+
+		log := e.Log.WithValues("volume_id", id, "not_after", cert.NotAfter, "next_issuance_time", meta.NextIssuanceTime)
+		switch {
+		case remaining <= 0:
+			log.Error(nil, "Certificate has expired without being renewed, check that renewal is working")
+		case remaining <= e.Threshold/4:
+			log.Error(nil, "Certificate is about to expire and has not been renewed, check that renewal is working", "expires_in", remaining)
+		default:
+			log.Info("WARNING: certificate is close to expiry and has not been renewed", "expires_in", remaining)
+		}
+	}
+
+	e.Metrics.SetNearExpiry(nearExpiry)
+
+	return nil
+}
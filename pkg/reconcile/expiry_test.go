@@ -0,0 +1,88 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcile
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/cert-manager/csi-driver/pkg/metrics"
+)
+
+func Test_ExpiryWatchdog(t *testing.T) {
+	store := newFakeStore()
+	// With a threshold of 8h, vol-warn expires within the threshold, vol-error
+	// within a quarter of it, and vol-expired has already expired.
+	store.addVolume(t, "vol-ok", fakeNow.Add(time.Hour*6), fakeNow.Add(time.Hour*10))
+	store.addVolume(t, "vol-warn", fakeNow.Add(-time.Hour), fakeNow.Add(time.Hour*4))
+	store.addVolume(t, "vol-error", fakeNow.Add(-time.Hour), fakeNow.Add(time.Hour))
+	store.addVolume(t, "vol-expired", fakeNow.Add(-time.Hour*4), fakeNow.Add(-time.Hour))
+
+	// Volumes served over named pipes should be excluded.
+	store.addVolume(t, "vol-fifo", fakeNow, fakeNow.Add(time.Hour))
+	store.metas["vol-fifo"].VolumeContext["csi.cert-manager.io/output-fifo"] = "true"
+
+	lines := make(map[string]string)
+	log := funcr.New(func(_, args string) {
+		for _, id := range []string{"vol-ok", "vol-warn", "vol-error", "vol-expired", "vol-fifo"} {
+			if strings.Contains(args, `"volume_id"="`+id+`"`) {
+				lines[id] = args
+			}
+		}
+	}, funcr.Options{})
+
+	registry := prometheus.NewPedanticRegistry()
+	e := &ExpiryWatchdog{
+		Log:       log,
+		Store:     store,
+		Metrics:   metrics.New(registry),
+		Clock:     clocktesting.NewFakeClock(fakeNow),
+		Threshold: time.Hour * 8,
+	}
+	require.NoError(t, e.check())
+
+	assert.NotContains(t, lines, "vol-ok")
+	assert.NotContains(t, lines, "vol-fifo")
+	assert.Contains(t, lines["vol-warn"], "WARNING: certificate is close to expiry")
+	assert.Contains(t, lines["vol-error"], "Certificate is about to expire")
+	assert.Contains(t, lines["vol-expired"], "Certificate has expired")
+
+	expected := `
+# HELP certmanager_csi_certificate_near_expiry The volumes whose certificate is within the expiry warning threshold without having been renewed. The value is always 1.
+# TYPE certmanager_csi_certificate_near_expiry gauge
+certmanager_csi_certificate_near_expiry{volume_id="vol-error"} 1
+certmanager_csi_certificate_near_expiry{volume_id="vol-expired"} 1
+certmanager_csi_certificate_near_expiry{volume_id="vol-warn"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "certmanager_csi_certificate_near_expiry"))
+
+	// Once renewed, a volume should no longer be recorded.
+	store.files["vol-warn"]["tls.crt"] = mustCertificatePEM(t, fakeNow.Add(time.Hour*24))
+	require.NoError(t, e.check())
+
+	expected = strings.Replace(expected, `certmanager_csi_certificate_near_expiry{volume_id="vol-warn"} 1
+`, "", 1)
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "certmanager_csi_certificate_near_expiry"))
+}
@@ -0,0 +1,134 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcile
+
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/go-logr/logr"
+	"k8s.io/utils/clock"
+
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+	"github.com/cert-manager/csi-driver/pkg/filestore"
+	"github.com/cert-manager/csi-driver/pkg/volumelog"
+)
+
+// Backend is a storage backend which can also read back the files of a
+// volume.
+type Backend interface {
+	storage.Interface
+
+	// ReadFile reads a single named file from the data directory of the
+	// given volume.
+	ReadFile(volumeID, name string) ([]byte, error)
+}
+
+// Republish wraps a storage backend to check the certificate of a volume
+// which is published again while already registered, such as when the
+// kubelet restarts.
+//
+// csi-lib treats a republished volume which is already mounted as published,
+// without reading its files. If the certificate of such a volume is missing
+// or cannot be decoded, registration fails instead. csi-lib then unmounts and
+// removes the volume, so that the kubelet's retry provisions it from scratch.
+// Volumes which have not yet completed issuance, and volumes serving their
+// certificate over named pipes, are not checked.
+//
+// If the volume sets csi.cert-manager.io/reissue-on-san-drift, the SANs
+// requested from the volume context it is published with are compared with
+// those of the certificate in the volume, which records the SANs used at
+// issuance. If they differ, the volume is scheduled for immediate renewal.
+type Republish struct {
+	Backend
+
+	Log   logr.Logger
+	Clock clock.Clock
+}
+
+// RegisterMetadata registers the volume with the storage backend. If the
+// volume was already registered, its certificate is checked.
+func (r *Republish) RegisterMetadata(meta metadata.Metadata) (bool, error) {
+	// Read the metadata before registering, since the backend replaces the
+	// volume context of an existing volume if it has changed.
+	existing, readErr := r.Backend.ReadMetadata(meta.VolumeID)
+
+	registered, err := r.Backend.RegisterMetadata(meta)
+	if err != nil || readErr != nil {
+		return registered, err
+	}
+	if existing.NextIssuanceTime == nil || existing.NextIssuanceTime.IsZero() || existing.VolumeContext[csiapi.OutputFIFOKey] == "true" {
+		return registered, nil
+	}
+
+	crt, err := readCertificate(r.Backend, meta.VolumeID, existing)
+	if err != nil {
+		// A changed volume context is registered as new, so that its
+		// certificate is only checked if the context is unchanged.
+		if registered {
+			return registered, nil
+		}
+		volumelog.ForMetadata(r.Log, meta).Info("Certificate of republished volume is missing or invalid, re-provisioning", "error", err.Error())
+		return false, fmt.Errorf("certificate of already published volume is missing or invalid, volume will be re-provisioned: %w", err)
+	}
+
+	if meta.VolumeContext[csiapi.ReissueOnSANDriftKey] == "true" {
+		if err := r.reissueOnSANDrift(meta, crt); err != nil {
+			return registered, err
+		}
+	}
+
+	return registered, nil
+}
+
+// reissueOnSANDrift schedules the volume for immediate renewal if the SANs
+// requested from the given metadata differ from those of the certificate.
+// Extra SANs added by the issuer are only drift if the volume requires exact
+// SANs.
+func (r *Republish) reissueOnSANDrift(meta metadata.Metadata, crt *x509.Certificate) error {
+	log := volumelog.ForMetadata(r.Log, meta)
+
+	exact := meta.VolumeContext[csiapi.RequireExactSANsKey] == csiapi.RequireSANsExact
+	drift, err := filestore.SANDrift(meta, crt, exact)
+	if err != nil {
+		log.Error(err, "Failed to compare SANs of republished volume, not checking for drift")
+		return nil
+	}
+	if len(drift) == 0 {
+		return nil
+	}
+
+	current, err := r.Backend.ReadMetadata(meta.VolumeID)
+	if err != nil {
+		return fmt.Errorf("reading metadata to reissue volume with drifted SANs: %w", err)
+	}
+
+	now := time.Now()
+	if r.Clock != nil {
+		now = r.Clock.Now()
+	}
+	current.NextIssuanceTime = &now
+	if err := r.Backend.WriteMetadata(meta.VolumeID, current); err != nil {
+		return fmt.Errorf("writing metadata to reissue volume with drifted SANs: %w", err)
+	}
+
+	log.Info("SANs of republished volume have drifted from its certificate, reissuing", "drifted_sans", drift)
+	return nil
+}
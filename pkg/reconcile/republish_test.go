@@ -0,0 +1,214 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcile
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/cert-manager/csi-lib/manager"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	testdriver "github.com/cert-manager/csi-lib/test/driver"
+	testutil "github.com/cert-manager/csi-lib/test/util"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/mount-utils"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+// memoryBackend adds ReadFile to the in-memory storage backend.
+type memoryBackend struct {
+	*storage.MemoryFS
+}
+
+func (m memoryBackend) ReadFile(volumeID, name string) ([]byte, error) {
+	files, err := m.ReadFiles(volumeID)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := files[name]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return data, nil
+}
+
+func Test_Republish(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	backend := memoryBackend{storage.NewMemoryFS()}
+	mounter := mount.NewFakeMounter(nil)
+	opts, cl, stop := testdriver.Run(t, testdriver.Options{
+		Store:   &Republish{Backend: backend, Log: logr.Discard()},
+		Mounter: mounter,
+		GenerateRequest: func(metadata.Metadata) (*manager.CertificateRequestBundle, error) {
+			return &manager.CertificateRequestBundle{Namespace: "test-ns"}, nil
+		},
+		WriteKeypair: func(meta metadata.Metadata, _ crypto.PrivateKey, chain []byte, _ []byte) error {
+			if err := backend.WriteFiles(meta, map[string][]byte{"tls.crt": chain}); err != nil {
+				return err
+			}
+			nextIssuanceTime := time.Now().Add(time.Hour)
+			meta.NextIssuanceTime = &nextIssuanceTime
+			return backend.WriteMetadata(meta.VolumeID, meta)
+		},
+	})
+	defer stop()
+
+	go testutil.IssueAllRequests(ctx, t, opts.Client, "test-ns", mustCertificatePEM(t, time.Now().Add(time.Hour*2)), []byte("ca"))
+
+	req := &csi.NodePublishVolumeRequest{
+		VolumeId: "vol-id",
+		VolumeContext: map[string]string{
+			"csi.storage.k8s.io/ephemeral":     "true",
+			"csi.storage.k8s.io/pod.name":      "my-pod",
+			"csi.storage.k8s.io/pod.namespace": "my-namespace",
+		},
+		TargetPath: t.TempDir(),
+		Readonly:   true,
+	}
+
+	requests := func() int {
+		reqs, err := opts.Client.CertmanagerV1().CertificateRequests("test-ns").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		return len(reqs.Items)
+	}
+
+	_, err := cl.NodePublishVolume(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, 1, requests())
+
+	// Publishing an already mounted volume with a valid certificate, such as
+	// after a kubelet restart, succeeds without re-provisioning or mounting
+	// again.
+	_, err = cl.NodePublishVolume(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, 1, requests())
+	mountPoints, err := mounter.List()
+	require.NoError(t, err)
+	assert.Len(t, mountPoints, 1)
+
+	// Publishing an already mounted volume with an invalid certificate fails
+	// and unmounts the volume, so that the retry re-provisions it.
+	require.NoError(t, backend.WriteFiles(metadata.Metadata{VolumeID: "vol-id"}, map[string][]byte{"tls.crt": []byte("not a certificate")}))
+	_, err = cl.NodePublishVolume(ctx, req)
+	assert.ErrorContains(t, err, "certificate of already published volume is missing or invalid")
+	mountPoints, err = mounter.List()
+	require.NoError(t, err)
+	assert.Empty(t, mountPoints)
+
+	_, err = cl.NodePublishVolume(ctx, req)
+	require.NoError(t, err)
+	mountPoints, err = mounter.List()
+	require.NoError(t, err)
+	assert.Len(t, mountPoints, 1)
+	meta, err := backend.ReadMetadata("vol-id")
+	require.NoError(t, err)
+	_, err = readCertificate(backend, "vol-id", meta)
+	assert.NoError(t, err, "expected volume to be re-provisioned with a valid certificate")
+}
+
+func Test_Republish_sanDrift(t *testing.T) {
+	pk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    fakeNow.Add(-time.Hour),
+		NotAfter:     fakeNow.Add(time.Hour),
+		DNSNames:     []string{"my-pod.my-namespace.svc"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pk.Public(), pk)
+	require.NoError(t, err)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	volumeContext := func(podName, drift string) map[string]string {
+		vc := map[string]string{
+			"csi.cert-manager.io/issuer-name":  "ca-issuer",
+			"csi.cert-manager.io/dns-names":    "${POD_NAME}.${POD_NAMESPACE}.svc",
+			"csi.storage.k8s.io/pod.name":      podName,
+			"csi.storage.k8s.io/pod.namespace": "my-namespace",
+		}
+		if len(drift) > 0 {
+			vc["csi.cert-manager.io/reissue-on-san-drift"] = drift
+		}
+		return vc
+	}
+
+	nextIssuanceTime := fakeNow.Add(time.Minute * 30)
+	tests := map[string]struct {
+		volumeContext       map[string]string
+		expNextIssuanceTime time.Time
+	}{
+		"if the SANs are unchanged, expect no reissue": {
+			volumeContext:       volumeContext("my-pod", "true"),
+			expNextIssuanceTime: nextIssuanceTime,
+		},
+		"if the SANs have drifted, expect immediate reissue": {
+			volumeContext:       volumeContext("other-pod", "true"),
+			expNextIssuanceTime: fakeNow,
+		},
+		"if the SANs have drifted but the check is disabled, expect no reissue": {
+			volumeContext:       volumeContext("other-pod", "false"),
+			expNextIssuanceTime: nextIssuanceTime,
+		},
+		"if the SANs have drifted but the check is not set, expect no reissue": {
+			volumeContext:       volumeContext("other-pod", ""),
+			expNextIssuanceTime: nextIssuanceTime,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			backend := memoryBackend{storage.NewMemoryFS()}
+			meta := metadata.Metadata{
+				VolumeID:         "vol-id",
+				TargetPath:       "/target-path",
+				NextIssuanceTime: &nextIssuanceTime,
+				VolumeContext:    volumeContext("my-pod", test.volumeContext["csi.cert-manager.io/reissue-on-san-drift"]),
+			}
+			_, err := backend.RegisterMetadata(meta)
+			require.NoError(t, err)
+			require.NoError(t, backend.WriteFiles(meta, map[string][]byte{"tls.crt": certPEM}))
+
+			r := &Republish{Backend: backend, Log: logr.Discard(), Clock: clocktesting.NewFakeClock(fakeNow)}
+			// The in-memory backend replaces the whole metadata of a volume
+			// whose context changed, unlike the filesystem backend which
+			// keeps its renewal time, so pass the renewal time through.
+			_, err = r.RegisterMetadata(metadata.Metadata{VolumeID: "vol-id", TargetPath: "/target-path", NextIssuanceTime: &nextIssuanceTime, VolumeContext: test.volumeContext})
+			require.NoError(t, err)
+
+			got, err := backend.ReadMetadata("vol-id")
+			require.NoError(t, err)
+			require.NotNil(t, got.NextIssuanceTime)
+			assert.True(t, test.expNextIssuanceTime.Equal(*got.NextIssuanceTime), "expected %s, got %s", test.expNextIssuanceTime, got.NextIssuanceTime)
+			assert.Equal(t, test.volumeContext, got.VolumeContext)
+		})
+	}
+}
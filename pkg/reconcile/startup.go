@@ -0,0 +1,347 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcile
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cert-manager/cert-manager/pkg/util/pki"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/go-logr/logr"
+	"golang.org/x/sync/errgroup"
+	"k8s.io/utils/clock"
+
+	"github.com/cert-manager/csi-driver/pkg/apis/defaults"
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+	"github.com/cert-manager/csi-driver/pkg/metrics"
+)
+
+// Store is the storage backend that existing volumes are read from.
+type Store interface {
+	storage.MetadataReader
+
+	// ReadFile reads a single named file from the data directory of the
+	// given volume.
+	ReadFile(volumeID, name string) ([]byte, error)
+
+	// WriteMetadata writes the metadata file for the given volume.
+	WriteMetadata(volumeID string, meta metadata.Metadata) error
+
+	// PathForVolume returns the data directory of the given volume.
+	PathForVolume(volumeID string) string
+}
+
+const (
+	// dataDirName is the symlink in a volume's data directory which points to
+	// the directory holding the current set of files.
+	dataDirName = "..data"
+
+	// newDataDirName is the symlink created while the set of files is
+	// swapped, before it is renamed over dataDirName.
+	newDataDirName = "..data_tmp"
+)
+
+// VolumeManager registers volumes for management.
+type VolumeManager interface {
+	ManageVolume(volumeID string) bool
+}
+
+// MetadataReaderForManager wraps the given MetadataReader so that it can be
+// passed to the csi-lib manager without the manager registering every
+// existing volume at once when it is constructed. Existing volumes are
+// instead registered by the Startup reconciler.
+func MetadataReaderForManager(r storage.MetadataReader) storage.MetadataReader {
+	return deferredMetadataReader{r}
+}
+
+type deferredMetadataReader struct {
+	storage.MetadataReader
+}
+
+// ListVolumes returns no volumes, since the csi-lib manager only lists
+// volumes on construction.
+func (deferredMetadataReader) ListVolumes() ([]string, error) {
+	return nil, nil
+}
+
+// Startup registers volumes which exist in the storage backend when the
+// driver starts for management. Volumes are registered in batches to smooth
+// out the load on the API server and issuers when a driver restarts on a node
+// hosting many volumes.
+type Startup struct {
+	Log     logr.Logger
+	Store   Store
+	Manager VolumeManager
+	Metrics *metrics.Metrics
+	Clock   clock.Clock
+
+	// BatchSize is the number of volumes registered at once. A value of 0
+	// registers all volumes in a single batch.
+	BatchSize int
+
+	// BatchDelay is the time waited between registering each batch.
+	BatchDelay time.Duration
+
+	// ReadConcurrency is the number of existing volumes which are read at
+	// once. A value of 0 reads volumes one at a time.
+	ReadConcurrency int
+
+	// MaxReuseAge is the maximum age of an existing certificate which will be
+	// reused. Volumes holding a certificate issued longer ago than this are
+	// re-issued as soon as they are registered, even if the certificate is
+	// still valid. A value of 0 reuses certificates until they are due for
+	// renewal.
+	MaxReuseAge time.Duration
+}
+
+// volume is an existing volume which is due to be registered.
+type volume struct {
+	id   string
+	meta metadata.Metadata
+
+	// expired is true if the certificate in the volume has expired, or could
+	// not be read.
+	expired bool
+
+	// stale is true if the certificate in the volume is older than the
+	// maximum reuse age.
+	stale bool
+
+	// notAfter is the expiry of the certificate in the volume, if it could be
+	// read.
+	notAfter time.Time
+
+	// interrupted is true if a write to the volume was interrupted, such as
+	// by the previous driver being terminated mid-renewal.
+	interrupted bool
+}
+
+// Run registers all existing volumes for management, returning once all
+// volumes have been registered or the context is cancelled.
+func (s *Startup) Run(ctx context.Context) error {
+	vols, err := s.existingVolumes()
+	if err != nil {
+		return err
+	}
+
+	batchSize := s.BatchSize
+	if batchSize <= 0 {
+		batchSize = len(vols)
+	}
+
+	for i := 0; i < len(vols); i += batchSize {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-s.Clock.After(s.BatchDelay):
+			}
+		}
+
+		end := min(i+batchSize, len(vols))
+		for _, vol := range vols[i:end] {
+			s.Log.Info("Registering existing data directory for management", "volume_id", vol.id, "expired", vol.expired, "stale", vol.stale, "interrupted", vol.interrupted)
+			s.Manager.ManageVolume(vol.id)
+			if s.Metrics != nil {
+				s.Metrics.VolumeRegistered(vol.meta)
+				if !vol.notAfter.IsZero() {
+					s.Metrics.CertificateWritten(vol.meta, vol.notAfter)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// existingVolumes returns the volumes in the store which should be registered
+// for management. Volumes whose certificate has expired are ordered first,
+// followed by volumes in order of their next issuance time. Volumes whose
+// certificate is older than the maximum reuse age have their next issuance
+// time brought forward so that they are re-issued immediately, as do volumes
+// with a write which was interrupted, once what it left behind is removed.
+//
+// Volumes are read concurrently, up to the read concurrency. The errors of
+// every volume which could not be read are returned together.
+func (s *Startup) existingVolumes() ([]volume, error) {
+	ids, err := s.Store.ListVolumes()
+	if err != nil {
+		return nil, fmt.Errorf("listing existing volumes: %w", err)
+	}
+
+	now := s.Clock.Now()
+
+	var (
+		results = make([]*volume, len(ids))
+		errs    = make([]error, len(ids))
+		g       errgroup.Group
+	)
+	g.SetLimit(max(s.ReadConcurrency, 1))
+	for i, id := range ids {
+		g.Go(func() error {
+			results[i], errs[i] = s.existingVolume(id, now)
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	var vols []volume
+	for _, vol := range results {
+		if vol != nil {
+			vols = append(vols, *vol)
+		}
+	}
+
+	sort.SliceStable(vols, func(i, j int) bool {
+		if vols[i].expired != vols[j].expired {
+			return vols[i].expired
+		}
+		return vols[i].meta.NextIssuanceTime.Before(*vols[j].meta.NextIssuanceTime)
+	})
+
+	return vols, nil
+}
+
+// existingVolume reads the existing volume with the given ID. Returns nil if
+// the volume should not be registered for management.
+func (s *Startup) existingVolume(id string, now time.Time) (*volume, error) {
+	meta, err := s.Store.ReadMetadata(id)
+	if err != nil {
+		return nil, fmt.Errorf("reading existing volume metadata %q: %w", id, err)
+	}
+	if meta.NextIssuanceTime == nil {
+		s.Log.Info("Skipping management of volume that has never successfully completed", "volume_id", id)
+		return nil, nil
+	}
+
+	vol := &volume{id: id, meta: meta, expired: true}
+
+	vol.interrupted, err = removeInterruptedWrite(s.Store.PathForVolume(id))
+	if err != nil {
+		return nil, fmt.Errorf("removing interrupted write to existing volume %q: %w", id, err)
+	}
+
+	// Certificates served over named pipes are held in memory only, so must
+	// be re-issued after a restart. Reading the pipe would block.
+	if meta.VolumeContext[csiapi.OutputFIFOKey] == "true" {
+		if now.Before(*meta.NextIssuanceTime) {
+			s.Log.Info("Existing certificate was served over named pipes, re-issuing", "volume_id", id)
+			vol.meta.NextIssuanceTime = &now
+			if err := s.Store.WriteMetadata(id, vol.meta); err != nil {
+				return nil, fmt.Errorf("writing existing volume metadata %q: %w", id, err)
+			}
+		}
+		return vol, nil
+	}
+
+	if cert, err := readCertificate(s.Store, id, meta); err == nil {
+		vol.expired = !now.Before(cert.NotAfter)
+		vol.stale = s.MaxReuseAge > 0 && now.Sub(cert.NotBefore) > s.MaxReuseAge
+		vol.notAfter = cert.NotAfter
+	}
+
+	if vol.stale && !vol.expired && now.Before(*meta.NextIssuanceTime) {
+		s.Log.Info("Existing certificate is older than the maximum reuse age, re-issuing", "volume_id", id)
+		vol.meta.NextIssuanceTime = &now
+		if err := s.Store.WriteMetadata(id, vol.meta); err != nil {
+			return nil, fmt.Errorf("writing existing volume metadata %q: %w", id, err)
+		}
+	}
+
+	// The certificate in the volume is still the one last written in full,
+	// but the renewal which was interrupted must be restarted. The files of
+	// the interrupted write may also be missing their permissions.
+	if vol.interrupted && now.Before(*vol.meta.NextIssuanceTime) {
+		s.Log.Info("Existing volume has an interrupted write, re-issuing", "volume_id", id)
+		vol.meta.NextIssuanceTime = &now
+		if err := s.Store.WriteMetadata(id, vol.meta); err != nil {
+			return nil, fmt.Errorf("writing existing volume metadata %q: %w", id, err)
+		}
+	}
+
+	return vol, nil
+}
+
+// removeInterruptedWrite removes anything left behind in the given data
+// directory by a write which did not complete. Files are written to a new
+// timestamped directory which is then swapped in place of the current one, so
+// an interrupted write leaves the current files intact, but may leave behind
+// the new directory, or the symlink used for the swap. A leftover swap symlink
+// causes every later write to fail. Returns true if anything was removed.
+func removeInterruptedWrite(dir string) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	current, err := os.Readlink(filepath.Join(dir, dataDirName))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+
+	var removed bool
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case name == newDataDirName:
+		case entry.IsDir() && strings.HasPrefix(name, "..") && name != current:
+		default:
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, name)); err != nil {
+			return false, err
+		}
+		removed = true
+	}
+
+	return removed, nil
+}
+
+// readCertificate reads and decodes the certificate written to the volume.
+func readCertificate(store Store, volumeID string, meta metadata.Metadata) (*x509.Certificate, error) {
+	attrs, err := defaults.SetDefaultAttributes(meta.VolumeContext)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := store.ReadFile(volumeID, attrs[csiapi.CertFileKey])
+	if err != nil {
+		return nil, err
+	}
+
+	if attrs[csiapi.EncodingKey] == csiapi.EncodingDER {
+		return x509.ParseCertificate(data)
+	}
+	return pki.DecodeX509CertificateBytes(data)
+}
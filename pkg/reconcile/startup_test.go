@@ -0,0 +1,492 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcile
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+var fakeNow = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// fakeStore is an in-memory Store.
+type fakeStore struct {
+	lock  sync.Mutex
+	metas map[string]metadata.Metadata
+	files map[string]map[string][]byte
+
+	// dir is the directory volume data directories are placed in.
+	dir string
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		metas: make(map[string]metadata.Metadata),
+		files: make(map[string]map[string][]byte),
+	}
+}
+
+// addVolume adds a volume whose certificate expires at notAfter, and that is
+// due to be renewed at nextIssuance.
+func (f *fakeStore) addVolume(t *testing.T, id string, nextIssuance, notAfter time.Time) {
+	f.metas[id] = metadata.Metadata{
+		VolumeID:         id,
+		NextIssuanceTime: &nextIssuance,
+		VolumeContext:    map[string]string{"csi.cert-manager.io/issuer-name": "ca-issuer"},
+	}
+	f.files[id] = map[string][]byte{"tls.crt": mustCertificatePEM(t, notAfter)}
+}
+
+func (f *fakeStore) ListVolumes() ([]string, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var ids []string
+	for id := range f.metas {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (f *fakeStore) ReadMetadata(volumeID string) (metadata.Metadata, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	meta, ok := f.metas[volumeID]
+	if !ok {
+		return metadata.Metadata{}, storage.ErrNotFound
+	}
+	return meta, nil
+}
+
+func (f *fakeStore) WriteMetadata(volumeID string, meta metadata.Metadata) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.metas[volumeID] = meta
+	return nil
+}
+
+func (f *fakeStore) ReadFile(volumeID, name string) ([]byte, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	data, ok := f.files[volumeID][name]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return data, nil
+}
+
+func (f *fakeStore) PathForVolume(volumeID string) string {
+	return filepath.Join(f.dir, volumeID, "data")
+}
+
+// fakeManager records the volumes that have been registered for management.
+type fakeManager struct {
+	lock    sync.Mutex
+	managed []string
+}
+
+func (f *fakeManager) ManageVolume(volumeID string) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.managed = append(f.managed, volumeID)
+	return true
+}
+
+func (f *fakeManager) volumes() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]string(nil), f.managed...)
+}
+
+func mustCertificatePEM(t testing.TB, notAfter time.Time) []byte {
+	pk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    notAfter.Add(-time.Hour * 24),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pk.Public(), pk)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func Test_MetadataReaderForManager(t *testing.T) {
+	store := newFakeStore()
+	store.addVolume(t, "vol-1", fakeNow, fakeNow.Add(time.Hour))
+
+	reader := MetadataReaderForManager(store)
+
+	vols, err := reader.ListVolumes()
+	require.NoError(t, err)
+	assert.Empty(t, vols)
+
+	meta, err := reader.ReadMetadata("vol-1")
+	require.NoError(t, err)
+	assert.Equal(t, "vol-1", meta.VolumeID)
+}
+
+func Test_Startup_ordering(t *testing.T) {
+	store := newFakeStore()
+	store.addVolume(t, "vol-renew-later", fakeNow.Add(time.Hour*2), fakeNow.Add(time.Hour*3))
+	store.addVolume(t, "vol-renew-soon", fakeNow.Add(time.Hour), fakeNow.Add(time.Hour*3))
+	store.addVolume(t, "vol-expired", fakeNow.Add(time.Hour*5), fakeNow.Add(-time.Minute))
+	store.addVolume(t, "vol-no-cert", fakeNow.Add(time.Hour*5), fakeNow.Add(time.Hour*6))
+	delete(store.files["vol-no-cert"], "tls.crt")
+	store.metas["vol-never-issued"] = metadata.Metadata{VolumeID: "vol-never-issued"}
+
+	mngr := new(fakeManager)
+	s := &Startup{
+		Log:     logr.Discard(),
+		Store:   store,
+		Manager: mngr,
+		Clock:   clocktesting.NewFakeClock(fakeNow),
+	}
+
+	require.NoError(t, s.Run(context.Background()))
+	assert.Equal(t, []string{"vol-expired", "vol-no-cert", "vol-renew-soon", "vol-renew-later"}, mngr.volumes())
+}
+
+func Test_Startup_batches(t *testing.T) {
+	store := newFakeStore()
+	for _, id := range []string{"vol-1", "vol-2", "vol-3", "vol-4", "vol-5"} {
+		store.addVolume(t, id, fakeNow.Add(time.Hour), fakeNow.Add(time.Hour*2))
+	}
+
+	fakeClock := clocktesting.NewFakeClock(fakeNow)
+	mngr := new(fakeManager)
+	s := &Startup{
+		Log:        logr.Discard(),
+		Store:      store,
+		Manager:    mngr,
+		Clock:      fakeClock,
+		BatchSize:  2,
+		BatchDelay: time.Second,
+	}
+
+	errCh := make(chan error)
+	go func() { errCh <- s.Run(context.Background()) }()
+
+	for _, expManaged := range [][]string{
+		{"vol-1", "vol-2"},
+		{"vol-1", "vol-2", "vol-3", "vol-4"},
+	} {
+		assert.Eventually(t, fakeClock.HasWaiters, time.Second, time.Millisecond)
+		assert.Equal(t, expManaged, mngr.volumes())
+		fakeClock.Step(time.Second)
+	}
+
+	require.NoError(t, <-errCh)
+	assert.Equal(t, []string{"vol-1", "vol-2", "vol-3", "vol-4", "vol-5"}, mngr.volumes())
+}
+
+func Test_Startup_cancelled(t *testing.T) {
+	store := newFakeStore()
+	for _, id := range []string{"vol-1", "vol-2", "vol-3"} {
+		store.addVolume(t, id, fakeNow.Add(time.Hour), fakeNow.Add(time.Hour*2))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	mngr := new(fakeManager)
+	s := &Startup{
+		Log:        logr.Discard(),
+		Store:      store,
+		Manager:    mngr,
+		Clock:      clocktesting.NewFakeClock(fakeNow),
+		BatchSize:  1,
+		BatchDelay: time.Hour,
+	}
+
+	require.NoError(t, s.Run(ctx))
+	assert.Equal(t, []string{"vol-1"}, mngr.volumes())
+}
+
+func Test_Startup_maxReuseAge(t *testing.T) {
+	store := newFakeStore()
+	// Certificates are valid for 24h, so these were issued 23h and 1h ago.
+	store.addVolume(t, "vol-old", fakeNow.Add(time.Hour*4), fakeNow.Add(time.Hour))
+	store.addVolume(t, "vol-new", fakeNow.Add(time.Hour*2), fakeNow.Add(time.Hour*23))
+
+	mngr := new(fakeManager)
+	s := &Startup{
+		Log:         logr.Discard(),
+		Store:       store,
+		Manager:     mngr,
+		Clock:       clocktesting.NewFakeClock(fakeNow),
+		MaxReuseAge: time.Hour * 12,
+	}
+
+	require.NoError(t, s.Run(context.Background()))
+	assert.Equal(t, []string{"vol-old", "vol-new"}, mngr.volumes())
+
+	assert.Equal(t, fakeNow, *store.metas["vol-old"].NextIssuanceTime, "expected stale volume to be re-issued immediately")
+	assert.Equal(t, fakeNow.Add(time.Hour*2), *store.metas["vol-new"].NextIssuanceTime, "expected fresh volume to be reused")
+}
+
+func Test_Startup_interruptedWrite(t *testing.T) {
+	store := newFakeStore()
+	store.dir = t.TempDir()
+	store.addVolume(t, "vol-interrupted", fakeNow.Add(time.Hour*2), fakeNow.Add(time.Hour*3))
+	store.addVolume(t, "vol-complete", fakeNow.Add(time.Hour*2), fakeNow.Add(time.Hour*3))
+
+	// Lay out the data directories as left by a completed write, then
+	// interrupt a second write to one volume just before its files were
+	// swapped in.
+	for _, id := range []string{"vol-interrupted", "vol-complete"} {
+		dir := store.PathForVolume(id)
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "..2000_01_01_00_00_00.1"), 0700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "..2000_01_01_00_00_00.1", "tls.crt"), store.files[id]["tls.crt"], 0600))
+		require.NoError(t, os.Symlink("..2000_01_01_00_00_00.1", filepath.Join(dir, "..data")))
+		require.NoError(t, os.Symlink(filepath.Join("..data", "tls.crt"), filepath.Join(dir, "tls.crt")))
+	}
+	dir := store.PathForVolume("vol-interrupted")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "..2000_01_01_01_00_00.2"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "..2000_01_01_01_00_00.2", "tls.crt"), []byte("partial"), 0600))
+	require.NoError(t, os.Symlink("..2000_01_01_01_00_00.2", filepath.Join(dir, "..data_tmp")))
+
+	mngr := new(fakeManager)
+	s := &Startup{
+		Log:     logr.Discard(),
+		Store:   store,
+		Manager: mngr,
+		Clock:   clocktesting.NewFakeClock(fakeNow),
+	}
+
+	require.NoError(t, s.Run(context.Background()))
+	assert.ElementsMatch(t, []string{"vol-interrupted", "vol-complete"}, mngr.volumes())
+
+	assert.Equal(t, fakeNow, *store.metas["vol-interrupted"].NextIssuanceTime, "expected interrupted volume to be re-issued immediately")
+	assert.Equal(t, fakeNow.Add(time.Hour*2), *store.metas["vol-complete"].NextIssuanceTime, "expected complete volume to be reused")
+
+	for _, id := range []string{"vol-interrupted", "vol-complete"} {
+		dir := store.PathForVolume(id)
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		assert.ElementsMatch(t, []string{"..2000_01_01_00_00_00.1", "..data", "tls.crt"}, names, "volume %q", id)
+
+		// The certificate last written in full must be left in place.
+		data, err := os.ReadFile(filepath.Join(dir, "tls.crt"))
+		require.NoError(t, err)
+		assert.Equal(t, store.files[id]["tls.crt"], data, "volume %q", id)
+	}
+}
+
+func Test_Startup_outputFIFO(t *testing.T) {
+	store := newFakeStore()
+	store.addVolume(t, "vol-fifo", fakeNow.Add(time.Hour*4), fakeNow.Add(time.Hour*12))
+	store.metas["vol-fifo"].VolumeContext["csi.cert-manager.io/output-fifo"] = "true"
+	delete(store.files, "vol-fifo")
+
+	mngr := new(fakeManager)
+	s := &Startup{
+		Log:     logr.Discard(),
+		Store:   store,
+		Manager: mngr,
+		Clock:   clocktesting.NewFakeClock(fakeNow),
+	}
+
+	require.NoError(t, s.Run(context.Background()))
+	assert.Equal(t, []string{"vol-fifo"}, mngr.volumes())
+	assert.Equal(t, fakeNow, *store.metas["vol-fifo"].NextIssuanceTime, "expected named pipe volume to be re-issued immediately")
+}
+
+func Test_Startup_readConcurrency(t *testing.T) {
+	store := newFakeStore()
+	var expManaged []string
+	for i := range 50 {
+		id := fmt.Sprintf("vol-%02d", i)
+		store.addVolume(t, id, fakeNow.Add(time.Hour*time.Duration(i+1)), fakeNow.Add(time.Hour*100))
+		expManaged = append(expManaged, id)
+	}
+	store.addVolume(t, "vol-expired", fakeNow.Add(time.Hour*5), fakeNow.Add(-time.Minute))
+	expManaged = append([]string{"vol-expired"}, expManaged...)
+
+	mngr := new(fakeManager)
+	s := &Startup{
+		Log:             logr.Discard(),
+		Store:           store,
+		Manager:         mngr,
+		Clock:           clocktesting.NewFakeClock(fakeNow),
+		ReadConcurrency: 8,
+	}
+
+	// The order volumes are read in must not affect the order they are
+	// registered in.
+	require.NoError(t, s.Run(context.Background()))
+	assert.Equal(t, expManaged, mngr.volumes())
+}
+
+// errorStore fails to read the metadata of the given volumes.
+type errorStore struct {
+	*fakeStore
+	failing []string
+}
+
+func (e *errorStore) ReadMetadata(volumeID string) (metadata.Metadata, error) {
+	if slices.Contains(e.failing, volumeID) {
+		return metadata.Metadata{}, errors.New("corrupt metadata")
+	}
+	return e.fakeStore.ReadMetadata(volumeID)
+}
+
+func Test_Startup_readErrors(t *testing.T) {
+	store := newFakeStore()
+	for _, id := range []string{"vol-1", "vol-2", "vol-3"} {
+		store.addVolume(t, id, fakeNow.Add(time.Hour), fakeNow.Add(time.Hour*2))
+	}
+
+	mngr := new(fakeManager)
+	s := &Startup{
+		Log:             logr.Discard(),
+		Store:           &errorStore{fakeStore: store, failing: []string{"vol-1", "vol-3"}},
+		Manager:         mngr,
+		Clock:           clocktesting.NewFakeClock(fakeNow),
+		ReadConcurrency: 2,
+	}
+
+	err := s.Run(context.Background())
+	assert.EqualError(t, err, "reading existing volume metadata \"vol-1\": corrupt metadata\n"+
+		"reading existing volume metadata \"vol-3\": corrupt metadata")
+	assert.Empty(t, mngr.volumes())
+}
+
+// dirStore is a Store reading volumes from a data root on disk, laid out as
+// written by the csi-lib filesystem backend.
+type dirStore struct {
+	root string
+}
+
+func (d *dirStore) ListVolumes() ([]string, error) {
+	entries, err := os.ReadDir(d.root)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, entry := range entries {
+		ids = append(ids, entry.Name())
+	}
+	return ids, nil
+}
+
+func (d *dirStore) ReadMetadata(volumeID string) (metadata.Metadata, error) {
+	data, err := os.ReadFile(filepath.Join(d.root, volumeID, "metadata.json"))
+	if err != nil {
+		return metadata.Metadata{}, err
+	}
+	var meta metadata.Metadata
+	return meta, json.Unmarshal(data, &meta)
+}
+
+func (d *dirStore) WriteMetadata(volumeID string, meta metadata.Metadata) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(d.root, volumeID, "metadata.json"), data, 0600)
+}
+
+func (d *dirStore) ReadFile(volumeID, name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(d.root, volumeID, "data", name))
+}
+
+func (d *dirStore) PathForVolume(volumeID string) string {
+	return filepath.Join(d.root, volumeID, "data")
+}
+
+// latency is the time each read of a volume takes on the benchmark data root,
+// modelling storage which is slower than the page cache of the test host.
+const latency = time.Millisecond
+
+// slowDirStore is a dirStore whose reads take at least latency.
+type slowDirStore struct {
+	*dirStore
+}
+
+func (s slowDirStore) ReadMetadata(volumeID string) (metadata.Metadata, error) {
+	time.Sleep(latency)
+	return s.dirStore.ReadMetadata(volumeID)
+}
+
+func (s slowDirStore) ReadFile(volumeID, name string) ([]byte, error) {
+	time.Sleep(latency)
+	return s.dirStore.ReadFile(volumeID, name)
+}
+
+func BenchmarkStartup_existingVolumes(b *testing.B) {
+	const volumes = 500
+
+	store := &dirStore{root: b.TempDir()}
+	certPEM := mustCertificatePEM(b, fakeNow.Add(time.Hour*24))
+	for i := range volumes {
+		id := fmt.Sprintf("csi-%04d", i)
+		require.NoError(b, os.MkdirAll(filepath.Join(store.root, id, "data"), 0700))
+		require.NoError(b, os.WriteFile(filepath.Join(store.root, id, "data", "tls.crt"), certPEM, 0600))
+
+		nextIssuance := fakeNow.Add(time.Hour)
+		require.NoError(b, store.WriteMetadata(id, metadata.Metadata{
+			VolumeID:         id,
+			NextIssuanceTime: &nextIssuance,
+			VolumeContext:    map[string]string{"csi.cert-manager.io/issuer-name": "ca-issuer"},
+		}))
+	}
+
+	for _, concurrency := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			s := &Startup{
+				Log:             logr.Discard(),
+				Store:           slowDirStore{store},
+				Clock:           clocktesting.NewFakeClock(fakeNow),
+				ReadConcurrency: concurrency,
+			}
+			for range b.N {
+				vols, err := s.existingVolumes()
+				require.NoError(b, err)
+				require.Len(b, vols, volumes)
+			}
+		})
+	}
+}
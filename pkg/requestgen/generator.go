@@ -19,14 +19,17 @@ package requestgen
 import (
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"errors"
 	"fmt"
+	"maps"
 	"net"
 	"net/url"
 	"os"
 	"strings"
 	"time"
 
+	cmacme "github.com/cert-manager/cert-manager/pkg/apis/acme/v1"
 	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
 	cmutil "github.com/cert-manager/cert-manager/pkg/util"
@@ -115,8 +118,21 @@ func RequestForMetadata(meta metadata.Metadata) (*manager.CertificateRequestBund
 	if err != nil {
 		return nil, fmt.Errorf("%q: %w", csiapi.URISANsKey, err)
 	}
+	if err := setSANCritical(request, attrs[csiapi.SANCriticalKey] == "true"); err != nil {
+		return nil, fmt.Errorf("%q: %w", csiapi.SANCriticalKey, err)
+	}
 
+	// Annotations requested by the volume are added first, so that they never
+	// replace those set by the driver. Reserved keys are rejected when the
+	// volume is validated.
 	annotations := make(map[string]string)
+	if v := attrs[csiapi.AnnotationsKey]; len(v) > 0 {
+		requested, err := validation.ParseKeyValues(v)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", csiapi.AnnotationsKey, err)
+		}
+		maps.Copy(annotations, requested)
+	}
 	for key, val := range attrs {
 		group, _, found := strings.Cut(key, "/")
 		if !found {
@@ -127,8 +143,16 @@ func RequestForMetadata(meta metadata.Metadata) (*manager.CertificateRequestBund
 			group != "csi.storage.k8s.io" {
 			annotations[key] = val
 		}
+
+		// Pass ACME attributes through as the annotations recognised by the
+		// cert-manager ACME issuer, which copies them onto the Order.
+		if name, ok := strings.CutPrefix(key, csiapi.ACMEKeyPrefix); ok {
+			annotations[cmacme.SchemeGroupVersion.Group+"/"+name] = val
+		}
 	}
 
+	annotations[csiapi.PriorityAnnotationKey] = priority(meta, attrs)
+
 	return &manager.CertificateRequestBundle{
 		Request:   request,
 		IsCA:      strings.ToLower(attrs[csiapi.IsCAKey]) == "true",
@@ -144,6 +168,57 @@ func RequestForMetadata(meta metadata.Metadata) (*manager.CertificateRequestBund
 	}, nil
 }
 
+// priority returns the priority of the request for the volume. Unless set by
+// the priority attribute, the initial issuance of a volume has a higher
+// priority than its renewals.
+func priority(meta metadata.Metadata, attrs map[string]string) string {
+	if p := attrs[csiapi.PriorityKey]; len(p) > 0 {
+		return p
+	}
+	if meta.NextIssuanceTime == nil || meta.NextIssuanceTime.IsZero() {
+		return csiapi.PriorityHigh
+	}
+	return csiapi.PriorityNormal
+}
+
+// setSANCritical adds the subjectAltName extension to the request marked as
+// critical if the request has an empty subject, or if forced. RFC 5280
+// requires the extension be critical when the subject is empty, which the Go
+// x509 library does not do for certificate requests.
+func setSANCritical(request *x509.CertificateRequest, force bool) error {
+	if len(request.DNSNames) == 0 && len(request.IPAddresses) == 0 && len(request.URIs) == 0 {
+		return nil
+	}
+
+	if !force && hasSubject(request) {
+		return nil
+	}
+
+	ext, err := cmpki.MarshalSANs(cmpki.GeneralNames{
+		DNSNames:                   request.DNSNames,
+		IPAddresses:                request.IPAddresses,
+		UniformResourceIdentifiers: cmpki.URLsToString(request.URIs),
+	}, false)
+	if err != nil {
+		return err
+	}
+
+	request.ExtraExtensions = append(request.ExtraExtensions, ext)
+	return nil
+}
+
+// hasSubject returns true if the request has a non-empty subject.
+func hasSubject(request *x509.CertificateRequest) bool {
+	if len(request.RawSubject) > 0 {
+		var rdnSequence pkix.RDNSequence
+		if _, err := asn1.Unmarshal(request.RawSubject, &rdnSequence); err != nil {
+			return true
+		}
+		return len(rdnSequence) > 0
+	}
+	return len(request.Subject.ToRDNSequence()) > 0
+}
+
 // parseDNSNames parses a csi.cert-manager.io/dns-names value, and returns the
 // set of DNS names to be requested. Executes metadata expand on string.
 func parseDNSNames(meta metadata.Metadata, dnsNames string) ([]string, error) {
@@ -231,11 +306,9 @@ func keyUsagesFromAttributes(usagesCSV string) []cmapi.KeyUsage {
 // expand executes os.Expand on the given csv with volume context variables
 // provided by the metadata.
 func expand(meta metadata.Metadata, csv string) (string, error) {
-	vars := map[string]string{
-		"POD_NAME":             meta.VolumeContext[csiapi.K8sVolumeContextKeyPodName],
-		"POD_NAMESPACE":        meta.VolumeContext[csiapi.K8sVolumeContextKeyPodNamespace],
-		"POD_UID":              meta.VolumeContext[csiapi.K8sVolumeContextKeyPodUID],
-		"SERVICE_ACCOUNT_NAME": meta.VolumeContext[csiapi.K8sVolumeContextKeyServiceAccountName],
+	vars := make(map[string]string, len(csiapi.TemplateVariables))
+	for name, key := range csiapi.TemplateVariables {
+		vars[name] = meta.VolumeContext[key]
 	}
 
 	var errs []string
@@ -17,8 +17,12 @@ limitations under the License.
 package requestgen
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"errors"
 	"net"
 	"net/url"
@@ -32,6 +36,7 @@ import (
 	"github.com/cert-manager/csi-lib/manager"
 	"github.com/cert-manager/csi-lib/metadata"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
 )
@@ -94,7 +99,7 @@ func Test_RequestForMetadata(t *testing.T) {
 					Group: "cert-manager.io",
 				},
 				Duration:    time.Hour * 24 * 90,
-				Annotations: make(map[string]string),
+				Annotations: map[string]string{"csi.cert-manager.io/priority": "high"},
 			},
 			expErr: false,
 		},
@@ -186,7 +191,7 @@ func Test_RequestForMetadata(t *testing.T) {
 					Group: "joshvanl.com",
 				},
 				Duration:    time.Hour,
-				Annotations: make(map[string]string),
+				Annotations: map[string]string{"csi.cert-manager.io/priority": "high"},
 			},
 			expErr: false,
 		},
@@ -205,10 +210,71 @@ func Test_RequestForMetadata(t *testing.T) {
 					Group: "cert-manager.io",
 				},
 				Duration:    cmapi.DefaultCertificateDuration,
-				Annotations: make(map[string]string),
+				Annotations: map[string]string{"csi.cert-manager.io/priority": "high"},
 			},
 			expErr: false,
 		},
+		"a metadata with ACME attributes should have them passed through as annotations": {
+			meta: baseMetadataWith(metadata.Metadata{VolumeContext: map[string]string{
+				csiapi.IssuerNameKey:                    "my-issuer",
+				csiapi.LiteralSubjectKey:                literalSubject,
+				csiapi.ACMEHTTP01IngressNameOverrideKey: "my-ingress",
+			}}),
+			expRequest: &manager.CertificateRequestBundle{
+				Request:   &x509.CertificateRequest{RawSubject: rawLiteralSubject},
+				Usages:    cmapi.DefaultKeyUsages(),
+				Namespace: "my-namespace",
+				IssuerRef: cmmeta.ObjectReference{
+					Name:  "my-issuer",
+					Kind:  "Issuer",
+					Group: "cert-manager.io",
+				},
+				Duration: cmapi.DefaultCertificateDuration,
+				Annotations: map[string]string{
+					"acme.cert-manager.io/http01-override-ingress-name": "my-ingress",
+					"csi.cert-manager.io/priority":                      "high",
+				},
+			},
+			expErr: false,
+		},
+		"a metadata with requested annotations should have them added alongside the driver annotations": {
+			meta: baseMetadataWith(metadata.Metadata{VolumeContext: map[string]string{
+				csiapi.IssuerNameKey:     "my-issuer",
+				csiapi.LiteralSubjectKey: literalSubject,
+				csiapi.AnnotationsKey:    "policy.example.com/team=payments, signer.example.com/profile=internal",
+			}}),
+			expRequest: &manager.CertificateRequestBundle{
+				Request:   &x509.CertificateRequest{RawSubject: rawLiteralSubject},
+				Usages:    cmapi.DefaultKeyUsages(),
+				Namespace: "my-namespace",
+				IssuerRef: cmmeta.ObjectReference{
+					Name:  "my-issuer",
+					Kind:  "Issuer",
+					Group: "cert-manager.io",
+				},
+				Duration: cmapi.DefaultCertificateDuration,
+				Annotations: map[string]string{
+					"csi.cert-manager.io/priority": "high",
+					"policy.example.com/team":      "payments",
+					"signer.example.com/profile":   "internal",
+				},
+			},
+			expErr: false,
+		},
+		"a metadata with malformed requested annotations should error": {
+			meta: baseMetadataWith(metadata.Metadata{VolumeContext: map[string]string{
+				csiapi.IssuerNameKey:  "my-issuer",
+				csiapi.AnnotationsKey: "policy.example.com/team",
+			}}),
+			expErr: true,
+		},
+		"a metadata with unsupported ACME attributes should error": {
+			meta: baseMetadataWith(metadata.Metadata{VolumeContext: map[string]string{
+				csiapi.IssuerNameKey:                     "my-issuer",
+				"csi.cert-manager.io/acme-http01-solver": "true",
+			}}),
+			expErr: true,
+		},
 		"a metadata with incorrect literal subject set should error": {
 			meta: baseMetadataWith(metadata.Metadata{VolumeContext: map[string]string{
 				csiapi.IssuerNameKey:     "my-issuer",
@@ -396,6 +462,124 @@ func Test_expand(t *testing.T) {
 	}
 }
 
+func Test_setSANCritical(t *testing.T) {
+	t.Parallel()
+
+	pk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	sanCritical := func(t *testing.T, request *x509.CertificateRequest) (bool, bool) {
+		der, err := x509.CreateCertificateRequest(rand.Reader, request, pk)
+		require.NoError(t, err)
+		csr, err := x509.ParseCertificateRequest(der)
+		require.NoError(t, err)
+		for _, ext := range csr.Extensions {
+			if ext.Id.Equal(oidExtensionSubjectAltName) {
+				return true, ext.Critical
+			}
+		}
+		return false, false
+	}
+
+	tests := map[string]struct {
+		request     *x509.CertificateRequest
+		force       bool
+		expSAN      bool
+		expCritical bool
+	}{
+		"no SANs should not add an extension": {
+			request: &x509.CertificateRequest{Subject: pkix.Name{CommonName: "foo"}},
+			force:   true,
+		},
+		"SANs with a subject should not be critical": {
+			request:     &x509.CertificateRequest{Subject: pkix.Name{CommonName: "foo"}, DNSNames: []string{"foo.bar"}},
+			expSAN:      true,
+			expCritical: false,
+		},
+		"SANs with an empty subject should be critical": {
+			request:     &x509.CertificateRequest{DNSNames: []string{"foo.bar"}, IPAddresses: []net.IP{net.ParseIP("1.2.3.4")}},
+			expSAN:      true,
+			expCritical: true,
+		},
+		"SANs with a subject should be critical if forced": {
+			request:     &x509.CertificateRequest{Subject: pkix.Name{CommonName: "foo"}, URIs: []*url.URL{{Scheme: "spiffe", Host: "foo.bar"}}},
+			force:       true,
+			expSAN:      true,
+			expCritical: true,
+		},
+		"SANs with a literal subject should not be critical": {
+			request: func() *x509.CertificateRequest {
+				rawSubject, err := cmpki.MarshalRDNSequenceToRawDERBytes(pkix.RDNSequence{{{Type: cmpki.OIDConstants.CommonName, Value: "foo"}}})
+				require.NoError(t, err)
+				return &x509.CertificateRequest{RawSubject: rawSubject, DNSNames: []string{"foo.bar"}}
+			}(),
+			expSAN:      true,
+			expCritical: false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, setSANCritical(test.request, test.force))
+			hasSAN, critical := sanCritical(t, test.request)
+			assert.Equal(t, test.expSAN, hasSAN)
+			assert.Equal(t, test.expCritical, critical)
+		})
+	}
+}
+
+func Test_priority(t *testing.T) {
+	t.Parallel()
+
+	epoch, renewal := time.Time{}, time.Now()
+
+	tests := map[string]struct {
+		nextIssuanceTime *time.Time
+		priority         string
+		expPriority      string
+	}{
+		"initial issuance should default to high": {
+			nextIssuanceTime: nil,
+			expPriority:      "high",
+		},
+		"initial issuance which did not complete should default to high": {
+			nextIssuanceTime: &epoch,
+			expPriority:      "high",
+		},
+		"renewal should default to normal": {
+			nextIssuanceTime: &renewal,
+			expPriority:      "normal",
+		},
+		"explicit priority should be used for initial issuance": {
+			nextIssuanceTime: nil,
+			priority:         "low",
+			expPriority:      "low",
+		},
+		"explicit priority should be used for renewal": {
+			nextIssuanceTime: &renewal,
+			priority:         "high",
+			expPriority:      "high",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			meta := baseMetadata()
+			meta.NextIssuanceTime = test.nextIssuanceTime
+			meta.VolumeContext[csiapi.IssuerNameKey] = "my-issuer"
+			if len(test.priority) > 0 {
+				meta.VolumeContext[csiapi.PriorityKey] = test.priority
+			}
+
+			request, err := RequestForMetadata(meta)
+			require.NoError(t, err)
+			assert.Equal(t, test.expPriority, request.Annotations["csi.cert-manager.io/priority"])
+		})
+	}
+}
+
+var oidExtensionSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
 func baseMetadata() metadata.Metadata {
 	return metadata.Metadata{
 		VolumeContext: map[string]string{
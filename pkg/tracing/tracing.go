@@ -0,0 +1,295 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing records OpenTelemetry spans for the issuance lifecycle of
+// the volumes managed by the driver.
+package tracing
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"sync"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/cert-manager/csi-lib/manager"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/mount-utils"
+
+	"github.com/cert-manager/csi-driver/internal/version"
+	"github.com/cert-manager/csi-driver/pkg/apis/defaults"
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+)
+
+const (
+	// Names of the spans recorded by the Tracer.
+	SpanNodePublishVolume         = "NodePublishVolume"
+	SpanCreateCertificateRequest  = "CreateCertificateRequest"
+	SpanWaitForCertificateRequest = "WaitForCertificateRequest"
+	SpanWriteFiles                = "WriteFiles"
+)
+
+var (
+	errPublishFailed    = errors.New("volume was removed before it was mounted")
+	errRequestAbandoned = errors.New("request did not complete before the next attempt or the volume was removed")
+)
+
+// NewProvider returns a tracer provider which exports spans with OTLP over
+// gRPC to the given endpoint URL. A http:// endpoint is not secured with TLS.
+// The provider must be shut down to flush the spans it has not yet exported.
+func NewProvider(ctx context.Context, endpoint string) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "cert-manager-csi-driver"),
+			attribute.String("service.version", version.DriverVersion()),
+		)),
+	), nil
+}
+
+// Tracer records the spans of the issuance lifecycle of each volume:
+//   - NodePublishVolume, from a new volume being registered until it is
+//     mounted into the pod, or removed because publishing failed.
+//   - CreateCertificateRequest, around the creation of each request.
+//   - WaitForCertificateRequest, from a request being created until its
+//     certificate is written, or the attempt is abandoned.
+//   - WriteFiles, around writing the certificate to the volume.
+//
+// The spans of the issuance attempt made while publishing a volume are
+// children of its NodePublishVolume span, and those of renewals are roots.
+// Every span carries the volume ID, the pod, and the issuer of the volume.
+type Tracer struct {
+	tracer trace.Tracer
+
+	lock sync.Mutex
+	// volumes holds the in progress spans of each volume.
+	volumes map[string]*volume
+	// paths maps the data directory of each volume being published to its ID.
+	paths map[string]string
+}
+
+// volume holds the in progress spans of a volume.
+type volume struct {
+	attrs []attribute.KeyValue
+	path  string
+
+	// publish is the NodePublishVolume span, until the volume is mounted.
+	publish trace.Span
+	// ctx is the parent of the spans of the next issuance attempt.
+	ctx context.Context
+	// wait is the WaitForCertificateRequest span of the request in flight.
+	wait trace.Span
+}
+
+// New returns a Tracer recording spans with the given provider.
+func New(provider trace.TracerProvider) *Tracer {
+	return &Tracer{
+		tracer:  provider.Tracer("github.com/cert-manager/csi-driver"),
+		volumes: make(map[string]*volume),
+		paths:   make(map[string]string),
+	}
+}
+
+// attributesForMetadata returns the span attributes of the given volume.
+func attributesForMetadata(meta metadata.Metadata) []attribute.KeyValue {
+	attrs, err := defaults.SetDefaultAttributes(meta.VolumeContext)
+	if err != nil {
+		attrs = meta.VolumeContext
+	}
+	return []attribute.KeyValue{
+		attribute.String("volume_id", meta.VolumeID),
+		attribute.String("pod_namespace", attrs[csiapi.K8sVolumeContextKeyPodNamespace]),
+		attribute.String("pod_name", attrs[csiapi.K8sVolumeContextKeyPodName]),
+		attribute.String("pod_uid", attrs[csiapi.K8sVolumeContextKeyPodUID]),
+		attribute.String("issuer_name", attrs[csiapi.IssuerNameKey]),
+		attribute.String("issuer_kind", attrs[csiapi.IssuerKindKey]),
+		attribute.String("issuer_group", attrs[csiapi.IssuerGroupKey]),
+	}
+}
+
+// end ends the given span, with an error status if err is not nil.
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// volumeFor returns the spans of the given volume, creating them if needed.
+// The lock must be held.
+func (t *Tracer) volumeFor(meta metadata.Metadata) *volume {
+	v, ok := t.volumes[meta.VolumeID]
+	if !ok {
+		v = &volume{attrs: attributesForMetadata(meta), ctx: context.Background()}
+		t.volumes[meta.VolumeID] = v
+	}
+	return v
+}
+
+// publishStarted starts the NodePublishVolume span of a new volume whose data
+// directory is the given path.
+func (t *Tracer) publishStarted(meta metadata.Metadata, path string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	v := t.volumeFor(meta)
+	v.ctx, v.publish = t.tracer.Start(context.Background(), SpanNodePublishVolume, trace.WithAttributes(v.attrs...))
+	v.path = path
+	t.paths[path] = meta.VolumeID
+}
+
+// mounted ends the NodePublishVolume span of the volume whose data directory
+// is the given path.
+func (t *Tracer) mounted(path string, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	v, ok := t.volumes[t.paths[path]]
+	if !ok || v.publish == nil {
+		return
+	}
+	end(v.publish, err)
+	delete(t.paths, path)
+	v.publish, v.ctx = nil, context.Background()
+}
+
+// removed ends the in progress spans of the given volume, as failed.
+func (t *Tracer) removed(volumeID string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	v, ok := t.volumes[volumeID]
+	if !ok {
+		return
+	}
+	delete(t.volumes, volumeID)
+	delete(t.paths, v.path)
+	if v.wait != nil {
+		end(v.wait, errRequestAbandoned)
+	}
+	if v.publish != nil {
+		end(v.publish, errPublishFailed)
+	}
+}
+
+// StartCreate starts the CreateCertificateRequest span of the given volume,
+// ending the WaitForCertificateRequest span of the previous request if it
+// never completed. The returned function must be called with the result of
+// the creation, and starts the WaitForCertificateRequest span of the created
+// request.
+func (t *Tracer) StartCreate(meta metadata.Metadata) func(*cmapi.CertificateRequest, error) {
+	t.lock.Lock()
+	v := t.volumeFor(meta)
+	if v.wait != nil {
+		end(v.wait, errRequestAbandoned)
+		v.wait = nil
+	}
+	parent := v.ctx
+	t.lock.Unlock()
+
+	_, span := t.tracer.Start(parent, SpanCreateCertificateRequest, trace.WithAttributes(v.attrs...))
+	return func(cr *cmapi.CertificateRequest, err error) {
+		end(span, err)
+		if err != nil {
+			return
+		}
+
+		t.lock.Lock()
+		defer t.lock.Unlock()
+		if t.volumes[meta.VolumeID] != v {
+			return
+		}
+		_, v.wait = t.tracer.Start(parent, SpanWaitForCertificateRequest, trace.WithAttributes(append(v.attrs,
+			attribute.String("request_namespace", cr.Namespace),
+			attribute.String("request_name", cr.Name),
+		)...))
+	}
+}
+
+// InstrumentWriteKeypair wraps the given function, which csi-lib calls once
+// a request has been issued, to end the WaitForCertificateRequest span of the
+// request and record the WriteFiles span.
+func (t *Tracer) InstrumentWriteKeypair(f manager.WriteKeypairFunc) manager.WriteKeypairFunc {
+	return func(meta metadata.Metadata, key crypto.PrivateKey, chain []byte, ca []byte) error {
+		t.lock.Lock()
+		v := t.volumeFor(meta)
+		if v.wait != nil {
+			end(v.wait, nil)
+			v.wait = nil
+		}
+		parent := v.ctx
+		t.lock.Unlock()
+
+		_, span := t.tracer.Start(parent, SpanWriteFiles, trace.WithAttributes(v.attrs...))
+		err := f(meta, key, chain, ca)
+		end(span, err)
+		return err
+	}
+}
+
+// Store wraps a storage backend to record the NodePublishVolume span of new
+// volumes, and to end the spans of volumes which are removed.
+type Store struct {
+	storage.Interface
+
+	Tracer *Tracer
+}
+
+// RegisterMetadata registers the volume with the storage backend, starting
+// its NodePublishVolume span if it is new.
+func (s *Store) RegisterMetadata(meta metadata.Metadata) (bool, error) {
+	registered, err := s.Interface.RegisterMetadata(meta)
+	if err == nil && registered {
+		s.Tracer.publishStarted(meta, s.Interface.PathForVolume(meta.VolumeID))
+	}
+	return registered, err
+}
+
+// RemoveVolume ends the in progress spans of the volume, and removes it from
+// the storage backend.
+func (s *Store) RemoveVolume(volumeID string) error {
+	s.Tracer.removed(volumeID)
+	return s.Interface.RemoveVolume(volumeID)
+}
+
+// Mounter wraps a mount.Interface to end the NodePublishVolume span of
+// volumes once they are mounted into their pod.
+type Mounter struct {
+	mount.Interface
+
+	Tracer *Tracer
+}
+
+// Mount mounts source at target, ending the NodePublishVolume span of the
+// volume whose data directory is source.
+func (m *Mounter) Mount(source, target, fstype string, options []string) error {
+	err := m.Interface.Mount(source, target, fstype, options)
+	m.Tracer.mounted(source, err)
+	return err
+}
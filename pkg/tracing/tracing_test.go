@@ -0,0 +1,153 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"crypto"
+	"errors"
+	"testing"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/mount-utils"
+
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+)
+
+func testMetadata(volumeID string) metadata.Metadata {
+	return metadata.Metadata{
+		VolumeID: volumeID,
+		VolumeContext: map[string]string{
+			csiapi.IssuerNameKey:                   "ca-issuer",
+			csiapi.K8sVolumeContextKeyPodName:      "my-pod",
+			csiapi.K8sVolumeContextKeyPodNamespace: "my-namespace",
+		},
+	}
+}
+
+// span is the part of a recorded span checked by the tests.
+type span struct {
+	name   string
+	parent string
+	status codes.Code
+}
+
+func recordedSpans(recorder *tracetest.SpanRecorder) []span {
+	names := make(map[string]string)
+	for _, s := range recorder.Ended() {
+		names[s.SpanContext().SpanID().String()] = s.Name()
+	}
+	var spans []span
+	for _, s := range recorder.Ended() {
+		spans = append(spans, span{name: s.Name(), parent: names[s.Parent().SpanID().String()], status: s.Status().Code})
+	}
+	return spans
+}
+
+func Test_Tracer(t *testing.T) {
+	request := &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{Namespace: "my-namespace", Name: "cr-1"}}
+
+	tests := map[string]struct {
+		steps    func(t *testing.T, tracer *Tracer, store *Store, mounter *Mounter)
+		expSpans []span
+	}{
+		"a successful publish should record the issuance as children of the publish": {
+			steps: func(t *testing.T, tracer *Tracer, store *Store, mounter *Mounter) {
+				_, err := store.RegisterMetadata(testMetadata("vol-1"))
+				require.NoError(t, err)
+				tracer.StartCreate(testMetadata("vol-1"))(request, nil)
+				writeKeypair := tracer.InstrumentWriteKeypair(func(metadata.Metadata, crypto.PrivateKey, []byte, []byte) error { return nil })
+				require.NoError(t, writeKeypair(testMetadata("vol-1"), nil, nil, nil))
+				require.NoError(t, mounter.Mount(store.PathForVolume("vol-1"), "/target", "", nil))
+			},
+			expSpans: []span{
+				{name: SpanCreateCertificateRequest, parent: SpanNodePublishVolume, status: codes.Unset},
+				{name: SpanWaitForCertificateRequest, parent: SpanNodePublishVolume, status: codes.Unset},
+				{name: SpanWriteFiles, parent: SpanNodePublishVolume, status: codes.Unset},
+				{name: SpanNodePublishVolume, status: codes.Unset},
+			},
+		},
+		"a publish which fails should end every span with an error": {
+			steps: func(t *testing.T, tracer *Tracer, store *Store, mounter *Mounter) {
+				_, err := store.RegisterMetadata(testMetadata("vol-1"))
+				require.NoError(t, err)
+				tracer.StartCreate(testMetadata("vol-1"))(request, nil)
+				require.NoError(t, store.RemoveVolume("vol-1"))
+			},
+			expSpans: []span{
+				{name: SpanCreateCertificateRequest, parent: SpanNodePublishVolume, status: codes.Unset},
+				{name: SpanWaitForCertificateRequest, parent: SpanNodePublishVolume, status: codes.Error},
+				{name: SpanNodePublishVolume, status: codes.Error},
+			},
+		},
+		"a failed creation or write should end its span with an error": {
+			steps: func(t *testing.T, tracer *Tracer, store *Store, mounter *Mounter) {
+				_, err := store.RegisterMetadata(testMetadata("vol-1"))
+				require.NoError(t, err)
+				tracer.StartCreate(testMetadata("vol-1"))(nil, errors.New("forbidden"))
+				tracer.StartCreate(testMetadata("vol-1"))(request, nil)
+				writeKeypair := tracer.InstrumentWriteKeypair(func(metadata.Metadata, crypto.PrivateKey, []byte, []byte) error { return errors.New("disk full") })
+				require.Error(t, writeKeypair(testMetadata("vol-1"), nil, nil, nil))
+				require.NoError(t, store.RemoveVolume("vol-1"))
+			},
+			expSpans: []span{
+				{name: SpanCreateCertificateRequest, parent: SpanNodePublishVolume, status: codes.Error},
+				{name: SpanCreateCertificateRequest, parent: SpanNodePublishVolume, status: codes.Unset},
+				{name: SpanWaitForCertificateRequest, parent: SpanNodePublishVolume, status: codes.Unset},
+				{name: SpanWriteFiles, parent: SpanNodePublishVolume, status: codes.Error},
+				{name: SpanNodePublishVolume, status: codes.Error},
+			},
+		},
+		"a renewal should record root spans, and end a request which never completed": {
+			steps: func(t *testing.T, tracer *Tracer, store *Store, mounter *Mounter) {
+				tracer.StartCreate(testMetadata("vol-1"))(request, nil)
+				tracer.StartCreate(testMetadata("vol-1"))(request, nil)
+			},
+			expSpans: []span{
+				{name: SpanCreateCertificateRequest, status: codes.Unset},
+				{name: SpanWaitForCertificateRequest, status: codes.Error},
+				{name: SpanCreateCertificateRequest, status: codes.Unset},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			tracer := New(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+			store := &Store{Interface: storage.NewMemoryFS(), Tracer: tracer}
+			mounter := &Mounter{Interface: mount.NewFakeMounter(nil), Tracer: tracer}
+
+			test.steps(t, tracer, store, mounter)
+
+			assert.Equal(t, test.expSpans, recordedSpans(recorder))
+			for _, s := range recorder.Ended() {
+				assert.Contains(t, s.Attributes(), attribute.String("volume_id", "vol-1"))
+				assert.Contains(t, s.Attributes(), attribute.String("pod_name", "my-pod"))
+				assert.Contains(t, s.Attributes(), attribute.String("issuer_name", "ca-issuer"))
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volumelog
+
+import (
+	"crypto"
+	"sync"
+	"time"
+
+	cmpki "github.com/cert-manager/cert-manager/pkg/util/pki"
+	"github.com/cert-manager/csi-lib/manager"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/go-logr/logr"
+	"k8s.io/utils/clock"
+
+	"github.com/cert-manager/csi-driver/pkg/apis/defaults"
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+)
+
+// Summary logs a single line for each successful mount, once the first
+// certificate for a newly published volume has been written. Renewals, and
+// volumes registered again after the driver restarts, are not logged.
+type Summary struct {
+	Log   logr.Logger
+	Clock clock.Clock
+
+	lock sync.Mutex
+	// published holds the time each newly published volume was registered,
+	// until its first certificate is written.
+	published map[string]time.Time
+}
+
+// InstrumentWriteKeypair wraps the given function to log the summary of a
+// mount once its first certificate has been written.
+func (s *Summary) InstrumentWriteKeypair(f manager.WriteKeypairFunc) manager.WriteKeypairFunc {
+	return func(meta metadata.Metadata, key crypto.PrivateKey, chain []byte, ca []byte) error {
+		if err := f(meta, key, chain, ca); err != nil {
+			return err
+		}
+
+		s.lock.Lock()
+		published, ok := s.published[meta.VolumeID]
+		delete(s.published, meta.VolumeID)
+		s.lock.Unlock()
+		if !ok {
+			return nil
+		}
+
+		attrs, err := defaults.SetDefaultAttributes(meta.VolumeContext)
+		if err != nil {
+			attrs = meta.VolumeContext
+		}
+		kv := []any{
+			"issuer_name", attrs[csiapi.IssuerNameKey],
+			"issuer_kind", attrs[csiapi.IssuerKindKey],
+			"issuer_group", attrs[csiapi.IssuerGroupKey],
+		}
+		if crt, err := cmpki.DecodeX509CertificateBytes(chain); err == nil {
+			kv = append(kv,
+				"sans", len(crt.DNSNames)+len(crt.IPAddresses)+len(crt.URIs)+len(crt.EmailAddresses),
+				"duration", crt.NotAfter.Sub(crt.NotBefore).String(),
+				"not_after", crt.NotAfter.UTC().Format(time.RFC3339),
+			)
+		}
+		kv = append(kv, "latency", s.now().Sub(published).String())
+
+		ForMetadata(s.Log, meta).Info("Volume provisioned", kv...)
+		return nil
+	}
+}
+
+func (s *Summary) now() time.Time {
+	if s.Clock != nil {
+		return s.Clock.Now()
+	}
+	return time.Now()
+}
+
+// SummaryStore wraps a storage backend to record when volumes are newly
+// published, so that the latency of their first issuance can be included in
+// the summary.
+type SummaryStore struct {
+	storage.Interface
+
+	Summary *Summary
+}
+
+// RegisterMetadata registers the volume with the storage backend, and
+// records the time if the volume is newly published.
+func (s *SummaryStore) RegisterMetadata(meta metadata.Metadata) (bool, error) {
+	registered, err := s.Interface.RegisterMetadata(meta)
+	if err != nil || !registered {
+		return registered, err
+	}
+
+	s.Summary.lock.Lock()
+	defer s.Summary.lock.Unlock()
+	if s.Summary.published == nil {
+		s.Summary.published = make(map[string]time.Time)
+	}
+	s.Summary.published[meta.VolumeID] = s.Summary.now()
+
+	return registered, nil
+}
+
+// RemoveVolume removes the volume from the storage backend, and forgets the
+// volume if its first certificate was never written.
+func (s *SummaryStore) RemoveVolume(volumeID string) error {
+	if err := s.Interface.RemoveVolume(volumeID); err != nil {
+		return err
+	}
+
+	s.Summary.lock.Lock()
+	defer s.Summary.lock.Unlock()
+	delete(s.Summary.published, volumeID)
+
+	return nil
+}
@@ -0,0 +1,107 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volumelog
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/go-logr/logr/funcr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func Test_Summary(t *testing.T) {
+	var lines []string
+	log := funcr.New(func(prefix, args string) {
+		lines = append(lines, args)
+	}, funcr.Options{})
+
+	now := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	fakeClock := clocktesting.NewFakeClock(now)
+
+	pk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"a.example.com", "b.example.com"},
+		IPAddresses:  []net.IP{net.ParseIP("10.0.0.1")},
+		NotBefore:    now,
+		NotAfter:     now.Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pk.Public(), pk)
+	require.NoError(t, err)
+	chain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	meta := func(volumeID string) metadata.Metadata {
+		return metadata.Metadata{
+			VolumeID: volumeID,
+			VolumeContext: map[string]string{
+				"csi.storage.k8s.io/pod.namespace": "sandbox",
+				"csi.storage.k8s.io/pod.name":      "my-pod",
+				"csi.cert-manager.io/issuer-name":  "ca-issuer",
+			},
+		}
+	}
+
+	summary := &Summary{Log: log, Clock: fakeClock}
+	store := &SummaryStore{Interface: storage.NewMemoryFS(), Summary: summary}
+	written := summary.InstrumentWriteKeypair(func(metadata.Metadata, crypto.PrivateKey, []byte, []byte) error {
+		return nil
+	})
+	failed := summary.InstrumentWriteKeypair(func(metadata.Metadata, crypto.PrivateKey, []byte, []byte) error {
+		return errors.New("write failed")
+	})
+
+	_, err = store.RegisterMetadata(meta("vol-id"))
+	require.NoError(t, err)
+	fakeClock.Step(time.Second * 5)
+
+	// A failed write is not a successful mount, and must not be logged.
+	assert.Error(t, failed(meta("vol-id"), nil, chain, nil))
+	assert.Empty(t, lines)
+
+	require.NoError(t, written(meta("vol-id"), nil, chain, nil))
+
+	// Renewals, and volumes which were not published by this driver
+	// instance, must not be logged.
+	require.NoError(t, written(meta("vol-id"), nil, chain, nil))
+	require.NoError(t, written(meta("existing-vol-id"), nil, chain, nil))
+
+	// Volumes unpublished before their first certificate is written must be
+	// forgotten.
+	_, err = store.RegisterMetadata(meta("unpublished-vol-id"))
+	require.NoError(t, err)
+	require.NoError(t, store.RemoveVolume("unpublished-vol-id"))
+	require.NoError(t, written(meta("unpublished-vol-id"), nil, chain, nil))
+
+	assert.Equal(t, []string{
+		`"level"=0 "msg"="Volume provisioned" "volume_id"="vol-id" "pod_namespace"="sandbox" "pod_name"="my-pod" "issuer_name"="ca-issuer" "issuer_kind"="Issuer" "issuer_group"="cert-manager.io" "sans"=3 "duration"="1h0m0s" "not_after"="2000-01-01T01:00:00Z" "latency"="5s"`,
+	}, lines)
+}
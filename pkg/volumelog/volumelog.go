@@ -0,0 +1,161 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package volumelog logs the lifecycle of each volume, from publish through
+// every issuance to unpublish. Every entry carries the volume ID under the
+// "volume_id" key, the same key used by csi-lib and the per-volume metrics,
+// so that a volume's full history can be found with a single search. Entries
+// logged with ForMetadata also carry the pod and the correlation ID of the
+// volume.
+package volumelog
+
+import (
+	"crypto"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"maps"
+
+	"github.com/cert-manager/csi-lib/manager"
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/go-logr/logr"
+
+	csiapi "github.com/cert-manager/csi-driver/pkg/apis/v1alpha1"
+)
+
+// ForVolume returns the logger for entries related to the given volume.
+func ForVolume(log logr.Logger, volumeID string) logr.Logger {
+	return log.WithValues("volume_id", volumeID)
+}
+
+// ForMetadata returns the logger for entries related to the given volume,
+// carrying the pod namespace and name, and the correlation ID, of the volume
+// where they are known. Callers with the metadata of the volume should
+// prefer it to ForVolume.
+func ForMetadata(log logr.Logger, meta metadata.Metadata) logr.Logger {
+	kv := []any{"volume_id", meta.VolumeID}
+	for _, f := range []struct{ key, attr string }{
+		{"pod_namespace", csiapi.K8sVolumeContextKeyPodNamespace},
+		{"pod_name", csiapi.K8sVolumeContextKeyPodName},
+		{"correlation_id", csiapi.CorrelationIDKey},
+	} {
+		if v := meta.VolumeContext[f.attr]; len(v) > 0 {
+			kv = append(kv, f.key, v)
+		}
+	}
+	return log.WithValues(kv...)
+}
+
+// CorrelationStore wraps a storage backend to set the correlation ID of each
+// volume as it is registered. A volume which is already registered keeps its
+// correlation ID, otherwise a new one is generated. Volumes registered before
+// correlation IDs were introduced are left without one, since a changed
+// volume context would register them as new.
+type CorrelationStore struct {
+	storage.Interface
+}
+
+// RegisterMetadata registers the volume with the storage backend, with the
+// correlation ID of the volume set in its volume context.
+func (s *CorrelationStore) RegisterMetadata(meta metadata.Metadata) (bool, error) {
+	var id string
+	if existing, err := s.Interface.ReadMetadata(meta.VolumeID); err == nil {
+		id = existing.VolumeContext[csiapi.CorrelationIDKey]
+	} else if id, err = newCorrelationID(); err != nil {
+		return false, fmt.Errorf("generating correlation ID: %w", err)
+	}
+
+	vc := maps.Clone(meta.VolumeContext)
+	if vc == nil {
+		vc = make(map[string]string)
+	}
+	delete(vc, csiapi.CorrelationIDKey)
+	if len(id) > 0 {
+		vc[csiapi.CorrelationIDKey] = id
+	}
+	meta.VolumeContext = vc
+
+	return s.Interface.RegisterMetadata(meta)
+}
+
+// newCorrelationID returns a random correlation ID.
+func newCorrelationID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// InstrumentGeneratePrivateKey wraps the given function, which csi-lib calls
+// at the start of every issuance attempt, to log the attempt.
+func InstrumentGeneratePrivateKey(log logr.Logger, f manager.GeneratePrivateKeyFunc) manager.GeneratePrivateKeyFunc {
+	return func(meta metadata.Metadata) (crypto.PrivateKey, error) {
+		ForMetadata(log, meta).Info("Issuing certificate")
+		return f(meta)
+	}
+}
+
+// InstrumentWriteKeypair wraps the given function, which csi-lib calls at the
+// end of every successful issuance attempt, to log the result.
+func InstrumentWriteKeypair(log logr.Logger, f manager.WriteKeypairFunc) manager.WriteKeypairFunc {
+	return func(meta metadata.Metadata, key crypto.PrivateKey, chain []byte, ca []byte) error {
+		log := ForMetadata(log, meta)
+		if err := f(meta, key, chain, ca); err != nil {
+			log.Error(err, "Failed to write issued certificate")
+			return err
+		}
+		log.Info("Certificate issued and written")
+		return nil
+	}
+}
+
+// Store wraps a storage backend to log when volumes are published and
+// unpublished.
+type Store struct {
+	storage.Interface
+
+	Log logr.Logger
+}
+
+// RegisterMetadata registers the volume with the storage backend, and logs
+// the publish.
+func (s *Store) RegisterMetadata(meta metadata.Metadata) (bool, error) {
+	registered, err := s.Interface.RegisterMetadata(meta)
+	if err != nil {
+		return registered, err
+	}
+
+	ForMetadata(s.Log, meta).Info("Volume published",
+		"new", registered,
+		"target_path", meta.TargetPath,
+	)
+
+	return registered, nil
+}
+
+// RemoveVolume removes the volume from the storage backend, and logs the
+// unpublish.
+func (s *Store) RemoveVolume(volumeID string) error {
+	if err := s.Interface.RemoveVolume(volumeID); err != nil {
+		return err
+	}
+
+	ForVolume(s.Log, volumeID).Info("Volume unpublished")
+
+	return nil
+}
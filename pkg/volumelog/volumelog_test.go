@@ -0,0 +1,108 @@
+/*
+Copyright The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volumelog
+
+import (
+	"crypto"
+	"errors"
+	"testing"
+
+	"github.com/cert-manager/csi-lib/metadata"
+	"github.com/cert-manager/csi-lib/storage"
+	"github.com/go-logr/logr/funcr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_lifecycle(t *testing.T) {
+	var lines []string
+	log := funcr.New(func(prefix, args string) {
+		lines = append(lines, args)
+	}, funcr.Options{})
+
+	meta := metadata.Metadata{
+		VolumeID:   "vol-id",
+		TargetPath: "/target-path",
+		VolumeContext: map[string]string{
+			"csi.storage.k8s.io/pod.namespace":   "sandbox",
+			"csi.storage.k8s.io/pod.name":        "my-pod",
+			"csi.cert-manager.io/correlation-id": "0123456789abcdef",
+		},
+	}
+
+	store := &Store{Interface: storage.NewMemoryFS(), Log: log}
+	_, err := store.RegisterMetadata(meta)
+	require.NoError(t, err)
+
+	generate := InstrumentGeneratePrivateKey(log, func(metadata.Metadata) (crypto.PrivateKey, error) {
+		return nil, nil
+	})
+	_, err = generate(meta)
+	require.NoError(t, err)
+
+	write := InstrumentWriteKeypair(log, func(metadata.Metadata, crypto.PrivateKey, []byte, []byte) error {
+		return errors.New("write failed")
+	})
+	assert.Error(t, write(meta, nil, nil, nil))
+
+	require.NoError(t, store.RemoveVolume("vol-id"))
+
+	assert.Equal(t, []string{
+		`"level"=0 "msg"="Volume published" "volume_id"="vol-id" "pod_namespace"="sandbox" "pod_name"="my-pod" "correlation_id"="0123456789abcdef" "new"=true "target_path"="/target-path"`,
+		`"level"=0 "msg"="Issuing certificate" "volume_id"="vol-id" "pod_namespace"="sandbox" "pod_name"="my-pod" "correlation_id"="0123456789abcdef"`,
+		`"msg"="Failed to write issued certificate" "error"="write failed" "volume_id"="vol-id" "pod_namespace"="sandbox" "pod_name"="my-pod" "correlation_id"="0123456789abcdef"`,
+		`"level"=0 "msg"="Volume unpublished" "volume_id"="vol-id"`,
+	}, lines)
+}
+
+func Test_CorrelationStore(t *testing.T) {
+	backend := storage.NewMemoryFS()
+	store := &CorrelationStore{Interface: backend}
+
+	meta := func(volumeID string, vc map[string]string) metadata.Metadata {
+		return metadata.Metadata{VolumeID: volumeID, TargetPath: "/target-path", VolumeContext: vc}
+	}
+	correlationID := func(volumeID string) string {
+		written, err := backend.ReadMetadata(volumeID)
+		require.NoError(t, err)
+		return written.VolumeContext["csi.cert-manager.io/correlation-id"]
+	}
+
+	vc := map[string]string{"csi.storage.k8s.io/pod.name": "my-pod"}
+	_, err := store.RegisterMetadata(meta("vol-id", vc))
+	require.NoError(t, err)
+	id := correlationID("vol-id")
+	assert.Len(t, id, 16)
+	assert.NotContains(t, vc, "csi.cert-manager.io/correlation-id", "the given volume context must not be modified")
+
+	// A republished volume keeps its correlation ID, even if one is given.
+	_, err = store.RegisterMetadata(meta("vol-id", map[string]string{"csi.cert-manager.io/correlation-id": "spoofed"}))
+	require.NoError(t, err)
+	assert.Equal(t, id, correlationID("vol-id"))
+
+	// A volume registered without a correlation ID is left without one.
+	_, err = backend.RegisterMetadata(meta("existing-vol-id", nil))
+	require.NoError(t, err)
+	_, err = store.RegisterMetadata(meta("existing-vol-id", map[string]string{"csi.cert-manager.io/correlation-id": "spoofed"}))
+	require.NoError(t, err)
+	assert.Empty(t, correlationID("existing-vol-id"))
+
+	// Other volumes have their own correlation ID.
+	_, err = store.RegisterMetadata(meta("other-vol-id", nil))
+	require.NoError(t, err)
+	assert.NotEqual(t, id, correlationID("other-vol-id"))
+}